@@ -0,0 +1,299 @@
+package apiserver
+
+import (
+	"context"
+	"crypto/tls"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptrace"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/instana/envcheck/network"
+	corev1 "k8s.io/api/core/v1"
+)
+
+const (
+	// DefaultTokenFile is the mounted ServiceAccount token.
+	DefaultTokenFile = "/var/run/secrets/kubernetes.io/serviceaccount/token"
+	// DefaultCAFile is the mounted cluster CA bundle.
+	DefaultCAFile = "/var/run/secrets/kubernetes.io/serviceaccount/ca.crt"
+	// DefaultServerName is a name present in every API server certificate.
+	DefaultServerName = "kubernetes.default.svc"
+	// EndpointsPath is the Endpoints resource behind the kubernetes Service.
+	EndpointsPath = "/api/v1/namespaces/default/endpoints/kubernetes"
+)
+
+const (
+	// ViaService is a probe through the kubernetes Service VIP.
+	ViaService = "service"
+	// ViaEndpoint is a probe directly to an API server endpoint.
+	ViaEndpoint = "endpoint"
+)
+
+const (
+	// AuthOK indicates the token was accepted.
+	AuthOK = "ok"
+	// AuthAnonymous indicates no token was available to send.
+	AuthAnonymous = "anonymous"
+	// AuthUnauthorized indicates the token was rejected.
+	AuthUnauthorized = "unauthorized"
+	// AuthForbidden indicates the token was accepted but lacks permission.
+	AuthForbidden = "forbidden"
+	// AuthUnknown indicates no response was received.
+	AuthUnknown = "unknown"
+)
+
+// Config configures the API server probe.
+type Config struct {
+	// Service is the kubernetes Service VIP as host:port.
+	Service string
+	// TokenFile is re-read for every probe as bound tokens are rotated.
+	TokenFile string
+	// CAFile is the PEM bundle used to verify the API server.
+	CAFile string
+	// ServerName is used to verify the certificate as endpoints are dialled by IP.
+	ServerName string
+	// Timeout bounds each request.
+	Timeout time.Duration
+}
+
+// Result is the outcome of probing a single API server address.
+type Result struct {
+	Address string
+	Via     string
+	TLS     Check
+	Auth    string
+	Version Check
+	Readyz  Check
+}
+
+// OK indicates the API server was reachable, trusted and ready.
+func (r *Result) OK() bool {
+	return r.TLS.OK && r.Version.OK && r.Readyz.OK
+}
+
+// Check is the outcome of a single step of the probe.
+type Check struct {
+	OK       bool
+	Status   int `json:",omitempty"`
+	Duration time.Duration
+	Detail   string `json:",omitempty"`
+	Err      string `json:",omitempty"`
+}
+
+// Prober probes the API server through the Service VIP and its endpoints.
+type Prober struct {
+	config Config
+}
+
+// New creates a Prober applying defaults for blank config values.
+func New(config Config) *Prober {
+	if config.ServerName == "" {
+		config.ServerName = DefaultServerName
+	}
+	if config.Timeout == 0 {
+		config.Timeout = 5 * time.Second
+	}
+	return &Prober{config: config}
+}
+
+// ProbeAll probes the Service VIP followed by each endpoint behind it. An
+// error is returned if the endpoints could not be discovered, the Service
+// result is still provided.
+func (p *Prober) ProbeAll(ctx context.Context) ([]Result, error) {
+	results := []Result{p.Probe(ctx, p.config.Service, ViaService)}
+	endpoints, err := p.Endpoints(ctx)
+	for _, ep := range endpoints {
+		results = append(results, p.Probe(ctx, ep, ViaEndpoint))
+	}
+	return results, err
+}
+
+// Probe checks the TLS handshake, token authentication and the /version and
+// /readyz end-points of the API server at address.
+func (p *Prober) Probe(ctx context.Context, address string, via string) Result {
+	result := Result{Address: address, Via: via, Auth: AuthUnknown}
+	client, err := p.client()
+	if err != nil {
+		result.TLS.Err = err.Error()
+		return result
+	}
+	defer client.CloseIdleConnections()
+	token := p.token()
+
+	var start time.Time
+	trace := &httptrace.ClientTrace{
+		TLSHandshakeStart: func() { start = time.Now() },
+		TLSHandshakeDone: func(state tls.ConnectionState, err error) {
+			result.TLS.Duration = time.Since(start)
+			if err != nil {
+				result.TLS.Err = err.Error()
+				return
+			}
+			result.TLS.OK = true
+			result.TLS.Detail = describeTLS(state)
+		},
+	}
+	ctx = httptrace.WithClientTrace(ctx, trace)
+
+	result.Version = p.get(ctx, client, address, "/version", token)
+	if result.Version.Status > 0 {
+		result.Auth = authStatus(result.Version.Status, token)
+	}
+	if !result.TLS.OK {
+		if result.TLS.Err == "" {
+			// the handshake was never attempted as the TCP connect failed.
+			result.TLS.Err = result.Version.Err
+		}
+		return result
+	}
+	result.Readyz = p.get(ctx, client, address, "/readyz", token)
+	return result
+}
+
+// Endpoints lists the API server endpoint addresses behind the Service.
+// Reading the Endpoints requires get on the kubernetes Endpoints in the
+// default namespace, without it an error is returned.
+func (p *Prober) Endpoints(ctx context.Context) ([]string, error) {
+	client, err := p.client()
+	if err != nil {
+		return nil, err
+	}
+	defer client.CloseIdleConnections()
+
+	ctx, cancel := context.WithTimeout(ctx, p.config.Timeout)
+	defer cancel()
+	req, err := p.request(ctx, p.config.Service, EndpointsPath, p.token())
+	if err != nil {
+		return nil, err
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("endpoints status %s", resp.Status)
+	}
+
+	var ep corev1.Endpoints
+	err = json.NewDecoder(resp.Body).Decode(&ep)
+	if err != nil {
+		return nil, err
+	}
+	return Addresses(&ep), nil
+}
+
+// Addresses flattens the Endpoints subsets into host:port addresses.
+func Addresses(ep *corev1.Endpoints) []string {
+	var addrs []string
+	for _, subset := range ep.Subsets {
+		for _, port := range subset.Ports {
+			if port.Name != "" && port.Name != "https" {
+				continue
+			}
+			for _, addr := range subset.Addresses {
+				addrs = append(addrs, net.JoinHostPort(addr.IP, strconv.Itoa(int(port.Port))))
+			}
+		}
+	}
+	return addrs
+}
+
+func (p *Prober) get(ctx context.Context, client *http.Client, address string, path string, token string) Check {
+	var check Check
+	ctx, cancel := context.WithTimeout(ctx, p.config.Timeout)
+	defer cancel()
+
+	req, err := p.request(ctx, address, path, token)
+	if err != nil {
+		check.Err = err.Error()
+		return check
+	}
+
+	start := time.Now()
+	resp, err := client.Do(req)
+	check.Duration = time.Since(start)
+	if err != nil {
+		check.Err = err.Error()
+		return check
+	}
+	defer resp.Body.Close()
+
+	b, _ := io.ReadAll(io.LimitReader(resp.Body, 4096))
+	check.Status = resp.StatusCode
+	check.OK = resp.StatusCode == http.StatusOK
+	if path == "/version" {
+		var v struct{ GitVersion string }
+		if json.Unmarshal(b, &v) == nil {
+			check.Detail = v.GitVersion
+		}
+	} else {
+		check.Detail = string(b)
+	}
+	if !check.OK {
+		check.Err = resp.Status
+	}
+	return check
+}
+
+func (p *Prober) request(ctx context.Context, address string, path string, token string) (*http.Request, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, "https://"+address+path, nil)
+	if err != nil {
+		return nil, err
+	}
+	if token != "" {
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+	return req, nil
+}
+
+func (p *Prober) client() (*http.Client, error) {
+	transport, err := network.NewTransport(network.TransportConfig{
+		CAFile:      p.config.CAFile,
+		DialTimeout: p.config.Timeout,
+	})
+	if err != nil {
+		return nil, err
+	}
+	transport.TLSClientConfig.ServerName = p.config.ServerName
+	return &http.Client{Transport: transport}, nil
+}
+
+func (p *Prober) token() string {
+	if p.config.TokenFile == "" {
+		return ""
+	}
+	b, err := os.ReadFile(p.config.TokenFile)
+	if err != nil {
+		return ""
+	}
+	return strings.TrimSpace(string(b))
+}
+
+func authStatus(status int, token string) string {
+	switch {
+	case status == http.StatusUnauthorized:
+		return AuthUnauthorized
+	case status == http.StatusForbidden:
+		return AuthForbidden
+	case token == "":
+		return AuthAnonymous
+	}
+	return AuthOK
+}
+
+func describeTLS(state tls.ConnectionState) string {
+	detail := fmt.Sprintf("version=%s", tls.VersionName(state.Version))
+	if len(state.PeerCertificates) > 0 {
+		cert := state.PeerCertificates[0]
+		detail += fmt.Sprintf(" issuer=%q expires=%s", cert.Issuer.String(), cert.NotAfter.UTC().Format(time.RFC3339))
+	}
+	return detail
+}
@@ -0,0 +1,168 @@
+package apiserver_test
+
+import (
+	"context"
+	"encoding/json"
+	"encoding/pem"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/instana/envcheck/apiserver"
+	corev1 "k8s.io/api/core/v1"
+)
+
+const token = "s3cr3t"
+
+func Test_Probe(t *testing.T) {
+	t.Parallel()
+	server, caFile := apiServer(t)
+	td := map[string]struct {
+		token   string
+		caFile  string
+		tls     bool
+		auth    string
+		version bool
+		readyz  bool
+	}{
+		"authenticated":  {token, caFile, true, apiserver.AuthOK, true, true},
+		"rejected token": {"expired", caFile, true, apiserver.AuthUnauthorized, false, false},
+		"anonymous":      {"", caFile, true, apiserver.AuthAnonymous, true, false},
+		"untrusted":      {token, "", false, apiserver.AuthUnknown, false, false},
+	}
+
+	for name, tc := range td {
+		tc := tc
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+			config := apiserver.Config{
+				Service:    server,
+				CAFile:     tc.caFile,
+				ServerName: "example.com",
+				Timeout:    2 * time.Second,
+			}
+			if tc.token != "" {
+				config.TokenFile = writeFile(t, "token", tc.token+"\n")
+			}
+
+			r := apiserver.New(config).Probe(context.Background(), server, apiserver.ViaService)
+			if r.TLS.OK != tc.tls {
+				t.Errorf("TLS.OK=%v, want %v (err=%v)", r.TLS.OK, tc.tls, r.TLS.Err)
+			}
+			if r.Auth != tc.auth {
+				t.Errorf("Auth=%v, want %v", r.Auth, tc.auth)
+			}
+			if r.Version.OK != tc.version {
+				t.Errorf("Version.OK=%v, want %v (err=%v)", r.Version.OK, tc.version, r.Version.Err)
+			}
+			if r.Readyz.OK != tc.readyz {
+				t.Errorf("Readyz.OK=%v, want %v (err=%v)", r.Readyz.OK, tc.readyz, r.Readyz.Err)
+			}
+		})
+	}
+}
+
+func Test_ProbeAll(t *testing.T) {
+	t.Parallel()
+	server, caFile := apiServer(t)
+	p := apiserver.New(apiserver.Config{
+		Service:    server,
+		CAFile:     caFile,
+		TokenFile:  writeFile(t, "token", token),
+		ServerName: "example.com",
+	})
+
+	results, err := p.ProbeAll(context.Background())
+	if err != nil {
+		t.Fatalf("ProbeAll() err=%v, want nil", err)
+	}
+	if len(results) != 2 {
+		t.Fatalf("len(results)=%d, want 2", len(results))
+	}
+	if results[1].Via != apiserver.ViaEndpoint || !results[1].OK() {
+		t.Errorf("results[1]=%+v, want healthy endpoint", results[1])
+	}
+}
+
+func Test_Addresses(t *testing.T) {
+	t.Parallel()
+	ep := &corev1.Endpoints{
+		Subsets: []corev1.EndpointSubset{{
+			Addresses: []corev1.EndpointAddress{{IP: "10.0.0.1"}, {IP: "10.0.0.2"}},
+			Ports:     []corev1.EndpointPort{{Name: "https", Port: 6443}},
+		}},
+	}
+
+	expected := []string{"10.0.0.1:6443", "10.0.0.2:6443"}
+	actual := apiserver.Addresses(ep)
+	if !cmp.Equal(expected, actual) {
+		t.Errorf("Addresses() mismatch (-want +got)\n%s", cmp.Diff(expected, actual))
+	}
+}
+
+// apiServer serves /version to any caller, /readyz to authenticated callers
+// and an Endpoints resource that points back at itself.
+func apiServer(t *testing.T) (string, string) {
+	t.Helper()
+	var address string
+	mux := http.NewServeMux()
+	authorised := func(w http.ResponseWriter, r *http.Request) bool {
+		auth := r.Header.Get("Authorization")
+		if auth == "" {
+			w.WriteHeader(http.StatusForbidden)
+			return false
+		}
+		if auth != "Bearer "+token {
+			w.WriteHeader(http.StatusUnauthorized)
+			return false
+		}
+		return true
+	}
+	mux.HandleFunc("/version", func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") != "" && !authorised(w, r) {
+			return
+		}
+		w.Write([]byte(`{"gitVersion":"v1.26.10"}`))
+	})
+	mux.HandleFunc("/readyz", func(w http.ResponseWriter, r *http.Request) {
+		if authorised(w, r) {
+			w.Write([]byte("ok"))
+		}
+	})
+	mux.HandleFunc(apiserver.EndpointsPath, func(w http.ResponseWriter, r *http.Request) {
+		if !authorised(w, r) {
+			return
+		}
+		host, p, _ := strings.Cut(address, ":")
+		port, _ := strconv.Atoi(p)
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"subsets": []interface{}{map[string]interface{}{
+				"addresses": []interface{}{map[string]string{"ip": host}},
+				"ports":     []interface{}{map[string]interface{}{"name": "https", "port": port}},
+			}},
+		})
+	})
+
+	server := httptest.NewTLSServer(mux)
+	t.Cleanup(server.Close)
+	address = server.Listener.Addr().String()
+
+	ca := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: server.Certificate().Raw})
+	return address, writeFile(t, "ca.crt", string(ca))
+}
+
+func writeFile(t *testing.T, name string, content string) string {
+	t.Helper()
+	filename := filepath.Join(t.TempDir(), name)
+	err := os.WriteFile(filename, []byte(content), 0600)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return filename
+}
@@ -0,0 +1,237 @@
+package backend
+
+import (
+	"bufio"
+	"context"
+	"crypto/tls"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/instana/envcheck/network"
+)
+
+// ResultPrefix prefixes the JSON encoded Result in the backendcheck logs.
+const ResultPrefix = "result="
+
+// ErrNoResult occurs when the log output does not yet contain a result.
+var ErrNoResult = fmt.Errorf("no result found")
+
+// Result is the outcome of each connectivity step from a single node.
+type Result struct {
+	Pod      string
+	Node     string
+	Endpoint string
+	Proxy    string
+	DNS      Step
+	TCP      Step
+	TLS      Step
+	HTTP2    Step
+}
+
+// OK indicates whether all of the steps succeeded. DNS is only required for
+// direct connections as a proxy resolves the name on our behalf.
+func (r *Result) OK() bool {
+	dns := r.DNS.OK || r.Proxy != network.Direct
+	return dns && r.TCP.OK && r.TLS.OK && r.HTTP2.OK
+}
+
+// Step is the outcome of a single connectivity step.
+type Step struct {
+	OK       bool
+	Duration time.Duration
+	Detail   string `json:",omitempty"`
+	Err      string `json:",omitempty"`
+}
+
+func (s *Step) done(start time.Time, detail string, err error) {
+	s.Duration = time.Since(start)
+	s.Detail = detail
+	if err != nil {
+		s.Err = err.Error()
+		return
+	}
+	s.OK = true
+}
+
+// Check tests DNS resolution, TCP connect, TLS handshake and a HTTP/2 request
+// to the endpoint (host:port), through the proxy in config when specified.
+func Check(ctx context.Context, endpoint string, config network.TransportConfig) Result {
+	result := Result{Endpoint: endpoint, Proxy: network.Direct}
+	host, port, err := net.SplitHostPort(endpoint)
+	if err != nil {
+		result.DNS.Err = err.Error()
+		return result
+	}
+
+	var proxy *url.URL
+	if config.Proxy != "" {
+		proxy, err = network.ParseProxy(config)
+		if err != nil {
+			result.TCP.Err = err.Error()
+			return result
+		}
+		result.Proxy = proxy.Redacted()
+	}
+
+	start := time.Now()
+	addrs, err := net.DefaultResolver.LookupHost(ctx, host)
+	result.DNS.done(start, strings.Join(addrs, ","), err)
+	if err != nil && proxy == nil {
+		// the proxy resolves the name on our behalf so only a direct connection requires DNS.
+		return result
+	}
+
+	dialer := &net.Dialer{Timeout: 10 * time.Second}
+	target := endpoint
+	if proxy != nil {
+		target = proxy.Host
+	} else if len(addrs) > 0 {
+		target = net.JoinHostPort(addrs[0], port)
+	}
+
+	start = time.Now()
+	conn, err := dialer.DialContext(ctx, "tcp", target)
+	result.TCP.done(start, target, err)
+	if err != nil {
+		return result
+	}
+	defer conn.Close()
+
+	if proxy != nil {
+		err = connect(conn, proxy, endpoint)
+		if err != nil {
+			result.TCP.OK = false
+			result.TCP.Err = err.Error()
+			return result
+		}
+	}
+
+	tlsConfig := &tls.Config{
+		ServerName:         host,
+		NextProtos:         []string{"h2", "http/1.1"},
+		InsecureSkipVerify: config.InsecureSkipVerify,
+	}
+	if config.CAFile != "" {
+		tlsConfig.RootCAs, err = network.LoadCertPool(config.CAFile)
+		if err != nil {
+			result.TLS.Err = err.Error()
+			return result
+		}
+	}
+
+	start = time.Now()
+	tlsConn := tls.Client(conn, tlsConfig)
+	err = tlsConn.HandshakeContext(ctx)
+	result.TLS.done(start, describeTLS(tlsConn.ConnectionState()), err)
+	if err != nil {
+		return result
+	}
+
+	transport, err := network.NewTransport(config)
+	if err != nil {
+		result.HTTP2.Err = err.Error()
+		return result
+	}
+	defer transport.CloseIdleConnections()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, "https://"+endpoint+"/", nil)
+	if err != nil {
+		result.HTTP2.Err = err.Error()
+		return result
+	}
+
+	start = time.Now()
+	resp, err := transport.RoundTrip(req)
+	if err != nil {
+		result.HTTP2.done(start, "", err)
+		return result
+	}
+	resp.Body.Close()
+
+	var protoErr error
+	if resp.ProtoMajor != 2 {
+		protoErr = fmt.Errorf("negotiated %s, HTTP/2 is required by the agent", resp.Proto)
+	}
+	result.HTTP2.done(start, fmt.Sprintf("proto=%s status=%d", resp.Proto, resp.StatusCode), protoErr)
+
+	return result
+}
+
+// connect establishes a HTTP CONNECT tunnel to endpoint over the proxy conn.
+func connect(conn net.Conn, proxy *url.URL, endpoint string) error {
+	req := &http.Request{
+		Method: http.MethodConnect,
+		URL:    &url.URL{Opaque: endpoint},
+		Host:   endpoint,
+		Header: make(http.Header),
+	}
+	if proxy.User != nil {
+		password, _ := proxy.User.Password()
+		auth := base64.StdEncoding.EncodeToString([]byte(proxy.User.Username() + ":" + password))
+		req.Header.Set("Proxy-Authorization", "Basic "+auth)
+	}
+
+	err := req.Write(conn)
+	if err != nil {
+		return err
+	}
+
+	// the buffered reader can be discarded as the TLS server will not speak until spoken to.
+	resp, err := http.ReadResponse(bufio.NewReader(conn), req)
+	if err != nil {
+		return err
+	}
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("proxy CONNECT failed: %s", resp.Status)
+	}
+	return nil
+}
+
+func describeTLS(state tls.ConnectionState) string {
+	detail := fmt.Sprintf("version=%s alpn=%s", tls.VersionName(state.Version), state.NegotiatedProtocol)
+	if len(state.PeerCertificates) > 0 {
+		detail += fmt.Sprintf(" issuer=%q", state.PeerCertificates[0].Issuer.String())
+	}
+	return detail
+}
+
+// Encode renders the result as a single log line.
+func Encode(result Result) (string, error) {
+	b, err := json.Marshal(result)
+	if err != nil {
+		return "", err
+	}
+	return ResultPrefix + string(b), nil
+}
+
+// Decode finds and decodes the last result in the log output.
+func Decode(logs []byte) (*Result, error) {
+	var found *Result
+	s := bufio.NewScanner(strings.NewReader(string(logs)))
+	s.Buffer(make([]byte, 64*1024), 1024*1024)
+	for s.Scan() {
+		i := strings.Index(s.Text(), ResultPrefix)
+		if i < 0 {
+			continue
+		}
+		var r Result
+		err := json.Unmarshal([]byte(s.Text()[i+len(ResultPrefix):]), &r)
+		if err != nil {
+			return nil, err
+		}
+		found = &r
+	}
+	if err := s.Err(); err != nil {
+		return nil, err
+	}
+	if found == nil {
+		return nil, ErrNoResult
+	}
+	return found, nil
+}
@@ -0,0 +1,138 @@
+package backend_test
+
+import (
+	"context"
+	"encoding/pem"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/instana/envcheck/backend"
+	"github.com/instana/envcheck/network"
+)
+
+func Test_Check_direct_http2(t *testing.T) {
+	ts, caFile := backendServer(t)
+	defer ts.Close()
+
+	u, _ := url.Parse(ts.URL)
+	result := backend.Check(context.Background(), u.Host, network.TransportConfig{CAFile: caFile})
+	if !result.OK() {
+		t.Fatalf("OK()=false, want true: %+v", result)
+	}
+	if result.Proxy != network.Direct {
+		t.Errorf("Proxy=%v, want direct", result.Proxy)
+	}
+	if !strings.Contains(result.HTTP2.Detail, "proto=HTTP/2.0") {
+		t.Errorf("HTTP2.Detail=%v, want HTTP/2.0", result.HTTP2.Detail)
+	}
+}
+
+func Test_Check_through_proxy(t *testing.T) {
+	ts, caFile := backendServer(t)
+	defer ts.Close()
+	proxy := httptest.NewServer(http.HandlerFunc(connectProxy))
+	defer proxy.Close()
+
+	u, _ := url.Parse(ts.URL)
+	result := backend.Check(context.Background(), u.Host, network.TransportConfig{CAFile: caFile, Proxy: proxy.URL})
+	if !result.OK() {
+		t.Fatalf("OK()=false, want true: %+v", result)
+	}
+	if result.Proxy != proxy.URL {
+		t.Errorf("Proxy=%v, want %v", result.Proxy, proxy.URL)
+	}
+}
+
+func Test_Check_untrusted_certificate_fails_tls(t *testing.T) {
+	ts, _ := backendServer(t)
+	defer ts.Close()
+
+	u, _ := url.Parse(ts.URL)
+	result := backend.Check(context.Background(), u.Host, network.TransportConfig{})
+	if !result.TCP.OK || result.TLS.OK {
+		t.Errorf("TCP.OK=%v TLS.OK=%v, want true false", result.TCP.OK, result.TLS.OK)
+	}
+}
+
+func Test_Check_refused_fails_tcp(t *testing.T) {
+	result := backend.Check(context.Background(), "127.0.0.1:1035", network.TransportConfig{})
+	if !result.DNS.OK || result.TCP.OK {
+		t.Errorf("DNS.OK=%v TCP.OK=%v, want true false", result.DNS.OK, result.TCP.OK)
+	}
+}
+
+func Test_Encode_Decode_round_trip(t *testing.T) {
+	expected := backend.Result{Node: "node-1", Endpoint: "ingress-red-saas.instana.io:443", DNS: backend.Step{OK: true, Duration: time.Millisecond}}
+	line, err := backend.Encode(expected)
+	if err != nil {
+		t.Fatalf("err=%v, want nil", err)
+	}
+
+	logs := "2023/01/01 00:00:00 app=backendcheck\n2023/01/01 00:00:01 " + line + "\n"
+	actual, err := backend.Decode([]byte(logs))
+	if err != nil {
+		t.Fatalf("err=%v, want nil", err)
+	}
+	if actual.Node != "node-1" || !actual.DNS.OK {
+		t.Errorf("Decode()=%+v, want %+v", actual, expected)
+	}
+}
+
+func Test_Decode_without_result(t *testing.T) {
+	_, err := backend.Decode([]byte("2023/01/01 00:00:00 app=backendcheck\n"))
+	if err != backend.ErrNoResult {
+		t.Errorf("err=%v, want ErrNoResult", err)
+	}
+}
+
+func backendServer(t *testing.T) (*httptest.Server, string) {
+	ts := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusNotFound)
+	}))
+	ts.EnableHTTP2 = true
+	ts.StartTLS()
+
+	caFile := path.Join(t.TempDir(), "ca.pem")
+	w, err := os.Create(caFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer w.Close()
+	err = pem.Encode(w, &pem.Block{Type: "CERTIFICATE", Bytes: ts.Certificate().Raw})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return ts, caFile
+}
+
+func connectProxy(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodConnect {
+		http.Error(w, "CONNECT only", http.StatusMethodNotAllowed)
+		return
+	}
+	upstream, err := net.Dial("tcp", r.Host)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadGateway)
+		return
+	}
+	w.WriteHeader(http.StatusOK)
+	conn, _, err := w.(http.Hijacker).Hijack()
+	if err != nil {
+		upstream.Close()
+		return
+	}
+	go func() {
+		io.Copy(upstream, conn)
+		upstream.Close()
+	}()
+	io.Copy(conn, upstream)
+	conn.Close()
+}
@@ -0,0 +1,149 @@
+package cluster
+
+import (
+	"context"
+	"sort"
+
+	appsv1 "k8s.io/api/apps/v1"
+	v1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+)
+
+// AgentManifests are the agent DaemonSet and the ConfigMaps it mounts.
+type AgentManifests struct {
+	DaemonSet  *appsv1.DaemonSet
+	ConfigMaps []v1.ConfigMap
+	// Selector is the label selector of the agent pods.
+	Selector string
+	// Missing are the mounted ConfigMaps that do not exist.
+	Missing []string
+}
+
+// Objects provides the DaemonSet and ConfigMaps for rendering.
+func (m *AgentManifests) Objects() []runtime.Object {
+	objects := []runtime.Object{m.DaemonSet}
+	for i := range m.ConfigMaps {
+		objects = append(objects, &m.ConfigMaps[i])
+	}
+	return objects
+}
+
+// AgentManifests retrieves the agent DaemonSet and the ConfigMaps mounted by
+// its pods. The server managed fields are dropped to keep them readable.
+func (q *KubernetesQuery) AgentManifests(ctx context.Context, namespace string, name string) (*AgentManifests, error) {
+	var ds *appsv1.DaemonSet
+	err := Retry(ctx, func() error {
+		var err error
+		ds, err = q.apps.DaemonSets(namespace).Get(ctx, name, metav1.GetOptions{})
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	ds.TypeMeta = metav1.TypeMeta{APIVersion: appsv1.SchemeGroupVersion.String(), Kind: "DaemonSet"}
+	ds.ManagedFields = nil
+
+	manifests := &AgentManifests{
+		DaemonSet: ds,
+		Selector:  metav1.FormatLabelSelector(ds.Spec.Selector),
+	}
+
+	names := make(Set)
+	for _, vol := range ds.Spec.Template.Spec.Volumes {
+		if vol.ConfigMap != nil {
+			names.Add(vol.ConfigMap.Name)
+		}
+	}
+	for _, cmName := range sortedKeys(names) {
+		var cm *v1.ConfigMap
+		err := Retry(ctx, func() error {
+			var err error
+			cm, err = q.core.ConfigMaps(namespace).Get(ctx, cmName, metav1.GetOptions{})
+			return err
+		})
+		if errors.IsNotFound(err) {
+			manifests.Missing = append(manifests.Missing, cmName)
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		cm.TypeMeta = metav1.TypeMeta{APIVersion: v1.SchemeGroupVersion.String(), Kind: "ConfigMap"}
+		cm.ManagedFields = nil
+		manifests.ConfigMaps = append(manifests.ConfigMaps, *cm)
+	}
+	return manifests, nil
+}
+
+// ContainerLog is the log of a container in a pod. Previous indicates the
+// log of the prior instance of a restarted container.
+type ContainerLog struct {
+	Pod       string
+	Node      string
+	Container string
+	Previous  bool
+	Restarts  int32
+	Body      []byte
+	Err       error
+}
+
+// LogOptions selects the lines of the container logs retrieved.
+type LogOptions struct {
+	// TailLines is the number of lines from the end of each log, 0 or less
+	// retrieves the whole log.
+	TailLines int64
+	// Timestamps prefixes each line with its RFC3339 timestamp.
+	Timestamps bool
+}
+
+// ContainerLogs retrieves the log of each container in the pods in namespace
+// matching the selector, and of the previous instance of each container that
+// has restarted.
+func (q *KubernetesQuery) ContainerLogs(ctx context.Context, namespace string, selector string, opts LogOptions) ([]ContainerLog, error) {
+	pods, err := q.listPods(ctx, namespace, selector)
+	if err != nil {
+		return nil, err
+	}
+	sort.Slice(pods.Items, func(i, j int) bool {
+		return pods.Items[i].Name < pods.Items[j].Name
+	})
+
+	var logs []ContainerLog
+	for _, pod := range pods.Items {
+		restarts := make(map[string]int32)
+		for _, status := range pod.Status.ContainerStatuses {
+			restarts[status.Name] = status.RestartCount
+		}
+
+		for _, c := range pod.Spec.Containers {
+			current := ContainerLog{Pod: pod.Name, Node: pod.Spec.NodeName, Container: c.Name, Restarts: restarts[c.Name]}
+			current.Body, current.Err = q.containerLog(ctx, namespace, pod.Name, c.Name, false, opts)
+			logs = append(logs, current)
+			if restarts[c.Name] == 0 {
+				continue
+			}
+
+			previous := current
+			previous.Previous = true
+			previous.Body, previous.Err = q.containerLog(ctx, namespace, pod.Name, c.Name, true, opts)
+			logs = append(logs, previous)
+		}
+	}
+	return logs, nil
+}
+
+func (q *KubernetesQuery) containerLog(ctx context.Context, namespace string, pod string, container string, previous bool, opts LogOptions) ([]byte, error) {
+	logOpts := &v1.PodLogOptions{Container: container, Previous: previous, Timestamps: opts.Timestamps}
+	if opts.TailLines > 0 {
+		logOpts.TailLines = &opts.TailLines
+	}
+	var body []byte
+	err := Retry(ctx, func() error {
+		var err error
+		body, err = q.core.Pods(namespace).GetLogs(pod, logOpts).DoRaw(ctx)
+		return err
+	})
+	return body, err
+}
@@ -0,0 +1,102 @@
+package cluster_test
+
+import (
+	"context"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/instana/envcheck/cluster"
+	appsv1 "k8s.io/api/apps/v1"
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+func Test_AgentManifests(t *testing.T) {
+	t.Parallel()
+	ds := appsv1.DaemonSet{
+		ObjectMeta: metav1.ObjectMeta{Namespace: "instana-agent", Name: "instana-agent"},
+		Spec: appsv1.DaemonSetSpec{
+			Selector: &metav1.LabelSelector{MatchLabels: map[string]string{"app": "instana-agent"}},
+			Template: v1.PodTemplateSpec{Spec: v1.PodSpec{Volumes: []v1.Volume{
+				configMapVolume("instana-agent"),
+				configMapVolume("missing"),
+				{Name: "dev", VolumeSource: v1.VolumeSource{HostPath: &v1.HostPathVolumeSource{Path: "/dev"}}},
+			}}},
+		},
+	}
+	cm := v1.ConfigMap{
+		ObjectMeta: metav1.ObjectMeta{Namespace: "instana-agent", Name: "instana-agent"},
+		Data:       map[string]string{"configuration.yaml": "com.instana.plugin.host: {}"},
+	}
+	client := fake.NewSimpleClientset(&ds, &cm)
+	query := cluster.NewQuery("localhost:1234", client.CoreV1(), client.AppsV1(), client.NetworkingV1(), nil, nil)
+
+	manifests, err := query.AgentManifests(context.Background(), "instana-agent", "instana-agent")
+	if err != nil {
+		t.Fatalf("AgentManifests() err=%v, want nil", err)
+	}
+	if manifests.Selector != "app=instana-agent" {
+		t.Errorf("Selector=%v, want app=instana-agent", manifests.Selector)
+	}
+	if manifests.DaemonSet.Kind != "DaemonSet" {
+		t.Errorf("DaemonSet.Kind=%v, want DaemonSet", manifests.DaemonSet.Kind)
+	}
+	if len(manifests.ConfigMaps) != 1 || manifests.ConfigMaps[0].Name != "instana-agent" {
+		t.Errorf("ConfigMaps=%v, want [instana-agent]", manifests.ConfigMaps)
+	}
+	if !cmp.Equal([]string{"missing"}, manifests.Missing) {
+		t.Errorf("Missing mismatch (-want +got)\n%s", cmp.Diff([]string{"missing"}, manifests.Missing))
+	}
+	if len(manifests.Objects()) != 2 {
+		t.Errorf("len(Objects())=%d, want 2", len(manifests.Objects()))
+	}
+}
+
+func Test_AgentManifests_should_error_when_no_daemonset(t *testing.T) {
+	t.Parallel()
+	client := fake.NewSimpleClientset()
+	query := cluster.NewQuery("localhost:1234", client.CoreV1(), client.AppsV1(), client.NetworkingV1(), nil, nil)
+
+	_, err := query.AgentManifests(context.Background(), "instana-agent", "instana-agent")
+	if err == nil {
+		t.Error("err=nil, want not found err")
+	}
+}
+
+func Test_ContainerLogs_should_include_previous_log_of_restarted_containers(t *testing.T) {
+	t.Parallel()
+	restarted := restartedAgentPod("instana-agent-b", 2)
+	running := restartedAgentPod("instana-agent-a", 0)
+	other := v1.Pod{ObjectMeta: metav1.ObjectMeta{Namespace: "instana-agent", Name: "other"}}
+	client := fake.NewSimpleClientset(&v1.PodList{Items: []v1.Pod{restarted, running, other}})
+	query := cluster.NewQuery("localhost:1234", client.CoreV1(), client.AppsV1(), client.NetworkingV1(), nil, nil)
+
+	logs, err := query.ContainerLogs(context.Background(), "instana-agent", "app=instana-agent", cluster.LogOptions{TailLines: 100})
+	if err != nil {
+		t.Fatalf("ContainerLogs() err=%v, want nil", err)
+	}
+	// the fake clientset responds to every log request with "fake logs".
+	expected := []cluster.ContainerLog{
+		{Pod: "instana-agent-a", Node: "node-1", Container: "instana-agent", Body: []byte("fake logs")},
+		{Pod: "instana-agent-b", Node: "node-1", Container: "instana-agent", Restarts: 2, Body: []byte("fake logs")},
+		{Pod: "instana-agent-b", Node: "node-1", Container: "instana-agent", Restarts: 2, Previous: true, Body: []byte("fake logs")},
+	}
+	if !cmp.Equal(expected, logs) {
+		t.Errorf("ContainerLogs() mismatch (-want +got)\n%s", cmp.Diff(expected, logs))
+	}
+}
+
+func configMapVolume(name string) v1.Volume {
+	return v1.Volume{Name: name, VolumeSource: v1.VolumeSource{ConfigMap: &v1.ConfigMapVolumeSource{
+		LocalObjectReference: v1.LocalObjectReference{Name: name},
+	}}}
+}
+
+func restartedAgentPod(name string, restarts int32) v1.Pod {
+	return v1.Pod{
+		ObjectMeta: metav1.ObjectMeta{Namespace: "instana-agent", Name: name, Labels: map[string]string{"app": "instana-agent"}},
+		Spec:       v1.PodSpec{NodeName: "node-1", Containers: []v1.Container{{Name: "instana-agent"}}},
+		Status:     v1.PodStatus{ContainerStatuses: []v1.ContainerStatus{{Name: "instana-agent", RestartCount: restarts}}},
+	}
+}
@@ -0,0 +1,147 @@
+package cluster
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+)
+
+// FieldManager is the server-side apply field manager for objects envcheckctl owns.
+const FieldManager = "envcheckctl"
+
+const (
+	// Created indicates the object did not exist.
+	Created = "created"
+	// Updated indicates the object existed and was changed.
+	Updated = "updated"
+	// Unchanged indicates the object already matched the desired state.
+	Unchanged = "unchanged"
+	// Recreated indicates the object was deleted and created as an immutable field changed.
+	Recreated = "recreated"
+)
+
+// ApplyResult is the outcome of applying a single object.
+type ApplyResult struct {
+	Kind      string
+	Namespace string
+	Name      string
+	Action    string
+}
+
+func (r ApplyResult) String() string {
+	return fmt.Sprintf("%s/%s/%s", strings.ToLower(r.Kind), r.Namespace, r.Name)
+}
+
+// objectClient adapts the typed clients of a single resource for apply.
+type objectClient struct {
+	get    func(ctx context.Context, name string) (runtime.Object, error)
+	create func(ctx context.Context) (runtime.Object, error)
+	patch  func(ctx context.Context, name string, data []byte) (runtime.Object, error)
+	delete func(ctx context.Context, name string) error
+}
+
+// recreateTimeout bounds how long a deleted object is waited on before it is created again.
+var recreateTimeout = 30 * time.Second
+
+// recreateInterval is the time between attempts to create a deleted object.
+var recreateInterval = time.Second
+
+// apply server-side applies desired with the envcheckctl field manager. An
+// object that cannot be updated because an immutable field changed (e.g. a
+// DaemonSet selector) is deleted and created again.
+func apply(ctx context.Context, client objectClient, kind string, namespace string, name string, desired runtime.Object) (ApplyResult, error) {
+	result := ApplyResult{Kind: kind, Namespace: namespace, Name: name}
+
+	current, err := client.get(ctx, name)
+	if errors.IsNotFound(err) {
+		_, err = client.create(ctx)
+		result.Action = Created
+		return result, err
+	}
+	if err != nil {
+		return result, err
+	}
+
+	data, err := json.Marshal(desired)
+	if err != nil {
+		return result, err
+	}
+
+	applied, err := client.patch(ctx, name, data)
+	if isImmutable(err) {
+		err = recreate(ctx, client, name)
+		result.Action = Recreated
+		return result, err
+	}
+	if err != nil {
+		return result, err
+	}
+
+	result.Action = Updated
+	if !changed(current, applied) {
+		result.Action = Unchanged
+	}
+	return result, nil
+}
+
+func recreate(ctx context.Context, client objectClient, name string) error {
+	err := client.delete(ctx, name)
+	if err != nil && !errors.IsNotFound(err) {
+		return err
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, recreateTimeout)
+	defer cancel()
+	for {
+		_, err = client.create(ctx)
+		if !errors.IsAlreadyExists(err) {
+			return err
+		}
+		// the previous object is still being removed.
+		select {
+		case <-ctx.Done():
+			return err
+		case <-time.After(recreateInterval):
+		}
+	}
+}
+
+func isImmutable(err error) bool {
+	return errors.IsInvalid(err) && strings.Contains(err.Error(), "field is immutable")
+}
+
+// changed compares the resource version and, as not every client maintains
+// it, the labels and spec of the objects.
+func changed(before runtime.Object, after runtime.Object) bool {
+	b, errB := fingerprint(before)
+	a, errA := fingerprint(after)
+	if errB != nil || errA != nil {
+		return true
+	}
+	return !bytes.Equal(a, b)
+}
+
+func fingerprint(obj runtime.Object) ([]byte, error) {
+	m, err := manifest(obj)
+	if err != nil {
+		return nil, err
+	}
+	var labels, version interface{}
+	if metadata, ok := m["metadata"].(map[string]interface{}); ok {
+		labels = metadata["labels"]
+		version = metadata["resourceVersion"]
+	}
+	return json.Marshal([]interface{}{version, labels, m["spec"]})
+}
+
+func applyOptions() metav1.PatchOptions {
+	force := true
+	return metav1.PatchOptions{FieldManager: FieldManager, Force: &force}
+}
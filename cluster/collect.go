@@ -0,0 +1,117 @@
+package cluster
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+)
+
+// DefaultWorkers is the number of collection steps run concurrently.
+const DefaultWorkers = 4
+
+// Step is a single collection step such as listing the nodes. A failed
+// optional step is recorded in its StepInfo rather than failing the collection.
+type Step struct {
+	Name     string
+	Optional bool
+	Run      func(ctx context.Context) error
+}
+
+// StepInfo is the timing and outcome of a collection step.
+type StepInfo struct {
+	Name     string
+	Started  time.Time
+	Duration time.Duration
+	Optional bool   `json:",omitempty"`
+	Err      string `json:",omitempty"`
+}
+
+// NewCollector builds a collector that runs at most workers steps at once.
+func NewCollector(workers int, now func() time.Time) *Collector {
+	if workers < 1 {
+		workers = 1
+	}
+	return &Collector{workers: workers, now: now}
+}
+
+// Collector runs independent collection steps with a bounded worker pool and
+// records the timing of each.
+type Collector struct {
+	workers int
+	now     func() time.Time
+	mu      sync.Mutex
+	steps   []StepInfo
+}
+
+// Run runs the steps concurrently and waits for them to finish. The first
+// required step to fail cancels the remaining steps and its error is returned.
+func (c *Collector) Run(ctx context.Context, steps ...Step) error {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	var wg sync.WaitGroup
+	var once sync.Once
+	var firstErr error
+	sem := make(chan struct{}, c.workers)
+	for _, step := range steps {
+		step := step
+		select {
+		case sem <- struct{}{}:
+		case <-ctx.Done():
+			c.record(step, c.now(), ctx.Err())
+			continue
+		}
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			defer func() { <-sem }()
+			err := c.Time(ctx, step)
+			if err != nil && !step.Optional {
+				once.Do(func() {
+					firstErr = fmt.Errorf("%s: %w", step.Name, err)
+					cancel()
+				})
+			}
+		}()
+	}
+	wg.Wait()
+	return firstErr
+}
+
+// Time runs the step in the calling goroutine and records its timing. It can
+// be used within a step for sub-steps that must run in order.
+func (c *Collector) Time(ctx context.Context, step Step) error {
+	started := c.now()
+	err := step.Run(ctx)
+	c.record(step, started, err)
+	return err
+}
+
+func (c *Collector) record(step Step, started time.Time, err error) {
+	info := StepInfo{
+		Name:     step.Name,
+		Started:  started,
+		Duration: c.now().Sub(started),
+		Optional: step.Optional,
+	}
+	if err != nil {
+		info.Err = err.Error()
+	}
+	c.mu.Lock()
+	c.steps = append(c.steps, info)
+	c.mu.Unlock()
+}
+
+// Steps provides the recorded steps in the order they started.
+func (c *Collector) Steps() []StepInfo {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	steps := make([]StepInfo, len(c.steps))
+	copy(steps, c.steps)
+	sort.SliceStable(steps, func(i, j int) bool {
+		return steps[i].Started.Before(steps[j].Started)
+	})
+	return steps
+}
@@ -0,0 +1,79 @@
+package cluster_test
+
+import (
+	"context"
+	"fmt"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/instana/envcheck/cluster"
+)
+
+func Test_Collector_should_bound_concurrent_steps(t *testing.T) {
+	t.Parallel()
+	var running, peak int32
+	step := func(ctx context.Context) error {
+		n := atomic.AddInt32(&running, 1)
+		for {
+			p := atomic.LoadInt32(&peak)
+			if n <= p || atomic.CompareAndSwapInt32(&peak, p, n) {
+				break
+			}
+		}
+		time.Sleep(10 * time.Millisecond)
+		atomic.AddInt32(&running, -1)
+		return nil
+	}
+
+	collector := cluster.NewCollector(2, time.Now)
+	var steps []cluster.Step
+	for i := 0; i < 6; i++ {
+		steps = append(steps, cluster.Step{Name: fmt.Sprintf("step-%d", i), Run: step})
+	}
+	err := collector.Run(context.Background(), steps...)
+	if err != nil {
+		t.Fatalf("Run() err=%v, want nil", err)
+	}
+	if peak > 2 {
+		t.Errorf("peak=%d, want <= 2", peak)
+	}
+	if len(collector.Steps()) != 6 {
+		t.Errorf("len(Steps())=%d, want 6", len(collector.Steps()))
+	}
+}
+
+func Test_Collector_should_record_optional_failures(t *testing.T) {
+	t.Parallel()
+	collector := cluster.NewCollector(cluster.DefaultWorkers, time.Now)
+	err := collector.Run(context.Background(),
+		cluster.Step{Name: "events", Optional: true, Run: func(_ context.Context) error { return fmt.Errorf("forbidden") }},
+		cluster.Step{Name: "nodes", Run: func(_ context.Context) error { return nil }},
+	)
+	if err != nil {
+		t.Fatalf("Run() err=%v, want nil", err)
+	}
+
+	errs := make(map[string]string)
+	for _, step := range collector.Steps() {
+		errs[step.Name] = step.Err
+	}
+	if errs["events"] != "forbidden" || errs["nodes"] != "" {
+		t.Errorf("step errs=%v, want events=forbidden nodes=''", errs)
+	}
+}
+
+func Test_Collector_should_cancel_remaining_steps_when_required_step_fails(t *testing.T) {
+	t.Parallel()
+	collector := cluster.NewCollector(cluster.DefaultWorkers, time.Now)
+	err := collector.Run(context.Background(),
+		cluster.Step{Name: "pods", Run: func(ctx context.Context) error {
+			<-ctx.Done()
+			return ctx.Err()
+		}},
+		cluster.Step{Name: "nodes", Run: func(_ context.Context) error { return fmt.Errorf("forbidden") }},
+	)
+	if err == nil || err.Error() != "nodes: forbidden" {
+		t.Errorf("Run() err=%v, want nodes: forbidden", err)
+	}
+}
@@ -2,17 +2,27 @@ package cluster
 
 import (
 	"context"
+	"fmt"
+
+	v1apps "k8s.io/api/apps/v1"
+	v1 "k8s.io/api/core/v1"
+	v1networking "k8s.io/api/networking/v1"
+	v1rbac "k8s.io/api/rbac/v1"
 	"k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
 	"k8s.io/client-go/kubernetes"
 	appsv1 "k8s.io/client-go/kubernetes/typed/apps/v1"
 	corev1 "k8s.io/client-go/kubernetes/typed/core/v1"
-	"k8s.io/client-go/tools/clientcmd"
+	networkingv1 "k8s.io/client-go/kubernetes/typed/networking/v1"
+	rbacv1 "k8s.io/client-go/kubernetes/typed/rbac/v1"
 )
 
 // NewCommand allocates and returns a new Command.
-func NewCommand(kubeconfig string) (*KubernetesCommand, error) {
-	config, err := clientcmd.BuildConfigFromFlags("", kubeconfig)
+func NewCommand(kubeconfig Kubeconfig) (*KubernetesCommand, error) {
+	config, _, err := kubeconfig.RESTConfig()
 	if err != nil {
 		return nil, err
 	}
@@ -23,43 +33,232 @@ func NewCommand(kubeconfig string) (*KubernetesCommand, error) {
 		return nil, err
 	}
 
-	return &KubernetesCommand{clientset.AppsV1(), clientset.CoreV1()}, nil
+	return &KubernetesCommand{clientset.AppsV1(), clientset.CoreV1(), clientset.NetworkingV1(), clientset.RbacV1()}, nil
 }
 
 // Command provides an interface for creating envcheck entities in a cluster.
 type Command interface {
-	CreateDaemon(DaemonConfig) error
-	CreatePinger(PingerConfig) error
-	CreateService(DaemonConfig) error
+	CreateDaemon(ctx context.Context, config DaemonConfig) (ApplyResult, error)
+	CreateDaemonAccess(ctx context.Context, config DaemonConfig) ([]ApplyResult, error)
+	CreatePinger(ctx context.Context, config PingerConfig) (ApplyResult, error)
+	CreateService(ctx context.Context, config DaemonConfig) (ApplyResult, error)
+	CreateBackend(ctx context.Context, config BackendConfig) (ApplyResult, error)
+	DeleteBackend(ctx context.Context, namespace string) error
+	Delete(ctx context.Context, applied ApplyResult) error
+	Exists(ctx context.Context, object ApplyResult) (bool, error)
+	DeleteDaemonSet(ctx context.Context, namespace string, name string) error
+	DeleteService(ctx context.Context, namespace string, name string) error
+	WaitRollout(ctx context.Context, namespace string, name string, progress func(*Rollout)) (*Rollout, error)
+	Namespaces(ctx context.Context, selector string) ([]string, error)
+	NetworkPolicies(ctx context.Context, namespace string) ([]v1networking.NetworkPolicy, error)
 }
 
 // KubernetesCommand is a k8s implementation of the Command interface.
 type KubernetesCommand struct {
 	appsv1.AppsV1Interface
 	corev1.CoreV1Interface
+	networkingv1.NetworkingV1Interface
+	rbacv1.RbacV1Interface
+}
+
+// CreateDaemon applies the envchecker daemonset in the current K8S environment.
+func (kc *KubernetesCommand) CreateDaemon(ctx context.Context, config DaemonConfig) (ApplyResult, error) {
+	return kc.applyDaemonSet(ctx, DaemonManifests(config)[0].(*v1apps.DaemonSet))
+}
+
+// CreateDaemonAccess applies the daemon ServiceAccount and the Role and
+// RoleBinding to read the API server endpoints in the current K8S environment.
+func (kc *KubernetesCommand) CreateDaemonAccess(ctx context.Context, config DaemonConfig) ([]ApplyResult, error) {
+	manifests := DaemonAccessManifests(config)
+	sa := manifests[0].(*v1.ServiceAccount)
+	role := manifests[1].(*v1rbac.Role)
+	binding := manifests[2].(*v1rbac.RoleBinding)
+
+	serviceAccounts := kc.ServiceAccounts(sa.Namespace)
+	roles := kc.Roles(role.Namespace)
+	bindings := kc.RoleBindings(binding.Namespace)
+	clients := []objectClient{
+		{
+			get: func(ctx context.Context, name string) (runtime.Object, error) {
+				return serviceAccounts.Get(ctx, name, metav1.GetOptions{})
+			},
+			create: func(ctx context.Context) (runtime.Object, error) {
+				return serviceAccounts.Create(ctx, sa, metav1.CreateOptions{FieldManager: FieldManager})
+			},
+			patch: func(ctx context.Context, name string, data []byte) (runtime.Object, error) {
+				return serviceAccounts.Patch(ctx, name, types.ApplyPatchType, data, applyOptions())
+			},
+			delete: func(ctx context.Context, name string) error {
+				return serviceAccounts.Delete(ctx, name, metav1.DeleteOptions{})
+			},
+		},
+		{
+			get: func(ctx context.Context, name string) (runtime.Object, error) {
+				return roles.Get(ctx, name, metav1.GetOptions{})
+			},
+			create: func(ctx context.Context) (runtime.Object, error) {
+				return roles.Create(ctx, role, metav1.CreateOptions{FieldManager: FieldManager})
+			},
+			patch: func(ctx context.Context, name string, data []byte) (runtime.Object, error) {
+				return roles.Patch(ctx, name, types.ApplyPatchType, data, applyOptions())
+			},
+			delete: func(ctx context.Context, name string) error {
+				return roles.Delete(ctx, name, metav1.DeleteOptions{})
+			},
+		},
+		{
+			get: func(ctx context.Context, name string) (runtime.Object, error) {
+				return bindings.Get(ctx, name, metav1.GetOptions{})
+			},
+			create: func(ctx context.Context) (runtime.Object, error) {
+				return bindings.Create(ctx, binding, metav1.CreateOptions{FieldManager: FieldManager})
+			},
+			patch: func(ctx context.Context, name string, data []byte) (runtime.Object, error) {
+				return bindings.Patch(ctx, name, types.ApplyPatchType, data, applyOptions())
+			},
+			delete: func(ctx context.Context, name string) error {
+				return bindings.Delete(ctx, name, metav1.DeleteOptions{})
+			},
+		},
+	}
+
+	var results []ApplyResult
+	for i, client := range clients {
+		obj := manifests[i]
+		accessor, err := meta.Accessor(obj)
+		if err != nil {
+			return results, err
+		}
+		kind := obj.GetObjectKind().GroupVersionKind().Kind
+		applied, err := apply(ctx, client, kind, accessor.GetNamespace(), accessor.GetName(), obj)
+		if err != nil {
+			return results, err
+		}
+		results = append(results, applied)
+	}
+	return results, nil
 }
 
-// CreateDaemon creates an envchecker daemonset in the current K8S environment.
-func (kc *KubernetesCommand) CreateDaemon(config DaemonConfig) error {
-	_, err := kc.DaemonSets(config.Namespace).Create(context.TODO(), Daemon(config), metav1.CreateOptions{})
-	if err != nil && errors.IsAlreadyExists(err) {
-		_, err = kc.DaemonSets(config.Namespace).Update(context.TODO(), Daemon(config), metav1.UpdateOptions{})
+// CreateService applies the envchecker service in the current K8S environment.
+func (kc *KubernetesCommand) CreateService(ctx context.Context, config DaemonConfig) (ApplyResult, error) {
+	svc := DaemonManifests(config)[1].(*v1.Service)
+	services := kc.Services(svc.Namespace)
+	client := objectClient{
+		get: func(ctx context.Context, name string) (runtime.Object, error) {
+			return services.Get(ctx, name, metav1.GetOptions{})
+		},
+		create: func(ctx context.Context) (runtime.Object, error) {
+			return services.Create(ctx, svc, metav1.CreateOptions{FieldManager: FieldManager})
+		},
+		patch: func(ctx context.Context, name string, data []byte) (runtime.Object, error) {
+			return services.Patch(ctx, name, types.ApplyPatchType, data, applyOptions())
+		},
+		delete: func(ctx context.Context, name string) error {
+			return services.Delete(ctx, name, metav1.DeleteOptions{})
+		},
+	}
+	return apply(ctx, client, svc.Kind, svc.Namespace, svc.Name, svc)
+}
+
+// CreatePinger applies the pinger daemonset in the current K8S environment.
+func (kc *KubernetesCommand) CreatePinger(ctx context.Context, config PingerConfig) (ApplyResult, error) {
+	return kc.applyDaemonSet(ctx, PingerManifests(config)[0].(*v1apps.DaemonSet))
+}
+
+// CreateBackend applies the backend check daemonset in the current K8S environment.
+func (kc *KubernetesCommand) CreateBackend(ctx context.Context, config BackendConfig) (ApplyResult, error) {
+	ds := Backend(config)
+	ds.TypeMeta = metav1.TypeMeta{APIVersion: v1apps.SchemeGroupVersion.String(), Kind: "DaemonSet"}
+	return kc.applyDaemonSet(ctx, ds)
+}
+
+func (kc *KubernetesCommand) applyDaemonSet(ctx context.Context, ds *v1apps.DaemonSet) (ApplyResult, error) {
+	daemonSets := kc.DaemonSets(ds.Namespace)
+	client := objectClient{
+		get: func(ctx context.Context, name string) (runtime.Object, error) {
+			return daemonSets.Get(ctx, name, metav1.GetOptions{})
+		},
+		create: func(ctx context.Context) (runtime.Object, error) {
+			return daemonSets.Create(ctx, ds, metav1.CreateOptions{FieldManager: FieldManager})
+		},
+		patch: func(ctx context.Context, name string, data []byte) (runtime.Object, error) {
+			return daemonSets.Patch(ctx, name, types.ApplyPatchType, data, applyOptions())
+		},
+		delete: func(ctx context.Context, name string) error {
+			propagation := metav1.DeletePropagationBackground
+			return daemonSets.Delete(ctx, name, metav1.DeleteOptions{PropagationPolicy: &propagation})
+		},
+	}
+	return apply(ctx, client, ds.Kind, ds.Namespace, ds.Name, ds)
+}
+
+// DeleteDaemonSet removes the named daemonset and its pods from the current K8S environment.
+func (kc *KubernetesCommand) DeleteDaemonSet(ctx context.Context, namespace string, name string) error {
+	propagation := metav1.DeletePropagationForeground
+	err := kc.DaemonSets(namespace).Delete(ctx, name, metav1.DeleteOptions{PropagationPolicy: &propagation})
+	if errors.IsNotFound(err) {
+		return nil
 	}
 	return err
 }
 
-// CreateService creates an envchecker service in the current K8S environment.
-func (kc *KubernetesCommand) CreateService(config DaemonConfig) error {
-	svc := Service(config)
-	_, err := kc.Services(config.Namespace).Create(context.TODO(), svc, metav1.CreateOptions{})
+// DeleteService removes the named service from the current K8S environment.
+func (kc *KubernetesCommand) DeleteService(ctx context.Context, namespace string, name string) error {
+	err := kc.Services(namespace).Delete(ctx, name, metav1.DeleteOptions{})
+	if errors.IsNotFound(err) {
+		return nil
+	}
 	return err
 }
 
-// CreatePinger creates a pinger daemonset in the current K8S environment.
-func (kc *KubernetesCommand) CreatePinger(config PingerConfig) error {
-	_, err := kc.DaemonSets(config.Namespace).Create(context.TODO(), Pinger(config), metav1.CreateOptions{})
-	if err != nil && errors.IsAlreadyExists(err) {
-		_, err = kc.DaemonSets(config.Namespace).Update(context.TODO(), Pinger(config), metav1.UpdateOptions{})
+// Delete removes the applied object from the current K8S environment.
+func (kc *KubernetesCommand) Delete(ctx context.Context, applied ApplyResult) error {
+	var err error
+	switch applied.Kind {
+	case "DaemonSet":
+		return kc.DeleteDaemonSet(ctx, applied.Namespace, applied.Name)
+	case "Service":
+		return kc.DeleteService(ctx, applied.Namespace, applied.Name)
+	case "ServiceAccount":
+		err = kc.ServiceAccounts(applied.Namespace).Delete(ctx, applied.Name, metav1.DeleteOptions{})
+	case "Role":
+		err = kc.Roles(applied.Namespace).Delete(ctx, applied.Name, metav1.DeleteOptions{})
+	case "RoleBinding":
+		err = kc.RoleBindings(applied.Namespace).Delete(ctx, applied.Name, metav1.DeleteOptions{})
+	default:
+		return fmt.Errorf("unable to delete %v of unknown kind %q", applied, applied.Kind)
+	}
+	if errors.IsNotFound(err) {
+		return nil
 	}
 	return err
 }
+
+// Exists indicates whether the object, identified by its kind, namespace and
+// name, is present in the current K8S environment.
+func (kc *KubernetesCommand) Exists(ctx context.Context, object ApplyResult) (bool, error) {
+	var err error
+	switch object.Kind {
+	case "DaemonSet":
+		_, err = kc.DaemonSets(object.Namespace).Get(ctx, object.Name, metav1.GetOptions{})
+	case "Service":
+		_, err = kc.Services(object.Namespace).Get(ctx, object.Name, metav1.GetOptions{})
+	case "ServiceAccount":
+		_, err = kc.ServiceAccounts(object.Namespace).Get(ctx, object.Name, metav1.GetOptions{})
+	case "Role":
+		_, err = kc.Roles(object.Namespace).Get(ctx, object.Name, metav1.GetOptions{})
+	case "RoleBinding":
+		_, err = kc.RoleBindings(object.Namespace).Get(ctx, object.Name, metav1.GetOptions{})
+	default:
+		return false, fmt.Errorf("unable to find %v of unknown kind %q", object, object.Kind)
+	}
+	if errors.IsNotFound(err) {
+		return false, nil
+	}
+	return err == nil, err
+}
+
+// DeleteBackend removes the backend check daemonset and its pods from the current K8S environment.
+func (kc *KubernetesCommand) DeleteBackend(ctx context.Context, namespace string) error {
+	return kc.DeleteDaemonSet(ctx, namespace, BackendName)
+}
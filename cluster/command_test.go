@@ -0,0 +1,167 @@
+package cluster_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/instana/envcheck/cluster"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/util/validation/field"
+	"k8s.io/client-go/kubernetes/fake"
+	k8stesting "k8s.io/client-go/testing"
+)
+
+func Test_CreateDaemon_should_report_each_action(t *testing.T) {
+	client := fake.NewSimpleClientset()
+	command := &cluster.KubernetesCommand{AppsV1Interface: client.AppsV1(), CoreV1Interface: client.CoreV1()}
+	config := cluster.DaemonConfig{Namespace: "instana-agent", Image: "instana/envcheck-daemon:latest", Version: "abc123"}
+
+	applied, err := command.CreateDaemon(context.Background(), config)
+	assertAction(t, applied, err, cluster.Created)
+	if applied.String() != "daemonset/instana-agent/envchecker" {
+		t.Errorf("applied=%v, want <daemonset/instana-agent/envchecker>", applied)
+	}
+
+	applied, err = command.CreateDaemon(context.Background(), config)
+	assertAction(t, applied, err, cluster.Unchanged)
+
+	config.Image = "registry.corp/instana/envcheck-daemon:latest"
+	applied, err = command.CreateDaemon(context.Background(), config)
+	assertAction(t, applied, err, cluster.Updated)
+}
+
+func Test_CreateService_should_apply_existing_service(t *testing.T) {
+	client := fake.NewSimpleClientset()
+	command := &cluster.KubernetesCommand{AppsV1Interface: client.AppsV1(), CoreV1Interface: client.CoreV1()}
+	config := cluster.DaemonConfig{Namespace: "instana-agent", Port: 42700}
+
+	applied, err := command.CreateService(context.Background(), config)
+	assertAction(t, applied, err, cluster.Created)
+
+	applied, err = command.CreateService(context.Background(), config)
+	assertAction(t, applied, err, cluster.Unchanged)
+}
+
+func Test_CreatePinger_should_recreate_on_immutable_selector(t *testing.T) {
+	client := fake.NewSimpleClientset()
+	command := &cluster.KubernetesCommand{AppsV1Interface: client.AppsV1(), CoreV1Interface: client.CoreV1()}
+	config := cluster.PingerConfig{Namespace: "default", Version: "abc123"}
+
+	applied, err := command.CreatePinger(context.Background(), config)
+	assertAction(t, applied, err, cluster.Created)
+
+	client.PrependReactor("patch", "daemonsets", func(action k8stesting.Action) (bool, runtime.Object, error) {
+		errs := field.ErrorList{field.Invalid(field.NewPath("spec", "selector"), "def456", "field is immutable")}
+		return true, nil, errors.NewInvalid(schema.GroupKind{Group: "apps", Kind: "DaemonSet"}, cluster.PingerName, errs)
+	})
+
+	config.Version = "def456"
+	applied, err = command.CreatePinger(context.Background(), config)
+	assertAction(t, applied, err, cluster.Recreated)
+
+	var deleted bool
+	for _, action := range client.Actions() {
+		deleted = deleted || action.GetVerb() == "delete"
+	}
+	if !deleted {
+		t.Errorf("delete action not found, want the pinger deleted before it is created")
+	}
+}
+
+func Test_CreatePinger_should_stop_waiting_to_recreate_when_cancelled(t *testing.T) {
+	client := fake.NewSimpleClientset()
+	command := &cluster.KubernetesCommand{AppsV1Interface: client.AppsV1(), CoreV1Interface: client.CoreV1()}
+	config := cluster.PingerConfig{Namespace: "default", Version: "abc123"}
+
+	_, err := command.CreatePinger(context.Background(), config)
+	if err != nil {
+		t.Fatalf("err=%v, want nil", err)
+	}
+
+	client.PrependReactor("patch", "daemonsets", func(action k8stesting.Action) (bool, runtime.Object, error) {
+		errs := field.ErrorList{field.Invalid(field.NewPath("spec", "selector"), "def456", "field is immutable")}
+		return true, nil, errors.NewInvalid(schema.GroupKind{Group: "apps", Kind: "DaemonSet"}, cluster.PingerName, errs)
+	})
+	// the deleted pinger is never removed.
+	client.PrependReactor("delete", "daemonsets", func(action k8stesting.Action) (bool, runtime.Object, error) {
+		return true, nil, nil
+	})
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	start := time.Now()
+	config.Version = "def456"
+	_, err = command.CreatePinger(ctx, config)
+	if !errors.IsAlreadyExists(err) {
+		t.Errorf("err=%v, want already exists", err)
+	}
+	if time.Since(start) > 5*time.Second {
+		t.Errorf("CreatePinger() took %v, want it to return once ctx is done", time.Since(start))
+	}
+}
+
+func assertAction(t *testing.T, applied cluster.ApplyResult, err error, action string) {
+	t.Helper()
+	if err != nil {
+		t.Fatalf("err=%v, want nil", err)
+	}
+	if applied.Action != action {
+		t.Errorf("Action=%v, want <%v>", applied.Action, action)
+	}
+}
+
+func Test_CreateDaemonAccess_should_grant_endpoints_to_daemon(t *testing.T) {
+	client := fake.NewSimpleClientset()
+	command := &cluster.KubernetesCommand{CoreV1Interface: client.CoreV1(), RbacV1Interface: client.RbacV1()}
+	config := cluster.DaemonConfig{Namespace: "instana-agent"}
+
+	applied, err := command.CreateDaemonAccess(context.Background(), config)
+	if err != nil {
+		t.Fatalf("CreateDaemonAccess() err=%v, want nil", err)
+	}
+	var got []string
+	for _, a := range applied {
+		got = append(got, a.String()+" "+a.Action)
+	}
+	expected := []string{
+		"serviceaccount/instana-agent/envchecker created",
+		"role/default/envchecker-instana-agent-endpoints created",
+		"rolebinding/default/envchecker-instana-agent-endpoints created",
+	}
+	if !cmp.Equal(expected, got) {
+		t.Errorf("CreateDaemonAccess() mismatch (-want +got)\n%s", cmp.Diff(expected, got))
+	}
+
+	binding, err := client.RbacV1().RoleBindings("default").Get(context.Background(), "envchecker-instana-agent-endpoints", metav1.GetOptions{})
+	if err != nil {
+		t.Fatalf("RoleBinding err=%v, want nil", err)
+	}
+	subject := binding.Subjects[0]
+	if subject.Name != cluster.DaemonSetName || subject.Namespace != "instana-agent" {
+		t.Errorf("subject=%+v, want envchecker in instana-agent", subject)
+	}
+
+	for _, a := range applied {
+		exists, err := command.Exists(context.Background(), a)
+		if err != nil || !exists {
+			t.Errorf("Exists(%v)=%v err=%v, want true nil", a, exists, err)
+		}
+		err = command.Delete(context.Background(), a)
+		if err != nil {
+			t.Fatalf("Delete(%v) err=%v, want nil", a, err)
+		}
+		exists, err = command.Exists(context.Background(), a)
+		if err != nil || exists {
+			t.Errorf("Exists(%v)=%v err=%v after Delete, want false nil", a, exists, err)
+		}
+	}
+	roles, _ := client.RbacV1().Roles("default").List(context.Background(), metav1.ListOptions{})
+	if len(roles.Items) != 0 {
+		t.Errorf("roles=%d, want 0", len(roles.Items))
+	}
+}
@@ -0,0 +1,204 @@
+package cluster
+
+import (
+	"sort"
+
+	"k8s.io/apimachinery/pkg/labels"
+)
+
+// AgentPorts are the agent ports workloads send traces and metrics to on
+// their node, the agent port and the OTLP gRPC and HTTP ports.
+var AgentPorts = []int32{42699, 4317, 4318}
+
+const (
+	// EgressAllowed is the verdict when every pod can reach the agent on every port.
+	EgressAllowed = "allowed"
+	// EgressPartial is the verdict when some pods or ports are blocked.
+	EgressPartial = "partial"
+	// EgressBlocked is the verdict when no pod can reach the agent on any port.
+	EgressBlocked = "blocked"
+)
+
+// EgressVerdict is the static evaluation of whether the pods in a namespace
+// can reach the agent on their node.
+type EgressVerdict struct {
+	Namespace string
+	Pods      int
+	Ports     []PortVerdict
+	// Policies are the policies restricting egress of pods in the namespace.
+	Policies []string `json:",omitempty"`
+	// Unevaluated are the policies that could apply but cannot be evaluated.
+	Unevaluated []string `json:",omitempty"`
+	Verdict     string
+}
+
+// PortVerdict counts the pods allowed and blocked from reaching an agent port.
+type PortVerdict struct {
+	Port    int32
+	Allowed int
+	Blocked int
+}
+
+// EvaluateEgress evaluates whether the pods in each namespace can reach the
+// agent on ports of their node given the policies. Host network pods are not
+// subject to policies and are excluded.
+func EvaluateEgress(pods []PodInfo, policies []PolicyInfo, ports []int32) []EgressVerdict {
+	evaluator := NewEgressEvaluator(policies, ports)
+	for _, pod := range pods {
+		evaluator.EachPod(pod)
+	}
+	return evaluator.Verdicts()
+}
+
+// NewEgressEvaluator builds an evaluator of agent egress for the policies
+// that is fed a pod at a time so pods can be evaluated as they are listed.
+func NewEgressEvaluator(policies []PolicyInfo, ports []int32) *EgressEvaluator {
+	selectors := make([]labels.Selector, len(policies))
+	for i := range policies {
+		if policies[i].Unsupported != "" {
+			continue
+		}
+		selector, err := labels.Parse(policies[i].Selector)
+		if err == nil {
+			selectors[i] = selector
+		}
+	}
+
+	return &EgressEvaluator{
+		policies:    policies,
+		ports:       ports,
+		selectors:   selectors,
+		verdicts:    make(map[string]*EgressVerdict),
+		restricting: make(map[string]Set),
+		unevaluated: make(map[string]Set),
+	}
+}
+
+// EgressEvaluator accumulates the agent egress verdict of each namespace.
+type EgressEvaluator struct {
+	policies    []PolicyInfo
+	ports       []int32
+	selectors   []labels.Selector
+	verdicts    map[string]*EgressVerdict
+	restricting map[string]Set
+	unevaluated map[string]Set
+}
+
+// EachPod evaluates the policies that apply to the pod.
+func (e *EgressEvaluator) EachPod(pod PodInfo) {
+	if pod.HostNetwork {
+		return
+	}
+	v, ok := e.verdicts[pod.Namespace]
+	if !ok {
+		v = &EgressVerdict{Namespace: pod.Namespace}
+		for _, port := range e.ports {
+			v.Ports = append(v.Ports, PortVerdict{Port: port})
+		}
+		e.verdicts[pod.Namespace] = v
+		e.restricting[pod.Namespace] = make(Set)
+		e.unevaluated[pod.Namespace] = make(Set)
+	}
+	v.Pods++
+
+	podLabels := labels.Set{ciliumNamespaceLabel: pod.Namespace, calicoNamespaceLabel: pod.Namespace}
+	for k, val := range pod.Labels {
+		podLabels[k] = val
+	}
+
+	var applied []*PolicyInfo
+	for i := range e.policies {
+		p := &e.policies[i]
+		if p.Namespace != "" && p.Namespace != pod.Namespace {
+			continue
+		}
+		if e.selectors[i] == nil {
+			if p.Egress {
+				e.unevaluated[pod.Namespace].Add(p.String())
+			}
+			continue
+		}
+		if p.Egress && e.selectors[i].Matches(podLabels) {
+			applied = append(applied, p)
+			e.restricting[pod.Namespace].Add(p.String())
+			if pod.Host == "" && p.hasBlocks() {
+				// an unscheduled pod has no node to compare the ipBlocks with.
+				e.unevaluated[pod.Namespace].Add(p.String())
+			}
+		}
+	}
+
+	for i := range v.Ports {
+		if allows(applied, pod.Host, v.Ports[i].Port) {
+			v.Ports[i].Allowed++
+		} else {
+			v.Ports[i].Blocked++
+		}
+	}
+}
+
+// EachNode is a no-op as policies only restrict pods.
+func (e *EgressEvaluator) EachNode(_ NodeInfo) {}
+
+// EachEgress is a no-op as the evaluator produces the verdicts.
+func (e *EgressEvaluator) EachEgress(_ EgressVerdict) {}
+
+// Verdicts provides the verdict of each namespace sorted by namespace.
+func (e *EgressEvaluator) Verdicts() []EgressVerdict {
+	var results []EgressVerdict
+	for ns, v := range e.verdicts {
+		v.Policies = sortedKeys(e.restricting[ns])
+		v.Unevaluated = sortedKeys(e.unevaluated[ns])
+		v.Verdict = verdict(v.Ports)
+		results = append(results, *v)
+	}
+	sort.Slice(results, func(i, j int) bool {
+		return results[i].Namespace < results[j].Namespace
+	})
+	return results
+}
+
+// allows applies the union of the allow rules of the policies to the node
+// with the address host with any matching deny rule taking precedence.
+func allows(policies []*PolicyInfo, host string, port int32) bool {
+	if len(policies) == 0 {
+		return true
+	}
+	var allowed bool
+	for _, p := range policies {
+		for _, r := range p.Rules {
+			if !r.Matches(host, port) {
+				continue
+			}
+			if r.Deny {
+				return false
+			}
+			allowed = true
+		}
+	}
+	return allowed
+}
+
+func verdict(ports []PortVerdict) string {
+	var allowed, blocked int
+	for _, p := range ports {
+		allowed += p.Allowed
+		blocked += p.Blocked
+	}
+	switch {
+	case blocked == 0:
+		return EgressAllowed
+	case allowed == 0:
+		return EgressBlocked
+	}
+	return EgressPartial
+}
+
+func sortedKeys(s Set) []string {
+	var keys []string
+	for k := range s {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
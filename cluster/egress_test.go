@@ -0,0 +1,145 @@
+package cluster_test
+
+import (
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/instana/envcheck/cluster"
+	networkingv1 "k8s.io/api/networking/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func Test_EvaluateEgress(t *testing.T) {
+	t.Parallel()
+	pods := []cluster.PodInfo{
+		{Namespace: "default", Name: "web"},
+		{Namespace: "instana-agent", Name: "instana-agent-abc12", HostNetwork: true},
+		{Namespace: "payments", Name: "checkout", Labels: map[string]string{"app": "checkout"}},
+		{Namespace: "payments", Name: "ledger", Labels: map[string]string{"app": "ledger"}},
+		{Namespace: "shop", Name: "cart"},
+	}
+	policies := []cluster.PolicyInfo{
+		{
+			Kind:      cluster.KindNetworkPolicy,
+			Namespace: "payments",
+			Name:      "checkout-agent",
+			Selector:  "app=checkout",
+			Egress:    true,
+			Rules:     []cluster.EgressRule{{Host: true, Ports: []cluster.PortRange{{Protocol: "TCP", Port: 42699}}}},
+		},
+		{Kind: cluster.KindNetworkPolicy, Namespace: "payments", Name: "allow-ingress"},
+		{
+			Kind:     cluster.KindCiliumClusterwideNetworkPolicy,
+			Name:     "shop-lockdown",
+			Selector: "io.kubernetes.pod.namespace=shop",
+			Egress:   true,
+			Rules:    []cluster.EgressRule{{Deny: true, Host: true}},
+		},
+		{Kind: cluster.KindCalicoNetworkPolicy, Namespace: "shop", Name: "legacy", Egress: true, Unsupported: "unsupported selector"},
+	}
+
+	verdicts := cluster.EvaluateEgress(pods, policies, []int32{42699, 4317})
+	expected := []cluster.EgressVerdict{
+		{
+			Namespace: "default",
+			Pods:      1,
+			Ports:     []cluster.PortVerdict{{Port: 42699, Allowed: 1}, {Port: 4317, Allowed: 1}},
+			Verdict:   cluster.EgressAllowed,
+		},
+		{
+			Namespace: "payments",
+			Pods:      2,
+			Ports:     []cluster.PortVerdict{{Port: 42699, Allowed: 2}, {Port: 4317, Allowed: 1, Blocked: 1}},
+			Policies:  []string{"NetworkPolicy/checkout-agent"},
+			Verdict:   cluster.EgressPartial,
+		},
+		{
+			Namespace:   "shop",
+			Pods:        1,
+			Ports:       []cluster.PortVerdict{{Port: 42699, Blocked: 1}, {Port: 4317, Blocked: 1}},
+			Policies:    []string{"CiliumClusterwideNetworkPolicy/shop-lockdown"},
+			Unevaluated: []string{"CalicoNetworkPolicy/legacy"},
+			Verdict:     cluster.EgressBlocked,
+		},
+	}
+	if !cmp.Equal(expected, verdicts) {
+		t.Errorf("EvaluateEgress() mismatch (-want +got)\n%s", cmp.Diff(expected, verdicts))
+	}
+}
+
+func Test_EvaluateEgress_should_match_ipBlocks_against_the_node(t *testing.T) {
+	t.Parallel()
+	cases := map[string]struct {
+		block    networkingv1.IPBlock
+		host     string
+		expected cluster.EgressVerdict
+	}{
+		"internet only blocks node": {
+			networkingv1.IPBlock{CIDR: "0.0.0.0/0", Except: []string{"10.0.0.0/8"}},
+			"10.1.2.3",
+			cluster.EgressVerdict{Ports: []cluster.PortVerdict{{Port: 42699, Blocked: 1}}, Verdict: cluster.EgressBlocked},
+		},
+		"internet only allows node outside exception": {
+			networkingv1.IPBlock{CIDR: "0.0.0.0/0", Except: []string{"10.0.0.0/8"}},
+			"192.168.1.5",
+			cluster.EgressVerdict{Ports: []cluster.PortVerdict{{Port: 42699, Allowed: 1}}, Verdict: cluster.EgressAllowed},
+		},
+		"unrelated host blocks node": {
+			networkingv1.IPBlock{CIDR: "203.0.113.7/32"},
+			"10.1.2.3",
+			cluster.EgressVerdict{Ports: []cluster.PortVerdict{{Port: 42699, Blocked: 1}}, Verdict: cluster.EgressBlocked},
+		},
+		"node cidr allows node": {
+			networkingv1.IPBlock{CIDR: "10.1.0.0/16"},
+			"10.1.2.3",
+			cluster.EgressVerdict{Ports: []cluster.PortVerdict{{Port: 42699, Allowed: 1}}, Verdict: cluster.EgressAllowed},
+		},
+		"unscheduled pod is unevaluated": {
+			networkingv1.IPBlock{CIDR: "203.0.113.7/32"},
+			"",
+			cluster.EgressVerdict{Ports: []cluster.PortVerdict{{Port: 42699, Allowed: 1}}, Unevaluated: []string{"NetworkPolicy/egress"}, Verdict: cluster.EgressAllowed},
+		},
+	}
+	for name, tc := range cases {
+		tc := tc
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+			block := tc.block
+			policy := &networkingv1.NetworkPolicy{
+				ObjectMeta: metav1.ObjectMeta{Namespace: "payments", Name: "egress"},
+				Spec: networkingv1.NetworkPolicySpec{
+					PolicyTypes: []networkingv1.PolicyType{networkingv1.PolicyTypeEgress},
+					Egress:      []networkingv1.NetworkPolicyEgressRule{{To: []networkingv1.NetworkPolicyPeer{{IPBlock: &block}}}},
+				},
+			}
+			pods := []cluster.PodInfo{{Namespace: "payments", Name: "checkout", Host: tc.host}}
+
+			verdicts := cluster.EvaluateEgress(pods, []cluster.PolicyInfo{cluster.NetworkPolicyInfo(policy)}, []int32{42699})
+			expected := tc.expected
+			expected.Namespace = "payments"
+			expected.Pods = 1
+			expected.Policies = []string{"NetworkPolicy/egress"}
+			if !cmp.Equal([]cluster.EgressVerdict{expected}, verdicts) {
+				t.Errorf("EvaluateEgress() mismatch (-want +got)\n%s", cmp.Diff([]cluster.EgressVerdict{expected}, verdicts))
+			}
+		})
+	}
+}
+
+func Test_Index_EachEgress(t *testing.T) {
+	t.Parallel()
+	index := cluster.NewIndex()
+	info := cluster.Info{Egress: []cluster.EgressVerdict{
+		{Namespace: "default", Verdict: cluster.EgressAllowed},
+		{Namespace: "shop", Verdict: cluster.EgressBlocked},
+	}}
+	info.Apply(index)
+
+	if index.Egress["shop"].Verdict != cluster.EgressBlocked {
+		t.Errorf("index.Egress[shop]=%v, want blocked", index.Egress["shop"])
+	}
+	expected := cluster.Counter{cluster.EgressAllowed: 1, cluster.EgressBlocked: 1}
+	if !cmp.Equal(expected, index.EgressVerdicts) {
+		t.Errorf("index.EgressVerdicts mismatch (-want +got)\n%s", cmp.Diff(expected, index.EgressVerdicts))
+	}
+}
@@ -0,0 +1,67 @@
+package cluster
+
+import (
+	"context"
+	"time"
+
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// EventInfo is summary details for a warning event.
+type EventInfo struct {
+	Namespace string
+	Kind      string
+	Name      string
+	Reason    string
+	Message   string
+	Count     int
+	LastSeen  time.Time
+}
+
+// AllEvents retrieves the warning events in namespace, or all namespaces when empty.
+func (q *KubernetesQuery) AllEvents(ctx context.Context, namespace string) ([]EventInfo, error) {
+	var eventList []EventInfo
+
+	err := paginate(ctx, func() { eventList = nil }, func(opts metav1.ListOptions) (string, error) {
+		opts.FieldSelector = "type=" + v1.EventTypeWarning
+		events, err := q.core.Events(namespace).List(ctx, opts)
+		if err != nil {
+			return "", err
+		}
+
+		for i := range events.Items {
+			eventList = append(eventList, eventInfo(&events.Items[i]))
+		}
+		return events.Continue, nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return eventList, nil
+}
+
+func eventInfo(ev *v1.Event) EventInfo {
+	info := EventInfo{
+		Namespace: ev.Namespace,
+		Kind:      ev.InvolvedObject.Kind,
+		Name:      ev.InvolvedObject.Name,
+		Reason:    ev.Reason,
+		Message:   ev.Message,
+		Count:     int(ev.Count),
+		LastSeen:  ev.LastTimestamp.Time,
+	}
+	// events from the events.k8s.io api set the series rather than the count.
+	if ev.Series != nil {
+		info.Count = int(ev.Series.Count)
+		info.LastSeen = ev.Series.LastObservedTime.Time
+	}
+	if info.Count == 0 {
+		info.Count = 1
+	}
+	if info.LastSeen.IsZero() {
+		info.LastSeen = ev.EventTime.Time
+	}
+	return info
+}
@@ -0,0 +1,71 @@
+package cluster_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/instana/envcheck/cluster"
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+func Test_AllEvents(t *testing.T) {
+	t.Parallel()
+	lastSeen := time.Date(2023, 5, 2, 19, 33, 47, 0, time.UTC)
+	seriesSeen := time.Date(2023, 5, 2, 19, 40, 0, 0, time.UTC)
+	client := fake.NewSimpleClientset(
+		&v1.Event{
+			ObjectMeta:     metav1.ObjectMeta{Name: "agent.1", Namespace: "instana-agent"},
+			InvolvedObject: v1.ObjectReference{Kind: "Pod", Name: "agent-abc123"},
+			Reason:         "BackOff",
+			Message:        "Back-off restarting failed container",
+			Count:          4,
+			LastTimestamp:  metav1.NewTime(lastSeen),
+			Type:           v1.EventTypeWarning,
+		},
+		&v1.Event{
+			ObjectMeta:     metav1.ObjectMeta{Name: "web.1", Namespace: "default"},
+			InvolvedObject: v1.ObjectReference{Kind: "Pod", Name: "web"},
+			Reason:         "FailedMount",
+			Series:         &v1.EventSeries{Count: 7, LastObservedTime: metav1.NewMicroTime(seriesSeen)},
+			Type:           v1.EventTypeWarning,
+		},
+	)
+	query := cluster.NewQuery("localhost:1234", client.CoreV1(), client.AppsV1(), client.NetworkingV1(), nil, nil)
+
+	events, err := query.AllEvents(context.Background(), "")
+	if err != nil {
+		t.Fatalf("err=%v, want nil", err)
+	}
+
+	expected := map[string]cluster.EventInfo{
+		"BackOff": {
+			Namespace: "instana-agent",
+			Kind:      "Pod",
+			Name:      "agent-abc123",
+			Reason:    "BackOff",
+			Message:   "Back-off restarting failed container",
+			Count:     4,
+			LastSeen:  lastSeen,
+		},
+		"FailedMount": {
+			Namespace: "default",
+			Kind:      "Pod",
+			Name:      "web",
+			Reason:    "FailedMount",
+			Count:     7,
+			LastSeen:  seriesSeen,
+		},
+	}
+	actual := make(map[string]cluster.EventInfo)
+	for _, ev := range events {
+		ev.LastSeen = ev.LastSeen.UTC()
+		actual[ev.Reason] = ev
+	}
+	if !cmp.Equal(expected, actual) {
+		t.Errorf("AllEvents() mismatch (-want +got):\n%s", cmp.Diff(expected, actual))
+	}
+}
@@ -13,6 +13,7 @@ func NewIndex() *Index {
 		Containers:        make(Set),
 		DaemonSets:        make(Set),
 		Deployments:       make(Set),
+		Egress:            make(map[string]EgressVerdict),
 		Namespaces:        make(Set),
 		Nodes:             make(Set),
 		Pods:              make(Set),
@@ -22,6 +23,7 @@ func NewIndex() *Index {
 		AgentStatus:       make(Counter),
 		ChartVersions:     make(Counter),
 		ContainerRuntimes: make(Counter),
+		EgressVerdicts:    make(Counter),
 		InstanceTypes:     make(Counter),
 		KernelVersions:    make(Counter),
 		KubeletVersions:   make(Counter),
@@ -39,6 +41,7 @@ type Index struct {
 	Containers        Set
 	DaemonSets        Set
 	Deployments       Set
+	Egress            map[string]EgressVerdict
 	Namespaces        Set
 	Nodes             Set
 	Pods              Set
@@ -49,6 +52,7 @@ type Index struct {
 	ChartVersions     Counter
 	CNIPlugins        Counter
 	ContainerRuntimes Counter
+	EgressVerdicts    Counter
 	InstanceTypes     Counter
 	KernelVersions    Counter
 	KubeletVersions   Counter
@@ -105,6 +109,12 @@ func (index *Index) EachNode(node NodeInfo) {
 	index.Zones.Add(node.Zone)
 }
 
+// EachEgress indexes the agent reachability verdict of a namespace.
+func (index *Index) EachEgress(verdict EgressVerdict) {
+	index.Egress[verdict.Namespace] = verdict
+	index.EgressVerdicts.Add(verdict.Verdict)
+}
+
 // EachPod extracts the relevant pod details and integrates it into the index.
 func (index *Index) EachPod(pod PodInfo) {
 	qualifiedName := fmt.Sprintf("%s/%s", pod.Namespace, pod.Name)
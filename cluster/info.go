@@ -8,11 +8,16 @@ import (
 type Applyable interface {
 	EachPod(PodInfo)
 	EachNode(NodeInfo)
+	EachEgress(EgressVerdict)
 }
 
 // Info is a data structure for relevant cluster data.
 type Info struct {
+	// SchemaVersion is the podfile schema version the info was written with.
+	SchemaVersion int
 	Name          string
+	// Context is the kubeconfig context the info was collected with.
+	Context       string `json:",omitempty"`
 	NodeCount     int
 	Nodes         []NodeInfo
 	PodCount      int
@@ -21,6 +26,13 @@ type Info struct {
 	Version       string
 	Started       time.Time
 	Finished      time.Time
+	Policies      []PolicyInfo    `json:",omitempty"`
+	Egress        []EgressVerdict `json:",omitempty"`
+	Events        []EventInfo     `json:",omitempty"`
+	// Steps are the timing and outcome of each collection step.
+	Steps []StepInfo `json:",omitempty"`
+	// Scopes are the resources collected or denied cluster-wide or by namespace.
+	Scopes []ScopeInfo `json:",omitempty"`
 }
 
 // Apply iterates over each pod and yields it to the list of applyables.
@@ -36,6 +48,12 @@ func (info *Info) Apply(applyable ...Applyable) {
 			a.EachNode(node)
 		}
 	}
+
+	for _, verdict := range info.Egress {
+		for _, a := range applyable {
+			a.EachEgress(verdict)
+		}
+	}
 }
 
 // PodInfo is summary details for a pod.
@@ -45,7 +63,9 @@ type PodInfo struct {
 	Containers       []ContainerInfo
 	LinkedConfigMaps []LinkedConfigMap
 	Host             string
+	HostNetwork      bool `json:",omitempty"`
 	IsRunning        bool
+	Labels           map[string]string `json:",omitempty"`
 	Name             string
 	Namespace        string
 	Owners           map[string]string
@@ -8,13 +8,15 @@ import (
 
 func Test_Apply(t *testing.T) {
 	testCases := map[string]struct {
-		info  cluster.Info
-		pods  int
-		nodes int
+		info   cluster.Info
+		pods   int
+		nodes  int
+		egress int
 	}{
-		"empty":    {info: cluster.Info{}, pods: 0},
-		"one pod":  {info: cluster.Info{Pods: []cluster.PodInfo{{}}}, pods: 1},
-		"one node": {info: cluster.Info{Nodes: []cluster.NodeInfo{{}}}, nodes: 1},
+		"empty":      {info: cluster.Info{}, pods: 0},
+		"one pod":    {info: cluster.Info{Pods: []cluster.PodInfo{{}}}, pods: 1},
+		"one node":   {info: cluster.Info{Nodes: []cluster.NodeInfo{{}}}, nodes: 1},
+		"one egress": {info: cluster.Info{Egress: []cluster.EgressVerdict{{}}}, egress: 1},
 	}
 
 	for name, tc := range testCases {
@@ -29,13 +31,17 @@ func Test_Apply(t *testing.T) {
 			if c.nodes != tc.nodes {
 				t.Errorf("nodes=%v, want %v", c.nodes, tc.nodes)
 			}
+			if c.egress != tc.egress {
+				t.Errorf("egress=%v, want %v", c.egress, tc.egress)
+			}
 		})
 	}
 }
 
 type counter struct {
-	pods  int
-	nodes int
+	pods   int
+	nodes  int
+	egress int
 }
 
 func (c *counter) EachPod(_ cluster.PodInfo) {
@@ -45,3 +51,7 @@ func (c *counter) EachPod(_ cluster.PodInfo) {
 func (c *counter) EachNode(_ cluster.NodeInfo) {
 	c.nodes++
 }
+
+func (c *counter) EachEgress(_ cluster.EgressVerdict) {
+	c.egress++
+}
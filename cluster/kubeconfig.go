@@ -0,0 +1,88 @@
+package cluster
+
+import (
+	"sort"
+
+	"k8s.io/client-go/rest"
+	"k8s.io/client-go/tools/clientcmd"
+)
+
+// Kubeconfig selects the cluster, user and namespace following the kubectl
+// loading rules.
+type Kubeconfig struct {
+	// Path is the kubeconfig file. When empty the files listed in KUBECONFIG
+	// are merged, falling back to ~/.kube/config and then the in-cluster
+	// config when running as a pod.
+	Path string
+	// Context overrides the current context.
+	Context string
+	// Namespace overrides the namespace of the context.
+	Namespace string
+	// As is the user to impersonate.
+	As string
+	// AsGroups are the groups to impersonate, as with kubectl they require As.
+	AsGroups []string
+}
+
+// ClientConfig builds the client config for the kubeconfig.
+func (k Kubeconfig) ClientConfig() clientcmd.ClientConfig {
+	rules := clientcmd.NewDefaultClientConfigLoadingRules()
+	rules.ExplicitPath = k.Path
+	overrides := &clientcmd.ConfigOverrides{CurrentContext: k.Context}
+	overrides.Context.Namespace = k.Namespace
+	overrides.AuthInfo.Impersonate = k.As
+	overrides.AuthInfo.ImpersonateGroups = k.AsGroups
+	return clientcmd.NewNonInteractiveDeferredLoadingClientConfig(rules, overrides)
+}
+
+// RESTConfig builds the REST config and provides the namespace selected.
+func (k Kubeconfig) RESTConfig() (*rest.Config, string, error) {
+	cc := k.ClientConfig()
+	config, err := cc.ClientConfig()
+	if err != nil {
+		return nil, "", err
+	}
+	// the in-cluster config ignores the impersonation overrides.
+	if k.As != "" {
+		config.Impersonate = rest.ImpersonationConfig{UserName: k.As, Groups: k.AsGroups}
+	}
+	namespace, _, err := cc.Namespace()
+	if err != nil {
+		return nil, "", err
+	}
+	return config, namespace, nil
+}
+
+// ContextNamespace provides the Namespace override or the namespace of the
+// selected context, blank when neither sets one.
+func (k Kubeconfig) ContextNamespace() (string, error) {
+	if k.Namespace != "" {
+		return k.Namespace, nil
+	}
+	raw, err := k.ClientConfig().RawConfig()
+	if err != nil {
+		return "", err
+	}
+	name := k.Context
+	if name == "" {
+		name = raw.CurrentContext
+	}
+	if context, ok := raw.Contexts[name]; ok {
+		return context.Namespace, nil
+	}
+	return "", nil
+}
+
+// Contexts provides the sorted names of the contexts in the kubeconfig.
+func (k Kubeconfig) Contexts() ([]string, error) {
+	raw, err := k.ClientConfig().RawConfig()
+	if err != nil {
+		return nil, err
+	}
+	var contexts []string
+	for name := range raw.Contexts {
+		contexts = append(contexts, name)
+	}
+	sort.Strings(contexts)
+	return contexts, nil
+}
@@ -0,0 +1,160 @@
+package cluster_test
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/instana/envcheck/cluster"
+	"k8s.io/client-go/rest"
+)
+
+const devKubeconfig = `apiVersion: v1
+kind: Config
+current-context: dev
+clusters:
+- name: dev
+  cluster:
+    server: https://dev.example:6443
+contexts:
+- name: dev
+  context:
+    cluster: dev
+    user: dev
+    namespace: team-a
+users:
+- name: dev
+  user:
+    token: dev-token
+`
+
+const prodKubeconfig = `apiVersion: v1
+kind: Config
+clusters:
+- name: prod
+  cluster:
+    server: https://prod.example:6443
+contexts:
+- name: prod
+  context:
+    cluster: prod
+    user: prod
+users:
+- name: prod
+  user:
+    token: prod-token
+`
+
+func Test_Kubeconfig_RESTConfig(t *testing.T) {
+	dir := t.TempDir()
+	dev := writeKubeconfig(t, dir, "dev", devKubeconfig)
+	prod := writeKubeconfig(t, dir, "prod", prodKubeconfig)
+	t.Setenv("KUBECONFIG", dev+string(os.PathListSeparator)+prod)
+
+	testCases := map[string]struct {
+		kubeconfig  cluster.Kubeconfig
+		host        string
+		namespace   string
+		impersonate rest.ImpersonationConfig
+	}{
+		"current context":    {cluster.Kubeconfig{}, "https://dev.example:6443", "team-a", rest.ImpersonationConfig{}},
+		"merged context":     {cluster.Kubeconfig{Context: "prod"}, "https://prod.example:6443", "default", rest.ImpersonationConfig{}},
+		"explicit path":      {cluster.Kubeconfig{Path: prod, Context: "prod"}, "https://prod.example:6443", "default", rest.ImpersonationConfig{}},
+		"namespace override": {cluster.Kubeconfig{Namespace: "team-b"}, "https://dev.example:6443", "team-b", rest.ImpersonationConfig{}},
+		"impersonate":        {cluster.Kubeconfig{As: "jane", AsGroups: []string{"ops"}}, "https://dev.example:6443", "team-a", rest.ImpersonationConfig{UserName: "jane", Groups: []string{"ops"}}},
+	}
+
+	for name, tc := range testCases {
+		tc := tc
+		t.Run(name, func(t *testing.T) {
+			config, namespace, err := tc.kubeconfig.RESTConfig()
+			if err != nil {
+				t.Fatalf("RESTConfig() err=%v, want nil", err)
+			}
+			if config.Host != tc.host {
+				t.Errorf("Host=%v, want %v", config.Host, tc.host)
+			}
+			if namespace != tc.namespace {
+				t.Errorf("namespace=%v, want %v", namespace, tc.namespace)
+			}
+			if !cmp.Equal(tc.impersonate, config.Impersonate) {
+				t.Errorf("Impersonate mismatch (-want +got)\n%s", cmp.Diff(tc.impersonate, config.Impersonate))
+			}
+		})
+	}
+}
+
+func Test_Kubeconfig_Contexts_should_merge_kubeconfig_paths(t *testing.T) {
+	dir := t.TempDir()
+	dev := writeKubeconfig(t, dir, "dev", devKubeconfig)
+	prod := writeKubeconfig(t, dir, "prod", prodKubeconfig)
+	t.Setenv("KUBECONFIG", prod+string(os.PathListSeparator)+dev)
+
+	contexts, err := cluster.Kubeconfig{}.Contexts()
+	if err != nil {
+		t.Fatalf("Contexts() err=%v, want nil", err)
+	}
+	expected := []string{"dev", "prod"}
+	if !cmp.Equal(expected, contexts) {
+		t.Errorf("Contexts() mismatch (-want +got)\n%s", cmp.Diff(expected, contexts))
+	}
+}
+
+func Test_Kubeconfig_ContextNamespace(t *testing.T) {
+	dir := t.TempDir()
+	dev := writeKubeconfig(t, dir, "dev", devKubeconfig)
+	prod := writeKubeconfig(t, dir, "prod", prodKubeconfig)
+	t.Setenv("KUBECONFIG", dev+string(os.PathListSeparator)+prod)
+
+	testCases := map[string]struct {
+		kubeconfig cluster.Kubeconfig
+		namespace  string
+	}{
+		"current context": {cluster.Kubeconfig{}, "team-a"},
+		"override":        {cluster.Kubeconfig{Namespace: "team-b"}, "team-b"},
+		"no namespace":    {cluster.Kubeconfig{Context: "prod"}, ""},
+	}
+	for name, tc := range testCases {
+		t.Run(name, func(t *testing.T) {
+			namespace, err := tc.kubeconfig.ContextNamespace()
+			if err != nil {
+				t.Fatalf("ContextNamespace() err=%v, want nil", err)
+			}
+			if namespace != tc.namespace {
+				t.Errorf("ContextNamespace()=%q, want %q", namespace, tc.namespace)
+			}
+		})
+	}
+}
+
+func Test_Kubeconfig_RESTConfig_errors(t *testing.T) {
+	dir := t.TempDir()
+	dev := writeKubeconfig(t, dir, "dev", devKubeconfig)
+	testCases := map[string]cluster.Kubeconfig{
+		"unknown context":     {Path: dev, Context: "missing"},
+		"groups without user": {Path: dev, AsGroups: []string{"ops"}},
+		"missing kubeconfig":  {Path: filepath.Join(dir, "missing")},
+	}
+
+	for name, kubeconfig := range testCases {
+		kubeconfig := kubeconfig
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+			_, _, err := kubeconfig.RESTConfig()
+			if err == nil {
+				t.Error("err=nil, want err")
+			}
+		})
+	}
+}
+
+func writeKubeconfig(t *testing.T, dir string, name string, content string) string {
+	t.Helper()
+	filename := filepath.Join(dir, name)
+	err := os.WriteFile(filename, []byte(content), 0600)
+	if err != nil {
+		t.Fatalf("WriteFile() err=%v, want nil", err)
+	}
+	return filename
+}
@@ -4,19 +4,24 @@ import (
 	"context"
 	"encoding/json"
 	"fmt"
+	"strconv"
 	"time"
 
 	"k8s.io/apimachinery/pkg/version"
 
+	appsv1 "k8s.io/api/apps/v1"
 	v1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/client-go/dynamic"
 	"k8s.io/client-go/kubernetes"
 	appv1 "k8s.io/client-go/kubernetes/typed/apps/v1"
 	typev1 "k8s.io/client-go/kubernetes/typed/core/v1"
+	netv1 "k8s.io/client-go/kubernetes/typed/networking/v1"
 
 	// imports all auth methods for kubernetes go client.
 	_ "k8s.io/client-go/plugin/pkg/client/auth"
-	"k8s.io/client-go/tools/clientcmd"
 )
 
 var (
@@ -27,8 +32,8 @@ var (
 )
 
 // New builds a new KubernetesQuery implementation with the given kubeconfig.
-func New(kubeconfig string) (*KubernetesQuery, error) {
-	config, err := clientcmd.BuildConfigFromFlags("", kubeconfig)
+func New(kubeconfig Kubeconfig) (*KubernetesQuery, error) {
+	config, namespace, err := kubeconfig.RESTConfig()
 	if err != nil {
 		return nil, err
 	}
@@ -39,31 +44,59 @@ func New(kubeconfig string) (*KubernetesQuery, error) {
 		return nil, err
 	}
 
-	return NewQuery(config.Host, clientset.CoreV1(), clientset.AppsV1(), clientset.ServerVersion), nil
+	dyn, err := dynamic.NewForConfig(config)
+	if err != nil {
+		return nil, err
+	}
+
+	query := NewQuery(config.Host, clientset.CoreV1(), clientset.AppsV1(), clientset.NetworkingV1(), dyn, clientset.ServerVersion)
+	query.namespace = namespace
+	return query, nil
 }
 
-// Query is a query interface for the cluster.
+// Query is a query interface for the cluster. Each method that calls the
+// api-server stops when ctx is done and retries throttled and transient errors.
 type Query interface {
-	// AllPods returns the list of pods from the related cluster.
-	AllPods() ([]PodInfo, error)
-	AllNodes() ([]NodeInfo, error)
+	// StreamPods calls fn with each pod in namespace, or all namespaces when
+	// empty, as it is listed.
+	StreamPods(ctx context.Context, namespace string, fn func(PodInfo)) error
+	AllNodes(ctx context.Context) ([]NodeInfo, error)
+	// AllEvents returns the warning events in namespace, or all namespaces when empty.
+	AllEvents(ctx context.Context, namespace string) ([]EventInfo, error)
+	// Namespaces returns the names of all namespaces.
+	Namespaces(ctx context.Context) ([]string, error)
+	// Namespace returns the namespace of the kubeconfig context.
+	Namespace() string
+	// AllPolicies returns the NetworkPolicies and any Cilium or Calico policies.
+	AllPolicies(ctx context.Context) ([]PolicyInfo, error)
 	Host() string
-	InstanaLeader() (string, error)
-	ServerVersion() (string, error)
+	InstanaLeader(ctx context.Context) (string, error)
+	ServerVersion(ctx context.Context) (string, error)
 	Time() time.Time
 }
 
-// NewQuery allocates and returns a new Query.
-func NewQuery(h string, cs typev1.CoreV1Interface, apps appv1.AppsV1Interface, version func() (*version.Info, error)) *KubernetesQuery {
-	return &KubernetesQuery{h, cs, apps, version}
+// NewQuery allocates and returns a new Query. The dynamic client is used for
+// CNI policy CRDs and may be nil to skip them.
+func NewQuery(h string, cs typev1.CoreV1Interface, apps appv1.AppsV1Interface, networking netv1.NetworkingV1Interface, dyn dynamic.Interface, version func() (*version.Info, error)) *KubernetesQuery {
+	return &KubernetesQuery{
+		host:       h,
+		core:       cs,
+		apps:       apps,
+		networking: networking,
+		dynamic:    dyn,
+		version:    version,
+	}
 }
 
 // KubernetesQuery is a concrete Kubernetes client to query various cluster info.
 type KubernetesQuery struct {
-	host    string
-	core    typev1.CoreV1Interface
-	apps    appv1.AppsV1Interface
-	version func() (*version.Info, error)
+	host       string
+	core       typev1.CoreV1Interface
+	apps       appv1.AppsV1Interface
+	networking netv1.NetworkingV1Interface
+	dynamic    dynamic.Interface
+	version    func() (*version.Info, error)
+	namespace  string
 }
 
 // Time returns the current time.
@@ -71,13 +104,46 @@ func (q *KubernetesQuery) Time() time.Time {
 	return time.Now()
 }
 
+// Namespace provides the namespace of the kubeconfig context or default when unset.
+func (q *KubernetesQuery) Namespace() string {
+	if q.namespace == "" {
+		return v1.NamespaceDefault
+	}
+	return q.namespace
+}
+
+// Namespaces retrieves the names of all namespaces.
+func (q *KubernetesQuery) Namespaces(ctx context.Context) ([]string, error) {
+	var names []string
+	err := paginate(ctx, func() { names = nil }, func(opts metav1.ListOptions) (string, error) {
+		list, err := q.core.Namespaces().List(ctx, opts)
+		if err != nil {
+			return "", err
+		}
+		for _, ns := range list.Items {
+			names = append(names, ns.Name)
+		}
+		return list.Continue, nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return names, nil
+}
+
 // Host provides the host info for the cluster.
 func (q *KubernetesQuery) Host() string {
 	return q.host
 }
 
-func (q *KubernetesQuery) ServerVersion() (string, error) {
-	info, err := q.version()
+// ServerVersion provides the api-server git version.
+func (q *KubernetesQuery) ServerVersion(ctx context.Context) (string, error) {
+	var info *version.Info
+	err := Retry(ctx, func() error {
+		var err error
+		info, err = q.version()
+		return err
+	})
 	if err != nil {
 		return "", err
 	}
@@ -85,29 +151,47 @@ func (q *KubernetesQuery) ServerVersion() (string, error) {
 }
 
 // InstanaLeader returns the instana agent leader pod name.
-func (q *KubernetesQuery) InstanaLeader() (string, error) {
-	ep, err := q.core.Endpoints("default").Get(context.TODO(), "instana", metav1.GetOptions{})
+func (q *KubernetesQuery) InstanaLeader(ctx context.Context) (string, error) {
+	lease, err := q.LeaderLease(ctx)
 	if err != nil {
 		return "", err
 	}
+	return lease.HolderIdentity, nil
+}
+
+// LeaderLease returns the lease of the instana agent leader.
+func (q *KubernetesQuery) LeaderLease(ctx context.Context) (*LeaderLease, error) {
+	var ep *v1.Endpoints
+	err := Retry(ctx, func() error {
+		var err error
+		ep, err = q.core.Endpoints("default").Get(ctx, "instana", metav1.GetOptions{})
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
 	v, ok := ep.Annotations["control-plane.alpha.kubernetes.io/leader"]
 	if !ok {
-		return "", ErrLeaderUndefined
+		return nil, ErrLeaderUndefined
 	}
 
 	var lease LeaderLease
 	err = json.Unmarshal([]byte(v), &lease)
 	if err != nil {
-		return "", ErrInvalidLeaseFormat
+		return nil, ErrInvalidLeaseFormat
 	}
 
-	return lease.HolderIdentity, nil
+	return &lease, nil
 }
 
 // LeaderLease is the lease struct for the leader elector sidecar.
 type LeaderLease struct {
 	HolderIdentity string `json:"holderIdentity"`
 	// {"holderIdentity":"instana-agent-hcdhs","leaseDurationSeconds":10,"acquireTime":"2020-06-03T19:54:57Z","renewTime":"2020-06-03T20:04:12Z","leaderTransitions":0}`
+	LeaseDurationSeconds int       `json:"leaseDurationSeconds"`
+	AcquireTime          time.Time `json:"acquireTime"`
+	RenewTime            time.Time `json:"renewTime"`
+	LeaderTransitions    int       `json:"leaderTransitions"`
 }
 
 type NodeInfo struct {
@@ -124,14 +208,14 @@ type NodeInfo struct {
 const limit = 250
 const pauseTime = 50
 
-func (q *KubernetesQuery) AllNodes() ([]NodeInfo, error) {
-	var cont string
+// AllNodes retrieves all node info from the cluster.
+func (q *KubernetesQuery) AllNodes(ctx context.Context) ([]NodeInfo, error) {
 	var nodeList []NodeInfo
 
-	for true {
-		nodes, err := q.core.Nodes().List(context.TODO(), metav1.ListOptions{Limit: limit, Continue: cont})
+	err := paginate(ctx, func() { nodeList = nil }, func(opts metav1.ListOptions) (string, error) {
+		nodes, err := q.core.Nodes().List(ctx, opts)
 		if err != nil {
-			return nil, err
+			return "", err
 		}
 
 		for _, node := range nodes.Items {
@@ -149,14 +233,11 @@ func (q *KubernetesQuery) AllNodes() ([]NodeInfo, error) {
 				Zone:             labels["topology.kubernetes.io/zone"],
 			}
 			nodeList = append(nodeList, info)
-
-		}
-
-		cont = nodes.Continue
-		if cont == "" {
-			break
 		}
-		time.Sleep(pauseTime * time.Millisecond)
+		return nodes.Continue, nil
+	})
+	if err != nil {
+		return nil, err
 	}
 
 	return nodeList, nil
@@ -168,67 +249,133 @@ type LinkedConfigMap struct {
 }
 
 // AllPods retrieves all pod info from the cluster.
-func (q *KubernetesQuery) AllPods() ([]PodInfo, error) {
-	var cont string
+func (q *KubernetesQuery) AllPods(ctx context.Context) ([]PodInfo, error) {
 	var podList []PodInfo
-	namespaces := make(map[string]bool)
+	err := q.StreamPods(ctx, "", func(pod PodInfo) {
+		podList = append(podList, pod)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return podList, nil
+}
 
-	for true {
-		pods, err := q.core.Pods("").List(context.TODO(), metav1.ListOptions{Limit: limit, Continue: cont})
+// StreamPods lists the pods in namespace, or all namespaces when empty, a
+// page at a time and calls fn with each pod so memory is bounded by the page
+// size rather than the cluster. The API server lists pods ordered by
+// namespace and name, so when a list is restarted after its continue token
+// expires the pods up to the last one passed to fn are skipped.
+func (q *KubernetesQuery) StreamPods(ctx context.Context, namespace string, fn func(PodInfo)) error {
+	var last string
+	var restarted bool
+
+	return paginate(ctx, func() { restarted = true }, func(opts metav1.ListOptions) (string, error) {
+		pods, err := q.core.Pods(namespace).List(ctx, opts)
 		if err != nil {
-			return nil, err
+			return "", err
 		}
 
-		for _, pod := range pods.Items {
-
-			info := PodInfo{
-				Annotations:  pod.Annotations,
-				ChartVersion: pod.Labels["app.kubernetes.io/version"],
-				Host:         pod.Status.HostIP,
-				IsRunning:    pod.Status.Phase == v1.PodRunning,
-				Name:         pod.Name,
-				Namespace:    pod.Namespace,
-				Owners:       make(map[string]string),
-				Status:       string(pod.Status.Phase),
-			}
-			for _, owner := range pod.OwnerReferences {
-				info.Owners[owner.Name] = owner.Kind
-			}
-			namespaces[pod.Namespace] = true
-
-			var linkedConfigMaps []LinkedConfigMap
-			for _, vol := range pod.Spec.Volumes {
-				if vol.ConfigMap != nil {
-					linkedConfigMaps = append(linkedConfigMaps, LinkedConfigMap{
-						Name:      vol.ConfigMap.Name,
-						Namespace: pod.Namespace,
-					})
-				}
+		for i := range pods.Items {
+			pod := &pods.Items[i]
+			key := pod.Namespace + "/" + pod.Name
+			if restarted && key <= last {
+				continue
 			}
+			last = key
+			fn(podInfo(pod))
+		}
+		return pods.Continue, nil
+	})
+}
 
-			var containers []ContainerInfo
-			for _, container := range pod.Spec.Containers {
-				containers = append(containers, ContainerInfo{
-					Image: container.Image,
-					Name:  container.Name,
-				})
-			}
-			for _, status := range pod.Status.ContainerStatuses {
-				info.Restarts += int(status.RestartCount)
-			}
-			info.Containers = containers
-			info.LinkedConfigMaps = linkedConfigMaps
-			podList = append(podList, info)
+func podInfo(pod *v1.Pod) PodInfo {
+	info := PodInfo{
+		Annotations:  pod.Annotations,
+		ChartVersion: pod.Labels["app.kubernetes.io/version"],
+		Host:         pod.Status.HostIP,
+		HostNetwork:  pod.Spec.HostNetwork,
+		IsRunning:    pod.Status.Phase == v1.PodRunning,
+		Labels:       pod.Labels,
+		Name:         pod.Name,
+		Namespace:    pod.Namespace,
+		Owners:       make(map[string]string),
+		Status:       string(pod.Status.Phase),
+	}
+	for _, owner := range pod.OwnerReferences {
+		info.Owners[owner.Name] = owner.Kind
+	}
+
+	for _, vol := range pod.Spec.Volumes {
+		if vol.ConfigMap != nil {
+			info.LinkedConfigMaps = append(info.LinkedConfigMaps, LinkedConfigMap{
+				Name:      vol.ConfigMap.Name,
+				Namespace: pod.Namespace,
+			})
 		}
+	}
+
+	for _, container := range pod.Spec.Containers {
+		info.Containers = append(info.Containers, ContainerInfo{
+			Image: container.Image,
+			Name:  container.Name,
+		})
+	}
+	for _, status := range pod.Status.ContainerStatuses {
+		info.Restarts += int(status.RestartCount)
+	}
+	return info
+}
 
-		cont = pods.Continue
-		if cont == "" {
-			break
+// AllPolicies retrieves the NetworkPolicies and the Cilium and Calico policies
+// when their CRDs are installed. CRDs that cannot be listed are reported as an
+// unsupported cluster wide policy rather than failing the collection.
+func (q *KubernetesQuery) AllPolicies(ctx context.Context) ([]PolicyInfo, error) {
+	var policies []PolicyInfo
+
+	err := paginate(ctx, func() { policies = nil }, func(opts metav1.ListOptions) (string, error) {
+		list, err := q.networking.NetworkPolicies("").List(ctx, opts)
+		if err != nil {
+			return "", err
+		}
+		for i := range list.Items {
+			policies = append(policies, NetworkPolicyInfo(&list.Items[i]))
 		}
-		time.Sleep(pauseTime * time.Millisecond)
+		return list.Continue, nil
+	})
+	if err != nil {
+		return nil, err
 	}
 
-	return podList, nil
+	if q.dynamic == nil {
+		return policies, nil
+	}
+	for _, crd := range policyResources {
+		var list *unstructured.UnstructuredList
+		err := Retry(ctx, func() error {
+			var err error
+			list, err = q.dynamic.Resource(crd.resource).List(ctx, metav1.ListOptions{})
+			return err
+		})
+		if errors.IsNotFound(err) {
+			continue
+		}
+		if ctx.Err() != nil {
+			return nil, ctx.Err()
+		}
+		if err != nil {
+			policies = append(policies, PolicyInfo{Kind: crd.kind, Name: "*", Egress: true, Unsupported: err.Error()})
+			continue
+		}
+		for i := range list.Items {
+			converted, err := crd.convert(crd.kind, &list.Items[i])
+			if err != nil {
+				policies = append(policies, PolicyInfo{Kind: crd.kind, Namespace: list.Items[i].GetNamespace(), Name: list.Items[i].GetName(), Egress: true, Unsupported: err.Error()})
+				continue
+			}
+			policies = append(policies, converted...)
+		}
+	}
+	return policies, nil
 }
 
 // AgentEvent represents a single K8S event associated with the agent.
@@ -249,8 +396,13 @@ type AgentInfo struct {
 }
 
 // AgentInfo queries the api-server for details about the Instana agent.
-func (q *KubernetesQuery) AgentInfo(namespace string, name string) (*AgentInfo, error) {
-	ds, err := q.apps.DaemonSets(namespace).Get(context.TODO(), name, metav1.GetOptions{})
+func (q *KubernetesQuery) AgentInfo(ctx context.Context, namespace string, name string) (*AgentInfo, error) {
+	var ds *appsv1.DaemonSet
+	err := Retry(ctx, func() error {
+		var err error
+		ds, err = q.apps.DaemonSets(namespace).Get(ctx, name, metav1.GetOptions{})
+		return err
+	})
 	if err != nil {
 		return nil, err
 	}
@@ -261,7 +413,12 @@ func (q *KubernetesQuery) AgentInfo(namespace string, name string) (*AgentInfo,
 	opts := metav1.ListOptions{
 		FieldSelector: selector.String(),
 	}
-	list, err := eventInterface.List(context.TODO(), opts)
+	var list *v1.EventList
+	err = Retry(ctx, func() error {
+		var err error
+		list, err = eventInterface.List(ctx, opts)
+		return err
+	})
 	if err != nil {
 		return nil, err
 	}
@@ -286,3 +443,67 @@ func (q *KubernetesQuery) AgentInfo(namespace string, name string) (*AgentInfo,
 	}
 	return info, nil
 }
+
+// PodResponse is the response body or error from a proxied request to a pod.
+type PodResponse struct {
+	Pod  string
+	Node string
+	Body []byte
+	Err  error
+}
+
+// ProxyPods issues a HTTP GET through the api-server pod proxy to each running
+// pod in namespace that matches the label selector.
+func (q *KubernetesQuery) ProxyPods(ctx context.Context, namespace string, selector string, port int, path string, params map[string]string) ([]PodResponse, error) {
+	pods, err := q.listPods(ctx, namespace, selector)
+	if err != nil {
+		return nil, err
+	}
+
+	var responses []PodResponse
+	for _, pod := range pods.Items {
+		if pod.Status.Phase != v1.PodRunning {
+			continue
+		}
+		resp := PodResponse{Pod: pod.Name, Node: pod.Spec.NodeName}
+		resp.Body, resp.Err = q.core.Pods(namespace).ProxyGet("http", pod.Name, strconv.Itoa(port), path, params).DoRaw(ctx)
+		responses = append(responses, resp)
+	}
+	return responses, nil
+}
+
+// PodLogs retrieves the logs of each running pod in namespace that matches the
+// label selector, pods being deleted are skipped. Only the logs written in the
+// last since are retrieved unless it is 0.
+func (q *KubernetesQuery) PodLogs(ctx context.Context, namespace string, selector string, since time.Duration) ([]PodResponse, error) {
+	pods, err := q.listPods(ctx, namespace, selector)
+	if err != nil {
+		return nil, err
+	}
+
+	var opts v1.PodLogOptions
+	if since > 0 {
+		seconds := int64(since.Seconds())
+		opts.SinceSeconds = &seconds
+	}
+	var responses []PodResponse
+	for _, pod := range pods.Items {
+		if pod.Status.Phase != v1.PodRunning || pod.DeletionTimestamp != nil {
+			continue
+		}
+		resp := PodResponse{Pod: pod.Name, Node: pod.Spec.NodeName}
+		resp.Body, resp.Err = q.core.Pods(namespace).GetLogs(pod.Name, &opts).DoRaw(ctx)
+		responses = append(responses, resp)
+	}
+	return responses, nil
+}
+
+func (q *KubernetesQuery) listPods(ctx context.Context, namespace string, selector string) (*v1.PodList, error) {
+	var pods *v1.PodList
+	err := Retry(ctx, func() error {
+		var err error
+		pods, err = q.core.Pods(namespace).List(ctx, metav1.ListOptions{LabelSelector: selector})
+		return err
+	})
+	return pods, err
+}
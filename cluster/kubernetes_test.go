@@ -1,22 +1,29 @@
 package cluster_test
 
 import (
+	"bytes"
+	"context"
+	"io"
 	"testing"
+	"time"
 
 	"github.com/google/go-cmp/cmp"
 	"github.com/instana/envcheck/cluster"
 	v1 "k8s.io/api/core/v1"
 	"k8s.io/apimachinery/pkg/api/errors"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
 	"k8s.io/client-go/kubernetes/fake"
+	"k8s.io/client-go/rest"
+	k8stesting "k8s.io/client-go/testing"
 )
 
 func Test_InstanaLeader_should_return_leader(t *testing.T) {
 	t.Parallel()
 	endpoints := v1.EndpointsList{Items: []v1.Endpoints{instanaEndpoint(`{"holderIdentity":"instana-agent-hcdhs"}`)}}
 	client := fake.NewSimpleClientset(&endpoints)
-	query := cluster.NewQuery("localhost:1234", client.CoreV1(), client.AppsV1(), nil)
-	leader, err := query.InstanaLeader()
+	query := cluster.NewQuery("localhost:1234", client.CoreV1(), client.AppsV1(), client.NetworkingV1(), nil, nil)
+	leader, err := query.InstanaLeader(context.Background())
 	if err != nil {
 		t.Errorf("query.InstanaLeader() err=%#v, want nil", err)
 	}
@@ -30,8 +37,8 @@ func Test_InstanaLeader_should_return_invalid_format_if_json_invalid(t *testing.
 	t.Parallel()
 	endpoints := v1.EndpointsList{Items: []v1.Endpoints{instanaEndpoint("foobar")}}
 	client := fake.NewSimpleClientset(&endpoints)
-	query := cluster.NewQuery("localhost:1234", client.CoreV1(), client.AppsV1(), nil)
-	_, err := query.InstanaLeader()
+	query := cluster.NewQuery("localhost:1234", client.CoreV1(), client.AppsV1(), client.NetworkingV1(), nil, nil)
+	_, err := query.InstanaLeader(context.Background())
 	if err != cluster.ErrInvalidLeaseFormat {
 		t.Errorf("query.InstanaLeader() err=%#v, want ErrInvalidLeaseFormat", err)
 	}
@@ -41,8 +48,8 @@ func Test_InstanaLeader_should_return_leader_unknown_if_none_defined(t *testing.
 	t.Parallel()
 	endpoints := v1.EndpointsList{Items: []v1.Endpoints{instanaEndpoint("")}}
 	client := fake.NewSimpleClientset(&endpoints)
-	query := cluster.NewQuery("localhost:1234", client.CoreV1(), client.AppsV1(), nil)
-	_, err := query.InstanaLeader()
+	query := cluster.NewQuery("localhost:1234", client.CoreV1(), client.AppsV1(), client.NetworkingV1(), nil, nil)
+	_, err := query.InstanaLeader(context.Background())
 	if err != cluster.ErrLeaderUndefined {
 		t.Errorf("query.InstanaLeader() err=%#v, want ErrLeaderUndefined", err)
 	}
@@ -52,8 +59,8 @@ func Test_InstanaLeader_should_error_when_no_endpoint(t *testing.T) {
 	t.Parallel()
 	endpoints := v1.EndpointsList{Items: []v1.Endpoints{}}
 	client := fake.NewSimpleClientset(&endpoints)
-	query := cluster.NewQuery("localhost:1234", client.CoreV1(), client.AppsV1(), nil)
-	_, err := query.InstanaLeader()
+	query := cluster.NewQuery("localhost:1234", client.CoreV1(), client.AppsV1(), client.NetworkingV1(), nil, nil)
+	_, err := query.InstanaLeader(context.Background())
 	_, ok := err.(*errors.StatusError)
 	if !ok {
 		t.Errorf("query.InstanaLeader() err=%#v, want StatusError NotFound", err)
@@ -64,9 +71,9 @@ func Test_AllNodes(t *testing.T) {
 	t.Parallel()
 	items := []v1.Node{awsHost()}
 	client := fake.NewSimpleClientset(&v1.NodeList{Items: items})
-	query := cluster.NewQuery("localhost:1234", client.CoreV1(), client.AppsV1(), nil)
+	query := cluster.NewQuery("localhost:1234", client.CoreV1(), client.AppsV1(), client.NetworkingV1(), nil, nil)
 
-	all, err := query.AllNodes()
+	all, err := query.AllNodes(context.Background())
 	if err != nil {
 		t.Errorf("err=%v, want nil", err)
 	}
@@ -92,9 +99,9 @@ func Test_AllPods(t *testing.T) {
 
 	client := fake.NewSimpleClientset(&v1.PodList{Items: items})
 
-	query := cluster.NewQuery("localhost:1234", client.CoreV1(), client.AppsV1(), nil)
+	query := cluster.NewQuery("localhost:1234", client.CoreV1(), client.AppsV1(), client.NetworkingV1(), nil, nil)
 
-	all, err := query.AllPods()
+	all, err := query.AllPods(context.Background())
 	if err != nil {
 		t.Errorf("err=%v, want nil", err)
 	}
@@ -121,6 +128,41 @@ func Test_AllPods(t *testing.T) {
 	}
 }
 
+func Test_StreamPods_should_skip_pods_already_streamed_when_restarted(t *testing.T) {
+	t.Parallel()
+	pod := func(namespace string, name string) v1.Pod {
+		return v1.Pod{ObjectMeta: metav1.ObjectMeta{Namespace: namespace, Name: name}}
+	}
+	pages := []*v1.PodList{
+		{ListMeta: metav1.ListMeta{Continue: "page-2"}, Items: []v1.Pod{pod("team-a", "api"), pod("team-a", "web")}},
+		nil,
+		{Items: []v1.Pod{pod("team-a", "api"), pod("team-a", "web"), pod("team-b", "api")}},
+	}
+	var calls int
+	client := fake.NewSimpleClientset()
+	client.PrependReactor("list", "pods", func(action k8stesting.Action) (bool, runtime.Object, error) {
+		page := pages[calls]
+		calls++
+		if page == nil {
+			return true, nil, errors.NewResourceExpired("continue token expired")
+		}
+		return true, page, nil
+	})
+	query := cluster.NewQuery("localhost:1234", client.CoreV1(), client.AppsV1(), client.NetworkingV1(), nil, nil)
+
+	var streamed []string
+	err := query.StreamPods(context.Background(), "", func(pod cluster.PodInfo) {
+		streamed = append(streamed, pod.Namespace+"/"+pod.Name)
+	})
+	if err != nil {
+		t.Fatalf("StreamPods() err=%v, want nil", err)
+	}
+	expected := []string{"team-a/api", "team-a/web", "team-b/api"}
+	if !cmp.Equal(expected, streamed) {
+		t.Errorf("StreamPods() mismatch (-want +got):\n%s", cmp.Diff(expected, streamed))
+	}
+}
+
 func instanaEndpoint(value string) v1.Endpoints {
 	annotations := map[string]string{
 		"k8s.instana.io/clusterid": "3babd325-b451-40df-97a5-0398d0080fe8",
@@ -182,3 +224,67 @@ func awsHost() v1.Node {
 	}
 	return node
 }
+
+func Test_ProxyPods_requests_running_pods(t *testing.T) {
+	t.Parallel()
+	running := repocheckPod("repocheck-abc12", v1.PodRunning)
+	pending := repocheckPod("repocheck-def34", v1.PodPending)
+	client := fake.NewSimpleClientset(&v1.PodList{Items: []v1.Pod{running, pending}})
+	client.PrependProxyReactor("pods", func(action k8stesting.Action) (bool, rest.ResponseWrapper, error) {
+		proxy := action.(k8stesting.ProxyGetAction)
+		return true, &stubResponse{body: []byte(proxy.GetName() + ":" + proxy.GetPort() + proxy.GetPath())}, nil
+	})
+	query := cluster.NewQuery("localhost:1234", client.CoreV1(), client.AppsV1(), client.NetworkingV1(), nil, nil)
+
+	responses, err := query.ProxyPods(context.Background(), "instana-agent", "app=repocheck", 42701, "/results", nil)
+	if err != nil {
+		t.Fatalf("err=%v, want nil", err)
+	}
+
+	expected := []cluster.PodResponse{{Pod: "repocheck-abc12", Node: "node-1", Body: []byte("repocheck-abc12:42701/results")}}
+	if !cmp.Equal(expected, responses) {
+		t.Errorf("ProxyPods() mismatch (-want +got):\n%s", cmp.Diff(expected, responses))
+	}
+}
+
+func Test_PodLogs_reads_running_pods(t *testing.T) {
+	t.Parallel()
+	running := repocheckPod("repocheck-abc12", v1.PodRunning)
+	pending := repocheckPod("repocheck-def34", v1.PodPending)
+	terminating := repocheckPod("repocheck-ghi56", v1.PodRunning)
+	terminating.DeletionTimestamp = &metav1.Time{Time: time.Now()}
+	client := fake.NewSimpleClientset(&v1.PodList{Items: []v1.Pod{running, pending, terminating}})
+	query := cluster.NewQuery("localhost:1234", client.CoreV1(), client.AppsV1(), client.NetworkingV1(), nil, nil)
+
+	responses, err := query.PodLogs(context.Background(), "instana-agent", "app=repocheck", 2*time.Minute)
+	if err != nil {
+		t.Fatalf("err=%v, want nil", err)
+	}
+
+	expected := []cluster.PodResponse{{Pod: "repocheck-abc12", Node: "node-1", Body: []byte("fake logs")}}
+	if !cmp.Equal(expected, responses) {
+		t.Errorf("PodLogs() mismatch (-want +got):\n%s", cmp.Diff(expected, responses))
+	}
+}
+
+func repocheckPod(name string, phase v1.PodPhase) v1.Pod {
+	var pod v1.Pod
+	pod.Name = name
+	pod.Namespace = "instana-agent"
+	pod.Labels = map[string]string{"app": "repocheck"}
+	pod.Spec.NodeName = "node-1"
+	pod.Status.Phase = phase
+	return pod
+}
+
+type stubResponse struct {
+	body []byte
+}
+
+func (r *stubResponse) DoRaw(context.Context) ([]byte, error) {
+	return r.body, nil
+}
+
+func (r *stubResponse) Stream(context.Context) (io.ReadCloser, error) {
+	return io.NopCloser(bytes.NewReader(r.body)), nil
+}
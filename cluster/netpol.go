@@ -0,0 +1,166 @@
+package cluster
+
+import (
+	"context"
+	"fmt"
+	"sort"
+
+	networkingv1 "k8s.io/api/networking/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+)
+
+// PolicyReport summarises a NetworkPolicy that selects a set of pods.
+type PolicyReport struct {
+	Namespace string
+	Name      string
+	Types     []string
+	// BlocksEgress indicates the policy restricts egress and no egress rule of
+	// the policies selecting the same pods allows the port to the host network.
+	BlocksEgress bool
+	Reason       string
+}
+
+func (p PolicyReport) String() string {
+	return fmt.Sprintf("%s/%s", p.Namespace, p.Name)
+}
+
+// Namespaces lists the names of the namespaces matching the label selector.
+func (kc *KubernetesCommand) Namespaces(ctx context.Context, selector string) ([]string, error) {
+	list, err := kc.CoreV1Interface.Namespaces().List(ctx, metav1.ListOptions{LabelSelector: selector})
+	if err != nil {
+		return nil, err
+	}
+
+	var namespaces []string
+	for _, ns := range list.Items {
+		namespaces = append(namespaces, ns.Name)
+	}
+	sort.Strings(namespaces)
+	return namespaces, nil
+}
+
+// NetworkPolicies lists the NetworkPolicies in namespace.
+func (kc *KubernetesCommand) NetworkPolicies(ctx context.Context, namespace string) ([]networkingv1.NetworkPolicy, error) {
+	list, err := kc.NetworkingV1Interface.NetworkPolicies(namespace).List(ctx, metav1.ListOptions{})
+	if err != nil {
+		return nil, err
+	}
+	return list.Items, nil
+}
+
+// PolicyReports reports the policies that select pods with podLabels. The
+// union of their egress rules is evaluated as the pods see it, so a policy
+// only blocks egress to the host network on port when none of the selecting
+// policies allow it.
+func PolicyReports(policies []networkingv1.NetworkPolicy, podLabels map[string]string, port int32) []PolicyReport {
+	var reports []PolicyReport
+	var egress []*PolicyInfo
+	var restricting []int
+	for i := range policies {
+		policy := &policies[i]
+		if !Selects(policy, podLabels) {
+			continue
+		}
+		_, reason := EgressAllows(policy, port)
+		reports = append(reports, PolicyReport{
+			Namespace: policy.Namespace,
+			Name:      policy.Name,
+			Types:     policyTypes(policy),
+			Reason:    reason,
+		})
+		if hasType(policy, networkingv1.PolicyTypeEgress) {
+			info := NetworkPolicyInfo(policy)
+			egress = append(egress, &info)
+			restricting = append(restricting, len(reports)-1)
+		}
+	}
+
+	if allows(egress, "", port) {
+		return reports
+	}
+	for _, i := range restricting {
+		reports[i].BlocksEgress = true
+	}
+	return reports
+}
+
+// Selects indicates whether the policy pod selector matches podLabels.
+func Selects(policy *networkingv1.NetworkPolicy, podLabels map[string]string) bool {
+	selector, err := metav1.LabelSelectorAsSelector(&policy.Spec.PodSelector)
+	if err != nil {
+		return false
+	}
+	return selector.Matches(labels.Set(podLabels))
+}
+
+// EgressAllows indicates whether the policy on its own allows TCP egress on
+// port to a host network address. Pod and namespace selector peers do not
+// match host network addresses so only rules without peers or with an ipBlock
+// peer are considered. The node addresses are unknown so a rule allowing the
+// port to an ipBlock is reported as not evaluated rather than allowed.
+func EgressAllows(policy *networkingv1.NetworkPolicy, port int32) (bool, string) {
+	info := NetworkPolicyInfo(policy)
+	if !info.Egress {
+		return true, "ingress only"
+	}
+	if len(info.Rules) == 0 {
+		return false, "denies all egress"
+	}
+	var block bool
+	for _, r := range info.Rules {
+		if !r.Matches("", port) {
+			continue
+		}
+		if len(r.Blocks) == 0 {
+			return true, "egress allowed"
+		}
+		block = true
+	}
+	if block {
+		return true, fmt.Sprintf("ipBlock allowing TCP/%d not evaluated against the nodes", port)
+	}
+	return false, fmt.Sprintf("no egress rule allows TCP/%d to an ipBlock", port)
+}
+
+// egressPeers provides the rule for the destination peers, a rule without
+// peers allows every destination.
+func egressPeers(peers []networkingv1.NetworkPolicyPeer) EgressRule {
+	if len(peers) == 0 {
+		return EgressRule{Host: true}
+	}
+	var r EgressRule
+	for _, peer := range peers {
+		if peer.IPBlock != nil {
+			r.Host = true
+			r.Blocks = append(r.Blocks, IPBlock{CIDR: peer.IPBlock.CIDR, Except: peer.IPBlock.Except})
+		}
+	}
+	return r
+}
+
+// policyTypes provides the explicit policy types or those implied by the
+// rules when none are specified.
+func policyTypes(policy *networkingv1.NetworkPolicy) []string {
+	var types []string
+	if len(policy.Spec.PolicyTypes) > 0 {
+		for _, t := range policy.Spec.PolicyTypes {
+			types = append(types, string(t))
+		}
+		return types
+	}
+	types = append(types, string(networkingv1.PolicyTypeIngress))
+	if len(policy.Spec.Egress) > 0 {
+		types = append(types, string(networkingv1.PolicyTypeEgress))
+	}
+	return types
+}
+
+func hasType(policy *networkingv1.NetworkPolicy, t networkingv1.PolicyType) bool {
+	for _, pt := range policyTypes(policy) {
+		if pt == string(t) {
+			return true
+		}
+	}
+	return false
+}
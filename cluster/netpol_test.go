@@ -0,0 +1,151 @@
+package cluster_test
+
+import (
+	"context"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/instana/envcheck/cluster"
+	corev1 "k8s.io/api/core/v1"
+	networkingv1 "k8s.io/api/networking/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/intstr"
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+func Test_EgressAllows(t *testing.T) {
+	t.Parallel()
+	udp := corev1.ProtocolUDP
+	daemonPort := intstr.FromInt(42700)
+	lowPort := intstr.FromInt(8000)
+	endPort := int32(50000)
+	namedPort := intstr.FromString("envcheck")
+	ipBlock := []networkingv1.NetworkPolicyPeer{{IPBlock: &networkingv1.IPBlock{CIDR: "10.0.0.0/8"}}}
+	podPeer := []networkingv1.NetworkPolicyPeer{{PodSelector: &metav1.LabelSelector{}}}
+
+	cases := map[string]struct {
+		spec    networkingv1.NetworkPolicySpec
+		allowed bool
+		reason  string
+	}{
+		"ingress only":        {networkingv1.NetworkPolicySpec{}, true, "ingress only"},
+		"deny all egress":     {egressSpec(nil), false, "denies all egress"},
+		"allow all egress":    {egressSpec([]networkingv1.NetworkPolicyEgressRule{{}}), true, "egress allowed"},
+		"port to ipBlock":     {egressSpec([]networkingv1.NetworkPolicyEgressRule{{To: ipBlock, Ports: []networkingv1.NetworkPolicyPort{{Port: &daemonPort}}}}), true, "ipBlock allowing TCP/42700 not evaluated against the nodes"},
+		"port range":          {egressSpec([]networkingv1.NetworkPolicyEgressRule{{Ports: []networkingv1.NetworkPolicyPort{{Port: &lowPort, EndPort: &endPort}}}}), true, "egress allowed"},
+		"other port":          {egressSpec([]networkingv1.NetworkPolicyEgressRule{{Ports: []networkingv1.NetworkPolicyPort{{Port: &lowPort}}}}), false, "no egress rule allows TCP/42700 to an ipBlock"},
+		"udp port":            {egressSpec([]networkingv1.NetworkPolicyEgressRule{{Ports: []networkingv1.NetworkPolicyPort{{Protocol: &udp, Port: &daemonPort}}}}), false, "no egress rule allows TCP/42700 to an ipBlock"},
+		"named port":          {egressSpec([]networkingv1.NetworkPolicyEgressRule{{Ports: []networkingv1.NetworkPolicyPort{{Port: &namedPort}}}}), false, "no egress rule allows TCP/42700 to an ipBlock"},
+		"pod selector peer":   {egressSpec([]networkingv1.NetworkPolicyEgressRule{{To: podPeer}}), false, "no egress rule allows TCP/42700 to an ipBlock"},
+		"inferred egress":     {networkingv1.NetworkPolicySpec{Egress: []networkingv1.NetworkPolicyEgressRule{{To: podPeer}}}, false, "no egress rule allows TCP/42700 to an ipBlock"},
+		"ingress policy type": {networkingv1.NetworkPolicySpec{PolicyTypes: []networkingv1.PolicyType{networkingv1.PolicyTypeIngress}}, true, "ingress only"},
+	}
+	for name, tc := range cases {
+		tc := tc
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+			policy := &networkingv1.NetworkPolicy{Spec: tc.spec}
+			allowed, reason := cluster.EgressAllows(policy, 42700)
+			if allowed != tc.allowed || reason != tc.reason {
+				t.Errorf("EgressAllows()=%v %q, want %v %q", allowed, reason, tc.allowed, tc.reason)
+			}
+		})
+	}
+}
+
+func Test_PolicyReports_should_only_include_selecting_policies(t *testing.T) {
+	t.Parallel()
+	podLabels := map[string]string{cluster.LabelName: cluster.PingerName}
+	policies := []networkingv1.NetworkPolicy{
+		{
+			ObjectMeta: metav1.ObjectMeta{Namespace: "team-a", Name: "default-deny"},
+			Spec:       egressSpec(nil),
+		},
+		{
+			ObjectMeta: metav1.ObjectMeta{Namespace: "team-a", Name: "frontend"},
+			Spec: networkingv1.NetworkPolicySpec{
+				PodSelector: metav1.LabelSelector{MatchLabels: map[string]string{"app": "frontend"}},
+			},
+		},
+		{
+			ObjectMeta: metav1.ObjectMeta{Namespace: "team-a", Name: "allow-ingress"},
+			Spec: networkingv1.NetworkPolicySpec{
+				PodSelector: metav1.LabelSelector{MatchLabels: podLabels},
+			},
+		},
+	}
+
+	reports := cluster.PolicyReports(policies, podLabels, 42700)
+	expected := []cluster.PolicyReport{
+		{Namespace: "team-a", Name: "default-deny", Types: []string{"Egress"}, BlocksEgress: true, Reason: "denies all egress"},
+		{Namespace: "team-a", Name: "allow-ingress", Types: []string{"Ingress"}, Reason: "ingress only"},
+	}
+	if !cmp.Equal(expected, reports) {
+		t.Errorf("PolicyReports() mismatch (-want +got)\n%s", cmp.Diff(expected, reports))
+	}
+}
+
+func Test_PolicyReports_should_evaluate_the_union_of_selecting_policies(t *testing.T) {
+	t.Parallel()
+	podLabels := map[string]string{cluster.LabelName: cluster.PingerName}
+	daemonPort := intstr.FromInt(42700)
+	cases := map[string]struct {
+		allow    []networkingv1.NetworkPolicyEgressRule
+		expected []cluster.PolicyReport
+	}{
+		"allowed by another policy": {
+			[]networkingv1.NetworkPolicyEgressRule{{Ports: []networkingv1.NetworkPolicyPort{{Port: &daemonPort}}}},
+			[]cluster.PolicyReport{
+				{Namespace: "team-a", Name: "default-deny", Types: []string{"Egress"}, Reason: "denies all egress"},
+				{Namespace: "team-a", Name: "allow-daemon", Types: []string{"Egress"}, Reason: "egress allowed"},
+			},
+		},
+		"denied by all policies": {
+			[]networkingv1.NetworkPolicyEgressRule{{Ports: []networkingv1.NetworkPolicyPort{{Port: &daemonPort}}, To: []networkingv1.NetworkPolicyPeer{{PodSelector: &metav1.LabelSelector{}}}}},
+			[]cluster.PolicyReport{
+				{Namespace: "team-a", Name: "default-deny", Types: []string{"Egress"}, BlocksEgress: true, Reason: "denies all egress"},
+				{Namespace: "team-a", Name: "allow-daemon", Types: []string{"Egress"}, BlocksEgress: true, Reason: "no egress rule allows TCP/42700 to an ipBlock"},
+			},
+		},
+	}
+	for name, tc := range cases {
+		tc := tc
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+			policies := []networkingv1.NetworkPolicy{
+				{ObjectMeta: metav1.ObjectMeta{Namespace: "team-a", Name: "default-deny"}, Spec: egressSpec(nil)},
+				{ObjectMeta: metav1.ObjectMeta{Namespace: "team-a", Name: "allow-daemon"}, Spec: egressSpec(tc.allow)},
+			}
+			reports := cluster.PolicyReports(policies, podLabels, 42700)
+			if !cmp.Equal(tc.expected, reports) {
+				t.Errorf("PolicyReports() mismatch (-want +got)\n%s", cmp.Diff(tc.expected, reports))
+			}
+		})
+	}
+}
+
+func Test_Namespaces_should_filter_by_selector(t *testing.T) {
+	t.Parallel()
+	client := fake.NewSimpleClientset(
+		&corev1.Namespace{ObjectMeta: metav1.ObjectMeta{Name: "team-b", Labels: map[string]string{"team": "x"}}},
+		&corev1.Namespace{ObjectMeta: metav1.ObjectMeta{Name: "team-a", Labels: map[string]string{"team": "x"}}},
+		&corev1.Namespace{ObjectMeta: metav1.ObjectMeta{Name: "kube-system"}},
+	)
+	command := &cluster.KubernetesCommand{CoreV1Interface: client.CoreV1(), NetworkingV1Interface: client.NetworkingV1()}
+
+	namespaces, err := command.Namespaces(context.Background(), "team=x")
+	if err != nil {
+		t.Fatalf("Namespaces() err=%v, want nil", err)
+	}
+	expected := []string{"team-a", "team-b"}
+	if !cmp.Equal(expected, namespaces) {
+		t.Errorf("Namespaces() mismatch (-want +got)\n%s", cmp.Diff(expected, namespaces))
+	}
+}
+
+func egressSpec(egress []networkingv1.NetworkPolicyEgressRule) networkingv1.NetworkPolicySpec {
+	return networkingv1.NetworkPolicySpec{
+		PolicyTypes: []networkingv1.PolicyType{networkingv1.PolicyTypeEgress},
+		Egress:      egress,
+	}
+}
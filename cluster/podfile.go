@@ -0,0 +1,278 @@
+package cluster
+
+import (
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strings"
+)
+
+// PodfileSchemaVersion is the schema version of the podfiles written. Podfiles
+// without a version predate versioning and are version 0.
+const PodfileSchemaVersion = 1
+
+const (
+	// podsKey is the Info field holding the pods in a podfile.
+	podsKey = "Pods"
+	// schemaVersionKey is the Info field holding the podfile schema version.
+	schemaVersionKey = "SchemaVersion"
+)
+
+var (
+	gzipMagic = []byte{0x1f, 0x8b}
+	zstdMagic = []byte{0x28, 0xb5, 0x2f, 0xfd}
+)
+
+// migrations upgrade an Info from the schema version at their index to the
+// next version given the number of pods decoded.
+var migrations = []func(info *Info, pods int){
+	// version 0 podfiles could omit the counts.
+	func(info *Info, pods int) {
+		if info.PodCount == 0 {
+			info.PodCount = pods
+		}
+		if info.NodeCount == 0 {
+			info.NodeCount = len(info.Nodes)
+		}
+	},
+}
+
+// NewPodfileWriter builds a podfile writer that encodes pods to w as they are
+// applied rather than holding them in memory. The podfile is gzip compressed
+// when compress is true.
+func NewPodfileWriter(w io.Writer, compress bool) *PodfileWriter {
+	pw := &PodfileWriter{}
+	if compress {
+		pw.gz = gzip.NewWriter(w)
+		w = pw.gz
+	}
+	pw.w = bufio.NewWriter(w)
+	return pw
+}
+
+// PodfileWriter incrementally encodes an Info to a podfile. The schema version
+// and pods are written first with the pods written as they are received and
+// the remaining fields on Close.
+type PodfileWriter struct {
+	w     *bufio.Writer
+	gz    *gzip.Writer
+	count int
+	err   error
+}
+
+// EachPod encodes the pod as the next element of the pods array.
+func (pw *PodfileWriter) EachPod(pod PodInfo) {
+	if pw.err != nil {
+		return
+	}
+	b, err := json.Marshal(pod)
+	if err != nil {
+		pw.err = err
+		return
+	}
+	if pw.count == 0 {
+		pw.begin()
+	} else {
+		pw.write(",")
+	}
+	pw.write(string(b))
+	pw.count++
+}
+
+// EachNode is a no-op as nodes are written with the remaining fields on Close.
+func (pw *PodfileWriter) EachNode(_ NodeInfo) {}
+
+// EachEgress is a no-op as verdicts are written with the remaining fields on Close.
+func (pw *PodfileWriter) EachEgress(_ EgressVerdict) {}
+
+// Close terminates the pods array, writes the fields of info other than its
+// pods and flushes the podfile. The info is stamped with the schema version
+// written. It returns the first error encountered.
+func (pw *PodfileWriter) Close(info *Info) error {
+	if pw.err != nil {
+		return pw.err
+	}
+	info.SchemaVersion = PodfileSchemaVersion
+	if pw.count == 0 {
+		pw.begin()
+	}
+	pw.write("]")
+
+	b, err := json.Marshal(info)
+	if err != nil {
+		return err
+	}
+	var fields map[string]json.RawMessage
+	err = json.Unmarshal(b, &fields)
+	if err != nil {
+		return err
+	}
+	delete(fields, podsKey)
+	delete(fields, schemaVersionKey)
+	b, err = json.Marshal(fields)
+	if err != nil {
+		return err
+	}
+	// the remaining fields follow the pods in the same object.
+	pw.write(",")
+	pw.write(string(b[1:]))
+	pw.write("\n")
+
+	if pw.err != nil {
+		return pw.err
+	}
+	err = pw.w.Flush()
+	if err != nil {
+		return err
+	}
+	if pw.gz != nil {
+		return pw.gz.Close()
+	}
+	return nil
+}
+
+func (pw *PodfileWriter) begin() {
+	pw.write(fmt.Sprintf(`{"%s":%d,"%s":[`, schemaVersionKey, PodfileSchemaVersion, podsKey))
+}
+
+func (pw *PodfileWriter) write(s string) {
+	if pw.err != nil {
+		return
+	}
+	_, pw.err = pw.w.WriteString(s)
+}
+
+// DecodePodfile decodes the podfile from r yielding each pod to the
+// applyables as it is decoded. Gzip compressed podfiles are detected and
+// podfiles from older schema versions are migrated to the current version.
+// The returned Info has every field except its pods.
+func DecodePodfile(r io.Reader, applyable ...Applyable) (*Info, error) {
+	r, err := decompress(r)
+	if err != nil {
+		return nil, err
+	}
+
+	dec := json.NewDecoder(r)
+	err = expectDelim(dec, '{')
+	if err != nil {
+		return nil, err
+	}
+
+	var pods int
+	fields := make(map[string]json.RawMessage)
+	for dec.More() {
+		tok, err := dec.Token()
+		if err != nil {
+			return nil, err
+		}
+		key, ok := tok.(string)
+		if !ok {
+			return nil, fmt.Errorf("podfile: unexpected token %v, want field name", tok)
+		}
+		if strings.EqualFold(key, podsKey) {
+			pods, err = decodePods(dec, applyable)
+		} else {
+			var raw json.RawMessage
+			err = dec.Decode(&raw)
+			fields[key] = raw
+		}
+		if err != nil {
+			return nil, err
+		}
+		// the version precedes the pods so newer podfiles are rejected before streaming them.
+		if strings.EqualFold(key, schemaVersionKey) {
+			err = checkVersion(fields[key])
+			if err != nil {
+				return nil, err
+			}
+		}
+	}
+	err = expectDelim(dec, '}')
+	if err != nil {
+		return nil, err
+	}
+
+	var info Info
+	b, err := json.Marshal(fields)
+	if err != nil {
+		return nil, err
+	}
+	err = json.Unmarshal(b, &info)
+	if err != nil {
+		return nil, err
+	}
+
+	for v := info.SchemaVersion; v < PodfileSchemaVersion; v++ {
+		migrations[v](&info, pods)
+	}
+	info.SchemaVersion = PodfileSchemaVersion
+	return &info, nil
+}
+
+// decompress detects a compressed podfile and provides its decompressed reader.
+func decompress(r io.Reader) (io.Reader, error) {
+	br := bufio.NewReader(r)
+	magic, _ := br.Peek(len(zstdMagic))
+	switch {
+	case bytes.HasPrefix(magic, gzipMagic):
+		return gzip.NewReader(br)
+	case bytes.HasPrefix(magic, zstdMagic):
+		return nil, fmt.Errorf("podfile: zstd compression is not supported, decompress with zstd -d first")
+	}
+	return br, nil
+}
+
+func checkVersion(raw json.RawMessage) error {
+	var version int
+	err := json.Unmarshal(raw, &version)
+	if err != nil {
+		return fmt.Errorf("podfile: invalid schema version %s", raw)
+	}
+	if version < 0 || version > PodfileSchemaVersion {
+		return fmt.Errorf("podfile: schema version %d is not supported, upgrade envcheckctl to read schema versions up to %d", version, PodfileSchemaVersion)
+	}
+	return nil
+}
+
+func decodePods(dec *json.Decoder, applyable []Applyable) (int, error) {
+	tok, err := dec.Token()
+	if err != nil {
+		return 0, err
+	}
+	if tok == nil {
+		return 0, nil
+	}
+	if delim, ok := tok.(json.Delim); !ok || delim != '[' {
+		return 0, fmt.Errorf("podfile: unexpected token %v, want [", tok)
+	}
+	var count int
+	for dec.More() {
+		var pod PodInfo
+		err = dec.Decode(&pod)
+		if err != nil {
+			return count, err
+		}
+		count++
+		for _, a := range applyable {
+			a.EachPod(pod)
+		}
+	}
+	return count, expectDelim(dec, ']')
+}
+
+func expectDelim(dec *json.Decoder, want json.Delim) error {
+	tok, err := dec.Token()
+	if err == io.EOF {
+		return io.ErrUnexpectedEOF
+	}
+	if err != nil {
+		return err
+	}
+	if delim, ok := tok.(json.Delim); !ok || delim != want {
+		return fmt.Errorf("podfile: unexpected token %v, want %v", tok, want)
+	}
+	return nil
+}
@@ -0,0 +1,176 @@
+package cluster_test
+
+import (
+	"bytes"
+	"compress/gzip"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/instana/envcheck/cluster"
+)
+
+func Test_PodfileWriter_round_trip(t *testing.T) {
+	testCases := map[string]struct {
+		pods     []cluster.PodInfo
+		compress bool
+	}{
+		"no pods":             {},
+		"one pod":             {pods: []cluster.PodInfo{{Name: "agent-1", Namespace: "instana-agent"}}},
+		"two pods":            {pods: []cluster.PodInfo{{Name: "agent-1", Namespace: "instana-agent"}, {Name: "web", Namespace: "default", Restarts: 3}}},
+		"compressed no pods":  {compress: true},
+		"compressed two pods": {pods: []cluster.PodInfo{{Name: "agent-1", Namespace: "instana-agent"}, {Name: "web", Namespace: "default"}}, compress: true},
+	}
+
+	for name, tc := range testCases {
+		tc := tc
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+			info := &cluster.Info{
+				Name:      "https://localhost:6443",
+				NodeCount: 1,
+				Nodes:     []cluster.NodeInfo{{Name: "node-1"}},
+				PodCount:  len(tc.pods),
+				Started:   time.Unix(1589217975, 0).UTC(),
+				Egress:    []cluster.EgressVerdict{{Namespace: "default", Verdict: cluster.EgressAllowed}},
+			}
+
+			var buf bytes.Buffer
+			w := cluster.NewPodfileWriter(&buf, tc.compress)
+			for _, pod := range tc.pods {
+				w.EachPod(pod)
+			}
+			err := w.Close(info)
+			if err != nil {
+				t.Fatalf("Close() err=%v, want nil", err)
+			}
+			if json.Valid(buf.Bytes()) == tc.compress {
+				t.Fatalf("json.Valid()=%v, want %v", !tc.compress, tc.compress)
+			}
+
+			collected := &collector{}
+			actual, err := cluster.DecodePodfile(&buf, collected)
+			if err != nil {
+				t.Fatalf("DecodePodfile() err=%v, want nil", err)
+			}
+			if actual.SchemaVersion != cluster.PodfileSchemaVersion {
+				t.Errorf("SchemaVersion=%d, want %d", actual.SchemaVersion, cluster.PodfileSchemaVersion)
+			}
+			if !cmp.Equal(info, actual) {
+				t.Errorf("DecodePodfile() mismatch (-want +got):\n%s", cmp.Diff(info, actual))
+			}
+			if !cmp.Equal(tc.pods, collected.pods) {
+				t.Errorf("pods mismatch (-want +got):\n%s", cmp.Diff(tc.pods, collected.pods))
+			}
+		})
+	}
+}
+
+func Test_PodfileWriter_should_write_schema_version_first(t *testing.T) {
+	t.Parallel()
+	var buf bytes.Buffer
+	w := cluster.NewPodfileWriter(&buf, false)
+	w.EachPod(cluster.PodInfo{Name: "a"})
+	err := w.Close(&cluster.Info{})
+	if err != nil {
+		t.Fatalf("Close() err=%v, want nil", err)
+	}
+
+	prefix := fmt.Sprintf(`{"SchemaVersion":%d,"Pods":[{`, cluster.PodfileSchemaVersion)
+	if !strings.HasPrefix(buf.String(), prefix) {
+		t.Errorf("podfile=%s, want prefix %s", buf.String(), prefix)
+	}
+}
+
+func Test_DecodePodfile_should_migrate_unversioned_podfiles(t *testing.T) {
+	t.Parallel()
+	var buf bytes.Buffer
+	gz := gzip.NewWriter(&buf)
+	_, _ = gz.Write([]byte(`{"Name":"c1","Nodes":[{"Name":"n1"}],"Pods":[{"Name":"a"},{"Name":"b"}]}`))
+	gz.Close()
+
+	info, err := cluster.DecodePodfile(&buf)
+	if err != nil {
+		t.Fatalf("DecodePodfile() err=%v, want nil", err)
+	}
+	expected := &cluster.Info{
+		SchemaVersion: cluster.PodfileSchemaVersion,
+		Name:          "c1",
+		NodeCount:     1,
+		Nodes:         []cluster.NodeInfo{{Name: "n1"}},
+		PodCount:      2,
+	}
+	if !cmp.Equal(expected, info) {
+		t.Errorf("DecodePodfile() mismatch (-want +got):\n%s", cmp.Diff(expected, info))
+	}
+}
+
+func Test_DecodePodfile(t *testing.T) {
+	testCases := map[string]struct {
+		podfile string
+		name    string
+		pods    int
+	}{
+		"pods first": {podfile: `{"Pods":[{"Name":"a"},{"Name":"b"}],"Name":"c1"}`, name: "c1", pods: 2},
+		"pods last":  {podfile: `{"Name":"c1","PodCount":1,"Pods":[{"Name":"a"}]}`, name: "c1", pods: 1},
+		"null pods":  {podfile: `{"Name":"c1","Pods":null}`, name: "c1"},
+		"no pods":    {podfile: `{"Name":"c1"}`, name: "c1"},
+	}
+
+	for name, tc := range testCases {
+		tc := tc
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+			c := &counter{}
+			info, err := cluster.DecodePodfile(strings.NewReader(tc.podfile), c)
+			if err != nil {
+				t.Fatalf("DecodePodfile() err=%v, want nil", err)
+			}
+			if info.Name != tc.name {
+				t.Errorf("info.Name=%v, want %v", info.Name, tc.name)
+			}
+			if c.pods != tc.pods {
+				t.Errorf("pods=%v, want %v", c.pods, tc.pods)
+			}
+		})
+	}
+}
+
+func Test_DecodePodfile_errors_with_invalid_json(t *testing.T) {
+	testCases := map[string]string{
+		"empty":         ``,
+		"truncated":     `{"Name":"c1","Pods":[{"Name":"a"}`,
+		"array":         `[]`,
+		"invalid pods":  `{"Pods":{}}`,
+		"missing value": `{"bloop"`,
+		"newer version": `{"SchemaVersion":99,"Pods":[{"Name":"a"}]}`,
+		"zstd":          "\x28\xb5\x2f\xfd\x00\x00",
+		"corrupt gzip":  "\x1f\x8b\x08\x00garbage",
+	}
+
+	for name, podfile := range testCases {
+		podfile := podfile
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+			_, err := cluster.DecodePodfile(strings.NewReader(podfile))
+			if err == nil {
+				t.Error("err=nil, want json err")
+			}
+		})
+	}
+}
+
+type collector struct {
+	pods []cluster.PodInfo
+}
+
+func (c *collector) EachPod(pod cluster.PodInfo) {
+	c.pods = append(c.pods, pod)
+}
+
+func (c *collector) EachNode(_ cluster.NodeInfo) {}
+
+func (c *collector) EachEgress(_ cluster.EgressVerdict) {}
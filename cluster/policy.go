@@ -0,0 +1,506 @@
+package cluster
+
+import (
+	"encoding/json"
+	"fmt"
+	"net"
+	"strconv"
+	"strings"
+
+	v1 "k8s.io/api/core/v1"
+	networkingv1 "k8s.io/api/networking/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/util/intstr"
+)
+
+const (
+	// KindNetworkPolicy is the kind of a networking.k8s.io/v1 NetworkPolicy.
+	KindNetworkPolicy = "NetworkPolicy"
+	// KindCiliumNetworkPolicy is the kind of a cilium.io/v2 CiliumNetworkPolicy.
+	KindCiliumNetworkPolicy = "CiliumNetworkPolicy"
+	// KindCiliumClusterwideNetworkPolicy is the kind of a cilium.io/v2 CiliumClusterwideNetworkPolicy.
+	KindCiliumClusterwideNetworkPolicy = "CiliumClusterwideNetworkPolicy"
+	// KindCalicoNetworkPolicy is the kind of a crd.projectcalico.org/v1 NetworkPolicy.
+	KindCalicoNetworkPolicy = "CalicoNetworkPolicy"
+	// KindCalicoGlobalNetworkPolicy is the kind of a crd.projectcalico.org/v1 GlobalNetworkPolicy.
+	KindCalicoGlobalNetworkPolicy = "CalicoGlobalNetworkPolicy"
+
+	// ciliumNamespaceLabel is the label Cilium adds to endpoints for their namespace.
+	ciliumNamespaceLabel = "io.kubernetes.pod.namespace"
+	// calicoNamespaceLabel is the label Calico adds to endpoints for their namespace.
+	calicoNamespaceLabel = "projectcalico.org/namespace"
+)
+
+// policyResource is a policy CRD and the conversion to PolicyInfo.
+type policyResource struct {
+	kind     string
+	resource schema.GroupVersionResource
+	convert  func(kind string, item *unstructured.Unstructured) ([]PolicyInfo, error)
+}
+
+// policyResources are the CNI policy CRDs collected when installed.
+var policyResources = []policyResource{
+	{KindCiliumNetworkPolicy, schema.GroupVersionResource{Group: "cilium.io", Version: "v2", Resource: "ciliumnetworkpolicies"}, CiliumPolicyInfo},
+	{KindCiliumClusterwideNetworkPolicy, schema.GroupVersionResource{Group: "cilium.io", Version: "v2", Resource: "ciliumclusterwidenetworkpolicies"}, CiliumPolicyInfo},
+	{KindCalicoNetworkPolicy, schema.GroupVersionResource{Group: "crd.projectcalico.org", Version: "v1", Resource: "networkpolicies"}, CalicoPolicyInfo},
+	{KindCalicoGlobalNetworkPolicy, schema.GroupVersionResource{Group: "crd.projectcalico.org", Version: "v1", Resource: "globalnetworkpolicies"}, CalicoPolicyInfo},
+}
+
+// PolicyInfo is a NetworkPolicy, Cilium or Calico policy normalised to the
+// egress rules that affect traffic from pods to their node.
+type PolicyInfo struct {
+	Kind string
+	// Namespace is empty for cluster wide policies.
+	Namespace string `json:",omitempty"`
+	Name      string
+	// Selector is the pod label selector in the k8s selector syntax.
+	Selector string `json:",omitempty"`
+	// Egress indicates the policy restricts egress of the selected pods.
+	Egress bool
+	Rules  []EgressRule `json:",omitempty"`
+	// Unsupported is the reason the policy cannot be evaluated.
+	Unsupported string `json:",omitempty"`
+}
+
+func (p PolicyInfo) String() string {
+	return p.Kind + "/" + p.Name
+}
+
+// EgressRule is a single egress rule of a policy.
+type EgressRule struct {
+	Deny bool `json:",omitempty"`
+	// Host indicates the rule destination can include the node address.
+	Host bool
+	// Blocks limit the destination to the node addresses they contain when set.
+	Blocks []IPBlock `json:",omitempty"`
+	// Ports is empty when the rule applies to all ports.
+	Ports []PortRange `json:",omitempty"`
+}
+
+// Matches indicates whether the rule applies to TCP traffic on port to the
+// node with the address host.
+func (r EgressRule) Matches(host string, port int32) bool {
+	if !r.Host || !r.Covers(host) {
+		return false
+	}
+	if len(r.Ports) == 0 {
+		return true
+	}
+	for _, p := range r.Ports {
+		if p.Matches(port) {
+			return true
+		}
+	}
+	return false
+}
+
+// Covers indicates whether the node address host is in one of the ipBlocks of
+// the rule. A rule without ipBlocks covers every node and a node with an
+// unknown address is assumed to be covered.
+func (r EgressRule) Covers(host string) bool {
+	ip := net.ParseIP(host)
+	if len(r.Blocks) == 0 || ip == nil {
+		return true
+	}
+	for _, b := range r.Blocks {
+		if b.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+// IPBlock is a CIDR with the CIDRs excluded from it.
+type IPBlock struct {
+	CIDR   string
+	Except []string `json:",omitempty"`
+}
+
+// Contains indicates whether ip is in the CIDR and none of the exceptions.
+func (b IPBlock) Contains(ip net.IP) bool {
+	if !cidrContains(b.CIDR, ip) {
+		return false
+	}
+	for _, except := range b.Except {
+		if cidrContains(except, ip) {
+			return false
+		}
+	}
+	return true
+}
+
+func cidrContains(cidr string, ip net.IP) bool {
+	_, network, err := net.ParseCIDR(cidr)
+	if err != nil {
+		return false
+	}
+	return network.Contains(ip)
+}
+
+// PortRange is a port or range of ports for a protocol, a zero Port matches all ports.
+type PortRange struct {
+	Protocol string `json:",omitempty"`
+	Port     int32  `json:",omitempty"`
+	EndPort  int32  `json:",omitempty"`
+	// Name is a named container port which never matches the node.
+	Name string `json:",omitempty"`
+}
+
+// Matches indicates whether the range includes TCP port.
+func (p PortRange) Matches(port int32) bool {
+	if p.Name != "" {
+		return false
+	}
+	switch strings.ToUpper(p.Protocol) {
+	case "", "ANY", string(v1.ProtocolTCP), "6":
+	default:
+		return false
+	}
+	if p.Port == 0 {
+		return true
+	}
+	end := p.Port
+	if p.EndPort > end {
+		end = p.EndPort
+	}
+	return port >= p.Port && port <= end
+}
+
+// Allows indicates whether an allow rule and no deny rule matches TCP
+// traffic on port to the node with the address host. Policies that do not
+// restrict egress allow all.
+func (p *PolicyInfo) Allows(host string, port int32) bool {
+	if !p.Egress {
+		return true
+	}
+	return allows([]*PolicyInfo{p}, host, port)
+}
+
+// hasBlocks indicates whether a rule of the policy depends on the node address.
+func (p *PolicyInfo) hasBlocks() bool {
+	for _, r := range p.Rules {
+		if len(r.Blocks) > 0 {
+			return true
+		}
+	}
+	return false
+}
+
+// NetworkPolicyInfo normalises a networking.k8s.io/v1 NetworkPolicy. Pod and
+// namespace selector peers never match the node, ipBlock peers match the node
+// addresses in their CIDR and not in its exceptions.
+func NetworkPolicyInfo(policy *networkingv1.NetworkPolicy) PolicyInfo {
+	info := PolicyInfo{
+		Kind:      KindNetworkPolicy,
+		Namespace: policy.Namespace,
+		Name:      policy.Name,
+		Egress:    hasType(policy, networkingv1.PolicyTypeEgress),
+	}
+	selector, err := metav1.LabelSelectorAsSelector(&policy.Spec.PodSelector)
+	if err != nil {
+		info.Unsupported = err.Error()
+		return info
+	}
+	info.Selector = selector.String()
+
+	for _, rule := range policy.Spec.Egress {
+		r := egressPeers(rule.To)
+		for _, p := range rule.Ports {
+			var pr PortRange
+			if p.Protocol != nil {
+				pr.Protocol = string(*p.Protocol)
+			}
+			if p.Port != nil {
+				if p.Port.Type == intstr.String {
+					pr.Name = p.Port.StrVal
+				}
+				pr.Port = p.Port.IntVal
+			}
+			if p.EndPort != nil {
+				pr.EndPort = *p.EndPort
+			}
+			r.Ports = append(r.Ports, pr)
+		}
+		info.Rules = append(info.Rules, r)
+	}
+	return info
+}
+
+// ciliumPolicy is the subset of a Cilium policy evaluated for node egress.
+type ciliumPolicy struct {
+	Metadata metav1.ObjectMeta `json:"metadata"`
+	Spec     *ciliumRule       `json:"spec"`
+	Specs    []ciliumRule      `json:"specs"`
+}
+
+type ciliumRule struct {
+	EndpointSelector *metav1.LabelSelector `json:"endpointSelector"`
+	NodeSelector     *metav1.LabelSelector `json:"nodeSelector"`
+	Egress           []ciliumEgress        `json:"egress"`
+	EgressDeny       []ciliumEgress        `json:"egressDeny"`
+}
+
+type ciliumEgress struct {
+	ToEntities []string `json:"toEntities"`
+	ToPorts    []struct {
+		Ports []struct {
+			Port     string `json:"port"`
+			EndPort  int32  `json:"endPort"`
+			Protocol string `json:"protocol"`
+		} `json:"ports"`
+	} `json:"toPorts"`
+}
+
+// CiliumPolicyInfo normalises a CiliumNetworkPolicy or CiliumClusterwideNetworkPolicy
+// with a PolicyInfo for each of its rules. Only the host, cluster and all
+// entities match the node, Cilium CIDR rules never select cluster nodes.
+func CiliumPolicyInfo(kind string, item *unstructured.Unstructured) ([]PolicyInfo, error) {
+	b, err := item.MarshalJSON()
+	if err != nil {
+		return nil, err
+	}
+	var policy ciliumPolicy
+	err = json.Unmarshal(b, &policy)
+	if err != nil {
+		return nil, err
+	}
+
+	rules := policy.Specs
+	if policy.Spec != nil {
+		rules = append([]ciliumRule{*policy.Spec}, rules...)
+	}
+
+	var infos []PolicyInfo
+	for i, rule := range rules {
+		info := PolicyInfo{
+			Kind:      kind,
+			Namespace: policy.Metadata.Namespace,
+			Name:      policy.Metadata.Name,
+			Egress:    rule.Egress != nil || rule.EgressDeny != nil,
+		}
+		if len(rules) > 1 {
+			info.Name = fmt.Sprintf("%s[%d]", info.Name, i)
+		}
+		if rule.EndpointSelector == nil {
+			// node selector rules are host policies and do not apply to pods.
+			continue
+		}
+		info.Selector, err = ciliumSelector(rule.EndpointSelector)
+		if err != nil {
+			info.Unsupported = err.Error()
+		}
+		for _, deny := range []bool{false, true} {
+			egress := rule.Egress
+			if deny {
+				egress = rule.EgressDeny
+			}
+			for _, e := range egress {
+				info.Rules = append(info.Rules, ciliumEgressRule(e, deny))
+			}
+		}
+		infos = append(infos, info)
+	}
+	return infos, nil
+}
+
+func ciliumEgressRule(e ciliumEgress, deny bool) EgressRule {
+	r := EgressRule{Deny: deny}
+	for _, entity := range e.ToEntities {
+		switch entity {
+		case "host", "cluster", "all":
+			r.Host = true
+		}
+	}
+	for _, tp := range e.ToPorts {
+		for _, p := range tp.Ports {
+			pr := PortRange{Protocol: p.Protocol, EndPort: p.EndPort}
+			port, err := strconv.Atoi(p.Port)
+			if err != nil {
+				pr.Name = p.Port
+			}
+			pr.Port = int32(port)
+			r.Ports = append(r.Ports, pr)
+		}
+	}
+	return r
+}
+
+// ciliumSelector converts an endpoint selector to the k8s selector syntax
+// dropping the k8s: and any: label source prefixes.
+func ciliumSelector(selector *metav1.LabelSelector) (string, error) {
+	trim := func(key string) string {
+		return strings.TrimPrefix(strings.TrimPrefix(key, "k8s:"), "any:")
+	}
+	converted := &metav1.LabelSelector{MatchLabels: make(map[string]string)}
+	for k, v := range selector.MatchLabels {
+		converted.MatchLabels[trim(k)] = v
+	}
+	for _, expr := range selector.MatchExpressions {
+		expr.Key = trim(expr.Key)
+		converted.MatchExpressions = append(converted.MatchExpressions, expr)
+	}
+	s, err := metav1.LabelSelectorAsSelector(converted)
+	if err != nil {
+		return "", err
+	}
+	return s.String(), nil
+}
+
+// calicoPolicy is the subset of a Calico policy evaluated for node egress.
+type calicoPolicy struct {
+	Metadata metav1.ObjectMeta `json:"metadata"`
+	Spec     struct {
+		Selector          string       `json:"selector"`
+		NamespaceSelector string       `json:"namespaceSelector"`
+		Types             []string     `json:"types"`
+		Egress            []calicoRule `json:"egress"`
+	} `json:"spec"`
+}
+
+type calicoRule struct {
+	Action      string              `json:"action"`
+	Protocol    *intstr.IntOrString `json:"protocol"`
+	Destination struct {
+		Selector          string               `json:"selector"`
+		NamespaceSelector string               `json:"namespaceSelector"`
+		ServiceAccounts   json.RawMessage      `json:"serviceAccounts"`
+		Services          json.RawMessage      `json:"services"`
+		Ports             []intstr.IntOrString `json:"ports"`
+	} `json:"destination"`
+}
+
+// CalicoPolicyInfo normalises a Calico NetworkPolicy or GlobalNetworkPolicy.
+// Destinations with a selector, namespace selector, service account or service
+// never match the node. Log and Pass actions and the policy order are ignored.
+func CalicoPolicyInfo(kind string, item *unstructured.Unstructured) ([]PolicyInfo, error) {
+	b, err := item.MarshalJSON()
+	if err != nil {
+		return nil, err
+	}
+	var policy calicoPolicy
+	err = json.Unmarshal(b, &policy)
+	if err != nil {
+		return nil, err
+	}
+
+	info := PolicyInfo{
+		Kind:      kind,
+		Namespace: policy.Metadata.Namespace,
+		Name:      policy.Metadata.Name,
+		Egress:    len(policy.Spec.Egress) > 0,
+	}
+	if len(policy.Spec.Types) > 0 {
+		info.Egress = false
+		for _, t := range policy.Spec.Types {
+			if t == string(networkingv1.PolicyTypeEgress) {
+				info.Egress = true
+			}
+		}
+	}
+
+	info.Selector, err = calicoSelector(policy.Spec.Selector)
+	if err != nil {
+		info.Unsupported = err.Error()
+	}
+	if policy.Spec.NamespaceSelector != "" {
+		info.Unsupported = "namespaceSelector " + policy.Spec.NamespaceSelector
+	}
+
+	for _, rule := range policy.Spec.Egress {
+		if rule.Action != "Allow" && rule.Action != "Deny" {
+			continue
+		}
+		dest := rule.Destination
+		r := EgressRule{
+			Deny: rule.Action == "Deny",
+			Host: dest.Selector == "" && dest.NamespaceSelector == "" && len(dest.ServiceAccounts) == 0 && len(dest.Services) == 0,
+		}
+		var protocol string
+		if rule.Protocol != nil {
+			protocol = rule.Protocol.String()
+		}
+		for _, p := range dest.Ports {
+			r.Ports = append(r.Ports, calicoPort(protocol, p))
+		}
+		if len(dest.Ports) == 0 && protocol != "" {
+			r.Ports = append(r.Ports, PortRange{Protocol: protocol})
+		}
+		info.Rules = append(info.Rules, r)
+	}
+	return []PolicyInfo{info}, nil
+}
+
+func calicoPort(protocol string, p intstr.IntOrString) PortRange {
+	pr := PortRange{Protocol: protocol}
+	if p.Type == intstr.Int {
+		pr.Port = p.IntVal
+		return pr
+	}
+	start, end, found := strings.Cut(p.StrVal, ":")
+	first, err := strconv.Atoi(start)
+	if err != nil {
+		pr.Name = p.StrVal
+		return pr
+	}
+	pr.Port = int32(first)
+	if found {
+		last, err := strconv.Atoi(end)
+		if err != nil {
+			pr.Name = p.StrVal
+			return pr
+		}
+		pr.EndPort = int32(last)
+	}
+	return pr
+}
+
+// calicoSelector converts the common Calico selector expressions joined by
+// && to the k8s selector syntax.
+func calicoSelector(s string) (string, error) {
+	s = strings.TrimSpace(s)
+	if s == "" || s == "all()" {
+		return "", nil
+	}
+	if strings.Contains(s, "||") {
+		return "", fmt.Errorf("unsupported selector %q", s)
+	}
+
+	var terms []string
+	for _, term := range strings.Split(s, "&&") {
+		term = strings.TrimSpace(term)
+		switch {
+		case strings.HasPrefix(term, "!has(") && strings.HasSuffix(term, ")"):
+			terms = append(terms, "!"+strings.TrimSpace(term[5:len(term)-1]))
+		case strings.HasPrefix(term, "has(") && strings.HasSuffix(term, ")"):
+			terms = append(terms, strings.TrimSpace(term[4:len(term)-1]))
+		case strings.Contains(term, "=="):
+			k, v, _ := strings.Cut(term, "==")
+			terms = append(terms, strings.TrimSpace(k)+"="+unquote(v))
+		case strings.Contains(term, "!="):
+			k, v, _ := strings.Cut(term, "!=")
+			terms = append(terms, strings.TrimSpace(k)+"!="+unquote(v))
+		case strings.Contains(term, " in {") && strings.HasSuffix(term, "}"):
+			k, v, _ := strings.Cut(term, " in {")
+			var values []string
+			for _, value := range strings.Split(strings.TrimSuffix(v, "}"), ",") {
+				values = append(values, unquote(value))
+			}
+			terms = append(terms, fmt.Sprintf("%s in (%s)", strings.TrimSpace(k), strings.Join(values, ",")))
+		default:
+			return "", fmt.Errorf("unsupported selector %q", s)
+		}
+	}
+	selector := strings.Join(terms, ",")
+	_, err := labels.Parse(selector)
+	if err != nil {
+		return "", fmt.Errorf("unsupported selector %q: %v", s, err)
+	}
+	return selector, nil
+}
+
+func unquote(s string) string {
+	return strings.Trim(strings.TrimSpace(s), `'"`)
+}
@@ -0,0 +1,187 @@
+package cluster_test
+
+import (
+	"context"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/instana/envcheck/cluster"
+	networkingv1 "k8s.io/api/networking/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	dynamicfake "k8s.io/client-go/dynamic/fake"
+	"k8s.io/client-go/kubernetes/fake"
+	k8stesting "k8s.io/client-go/testing"
+)
+
+func Test_CiliumPolicyInfo(t *testing.T) {
+	t.Parallel()
+	item := unstructuredPolicy("cilium.io/v2", "CiliumNetworkPolicy", "payments", "agent", map[string]interface{}{
+		"endpointSelector": map[string]interface{}{
+			"matchLabels": map[string]interface{}{"k8s:app": "checkout"},
+		},
+		"egress": []interface{}{
+			map[string]interface{}{
+				"toEntities": []interface{}{"host"},
+				"toPorts": []interface{}{
+					map[string]interface{}{"ports": []interface{}{map[string]interface{}{"port": "42699", "protocol": "TCP"}}},
+				},
+			},
+			map[string]interface{}{"toCIDR": []interface{}{"10.0.0.0/8"}},
+		},
+	})
+
+	infos, err := cluster.CiliumPolicyInfo(cluster.KindCiliumNetworkPolicy, item)
+	if err != nil {
+		t.Fatalf("CiliumPolicyInfo() err=%v, want nil", err)
+	}
+	expected := []cluster.PolicyInfo{
+		{
+			Kind:      cluster.KindCiliumNetworkPolicy,
+			Namespace: "payments",
+			Name:      "agent",
+			Selector:  "app=checkout",
+			Egress:    true,
+			Rules: []cluster.EgressRule{
+				{Host: true, Ports: []cluster.PortRange{{Protocol: "TCP", Port: 42699}}},
+				{},
+			},
+		},
+	}
+	if !cmp.Equal(expected, infos) {
+		t.Errorf("CiliumPolicyInfo() mismatch (-want +got)\n%s", cmp.Diff(expected, infos))
+	}
+	if !infos[0].Allows("", 42699) || infos[0].Allows("", 4317) {
+		t.Errorf("Allows(42699)=%v Allows(4317)=%v, want true false", infos[0].Allows("", 42699), infos[0].Allows("", 4317))
+	}
+}
+
+func Test_CalicoPolicyInfo(t *testing.T) {
+	t.Parallel()
+	cases := map[string]struct {
+		spec     map[string]interface{}
+		expected cluster.PolicyInfo
+	}{
+		"deny otlp": {
+			map[string]interface{}{
+				"selector": "app == 'checkout' && has(tier)",
+				"types":    []interface{}{"Egress"},
+				"egress": []interface{}{
+					map[string]interface{}{"action": "Deny", "protocol": "TCP", "destination": map[string]interface{}{"ports": []interface{}{"4317:4318"}}},
+					map[string]interface{}{"action": "Allow"},
+					map[string]interface{}{"action": "Log"},
+				},
+			},
+			cluster.PolicyInfo{
+				Kind:      cluster.KindCalicoNetworkPolicy,
+				Namespace: "payments",
+				Name:      "agent",
+				Selector:  "app=checkout,tier",
+				Egress:    true,
+				Rules: []cluster.EgressRule{
+					{Deny: true, Host: true, Ports: []cluster.PortRange{{Protocol: "TCP", Port: 4317, EndPort: 4318}}},
+					{Host: true},
+				},
+			},
+		},
+		"selector destination": {
+			map[string]interface{}{
+				"egress": []interface{}{
+					map[string]interface{}{"action": "Allow", "destination": map[string]interface{}{"selector": "app == 'db'", "ports": []interface{}{int64(5432)}}},
+				},
+			},
+			cluster.PolicyInfo{
+				Kind:      cluster.KindCalicoNetworkPolicy,
+				Namespace: "payments",
+				Name:      "agent",
+				Egress:    true,
+				Rules:     []cluster.EgressRule{{Ports: []cluster.PortRange{{Port: 5432}}}},
+			},
+		},
+		"unsupported selector": {
+			map[string]interface{}{"selector": "app == 'a' || app == 'b'", "types": []interface{}{"Ingress"}},
+			cluster.PolicyInfo{
+				Kind:        cluster.KindCalicoNetworkPolicy,
+				Namespace:   "payments",
+				Name:        "agent",
+				Unsupported: `unsupported selector "app == 'a' || app == 'b'"`,
+			},
+		},
+	}
+	for name, tc := range cases {
+		tc := tc
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+			item := unstructuredPolicy("crd.projectcalico.org/v1", "NetworkPolicy", "payments", "agent", tc.spec)
+			infos, err := cluster.CalicoPolicyInfo(cluster.KindCalicoNetworkPolicy, item)
+			if err != nil {
+				t.Fatalf("CalicoPolicyInfo() err=%v, want nil", err)
+			}
+			expected := []cluster.PolicyInfo{tc.expected}
+			if !cmp.Equal(expected, infos) {
+				t.Errorf("CalicoPolicyInfo() mismatch (-want +got)\n%s", cmp.Diff(expected, infos))
+			}
+		})
+	}
+}
+
+func Test_AllPolicies(t *testing.T) {
+	t.Parallel()
+	client := fake.NewSimpleClientset(&networkingv1.NetworkPolicy{
+		ObjectMeta: metav1.ObjectMeta{Namespace: "payments", Name: "default-deny"},
+		Spec:       egressSpec(nil),
+	})
+	cilium := unstructuredPolicy("cilium.io/v2", "CiliumClusterwideNetworkPolicy", "", "lockdown", map[string]interface{}{
+		"endpointSelector": map[string]interface{}{},
+		"egressDeny":       []interface{}{map[string]interface{}{"toEntities": []interface{}{"all"}}},
+	})
+	dyn := dynamicfake.NewSimpleDynamicClientWithCustomListKinds(runtime.NewScheme(), map[schema.GroupVersionResource]string{
+		{Group: "cilium.io", Version: "v2", Resource: "ciliumnetworkpolicies"}:             "CiliumNetworkPolicyList",
+		{Group: "cilium.io", Version: "v2", Resource: "ciliumclusterwidenetworkpolicies"}:  "CiliumClusterwideNetworkPolicyList",
+		{Group: "crd.projectcalico.org", Version: "v1", Resource: "networkpolicies"}:       "NetworkPolicyList",
+		{Group: "crd.projectcalico.org", Version: "v1", Resource: "globalnetworkpolicies"}: "GlobalNetworkPolicyList",
+	}, cilium)
+	dyn.PrependReactor("list", "*", func(action k8stesting.Action) (bool, runtime.Object, error) {
+		resource := action.GetResource()
+		switch resource.Resource {
+		case "ciliumnetworkpolicies", "networkpolicies":
+			return true, nil, errors.NewNotFound(resource.GroupResource(), "")
+		case "globalnetworkpolicies":
+			return true, nil, errors.NewForbidden(resource.GroupResource(), "", nil)
+		}
+		return false, nil, nil
+	})
+	query := cluster.NewQuery("localhost:1234", client.CoreV1(), client.AppsV1(), client.NetworkingV1(), dyn, nil)
+
+	policies, err := query.AllPolicies(context.Background())
+	if err != nil {
+		t.Fatalf("AllPolicies() err=%v, want nil", err)
+	}
+	var names []string
+	for _, p := range policies {
+		names = append(names, p.String())
+	}
+	expected := []string{"NetworkPolicy/default-deny", "CiliumClusterwideNetworkPolicy/lockdown", "CalicoGlobalNetworkPolicy/*"}
+	if !cmp.Equal(expected, names) {
+		t.Errorf("AllPolicies() mismatch (-want +got)\n%s", cmp.Diff(expected, names))
+	}
+	if policies[2].Unsupported == "" {
+		t.Error("forbidden CRD Unsupported is empty, want error")
+	}
+}
+
+func unstructuredPolicy(apiVersion string, kind string, namespace string, name string, spec map[string]interface{}) *unstructured.Unstructured {
+	metadata := map[string]interface{}{"name": name}
+	if namespace != "" {
+		metadata["namespace"] = namespace
+	}
+	return &unstructured.Unstructured{Object: map[string]interface{}{
+		"apiVersion": apiVersion,
+		"kind":       kind,
+		"metadata":   metadata,
+		"spec":       spec,
+	}}
+}
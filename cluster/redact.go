@@ -0,0 +1,335 @@
+package cluster
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"io"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// redacted replaces free text that may contain names such as error messages.
+const redacted = "redacted"
+
+// publicNames are well-known names kept as is so the analysis of a redacted
+// podfile still recognises the agent and system namespaces.
+var publicNames = map[string]bool{
+	"default":         true,
+	"instana-agent":   true,
+	"kube-node-lease": true,
+	"kube-public":     true,
+	"kube-system":     true,
+}
+
+// NewRedactor builds a redactor that pseudonymises names with an HMAC keyed
+// with a random key so names are consistent within a podfile but cannot be
+// recovered by hashing guesses. Annotations and labels with keys in keep are
+// retained, all others are dropped.
+func NewRedactor(keep []string) (*Redactor, error) {
+	key := make([]byte, 32)
+	_, err := rand.Read(key)
+	if err != nil {
+		return nil, err
+	}
+	return NewRedactorWithKey(key, keep), nil
+}
+
+// NewRedactorWithKey builds a redactor with the given key, see NewRedactor.
+func NewRedactorWithKey(key []byte, keep []string) *Redactor {
+	r := &Redactor{key: key, keep: make(Set), seen: make(map[string]string)}
+	for _, k := range keep {
+		r.keep.Add(k)
+	}
+	return r
+}
+
+// Redactor pseudonymises the names in cluster info and drops annotations
+// other than an allow-list. The same name is always given the same pseudonym
+// so the index and annotation grouping of a redacted podfile are unchanged.
+type Redactor struct {
+	key  []byte
+	keep Set
+
+	mu sync.Mutex
+	// seen are the pseudonyms given to each name for redacting free text.
+	seen map[string]string
+}
+
+// Name provides the pseudonym for name with the prefix, e.g. ns-1a2b3c4d5e.
+// Well-known names and the names of CNI plugins are not sensitive and kept.
+func (r *Redactor) Name(prefix string, name string) string {
+	if name == "" || publicNames[name] || IsCNIPlugin(name) {
+		return name
+	}
+	mac := hmac.New(sha256.New, r.key)
+	mac.Write([]byte(prefix + "/" + name))
+	pseudonym := prefix + "-" + hex.EncodeToString(mac.Sum(nil))[:10]
+
+	r.mu.Lock()
+	if _, ok := r.seen[name]; !ok {
+		r.seen[name] = pseudonym
+	}
+	r.mu.Unlock()
+	return pseudonym
+}
+
+// minTextName is the shortest name replaced in free text to avoid replacing
+// common words and numbers.
+const minTextName = 4
+
+// Text replaces the names redacted so far that appear in free text such as
+// logs and event messages with their pseudonyms. It is best-effort as only
+// names already passed to the redactor are known.
+func (r *Redactor) Text(text string) string {
+	r.mu.Lock()
+	var names []string
+	for name := range r.seen {
+		if len(name) >= minTextName {
+			names = append(names, name)
+		}
+	}
+	// the replacer prefers earlier pairs at a position so longer names go first.
+	sort.Slice(names, func(i, j int) bool {
+		if len(names[i]) != len(names[j]) {
+			return len(names[i]) > len(names[j])
+		}
+		return names[i] < names[j]
+	})
+	var pairs []string
+	for _, name := range names {
+		pairs = append(pairs, name, r.seen[name])
+	}
+	r.mu.Unlock()
+
+	if len(pairs) == 0 {
+		return text
+	}
+	return strings.NewReplacer(pairs...).Replace(text)
+}
+
+// Manifests redacts the agent manifests in place. The annotations and labels
+// not kept are dropped, literal environment variable values and ConfigMap
+// data values are replaced as they may hold credentials such as proxy
+// passwords and the namespace is pseudonymised.
+func (r *Redactor) Manifests(m *AgentManifests) {
+	ds := m.DaemonSet
+	ds.Namespace = r.Name("ns", ds.Namespace)
+	ds.Name = r.Name("owner", ds.Name)
+	ds.Annotations = r.filter(ds.Annotations)
+	ds.Labels = r.filter(ds.Labels)
+	ds.Spec.Template.Annotations = r.filter(ds.Spec.Template.Annotations)
+	for i := range ds.Spec.Template.Spec.Containers {
+		c := &ds.Spec.Template.Spec.Containers[i]
+		c.Image = r.Image(c.Image)
+		for j := range c.Env {
+			if c.Env[j].Value != "" {
+				c.Env[j].Value = redacted
+			}
+		}
+	}
+	for i := range ds.Spec.Template.Spec.Volumes {
+		if cm := ds.Spec.Template.Spec.Volumes[i].ConfigMap; cm != nil {
+			cm.Name = r.Name("cm", cm.Name)
+		}
+	}
+
+	for i := range m.ConfigMaps {
+		cm := &m.ConfigMaps[i]
+		cm.Namespace = r.Name("ns", cm.Namespace)
+		cm.Name = r.Name("cm", cm.Name)
+		cm.Annotations = r.filter(cm.Annotations)
+		cm.Labels = r.filter(cm.Labels)
+		for k := range cm.Data {
+			cm.Data[k] = redacted
+		}
+		cm.BinaryData = nil
+	}
+	for i, name := range m.Missing {
+		m.Missing[i] = r.Name("cm", name)
+	}
+}
+
+// Image masks the registry hostname of the image leaving the repository and tag.
+func (r *Redactor) Image(image string) string {
+	i := strings.Index(image, "/")
+	if i < 0 {
+		return image
+	}
+	host := image[:i]
+	// the first component is a registry host when it looks like a domain, as with docker.
+	if !strings.ContainsAny(host, ".:") && host != "localhost" {
+		return image
+	}
+	return r.Name("registry", host) + image[i:]
+}
+
+// Pod provides the redacted pod.
+func (r *Redactor) Pod(pod PodInfo) PodInfo {
+	pod.Annotations = r.filter(pod.Annotations)
+	pod.Labels = r.filter(pod.Labels)
+	pod.Host = r.Name("host", pod.Host)
+	pod.Name = r.Name("pod", pod.Name)
+	pod.Namespace = r.Name("ns", pod.Namespace)
+
+	owners := make(map[string]string, len(pod.Owners))
+	for name, kind := range pod.Owners {
+		owners[r.Name("owner", name)] = kind
+	}
+	pod.Owners = owners
+
+	var containers []ContainerInfo
+	for _, c := range pod.Containers {
+		containers = append(containers, ContainerInfo{Name: r.Name("container", c.Name), Image: r.Image(c.Image)})
+	}
+	pod.Containers = containers
+
+	var configMaps []LinkedConfigMap
+	for _, cm := range pod.LinkedConfigMaps {
+		configMaps = append(configMaps, LinkedConfigMap{Name: r.Name("cm", cm.Name), Namespace: r.Name("ns", cm.Namespace)})
+	}
+	pod.LinkedConfigMaps = configMaps
+	return pod
+}
+
+// Node provides the redacted node.
+func (r *Redactor) Node(node NodeInfo) NodeInfo {
+	node.Name = r.Name("node", node.Name)
+	return node
+}
+
+// Egress provides the redacted egress verdict.
+func (r *Redactor) Egress(verdict EgressVerdict) EgressVerdict {
+	verdict.Namespace = r.Name("ns", verdict.Namespace)
+	verdict.Policies = r.policyNames(verdict.Policies)
+	verdict.Unevaluated = r.policyNames(verdict.Unevaluated)
+	return verdict
+}
+
+// Info provides a redacted copy of the info other than its pods which are
+// redacted as they are streamed with Applyable.
+func (r *Redactor) Info(info *Info) *Info {
+	c := *info
+	c.Name = r.Name("cluster", info.Name)
+	c.Context = r.Name("context", info.Context)
+	c.Pods = nil
+
+	c.Nodes = nil
+	for _, node := range info.Nodes {
+		c.Nodes = append(c.Nodes, r.Node(node))
+	}
+
+	c.Policies = nil
+	for _, p := range info.Policies {
+		p.Namespace = r.Name("ns", p.Namespace)
+		if p.Name != "*" {
+			p.Name = r.Name("policy", p.Name)
+		}
+		// selectors are made of label keys and values which may name workloads.
+		p.Selector = ""
+		c.Policies = append(c.Policies, p)
+	}
+
+	c.Egress = nil
+	for _, v := range info.Egress {
+		c.Egress = append(c.Egress, r.Egress(v))
+	}
+
+	c.Events = nil
+	for _, ev := range info.Events {
+		kind := strings.ToLower(ev.Kind)
+		if kind == "" {
+			kind = "object"
+		}
+		ev.Namespace = r.Name("ns", ev.Namespace)
+		ev.Name = r.Name(kind, ev.Name)
+		ev.Message = ""
+		c.Events = append(c.Events, ev)
+	}
+
+	c.Steps = nil
+	for _, step := range info.Steps {
+		if step.Err != "" {
+			step.Err = redacted
+		}
+		c.Steps = append(c.Steps, step)
+	}
+
+	c.Scopes = nil
+	for _, scope := range info.Scopes {
+		scope.Namespace = r.Name("ns", scope.Namespace)
+		if scope.Err != "" {
+			scope.Err = redacted
+		}
+		c.Scopes = append(c.Scopes, scope)
+	}
+	return &c
+}
+
+// Applyable wraps a so that it receives redacted pods, nodes and verdicts.
+func (r *Redactor) Applyable(a Applyable) Applyable {
+	return &redacting{r, a}
+}
+
+// policyNames redacts the names of kind/name policy references.
+func (r *Redactor) policyNames(names []string) []string {
+	var redactedNames []string
+	for _, n := range names {
+		kind, name, ok := strings.Cut(n, "/")
+		if ok {
+			n = kind + "/" + r.Name("policy", name)
+		}
+		redactedNames = append(redactedNames, n)
+	}
+	return redactedNames
+}
+
+func (r *Redactor) filter(m map[string]string) map[string]string {
+	var kept map[string]string
+	for k, v := range m {
+		if !r.keep[k] {
+			continue
+		}
+		if kept == nil {
+			kept = make(map[string]string)
+		}
+		kept[k] = v
+	}
+	return kept
+}
+
+type redacting struct {
+	r *Redactor
+	a Applyable
+}
+
+func (ra *redacting) EachPod(pod PodInfo) {
+	ra.a.EachPod(ra.r.Pod(pod))
+}
+
+func (ra *redacting) EachNode(node NodeInfo) {
+	ra.a.EachNode(ra.r.Node(node))
+}
+
+func (ra *redacting) EachEgress(verdict EgressVerdict) {
+	ra.a.EachEgress(ra.r.Egress(verdict))
+}
+
+// RedactPodfile streams the podfile from r to w redacting the pods as they
+// are decoded so large podfiles are redacted without holding them in memory.
+// The written podfile is gzip compressed when compress is true.
+func RedactPodfile(r io.Reader, w io.Writer, redactor *Redactor, compress bool) (*Info, error) {
+	podfile := NewPodfileWriter(w, compress)
+	info, err := DecodePodfile(r, redactor.Applyable(podfile))
+	if err != nil {
+		return nil, err
+	}
+	redactedInfo := redactor.Info(info)
+	err = podfile.Close(redactedInfo)
+	if err != nil {
+		return nil, err
+	}
+	return redactedInfo, nil
+}
@@ -0,0 +1,230 @@
+package cluster_test
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/instana/envcheck/cluster"
+	appsv1 "k8s.io/api/apps/v1"
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func Test_Redactor_Name(t *testing.T) {
+	t.Parallel()
+	r := cluster.NewRedactorWithKey([]byte("key"), nil)
+	testCases := map[string]struct {
+		name     string
+		redacted bool
+	}{
+		"empty":         {"", false},
+		"system":        {"kube-system", false},
+		"agent":         {"instana-agent", false},
+		"cni plugin":    {"calico-node", false},
+		"customer name": {"payments", true},
+	}
+
+	for name, tc := range testCases {
+		tc := tc
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+			actual := r.Name("ns", tc.name)
+			if (actual != tc.name) != tc.redacted {
+				t.Errorf("Name(%q)=%q, want redacted=%v", tc.name, actual, tc.redacted)
+			}
+			if actual != r.Name("ns", tc.name) {
+				t.Errorf("Name(%q) is not consistent", tc.name)
+			}
+		})
+	}
+}
+
+func Test_Redactor_Text_should_replace_names_seen(t *testing.T) {
+	t.Parallel()
+	r := cluster.NewRedactorWithKey([]byte("key"), nil)
+	pod := r.Name("pod", "payments-api-1")
+	ns := r.Name("ns", "payments")
+	r.Name("ns", "web")
+
+	actual := r.Text("pod payments-api-1 in payments failed on web")
+	expected := "pod " + pod + " in " + ns + " failed on web"
+	if actual != expected {
+		t.Errorf("Text()=%q, want %q", actual, expected)
+	}
+}
+
+func Test_Redactor_Manifests(t *testing.T) {
+	t.Parallel()
+	r := cluster.NewRedactorWithKey([]byte("key"), nil)
+	m := &cluster.AgentManifests{
+		DaemonSet: &appsv1.DaemonSet{
+			ObjectMeta: metav1.ObjectMeta{Namespace: "monitoring", Name: "instana-agent", Annotations: map[string]string{"owner": "payments"}},
+			Spec: appsv1.DaemonSetSpec{Template: v1.PodTemplateSpec{Spec: v1.PodSpec{
+				Containers: []v1.Container{{
+					Name:  "instana-agent",
+					Image: "registry.example.com/instana/agent:latest",
+					Env:   []v1.EnvVar{{Name: "INSTANA_AGENT_KEY", Value: "s3cret"}, {Name: "NODE", ValueFrom: &v1.EnvVarSource{}}},
+				}},
+			}}},
+		},
+		ConfigMaps: []v1.ConfigMap{{
+			ObjectMeta: metav1.ObjectMeta{Namespace: "monitoring", Name: "agent-config"},
+			Data:       map[string]string{"configuration.yaml": "proxy password: s3cret"},
+		}},
+		Missing: []string{"agent-extra"},
+	}
+	r.Manifests(m)
+
+	ds := m.DaemonSet
+	if ds.Namespace == "monitoring" || ds.Annotations != nil {
+		t.Errorf("DaemonSet namespace=%s annotations=%v, want redacted", ds.Namespace, ds.Annotations)
+	}
+	env := ds.Spec.Template.Spec.Containers[0].Env
+	if env[0].Value == "s3cret" || env[1].Value != "" {
+		t.Errorf("Env=%v, want literal values redacted", env)
+	}
+	if strings.Contains(ds.Spec.Template.Spec.Containers[0].Image, "example.com") {
+		t.Errorf("Image=%s, want registry redacted", ds.Spec.Template.Spec.Containers[0].Image)
+	}
+	cm := m.ConfigMaps[0]
+	if cm.Name == "agent-config" || cm.Data["configuration.yaml"] == "proxy password: s3cret" {
+		t.Errorf("ConfigMap name=%s data=%v, want redacted", cm.Name, cm.Data)
+	}
+	if m.Missing[0] == "agent-extra" {
+		t.Errorf("Missing=%v, want redacted", m.Missing)
+	}
+}
+
+func Test_Redactor_Image(t *testing.T) {
+	t.Parallel()
+	r := cluster.NewRedactorWithKey([]byte("key"), nil)
+	testCases := map[string]struct {
+		image  string
+		masked bool
+	}{
+		"docker hub":       {"nginx:1.25", false},
+		"docker hub org":   {"instana/agent:latest", false},
+		"private registry": {"registry.corp.example/team/app:1.2", true},
+		"registry port":    {"localhost:5000/app", true},
+		"localhost":        {"localhost/app", true},
+	}
+
+	for name, tc := range testCases {
+		tc := tc
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+			actual := r.Image(tc.image)
+			if tc.masked {
+				host := tc.image[:strings.Index(tc.image, "/")]
+				if strings.Contains(actual, host) || !strings.HasPrefix(actual, "registry-") {
+					t.Errorf("Image(%q)=%q, want registry host masked", tc.image, actual)
+				}
+				if !strings.HasSuffix(actual, tc.image[len(host):]) {
+					t.Errorf("Image(%q)=%q, want repository kept", tc.image, actual)
+				}
+			} else if actual != tc.image {
+				t.Errorf("Image(%q)=%q, want unchanged", tc.image, actual)
+			}
+		})
+	}
+}
+
+func Test_Redactor_Pod_should_drop_annotations_not_kept(t *testing.T) {
+	t.Parallel()
+	r := cluster.NewRedactorWithKey([]byte("key"), []string{"instana.io/team"})
+	pod := r.Pod(cluster.PodInfo{
+		Annotations: map[string]string{"instana.io/team": "core", "owner": "jane@example.com"},
+		Labels:      map[string]string{"app": "payments"},
+	})
+
+	expected := map[string]string{"instana.io/team": "core"}
+	if !cmp.Equal(expected, pod.Annotations) {
+		t.Errorf("Annotations mismatch (-want +got):\n%s", cmp.Diff(expected, pod.Annotations))
+	}
+	if pod.Labels != nil {
+		t.Errorf("Labels=%v, want nil", pod.Labels)
+	}
+}
+
+func Test_Redactor_should_preserve_index_summary(t *testing.T) {
+	t.Parallel()
+	pods := []cluster.PodInfo{
+		agentPod("instana-agent-abc12", "10.0.0.1"),
+		agentPod("instana-agent-def34", "10.0.0.2"),
+		{
+			Name:       "payments-7d9f-x1",
+			Namespace:  "payments",
+			Host:       "10.0.0.1",
+			IsRunning:  true,
+			Owners:     map[string]string{"payments-7d9f": cluster.ReplicaSet},
+			Containers: []cluster.ContainerInfo{{Name: "api", Image: "registry.corp.example/payments/api:1"}},
+		},
+		{
+			Name:       "calico-node-1",
+			Namespace:  "kube-system",
+			Host:       "10.0.0.1",
+			Owners:     map[string]string{"calico-node": cluster.DaemonSet},
+			Containers: []cluster.ContainerInfo{{Name: "calico-node"}},
+		},
+	}
+	r := cluster.NewRedactorWithKey([]byte("key"), nil)
+
+	raw := cluster.NewIndex()
+	redacted := cluster.NewIndex()
+	for _, pod := range pods {
+		raw.EachPod(pod)
+		r.Applyable(redacted).EachPod(pod)
+	}
+
+	if !cmp.Equal(raw.Summary(), redacted.Summary()) {
+		t.Errorf("Summary() mismatch (-raw +redacted):\n%s", cmp.Diff(raw.Summary(), redacted.Summary()))
+	}
+	if raw.AgentRestarts.Len() != redacted.AgentRestarts.Len() || redacted.CNIPlugins.Len() != 1 {
+		t.Errorf("agents=%d cni=%d, want %d 1", redacted.AgentRestarts.Len(), redacted.CNIPlugins.Len(), raw.AgentRestarts.Len())
+	}
+}
+
+func Test_RedactPodfile(t *testing.T) {
+	t.Parallel()
+	var in bytes.Buffer
+	w := cluster.NewPodfileWriter(&in, false)
+	w.EachPod(cluster.PodInfo{Name: "payments-7d9f-x1", Namespace: "payments", Annotations: map[string]string{"owner": "jane"}})
+	err := w.Close(&cluster.Info{
+		Name:   "https://api.prod.corp.example:6443",
+		Nodes:  []cluster.NodeInfo{{Name: "ip-10-0-0-1.corp.example"}},
+		Events: []cluster.EventInfo{{Namespace: "payments", Kind: "Pod", Name: "payments-7d9f-x1", Message: "payments failed"}},
+		Scopes: []cluster.ScopeInfo{{Resource: "pods", Namespace: "payments", Denied: true, Err: `User "jane" cannot list pods`}},
+	})
+	if err != nil {
+		t.Fatalf("Close() err=%v, want nil", err)
+	}
+
+	var out bytes.Buffer
+	r := cluster.NewRedactorWithKey([]byte("key"), nil)
+	info, err := cluster.RedactPodfile(&in, &out, r, false)
+	if err != nil {
+		t.Fatalf("RedactPodfile() err=%v, want nil", err)
+	}
+	if info.Name != r.Name("cluster", "https://api.prod.corp.example:6443") {
+		t.Errorf("info.Name=%v, want redacted", info.Name)
+	}
+	for _, sensitive := range []string{"payments", "corp.example", "jane"} {
+		if strings.Contains(out.String(), sensitive) {
+			t.Errorf("redacted podfile contains %q: %s", sensitive, out.String())
+		}
+	}
+}
+
+func agentPod(name string, host string) cluster.PodInfo {
+	return cluster.PodInfo{
+		Name:       name,
+		Namespace:  "instana-agent",
+		Host:       host,
+		IsRunning:  true,
+		Owners:     map[string]string{"instana-agent": cluster.DaemonSet},
+		Containers: []cluster.ContainerInfo{{Name: "instana-agent", Image: "icr.io/instana/agent:latest"}},
+		Status:     "Running",
+	}
+}
@@ -0,0 +1,192 @@
+package cluster
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+
+	appsv1 "k8s.io/api/apps/v1"
+	v1 "k8s.io/api/core/v1"
+	rbacv1 "k8s.io/api/rbac/v1"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"sigs.k8s.io/yaml"
+)
+
+const (
+	// FormatYAML renders the manifests as a YAML stream.
+	FormatYAML = "yaml"
+	// FormatJSON renders the manifests as a JSON List.
+	FormatJSON = "json"
+	// KustomizationFile is the kustomize entry point written to the output directory.
+	KustomizationFile = "kustomization.yaml"
+)
+
+// DaemonManifests provides the objects the daemon subcommand applies.
+func DaemonManifests(config DaemonConfig) []runtime.Object {
+	ds := Daemon(config)
+	ds.TypeMeta = metav1.TypeMeta{APIVersion: appsv1.SchemeGroupVersion.String(), Kind: "DaemonSet"}
+	svc := Service(config)
+	svc.TypeMeta = metav1.TypeMeta{APIVersion: v1.SchemeGroupVersion.String(), Kind: "Service"}
+	return append([]runtime.Object{ds, svc}, DaemonAccessManifests(config)...)
+}
+
+// DaemonAccessManifests provides the ServiceAccount, Role and RoleBinding
+// the daemon needs to list the API server endpoints.
+func DaemonAccessManifests(config DaemonConfig) []runtime.Object {
+	sa := DaemonServiceAccount(config)
+	sa.TypeMeta = metav1.TypeMeta{APIVersion: v1.SchemeGroupVersion.String(), Kind: "ServiceAccount"}
+	role := EndpointsRole(config)
+	role.TypeMeta = metav1.TypeMeta{APIVersion: rbacv1.SchemeGroupVersion.String(), Kind: "Role"}
+	binding := EndpointsRoleBinding(config)
+	binding.TypeMeta = metav1.TypeMeta{APIVersion: rbacv1.SchemeGroupVersion.String(), Kind: "RoleBinding"}
+	return []runtime.Object{sa, role, binding}
+}
+
+// PingerManifests provides the objects the ping subcommand applies.
+func PingerManifests(config PingerConfig) []runtime.Object {
+	ds := Pinger(config)
+	ds.TypeMeta = metav1.TypeMeta{APIVersion: appsv1.SchemeGroupVersion.String(), Kind: "DaemonSet"}
+	return []runtime.Object{ds}
+}
+
+// Render writes the objects to w as a YAML stream or a JSON List.
+func Render(w io.Writer, format string, objects ...runtime.Object) error {
+	var manifests []map[string]interface{}
+	for _, obj := range objects {
+		m, err := manifest(obj)
+		if err != nil {
+			return err
+		}
+		manifests = append(manifests, m)
+	}
+
+	switch format {
+	case FormatJSON:
+		list := map[string]interface{}{
+			"apiVersion": "v1",
+			"kind":       "List",
+			"items":      manifests,
+		}
+		enc := json.NewEncoder(w)
+		enc.SetIndent("", "  ")
+		return enc.Encode(list)
+
+	case FormatYAML:
+		for i, m := range manifests {
+			b, err := yaml.Marshal(m)
+			if err != nil {
+				return err
+			}
+			if i > 0 {
+				io.WriteString(w, "---\n")
+			}
+			_, err = w.Write(b)
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+
+	return fmt.Errorf("unknown output format %q, expected yaml or json", format)
+}
+
+// WriteKustomize writes each object to its own YAML file in dir with a
+// kustomization.yaml listing them as resources. The file names include the
+// namespace when the objects span more than one namespace.
+func WriteKustomize(dir string, objects ...runtime.Object) ([]string, error) {
+	err := os.MkdirAll(dir, 0755)
+	if err != nil {
+		return nil, err
+	}
+
+	namespaces := make(map[string]bool)
+	for _, obj := range objects {
+		accessor, err := meta.Accessor(obj)
+		if err != nil {
+			return nil, err
+		}
+		namespaces[accessor.GetNamespace()] = true
+	}
+
+	var resources []string
+	for _, obj := range objects {
+		accessor, _ := meta.Accessor(obj)
+		kind := obj.GetObjectKind().GroupVersionKind().Kind
+		filename := fmt.Sprintf("%s-%s.yaml", strings.ToLower(kind), accessor.GetName())
+		if len(namespaces) > 1 {
+			filename = fmt.Sprintf("%s-%s-%s.yaml", strings.ToLower(kind), accessor.GetNamespace(), accessor.GetName())
+		}
+		err = writeFile(filepath.Join(dir, filename), FormatYAML, obj)
+		if err != nil {
+			return nil, err
+		}
+		resources = append(resources, filename)
+	}
+
+	kustomization := map[string]interface{}{
+		"apiVersion": "kustomize.config.k8s.io/v1beta1",
+		"kind":       "Kustomization",
+		"resources":  resources,
+	}
+	b, err := yaml.Marshal(kustomization)
+	if err != nil {
+		return nil, err
+	}
+	err = os.WriteFile(filepath.Join(dir, KustomizationFile), b, 0644)
+	if err != nil {
+		return nil, err
+	}
+	return append(resources, KustomizationFile), nil
+}
+
+func writeFile(filename string, format string, objects ...runtime.Object) error {
+	w, err := os.Create(filename)
+	if err != nil {
+		return err
+	}
+	err = Render(w, format, objects...)
+	if err != nil {
+		w.Close()
+		return err
+	}
+	return w.Close()
+}
+
+// manifest converts the object to a generic map dropping the status and the
+// null creation timestamps that typed objects marshal with.
+func manifest(obj runtime.Object) (map[string]interface{}, error) {
+	b, err := json.Marshal(obj)
+	if err != nil {
+		return nil, err
+	}
+	var m map[string]interface{}
+	err = json.Unmarshal(b, &m)
+	if err != nil {
+		return nil, err
+	}
+
+	delete(m, "status")
+	deleteNull(m, "metadata", "creationTimestamp")
+	deleteNull(m, "spec", "template", "metadata", "creationTimestamp")
+	return m, nil
+}
+
+func deleteNull(m map[string]interface{}, path ...string) {
+	for _, key := range path[:len(path)-1] {
+		next, ok := m[key].(map[string]interface{})
+		if !ok {
+			return
+		}
+		m = next
+	}
+	last := path[len(path)-1]
+	if v, ok := m[last]; ok && v == nil {
+		delete(m, last)
+	}
+}
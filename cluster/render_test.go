@@ -0,0 +1,118 @@
+package cluster_test
+
+import (
+	"bytes"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/instana/envcheck/cluster"
+)
+
+func Test_Render_yaml(t *testing.T) {
+	var buf bytes.Buffer
+	config := cluster.DaemonConfig{Namespace: "instana-agent", Image: "instana/envcheck-daemon:latest", Host: "0.0.0.0", Port: 42700}
+	err := cluster.Render(&buf, cluster.FormatYAML, cluster.DaemonManifests(config)...)
+	if err != nil {
+		t.Fatalf("Render() err=%v, want nil", err)
+	}
+
+	out := buf.String()
+	for _, want := range []string{"kind: DaemonSet\n", "---\n", "kind: Service\n", "image: instana/envcheck-daemon:latest\n"} {
+		if !strings.Contains(out, want) {
+			t.Errorf("Render() missing %q in\n%s", want, out)
+		}
+	}
+	for _, unwanted := range []string{"status:", "creationTimestamp"} {
+		if strings.Contains(out, unwanted) {
+			t.Errorf("Render() contains %q in\n%s", unwanted, out)
+		}
+	}
+}
+
+func Test_Render_json(t *testing.T) {
+	var buf bytes.Buffer
+	err := cluster.Render(&buf, cluster.FormatJSON, cluster.PingerManifests(cluster.PingerConfig{Namespace: "default"})...)
+	if err != nil {
+		t.Fatalf("Render() err=%v, want nil", err)
+	}
+
+	var list struct {
+		Kind  string
+		Items []struct{ Kind string }
+	}
+	err = json.Unmarshal(buf.Bytes(), &list)
+	if err != nil {
+		t.Fatalf("Unmarshal() err=%v, want nil", err)
+	}
+	if list.Kind != "List" || len(list.Items) != 1 || list.Items[0].Kind != "DaemonSet" {
+		t.Errorf("list=%+v, want List with a DaemonSet", list)
+	}
+}
+
+func Test_Render_unknown_format(t *testing.T) {
+	var buf bytes.Buffer
+	err := cluster.Render(&buf, "toml", cluster.PingerManifests(cluster.PingerConfig{})...)
+	if err == nil {
+		t.Errorf("Render() err=nil, want unknown format error")
+	}
+}
+
+func Test_WriteKustomize(t *testing.T) {
+	dir := filepath.Join(t.TempDir(), "envcheck")
+	files, err := cluster.WriteKustomize(dir, cluster.PingerManifests(cluster.PingerConfig{Namespace: "default"})...)
+	if err != nil {
+		t.Fatalf("WriteKustomize() err=%v, want nil", err)
+	}
+
+	expected := []string{"daemonset-pinger.yaml", "kustomization.yaml"}
+	if !cmp.Equal(expected, files) {
+		t.Errorf("WriteKustomize() mismatch (-want +got)\n%s", cmp.Diff(expected, files))
+	}
+
+	b, err := os.ReadFile(filepath.Join(dir, cluster.KustomizationFile))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(string(b), "- daemonset-pinger.yaml") {
+		t.Errorf("kustomization.yaml=%s, want daemonset resource", b)
+	}
+}
+
+func Test_WriteKustomize_daemon_with_endpoints_access(t *testing.T) {
+	dir := filepath.Join(t.TempDir(), "envcheck")
+	files, err := cluster.WriteKustomize(dir, cluster.DaemonManifests(cluster.DaemonConfig{Namespace: "instana-agent"})...)
+	if err != nil {
+		t.Fatalf("WriteKustomize() err=%v, want nil", err)
+	}
+
+	expected := []string{
+		"daemonset-instana-agent-envchecker.yaml",
+		"service-instana-agent-envchecker.yaml",
+		"serviceaccount-instana-agent-envchecker.yaml",
+		"role-default-envchecker-instana-agent-endpoints.yaml",
+		"rolebinding-default-envchecker-instana-agent-endpoints.yaml",
+		"kustomization.yaml",
+	}
+	if !cmp.Equal(expected, files) {
+		t.Errorf("WriteKustomize() mismatch (-want +got)\n%s", cmp.Diff(expected, files))
+	}
+}
+
+func Test_WriteKustomize_names_files_by_namespace_when_spanning_namespaces(t *testing.T) {
+	dir := filepath.Join(t.TempDir(), "envcheck")
+	objects := append(cluster.PingerManifests(cluster.PingerConfig{Namespace: "team-a"}),
+		cluster.PingerManifests(cluster.PingerConfig{Namespace: "team-b"})...)
+	files, err := cluster.WriteKustomize(dir, objects...)
+	if err != nil {
+		t.Fatalf("WriteKustomize() err=%v, want nil", err)
+	}
+
+	expected := []string{"daemonset-team-a-pinger.yaml", "daemonset-team-b-pinger.yaml", "kustomization.yaml"}
+	if !cmp.Equal(expected, files) {
+		t.Errorf("WriteKustomize() mismatch (-want +got)\n%s", cmp.Diff(expected, files))
+	}
+}
@@ -2,10 +2,13 @@ package cluster
 
 import (
 	"fmt"
+
+	"github.com/instana/envcheck/ping"
 	"k8s.io/apimachinery/pkg/util/intstr"
 
 	appsv1 "k8s.io/api/apps/v1"
 	v1 "k8s.io/api/core/v1"
+	rbacv1 "k8s.io/api/rbac/v1"
 	"k8s.io/apimachinery/pkg/api/resource"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 )
@@ -17,10 +20,17 @@ const (
 	ManagedBy = "envcheckctl"
 	// PingerName is the resource name for the pinger daemon set.
 	PingerName = "pinger"
+	// BackendName is the resource name for the backend check daemon set.
+	BackendName = "backendcheck"
+	// APIServerNamespace is the namespace of the kubernetes Service and Endpoints.
+	APIServerNamespace = "default"
+	// APIServerName is the name of the kubernetes Service and Endpoints.
+	APIServerName = "kubernetes"
 )
 
 // DaemonConfig is the configuration for the envchecker daemon set.
 type DaemonConfig struct {
+	Workload
 	Namespace string
 	Image     string
 	Version   string
@@ -93,19 +103,15 @@ func Daemon(config DaemonConfig) *appsv1.DaemonSet {
 						LabelVersion:   config.Version,
 					},
 				},
-				Spec: v1.PodSpec{
-					HostNetwork: true,
+				Spec: config.PodSpec(v1.PodSpec{
+					HostNetwork:        true,
+					ServiceAccountName: DaemonSetName,
 					Containers: []v1.Container{
 						{
 							Name:            DaemonSetName,
 							Image:           config.Image,
-							ImagePullPolicy: v1.PullAlways,
-							Resources: ResourceRequirements(Resources{
-								RequestCPU:    "5m",
-								RequestMemory: "20Mi",
-								LimitCPU:      "100m",
-								LimitMemory:   "512Mi",
-							}),
+							ImagePullPolicy: config.ImagePullPolicy(),
+							Resources:       config.ResourceRequirements(),
 							Env: []v1.EnvVar{
 								FieldPath("NAME", "metadata.name"),
 								FieldPath("NAMESPACE", "metadata.namespace"),
@@ -122,7 +128,76 @@ func Daemon(config DaemonConfig) *appsv1.DaemonSet {
 							},
 						},
 					},
-				},
+				}),
+			},
+		},
+	}
+}
+
+// DaemonServiceAccount creates the ServiceAccount the envchecker daemon set runs as.
+func DaemonServiceAccount(config DaemonConfig) *v1.ServiceAccount {
+	return &v1.ServiceAccount{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      DaemonSetName,
+			Namespace: config.Namespace,
+			Labels: map[string]string{
+				LabelManagedBy: ManagedBy,
+				LabelName:      DaemonSetName,
+			},
+		},
+	}
+}
+
+// EndpointsRoleName is the name of the Role and RoleBinding that allow the
+// daemon in namespace to read the API server endpoints.
+func EndpointsRoleName(namespace string) string {
+	return fmt.Sprintf("%s-%s-endpoints", DaemonSetName, namespace)
+}
+
+// EndpointsRole creates the Role to get the kubernetes Endpoints which is
+// all the daemon reads from the API server.
+func EndpointsRole(config DaemonConfig) *rbacv1.Role {
+	return &rbacv1.Role{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      EndpointsRoleName(config.Namespace),
+			Namespace: APIServerNamespace,
+			Labels: map[string]string{
+				LabelManagedBy: ManagedBy,
+				LabelName:      DaemonSetName,
+			},
+		},
+		Rules: []rbacv1.PolicyRule{
+			{
+				APIGroups:     []string{""},
+				Resources:     []string{"endpoints"},
+				ResourceNames: []string{APIServerName},
+				Verbs:         []string{"get"},
+			},
+		},
+	}
+}
+
+// EndpointsRoleBinding binds the EndpointsRole to the daemon ServiceAccount.
+func EndpointsRoleBinding(config DaemonConfig) *rbacv1.RoleBinding {
+	return &rbacv1.RoleBinding{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      EndpointsRoleName(config.Namespace),
+			Namespace: APIServerNamespace,
+			Labels: map[string]string{
+				LabelManagedBy: ManagedBy,
+				LabelName:      DaemonSetName,
+			},
+		},
+		RoleRef: rbacv1.RoleRef{
+			APIGroup: rbacv1.GroupName,
+			Kind:     "Role",
+			Name:     EndpointsRoleName(config.Namespace),
+		},
+		Subjects: []rbacv1.Subject{
+			{
+				Kind:      rbacv1.ServiceAccountKind,
+				Name:      DaemonSetName,
+				Namespace: config.Namespace,
 			},
 		},
 	}
@@ -130,6 +205,7 @@ func Daemon(config DaemonConfig) *appsv1.DaemonSet {
 
 // PingerConfig is the input configuration for the pinger DaemonSet.
 type PingerConfig struct {
+	Workload
 	Namespace  string
 	Image      string
 	Version    string
@@ -160,25 +236,92 @@ func Pinger(config PingerConfig) *appsv1.DaemonSet {
 						LabelVersion:   config.Version,
 					},
 				},
-				Spec: v1.PodSpec{
+				Spec: config.PodSpec(v1.PodSpec{
 					Containers: []v1.Container{
 						{
 							Name:            PingerName,
 							Image:           config.Image,
+							ImagePullPolicy: config.ImagePullPolicy(),
+							Resources:       config.ResourceRequirements(),
+							Env: []v1.EnvVar{
+								FieldPath("NAME", "metadata.name"),
+								FieldPath("NAMESPACE", "metadata.namespace"),
+								FieldPath("NODEIP", "status.hostIP"),
+								FieldPath("PODIP", "status.podIP"),
+								PingHost(config.Host, config.UseGateway),
+								{Name: "PINGPORT", Value: fmt.Sprintf("%d", config.Port)},
+								{Name: "PINGLISTEN", Value: fmt.Sprintf(":%d", ping.DefaultStatusPort)},
+							},
+							Ports: []v1.ContainerPort{
+								{
+									Name:          "status",
+									Protocol:      v1.ProtocolTCP,
+									ContainerPort: ping.DefaultStatusPort,
+								},
+							},
+						},
+					},
+				}),
+			},
+		},
+	}
+}
+
+// BackendConfig is the input configuration for the backend check DaemonSet.
+type BackendConfig struct {
+	Namespace   string
+	Image       string
+	Version     string
+	Endpoint    string
+	HostNetwork bool
+	Proxy       string
+}
+
+// Backend creates the backend check DaemonSet resource from the provided BackendConfig.
+func Backend(config BackendConfig) *appsv1.DaemonSet {
+	dnsPolicy := v1.DNSClusterFirst
+	if config.HostNetwork {
+		dnsPolicy = v1.DNSClusterFirstWithHostNet
+	}
+
+	return &appsv1.DaemonSet{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      BackendName,
+			Namespace: config.Namespace,
+		},
+		Spec: appsv1.DaemonSetSpec{
+			Selector: &metav1.LabelSelector{
+				MatchLabels: map[string]string{
+					LabelName: BackendName,
+				},
+			},
+			Template: v1.PodTemplateSpec{
+				ObjectMeta: metav1.ObjectMeta{
+					Labels: map[string]string{
+						LabelManagedBy: ManagedBy,
+						LabelName:      BackendName,
+						LabelVersion:   config.Version,
+					},
+				},
+				Spec: v1.PodSpec{
+					HostNetwork: config.HostNetwork,
+					DNSPolicy:   dnsPolicy,
+					Containers: []v1.Container{
+						{
+							Name:            BackendName,
+							Image:           config.Image,
 							ImagePullPolicy: v1.PullAlways,
 							Resources: ResourceRequirements(Resources{
 								RequestCPU:    "5m",
 								RequestMemory: "20Mi",
 								LimitCPU:      "100m",
-								LimitMemory:   "512Mi",
+								LimitMemory:   "128Mi",
 							}),
 							Env: []v1.EnvVar{
 								FieldPath("NAME", "metadata.name"),
-								FieldPath("NAMESPACE", "metadata.namespace"),
-								FieldPath("NODEIP", "status.hostIP"),
-								FieldPath("PODIP", "status.podIP"),
-								PingHost(config.Host, config.UseGateway),
-								{Name: "PINGPORT", Value: fmt.Sprintf("%d", config.Port)},
+								FieldPath("NODENAME", "spec.nodeName"),
+								{Name: "ENDPOINT", Value: config.Endpoint},
+								{Name: "PROXY", Value: config.Proxy},
 							},
 						},
 					},
@@ -214,6 +357,90 @@ func FieldPath(name, path string) v1.EnvVar {
 	}
 }
 
+// DefaultResources is the resource requirements of the envcheck DaemonSets.
+var DefaultResources = Resources{
+	RequestCPU:    "5m",
+	RequestMemory: "20Mi",
+	LimitCPU:      "100m",
+	LimitMemory:   "512Mi",
+}
+
+// Workload is the image pull, scheduling and resource configuration of a
+// DaemonSet. The zero value matches the defaults prior to it being configurable.
+type Workload struct {
+	PullPolicy    v1.PullPolicy
+	PullSecrets   []string
+	Tolerations   []v1.Toleration
+	NodeSelector  map[string]string
+	PriorityClass string
+	Resources     Resources
+}
+
+// ImagePullPolicy provides the pull policy defaulting to Always.
+func (w *Workload) ImagePullPolicy() v1.PullPolicy {
+	if w.PullPolicy == "" {
+		return v1.PullAlways
+	}
+	return w.PullPolicy
+}
+
+// ResourceRequirements builds the resource requirements with blank values
+// taken from DefaultResources.
+func (w *Workload) ResourceRequirements() v1.ResourceRequirements {
+	r := w.Resources
+	if r.RequestCPU == "" {
+		r.RequestCPU = DefaultResources.RequestCPU
+	}
+	if r.RequestMemory == "" {
+		r.RequestMemory = DefaultResources.RequestMemory
+	}
+	if r.LimitCPU == "" {
+		r.LimitCPU = DefaultResources.LimitCPU
+	}
+	if r.LimitMemory == "" {
+		r.LimitMemory = DefaultResources.LimitMemory
+	}
+	return ResourceRequirements(r)
+}
+
+// PodSpec applies the pull secrets and scheduling configuration to spec.
+func (w *Workload) PodSpec(spec v1.PodSpec) v1.PodSpec {
+	for _, secret := range w.PullSecrets {
+		spec.ImagePullSecrets = append(spec.ImagePullSecrets, v1.LocalObjectReference{Name: secret})
+	}
+	spec.Tolerations = w.Tolerations
+	spec.NodeSelector = w.NodeSelector
+	spec.PriorityClassName = w.PriorityClass
+	return spec
+}
+
+// Validate ensures the pull policy and resource quantities are valid as
+// ResourceRequirements panics on an invalid quantity.
+func (w *Workload) Validate() error {
+	switch w.PullPolicy {
+	case "", v1.PullAlways, v1.PullIfNotPresent, v1.PullNever:
+	default:
+		return fmt.Errorf("invalid pull policy %q, expected one of Always, IfNotPresent or Never", w.PullPolicy)
+	}
+
+	quantities := map[string]string{
+		"request cpu":    w.Resources.RequestCPU,
+		"request memory": w.Resources.RequestMemory,
+		"limit cpu":      w.Resources.LimitCPU,
+		"limit memory":   w.Resources.LimitMemory,
+	}
+	for name, q := range quantities {
+		if q == "" {
+			continue
+		}
+		_, err := resource.ParseQuantity(q)
+		if err != nil {
+			return fmt.Errorf("invalid %s %q: %v", name, q, err)
+		}
+	}
+	return nil
+}
+
 // Resources is the system resource contraints associated with an entity.
 type Resources struct {
 	RequestCPU    string
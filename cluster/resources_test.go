@@ -4,6 +4,7 @@ import (
 	"testing"
 
 	v1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
 
 	"github.com/instana/envcheck/cluster"
 )
@@ -61,6 +62,97 @@ func Test_PingerConfig_Image_should_change_manifests_image(t *testing.T) {
 	}
 }
 
+func Test_BackendConfig_HostNetwork_should_change_dns_policy(t *testing.T) {
+	config := cluster.BackendConfig{HostNetwork: true}
+	resource := cluster.Backend(config)
+	spec := resource.Spec.Template.Spec
+	if !spec.HostNetwork || spec.DNSPolicy != corev1.DNSClusterFirstWithHostNet {
+		t.Errorf("HostNetwork=%v DNSPolicy=%v, want true ClusterFirstWithHostNet", spec.HostNetwork, spec.DNSPolicy)
+	}
+}
+
+func Test_BackendConfig_Endpoint_should_change_env(t *testing.T) {
+	config := cluster.BackendConfig{Endpoint: "ingress-red-saas.instana.io:443"}
+	resource := cluster.Backend(config)
+	var actual string
+	for _, env := range resource.Spec.Template.Spec.Containers[0].Env {
+		if env.Name == "ENDPOINT" {
+			actual = env.Value
+		}
+	}
+	if actual != "ingress-red-saas.instana.io:443" {
+		t.Errorf("ENDPOINT=%v, want <ingress-red-saas.instana.io:443>", actual)
+	}
+}
+
+func Test_DaemonConfig_Workload_default_should_pull_always(t *testing.T) {
+	config := cluster.DaemonConfig{}
+	resource := cluster.Daemon(config)
+	container := resource.Spec.Template.Spec.Containers[0]
+	if container.ImagePullPolicy != corev1.PullAlways {
+		t.Errorf("ImagePullPolicy=%v, want <Always>", container.ImagePullPolicy)
+	}
+	if container.Resources.Limits.Memory().String() != "512Mi" {
+		t.Errorf("limit memory=%v, want <512Mi>", container.Resources.Limits.Memory())
+	}
+}
+
+func Test_PingerConfig_Workload_should_change_pod_spec(t *testing.T) {
+	config := cluster.PingerConfig{Workload: cluster.Workload{
+		PullPolicy:    corev1.PullIfNotPresent,
+		PullSecrets:   []string{"mirror"},
+		Tolerations:   []corev1.Toleration{{Operator: corev1.TolerationOpExists}},
+		NodeSelector:  map[string]string{"kubernetes.io/os": "linux"},
+		PriorityClass: "system-node-critical",
+		Resources:     cluster.Resources{LimitMemory: "64Mi"},
+	}}
+	resource := cluster.Pinger(config)
+	spec := resource.Spec.Template.Spec
+	container := spec.Containers[0]
+	if container.ImagePullPolicy != corev1.PullIfNotPresent {
+		t.Errorf("ImagePullPolicy=%v, want <IfNotPresent>", container.ImagePullPolicy)
+	}
+	if len(spec.ImagePullSecrets) != 1 || spec.ImagePullSecrets[0].Name != "mirror" {
+		t.Errorf("ImagePullSecrets=%v, want <[mirror]>", spec.ImagePullSecrets)
+	}
+	if len(spec.Tolerations) != 1 {
+		t.Errorf("len(Tolerations)=%v, want <1>", len(spec.Tolerations))
+	}
+	if spec.NodeSelector["kubernetes.io/os"] != "linux" {
+		t.Errorf("NodeSelector=%v, want <kubernetes.io/os=linux>", spec.NodeSelector)
+	}
+	if spec.PriorityClassName != "system-node-critical" {
+		t.Errorf("PriorityClassName=%v, want <system-node-critical>", spec.PriorityClassName)
+	}
+	if container.Resources.Limits.Memory().String() != "64Mi" {
+		t.Errorf("limit memory=%v, want <64Mi>", container.Resources.Limits.Memory())
+	}
+	if container.Resources.Requests.Cpu().String() != "5m" {
+		t.Errorf("request cpu=%v, want <5m>", container.Resources.Requests.Cpu())
+	}
+}
+
+func Test_Workload_Validate(t *testing.T) {
+	cases := map[string]struct {
+		workload cluster.Workload
+		valid    bool
+	}{
+		"zero value":          {cluster.Workload{}, true},
+		"if not present":      {cluster.Workload{PullPolicy: corev1.PullIfNotPresent}, true},
+		"invalid pull policy": {cluster.Workload{PullPolicy: "Sometimes"}, false},
+		"invalid quantity":    {cluster.Workload{Resources: cluster.Resources{LimitMemory: "lots"}}, false},
+	}
+	for name, tc := range cases {
+		tc := tc
+		t.Run(name, func(t *testing.T) {
+			err := tc.workload.Validate()
+			if (err == nil) != tc.valid {
+				t.Errorf("Validate()=%v, want valid=%v", err, tc.valid)
+			}
+		})
+	}
+}
+
 func versionLabel(resource *v1.DaemonSet) string {
 	return resource.Spec.Template.ObjectMeta.Labels[cluster.LabelVersion]
 }
@@ -0,0 +1,105 @@
+package cluster
+
+import (
+	"context"
+	goerrors "errors"
+	"io"
+	"net"
+	"syscall"
+	"time"
+
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/wait"
+)
+
+// Backoff is the retry policy for throttled and transient api-server errors.
+var Backoff = wait.Backoff{
+	Duration: 250 * time.Millisecond,
+	Factor:   2,
+	Jitter:   0.1,
+	Steps:    5,
+	Cap:      10 * time.Second,
+}
+
+// maxRestarts is the number of times a list is restarted after its continue token expires.
+const maxRestarts = 3
+
+// IsTransient indicates whether the error is throttling or a transient
+// api-server or network failure that is worth retrying.
+func IsTransient(err error) bool {
+	if err == nil {
+		return false
+	}
+	if errors.IsTooManyRequests(err) ||
+		errors.IsServerTimeout(err) ||
+		errors.IsTimeout(err) ||
+		errors.IsInternalError(err) ||
+		errors.IsServiceUnavailable(err) ||
+		errors.IsUnexpectedServerError(err) {
+		return true
+	}
+	var netErr net.Error
+	if goerrors.As(err, &netErr) && netErr.Timeout() {
+		return true
+	}
+	return goerrors.Is(err, syscall.ECONNRESET) || goerrors.Is(err, io.ErrUnexpectedEOF)
+}
+
+// Retry calls fn until it succeeds, returns a non-transient error, the
+// backoff is exhausted or ctx is done. A delay suggested by the api-server
+// with Retry-After is used in place of the backoff step when longer.
+func Retry(ctx context.Context, fn func() error) error {
+	backoff := Backoff
+	for {
+		err := fn()
+		if !IsTransient(err) || backoff.Steps <= 0 {
+			return err
+		}
+
+		delay := backoff.Step()
+		if seconds, ok := errors.SuggestsClientDelay(err); ok && time.Duration(seconds)*time.Second > delay {
+			delay = time.Duration(seconds) * time.Second
+		}
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(delay):
+		}
+	}
+}
+
+// paginate lists with page until there are no more continue tokens. Each page
+// is retried on transient errors. When a continue token expires the list is
+// restarted from the beginning after calling reset to discard the items seen.
+func paginate(ctx context.Context, reset func(), page func(opts metav1.ListOptions) (string, error)) error {
+	var cont string
+	var restarts int
+	for {
+		var next string
+		err := Retry(ctx, func() error {
+			var err error
+			next, err = page(metav1.ListOptions{Limit: limit, Continue: cont})
+			return err
+		})
+		if cont != "" && restarts < maxRestarts && (errors.IsResourceExpired(err) || errors.IsGone(err)) {
+			restarts++
+			cont = ""
+			reset()
+			continue
+		}
+		if err != nil {
+			return err
+		}
+
+		cont = next
+		if cont == "" {
+			return nil
+		}
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(pauseTime * time.Millisecond):
+		}
+	}
+}
@@ -0,0 +1,87 @@
+package cluster_test
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"testing"
+
+	"github.com/instana/envcheck/cluster"
+	v1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/client-go/kubernetes/fake"
+	k8stesting "k8s.io/client-go/testing"
+)
+
+func Test_IsTransient(t *testing.T) {
+	t.Parallel()
+	pods := schema.GroupResource{Resource: "pods"}
+	cases := map[string]struct {
+		err       error
+		transient bool
+	}{
+		"nil":               {nil, false},
+		"too many requests": {errors.NewTooManyRequests("slow down", 1), true},
+		"internal error":    {errors.NewInternalError(fmt.Errorf("etcd")), true},
+		"service unavail":   {errors.NewServiceUnavailable("starting"), true},
+		"server timeout":    {errors.NewServerTimeout(pods, "list", 1), true},
+		"unexpected eof":    {fmt.Errorf("read: %w", io.ErrUnexpectedEOF), true},
+		"not found":         {errors.NewNotFound(pods, "agent"), false},
+		"forbidden":         {errors.NewForbidden(pods, "", fmt.Errorf("rbac")), false},
+		"expired":           {errors.NewResourceExpired("continue expired"), false},
+	}
+	for name, tc := range cases {
+		tc := tc
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+			if cluster.IsTransient(tc.err) != tc.transient {
+				t.Errorf("IsTransient(%v)=%v, want %v", tc.err, !tc.transient, tc.transient)
+			}
+		})
+	}
+}
+
+func Test_Retry_should_stop_when_context_is_done(t *testing.T) {
+	t.Parallel()
+	ctx, cancel := context.WithCancel(context.Background())
+	var calls int
+	err := cluster.Retry(ctx, func() error {
+		calls++
+		cancel()
+		return errors.NewTooManyRequests("slow down", 0)
+	})
+	if err != context.Canceled || calls != 1 {
+		t.Errorf("Retry() err=%v calls=%d, want context.Canceled 1", err, calls)
+	}
+}
+
+func Test_AllPods_should_retry_and_restart_expired_lists(t *testing.T) {
+	t.Parallel()
+	client := fake.NewSimpleClientset()
+	pod := instanaAgent()
+	var calls int
+	client.PrependReactor("list", "pods", func(action k8stesting.Action) (bool, runtime.Object, error) {
+		calls++
+		switch calls {
+		case 1:
+			return true, nil, errors.NewTooManyRequests("slow down", 0)
+		case 2:
+			return true, &v1.PodList{ListMeta: metav1.ListMeta{Continue: "page-2"}, Items: []v1.Pod{pod}}, nil
+		case 3:
+			return true, nil, errors.NewResourceExpired("the provided continue parameter is too old")
+		}
+		return true, &v1.PodList{Items: []v1.Pod{pod}}, nil
+	})
+	query := cluster.NewQuery("localhost:1234", client.CoreV1(), client.AppsV1(), client.NetworkingV1(), nil, nil)
+
+	all, err := query.AllPods(context.Background())
+	if err != nil {
+		t.Fatalf("AllPods() err=%v, want nil", err)
+	}
+	if len(all) != 1 || calls != 4 {
+		t.Errorf("len(all)=%d calls=%d, want 1 4", len(all), calls)
+	}
+}
@@ -0,0 +1,198 @@
+package cluster
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"time"
+
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+)
+
+// RolloutInterval is the time between rollout status checks.
+var RolloutInterval = 2 * time.Second
+
+// Rollout is the progress of a DaemonSet rollout.
+type Rollout struct {
+	Namespace string
+	Name      string
+	Desired   int32
+	Updated   int32
+	Ready     int32
+	// Observed indicates the controller has seen the latest generation.
+	Observed bool
+	Pods     []PodProgress
+	Warnings []Warning
+}
+
+// Complete indicates every scheduled pod is updated and ready.
+func (r *Rollout) Complete() bool {
+	return r.Observed && r.Updated == r.Desired && r.Ready == r.Desired
+}
+
+// PodProgress is the state of a single DaemonSet pod.
+type PodProgress struct {
+	Name    string
+	Node    string
+	Phase   string
+	Ready   bool
+	Reason  string
+	Message string
+}
+
+func (p PodProgress) String() string {
+	return fmt.Sprintf("pod=%s node=%s phase=%s ready=%v reason=%s message='%s'", p.Name, p.Node, p.Phase, p.Ready, p.Reason, p.Message)
+}
+
+// Warning is a warning event for the DaemonSet or one of its pods.
+type Warning struct {
+	UID     string
+	Object  string
+	Reason  string
+	Message string
+	Count   int32
+}
+
+func (w Warning) String() string {
+	return fmt.Sprintf("object=%s reason=%s count=%d message='%s'", w.Object, w.Reason, w.Count, w.Message)
+}
+
+// Rollout provides the rollout progress of the named DaemonSet. Only warnings
+// for the DaemonSet and its current pods last seen at or after since are
+// included, a zero since includes them regardless of age.
+func (kc *KubernetesCommand) Rollout(ctx context.Context, namespace string, name string, since time.Time) (*Rollout, error) {
+	ds, err := kc.DaemonSets(namespace).Get(ctx, name, metav1.GetOptions{})
+	if err != nil {
+		return nil, err
+	}
+
+	rollout := &Rollout{
+		Namespace: namespace,
+		Name:      name,
+		Desired:   ds.Status.DesiredNumberScheduled,
+		Updated:   ds.Status.UpdatedNumberScheduled,
+		Ready:     ds.Status.NumberReady,
+		Observed:  ds.Status.ObservedGeneration >= ds.Generation,
+	}
+
+	selector, err := metav1.LabelSelectorAsSelector(ds.Spec.Selector)
+	if err != nil {
+		return nil, err
+	}
+	pods, err := kc.Pods(namespace).List(ctx, metav1.ListOptions{LabelSelector: selector.String()})
+	if err != nil {
+		return nil, err
+	}
+
+	objects := map[string]bool{name: true}
+	uids := map[types.UID]bool{ds.UID: true}
+	for _, pod := range pods.Items {
+		objects[pod.Name] = true
+		uids[pod.UID] = true
+		rollout.Pods = append(rollout.Pods, podProgress(&pod))
+	}
+	sort.Slice(rollout.Pods, func(i, j int) bool {
+		return rollout.Pods[i].Name < rollout.Pods[j].Name
+	})
+
+	events, err := kc.Events(namespace).List(ctx, metav1.ListOptions{FieldSelector: "type=" + v1.EventTypeWarning})
+	if err != nil {
+		return nil, err
+	}
+	for _, e := range events.Items {
+		// filtered again as not every client applies the field selector.
+		if e.Type != v1.EventTypeWarning || !objects[e.InvolvedObject.Name] {
+			continue
+		}
+		// a previous pod with the same name or a warning from an earlier rollout.
+		if e.InvolvedObject.UID != "" && !uids[e.InvolvedObject.UID] {
+			continue
+		}
+		if lastSeen(&e).Before(since) {
+			continue
+		}
+		rollout.Warnings = append(rollout.Warnings, Warning{
+			UID:     string(e.UID),
+			Object:  fmt.Sprintf("%s/%s", e.InvolvedObject.Kind, e.InvolvedObject.Name),
+			Reason:  e.Reason,
+			Message: e.Message,
+			Count:   e.Count,
+		})
+	}
+
+	return rollout, nil
+}
+
+// WaitRollout polls the rollout of the named DaemonSet until it is complete
+// or ctx is done, calling progress after each check.
+func (kc *KubernetesCommand) WaitRollout(ctx context.Context, namespace string, name string, progress func(*Rollout)) (*Rollout, error) {
+	// event timestamps have a resolution of a second.
+	since := time.Now().Truncate(time.Second)
+	var last *Rollout
+	for {
+		rollout, err := kc.Rollout(ctx, namespace, name, since)
+		if err == nil {
+			last = rollout
+			progress(rollout)
+			if rollout.Complete() {
+				return rollout, nil
+			}
+		}
+
+		select {
+		case <-ctx.Done():
+			if last == nil {
+				return nil, err
+			}
+			return last, ctx.Err()
+		case <-time.After(RolloutInterval):
+		}
+	}
+}
+
+// lastSeen is the most recent time the event was observed, events.k8s.io
+// clients only set the event time and series.
+func lastSeen(e *v1.Event) time.Time {
+	switch {
+	case e.Series != nil && !e.Series.LastObservedTime.IsZero():
+		return e.Series.LastObservedTime.Time
+	case !e.LastTimestamp.IsZero():
+		return e.LastTimestamp.Time
+	case !e.EventTime.IsZero():
+		return e.EventTime.Time
+	}
+	return e.CreationTimestamp.Time
+}
+
+// podProgress summarises the pod with the most relevant reason it is not ready.
+func podProgress(pod *v1.Pod) PodProgress {
+	p := PodProgress{
+		Name:  pod.Name,
+		Node:  pod.Spec.NodeName,
+		Phase: string(pod.Status.Phase),
+	}
+
+	for _, c := range pod.Status.Conditions {
+		switch {
+		case c.Type == v1.PodReady:
+			p.Ready = c.Status == v1.ConditionTrue
+		case c.Type == v1.PodScheduled && c.Status == v1.ConditionFalse:
+			p.Reason = c.Reason
+			p.Message = c.Message
+		}
+	}
+
+	for _, cs := range pod.Status.ContainerStatuses {
+		switch {
+		case cs.State.Waiting != nil && cs.State.Waiting.Reason != "ContainerCreating":
+			p.Reason = cs.State.Waiting.Reason
+			p.Message = cs.State.Waiting.Message
+		case cs.State.Terminated != nil:
+			p.Reason = cs.State.Terminated.Reason
+			p.Message = cs.State.Terminated.Message
+		}
+	}
+	return p
+}
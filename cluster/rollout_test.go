@@ -0,0 +1,141 @@
+package cluster_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/instana/envcheck/cluster"
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+func Test_Rollout_should_surface_pod_reasons_and_warnings(t *testing.T) {
+	client := fake.NewSimpleClientset(
+		pingerDaemonSet(2, 1),
+		pingerPod("pinger-ready", "node-1", corev1.ContainerState{Running: &corev1.ContainerStateRunning{}}, true),
+		pingerPod("pinger-pull", "node-2", corev1.ContainerState{Waiting: &corev1.ContainerStateWaiting{Reason: "ImagePullBackOff", Message: "Back-off pulling image"}}, false),
+		warning("pinger-pull", "Failed", "Failed to pull image"),
+		warning("unrelated", "BackOff", "Back-off restarting failed container"),
+	)
+	command := &cluster.KubernetesCommand{AppsV1Interface: client.AppsV1(), CoreV1Interface: client.CoreV1()}
+
+	rollout, err := command.Rollout(context.Background(), "default", cluster.PingerName, time.Time{})
+	if err != nil {
+		t.Fatalf("err=%v, want nil", err)
+	}
+	if rollout.Complete() {
+		t.Errorf("Complete()=true, want false")
+	}
+
+	expected := []cluster.PodProgress{
+		{Name: "pinger-pull", Node: "node-2", Phase: "Pending", Reason: "ImagePullBackOff", Message: "Back-off pulling image"},
+		{Name: "pinger-ready", Node: "node-1", Phase: "Running", Ready: true},
+	}
+	if !cmp.Equal(expected, rollout.Pods) {
+		t.Errorf("Pods mismatch (-want +got)\n%s", cmp.Diff(expected, rollout.Pods))
+	}
+	if len(rollout.Warnings) != 1 || rollout.Warnings[0].Object != "Pod/pinger-pull" {
+		t.Errorf("Warnings=%v, want the pinger-pull warning only", rollout.Warnings)
+	}
+}
+
+func Test_Rollout_should_skip_warnings_from_earlier_rollouts(t *testing.T) {
+	start := time.Now().Truncate(time.Second)
+	current := pingerPod("pinger-pull", "node-2", corev1.ContainerState{Waiting: &corev1.ContainerStateWaiting{Reason: "ImagePullBackOff"}}, false)
+	current.UID = "uid-current"
+	recent := warning("pinger-pull", "Failed", "Failed to pull image")
+	recent.InvolvedObject.UID = "uid-current"
+	recent.LastTimestamp = metav1.NewTime(start.Add(time.Second))
+	stale := warning("pinger-pull", "BackOff", "Back-off restarting failed container")
+	stale.InvolvedObject.UID = "uid-current"
+	stale.LastTimestamp = metav1.NewTime(start.Add(-time.Hour))
+	replaced := warning("pinger-pull", "FailedMount", "MountVolume.SetUp failed")
+	replaced.InvolvedObject.UID = "uid-previous"
+	replaced.LastTimestamp = metav1.NewTime(start.Add(time.Second))
+	client := fake.NewSimpleClientset(pingerDaemonSet(1, 0), current, recent, stale, replaced)
+	command := &cluster.KubernetesCommand{AppsV1Interface: client.AppsV1(), CoreV1Interface: client.CoreV1()}
+
+	rollout, err := command.Rollout(context.Background(), "default", cluster.PingerName, start)
+	if err != nil {
+		t.Fatalf("err=%v, want nil", err)
+	}
+	if len(rollout.Warnings) != 1 || rollout.Warnings[0].Reason != "Failed" {
+		t.Errorf("Warnings=%v, want the Failed warning only", rollout.Warnings)
+	}
+}
+
+func Test_WaitRollout_should_return_when_complete(t *testing.T) {
+	client := fake.NewSimpleClientset(pingerDaemonSet(1, 1))
+	command := &cluster.KubernetesCommand{AppsV1Interface: client.AppsV1(), CoreV1Interface: client.CoreV1()}
+
+	var calls int
+	rollout, err := command.WaitRollout(context.Background(), "default", cluster.PingerName, func(*cluster.Rollout) { calls++ })
+	if err != nil {
+		t.Fatalf("err=%v, want nil", err)
+	}
+	if !rollout.Complete() || calls != 1 {
+		t.Errorf("Complete()=%v calls=%d, want true 1", rollout.Complete(), calls)
+	}
+}
+
+func Test_WaitRollout_should_timeout_when_incomplete(t *testing.T) {
+	client := fake.NewSimpleClientset(pingerDaemonSet(2, 1))
+	command := &cluster.KubernetesCommand{AppsV1Interface: client.AppsV1(), CoreV1Interface: client.CoreV1()}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	rollout, err := command.WaitRollout(ctx, "default", cluster.PingerName, func(*cluster.Rollout) {})
+	if err != context.DeadlineExceeded {
+		t.Errorf("err=%v, want context.DeadlineExceeded", err)
+	}
+	if rollout == nil || rollout.Ready != 1 {
+		t.Errorf("rollout=%+v, want the last progress", rollout)
+	}
+}
+
+func pingerDaemonSet(desired int32, ready int32) *appsv1.DaemonSet {
+	ds := cluster.Pinger(cluster.PingerConfig{Namespace: "default"})
+	ds.Status = appsv1.DaemonSetStatus{
+		DesiredNumberScheduled: desired,
+		UpdatedNumberScheduled: desired,
+		NumberReady:            ready,
+	}
+	return ds
+}
+
+func pingerPod(name string, node string, state corev1.ContainerState, ready bool) *corev1.Pod {
+	phase := corev1.PodPending
+	readyStatus := corev1.ConditionFalse
+	if ready {
+		phase = corev1.PodRunning
+		readyStatus = corev1.ConditionTrue
+	}
+	return &corev1.Pod{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      name,
+			Namespace: "default",
+			Labels:    map[string]string{cluster.LabelName: cluster.PingerName, cluster.LabelVersion: ""},
+		},
+		Spec: corev1.PodSpec{NodeName: node},
+		Status: corev1.PodStatus{
+			Phase:             phase,
+			Conditions:        []corev1.PodCondition{{Type: corev1.PodReady, Status: readyStatus}},
+			ContainerStatuses: []corev1.ContainerStatus{{Name: cluster.PingerName, State: state}},
+		},
+	}
+}
+
+func warning(object string, reason string, message string) *corev1.Event {
+	return &corev1.Event{
+		ObjectMeta:     metav1.ObjectMeta{Name: object + "." + reason, Namespace: "default"},
+		InvolvedObject: corev1.ObjectReference{Kind: "Pod", Name: object, Namespace: "default"},
+		Type:           corev1.EventTypeWarning,
+		Reason:         reason,
+		Message:        message,
+		Count:          1,
+	}
+}
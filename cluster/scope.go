@@ -0,0 +1,132 @@
+package cluster
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"sync"
+
+	"k8s.io/apimachinery/pkg/api/errors"
+)
+
+// ScopeInfo records whether a resource was collected cluster-wide or in a
+// namespace, and whether access was denied.
+type ScopeInfo struct {
+	Resource string
+	// Namespace is empty when the resource was listed cluster-wide.
+	Namespace string `json:",omitempty"`
+	Denied    bool   `json:",omitempty"`
+	Err       string `json:",omitempty"`
+}
+
+// String provides the resource and its scope, e.g. pods in payments.
+func (s ScopeInfo) String() string {
+	if s.Namespace == "" {
+		return s.Resource + " cluster-wide"
+	}
+	return s.Resource + " in " + s.Namespace
+}
+
+// NewScopes builds the collection scopes for the query. An empty list of
+// namespaces collects cluster-wide and falls back to each namespace when
+// cluster-wide access is denied.
+func NewScopes(query Query, namespaces []string) *Scopes {
+	return &Scopes{query: query, explicit: namespaces}
+}
+
+// Scopes resolves the namespaces to collect namespaced resources from and
+// records the scopes collected and denied. It is safe for concurrent use.
+type Scopes struct {
+	query    Query
+	explicit []string
+
+	once       sync.Once
+	namespaces []string
+
+	mu     sync.Mutex
+	scopes []ScopeInfo
+}
+
+// Each calls fn cluster-wide, or with each namespace when namespaces were
+// given or cluster-wide access is denied. Denied namespaces are recorded and
+// skipped. An error is returned when fn fails other than being denied or when
+// every namespace is denied.
+func (s *Scopes) Each(ctx context.Context, resource string, fn func(ctx context.Context, namespace string) error) error {
+	namespaces := s.explicit
+	if len(namespaces) == 0 {
+		err := fn(ctx, "")
+		if !errors.IsForbidden(err) {
+			if err == nil {
+				s.Record(ScopeInfo{Resource: resource})
+			}
+			return err
+		}
+		s.Record(ScopeInfo{Resource: resource, Denied: true, Err: err.Error()})
+		namespaces = s.fallback(ctx)
+	}
+
+	var collected int
+	for _, ns := range namespaces {
+		err := fn(ctx, ns)
+		if errors.IsForbidden(err) {
+			s.Record(ScopeInfo{Resource: resource, Namespace: ns, Denied: true, Err: err.Error()})
+			continue
+		}
+		if err != nil {
+			return err
+		}
+		s.Record(ScopeInfo{Resource: resource, Namespace: ns})
+		collected++
+	}
+	if collected == 0 {
+		return fmt.Errorf("%s denied in every namespace", resource)
+	}
+	return nil
+}
+
+// fallback provides the namespaces that can be listed or the namespace of
+// the kubeconfig context when listing namespaces is denied too.
+func (s *Scopes) fallback(ctx context.Context) []string {
+	s.once.Do(func() {
+		namespaces, err := s.query.Namespaces(ctx)
+		if err != nil {
+			s.Record(ScopeInfo{Resource: "namespaces", Denied: errors.IsForbidden(err), Err: err.Error()})
+			namespaces = []string{s.query.Namespace()}
+		}
+		s.namespaces = namespaces
+	})
+	return s.namespaces
+}
+
+// Record adds the scope to those collected or denied.
+func (s *Scopes) Record(scope ScopeInfo) {
+	s.mu.Lock()
+	s.scopes = append(s.scopes, scope)
+	s.mu.Unlock()
+}
+
+// Scopes provides the recorded scopes sorted by resource and namespace.
+func (s *Scopes) Scopes() []ScopeInfo {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	scopes := make([]ScopeInfo, len(s.scopes))
+	copy(scopes, s.scopes)
+	sort.SliceStable(scopes, func(i, j int) bool {
+		if scopes[i].Resource != scopes[j].Resource {
+			return scopes[i].Resource < scopes[j].Resource
+		}
+		return scopes[i].Namespace < scopes[j].Namespace
+	})
+	return scopes
+}
+
+// Denied lists the scopes that could not be collected.
+func Denied(scopes []ScopeInfo) []ScopeInfo {
+	var denied []ScopeInfo
+	for _, s := range scopes {
+		if s.Denied {
+			denied = append(denied, s)
+		}
+	}
+	return denied
+}
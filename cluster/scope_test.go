@@ -0,0 +1,116 @@
+package cluster_test
+
+import (
+	"context"
+	"fmt"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/instana/envcheck/cluster"
+	v1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/client-go/kubernetes/fake"
+	k8stesting "k8s.io/client-go/testing"
+)
+
+func Test_Scopes_Each(t *testing.T) {
+	denied := errors.NewForbidden(schema.GroupResource{Resource: "pods"}, "", fmt.Errorf("rbac"))
+	testCases := map[string]struct {
+		namespaces []string
+		allowed    map[string]bool
+		listable   bool
+		visited    []string
+		scopes     []cluster.ScopeInfo
+		err        string
+	}{
+		"cluster-wide": {
+			allowed: map[string]bool{"": true},
+			visited: []string{""},
+			scopes:  []cluster.ScopeInfo{{Resource: "pods"}},
+		},
+		"explicit namespaces": {
+			namespaces: []string{"a", "b"},
+			allowed:    map[string]bool{"a": true},
+			visited:    []string{"a", "b"},
+			scopes:     []cluster.ScopeInfo{{Resource: "pods", Namespace: "a"}, {Resource: "pods", Namespace: "b", Denied: true, Err: denied.Error()}},
+		},
+		"fallback to listed namespaces": {
+			allowed:  map[string]bool{"default": true},
+			listable: true,
+			visited:  []string{"", "default", "kube-system"},
+			scopes: []cluster.ScopeInfo{
+				{Resource: "pods", Denied: true, Err: denied.Error()},
+				{Resource: "pods", Namespace: "default"},
+				{Resource: "pods", Namespace: "kube-system", Denied: true, Err: denied.Error()},
+			},
+		},
+		"every namespace denied": {
+			namespaces: []string{"a"},
+			visited:    []string{"a"},
+			scopes:     []cluster.ScopeInfo{{Resource: "pods", Namespace: "a", Denied: true, Err: denied.Error()}},
+			err:        "pods denied in every namespace",
+		},
+	}
+
+	for name, tc := range testCases {
+		tc := tc
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+			client := fake.NewSimpleClientset(
+				&v1.Namespace{ObjectMeta: metav1.ObjectMeta{Name: "default"}},
+				&v1.Namespace{ObjectMeta: metav1.ObjectMeta{Name: "kube-system"}},
+			)
+			if !tc.listable {
+				client.PrependReactor("list", "namespaces", func(action k8stesting.Action) (bool, runtime.Object, error) {
+					return true, nil, errors.NewForbidden(schema.GroupResource{Resource: "namespaces"}, "", fmt.Errorf("rbac"))
+				})
+			}
+			query := cluster.NewQuery("localhost:1234", client.CoreV1(), client.AppsV1(), client.NetworkingV1(), nil, nil)
+			scopes := cluster.NewScopes(query, tc.namespaces)
+
+			var visited []string
+			err := scopes.Each(context.Background(), "pods", func(_ context.Context, namespace string) error {
+				visited = append(visited, namespace)
+				if !tc.allowed[namespace] {
+					return denied
+				}
+				return nil
+			})
+
+			var errStr string
+			if err != nil {
+				errStr = err.Error()
+			}
+			if errStr != tc.err {
+				t.Errorf("Each() err=%v, want %v", errStr, tc.err)
+			}
+			if !cmp.Equal(tc.visited, visited) {
+				t.Errorf("visited mismatch (-want +got):\n%s", cmp.Diff(tc.visited, visited))
+			}
+			actual := scopes.Scopes()
+			if !cmp.Equal(tc.scopes, actual) {
+				t.Errorf("Scopes() mismatch (-want +got):\n%s", cmp.Diff(tc.scopes, actual))
+			}
+		})
+	}
+}
+
+func Test_Scopes_Each_should_return_other_errors(t *testing.T) {
+	t.Parallel()
+	client := fake.NewSimpleClientset()
+	query := cluster.NewQuery("localhost:1234", client.CoreV1(), client.AppsV1(), client.NetworkingV1(), nil, nil)
+	scopes := cluster.NewScopes(query, nil)
+
+	err := scopes.Each(context.Background(), "pods", func(_ context.Context, _ string) error {
+		return fmt.Errorf("connection refused")
+	})
+	if err == nil || err.Error() != "connection refused" {
+		t.Errorf("Each() err=%v, want connection refused", err)
+	}
+	if len(scopes.Scopes()) != 0 {
+		t.Errorf("len(Scopes())=%d, want 0", len(scopes.Scopes()))
+	}
+}
@@ -0,0 +1,66 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"time"
+
+	"github.com/instana/envcheck/backend"
+	"github.com/instana/envcheck/network"
+)
+
+var (
+	// Revision is the Git commit SHA injected at compile time.
+	Revision = "dev"
+)
+
+// Exec is the primary execution for the backendcheck application.
+func Exec(endpoint string, pod string, node string, config network.TransportConfig, timeout time.Duration) error {
+	log.SetFlags(log.LUTC | log.Lmsgprefix | log.LstdFlags)
+	log.SetPrefix(fmt.Sprintf("pod=%s node=%s ", pod, node))
+	log.Printf("endpoint=%s revision=%v", endpoint, Revision)
+
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+
+	result := backend.Check(ctx, endpoint, config)
+	result.Pod = pod
+	result.Node = node
+
+	line, err := backend.Encode(result)
+	if err != nil {
+		return err
+	}
+	log.Println(line)
+	return nil
+}
+
+func main() {
+	var endpoint string
+	var pod string
+	var node string
+	var timeout time.Duration
+	var tc network.TransportConfig
+
+	flag.StringVar(&endpoint, "endpoint", os.Getenv("ENDPOINT"), "agent backend endpoint as host:port.")
+	flag.StringVar(&pod, "name", os.Getenv("NAME"), "name of this pod.")
+	flag.StringVar(&node, "node", os.Getenv("NODENAME"), "node this pod is running on.")
+	flag.DurationVar(&timeout, "timeout", 30*time.Second, "timeout for the complete check.")
+	flag.StringVar(&tc.Proxy, "proxy", os.Getenv("PROXY"), "proxy URL, direct if blank.")
+	flag.StringVar(&tc.ProxyAuth, "proxy-auth", os.Getenv("PROXYAUTH"), "proxy credentials in the form user:password.")
+	flag.StringVar(&tc.CAFile, "ca-file", "", "PEM bundle of additional CA certificates to trust.")
+	flag.BoolVar(&tc.InsecureSkipVerify, "insecure-skip-verify", false, "skip server certificate verification.")
+	flag.Parse()
+
+	err := Exec(endpoint, pod, node, tc, timeout)
+	if err != nil {
+		log.Printf("status=shutdown error='%v'\n", err)
+		os.Exit(1)
+	}
+
+	// a DaemonSet restarts completed pods so idle until envcheckctl removes it.
+	select {}
+}
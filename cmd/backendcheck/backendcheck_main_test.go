@@ -0,0 +1,7 @@
+package main_test
+
+import "testing"
+
+func Test_todo(t *testing.T) {
+	t.Skip("Add a test")
+}
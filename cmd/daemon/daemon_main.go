@@ -1,13 +1,19 @@
 package main
 
 import (
+	"context"
+	"encoding/json"
 	"expvar"
 	"flag"
 	"fmt"
 	"log"
+	"net"
 	"net/http"
 	"os"
+	"sync"
+	"time"
 
+	"github.com/instana/envcheck/apiserver"
 	"github.com/instana/envcheck/network"
 )
 
@@ -17,7 +23,7 @@ var (
 )
 
 // Exec is the primary execution for the daemon application.
-func Exec(address string, info DownwardInfo) error {
+func Exec(address string, info DownwardInfo, probe APIProbe) error {
 	log.SetFlags(log.LUTC | log.Lmsgprefix | log.LstdFlags)
 	log.SetPrefix(fmt.Sprintf("pod=%s/%s ", info.Namespace, info.Name))
 
@@ -40,6 +46,13 @@ func Exec(address string, info DownwardInfo) error {
 
 	http.HandleFunc("/ping", PingHandler(info))
 
+	if probe.Interval > 0 {
+		probe.Config.Service = info.KubeAPI
+		results := &probeResults{}
+		http.HandleFunc("/apiserver", results.Handler)
+		go probeLoop(apiserver.New(probe.Config), probe.Interval, results)
+	}
+
 	return http.ListenAndServe(address, nil)
 }
 
@@ -53,11 +66,75 @@ func PingHandler(info DownwardInfo) func(w http.ResponseWriter, r *http.Request)
 	}
 }
 
+// APIProbe configures the periodic API server reachability probe.
+type APIProbe struct {
+	Config   apiserver.Config
+	Interval time.Duration
+}
+
+type probeResults struct {
+	mu      sync.Mutex
+	results []apiserver.Result
+}
+
+// Handler serves the latest probe results as JSON.
+func (p *probeResults) Handler(w http.ResponseWriter, r *http.Request) {
+	p.mu.Lock()
+	b, err := json.Marshal(p.results)
+	p.mu.Unlock()
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.Write(b)
+}
+
+// probeLoop logs every failed probe but only the first success of each
+// address to keep the logs quiet on a healthy cluster.
+func probeLoop(prober *apiserver.Prober, interval time.Duration, latest *probeResults) {
+	healthy := make(map[string]bool)
+	var endpointsErr string
+	for {
+		results, err := prober.ProbeAll(context.Background())
+		if err != nil && err.Error() != endpointsErr {
+			log.Printf("apiserver=endpoints status=failed err='%v'", err)
+		}
+		endpointsErr = ""
+		if err != nil {
+			endpointsErr = err.Error()
+		}
+
+		for _, r := range results {
+			if r.OK() && healthy[r.Address] {
+				continue
+			}
+			healthy[r.Address] = r.OK()
+			log.Printf("apiserver=%s via=%s ok=%v tls=%v auth=%s version=%s readyz=%d latency=%v err='%s'",
+				r.Address, r.Via, r.OK(), r.TLS.OK, r.Auth, r.Version.Detail, r.Readyz.Status, r.TLS.Duration+r.Version.Duration, firstErr(r))
+		}
+		latest.mu.Lock()
+		latest.results = results
+		latest.mu.Unlock()
+		time.Sleep(interval)
+	}
+}
+
+func firstErr(r apiserver.Result) string {
+	for _, c := range []apiserver.Check{r.TLS, r.Version, r.Readyz} {
+		if c.Err != "" {
+			return c.Err
+		}
+	}
+	return ""
+}
+
 func main() {
 	var apiHost string
 	var apiPort string
 	var address string
 	var downward DownwardInfo
+	var probe APIProbe
 
 	flag.StringVar(&downward.Name, "name", os.Getenv("NAME"), "name of this pod.")
 	flag.StringVar(&downward.Namespace, "namespace", os.Getenv("NAMESPACE"), "namespace this service is running in.")
@@ -66,11 +143,14 @@ func main() {
 	flag.StringVar(&address, "address", os.Getenv("ADDRESS"), "listening address for this service to bind on.")
 	flag.StringVar(&apiHost, "kubehost", os.Getenv("KUBERNETES_SERVICE_HOST"), "kube api host")
 	flag.StringVar(&apiPort, "kubeport", os.Getenv("KUBERNETES_SERVICE_PORT"), "kube api port")
+	flag.DurationVar(&probe.Interval, "kube-probe-interval", time.Minute, "interval between API server probes, 0 to disable.")
+	flag.StringVar(&probe.Config.TokenFile, "token-file", apiserver.DefaultTokenFile, "ServiceAccount token used to authenticate the API server probe.")
+	flag.StringVar(&probe.Config.CAFile, "kube-ca-file", apiserver.DefaultCAFile, "CA bundle used to verify the API server.")
 	flag.Parse()
 
-	downward.KubeAPI = fmt.Sprintf("%s:%s", apiHost, apiPort)
+	downward.KubeAPI = net.JoinHostPort(apiHost, apiPort)
 
-	err := Exec(address, downward)
+	err := Exec(address, downward, probe)
 
 	if err != nil {
 		log.Printf("status=shutdown error='%v'\n", err)
@@ -0,0 +1,133 @@
+package main
+
+import (
+	"archive/tar"
+	"compress/gzip"
+	"encoding/json"
+	"io"
+	"os"
+	"time"
+)
+
+// ManifestFile is the name of the bundle entry describing its contents.
+const ManifestFile = "manifest.json"
+
+// BundleManifest describes the contents of a support bundle.
+type BundleManifest struct {
+	Revision string
+	Cluster  string
+	Created  time.Time
+	Redacted bool
+	Entries  []BundleEntry
+}
+
+// BundleEntry describes a file in the bundle, or the error when it could not
+// be collected.
+type BundleEntry struct {
+	Path        string
+	Description string
+	Size        int64  `json:",omitempty"`
+	Err         string `json:",omitempty"`
+}
+
+// NewBundle builds a support bundle writing a gzip compressed tar to w.
+func NewBundle(w io.Writer, now time.Time) *Bundle {
+	gz := gzip.NewWriter(w)
+	return &Bundle{
+		gz:       gz,
+		tw:       tar.NewWriter(gz),
+		now:      now,
+		Manifest: BundleManifest{Revision: Revision, Created: now},
+	}
+}
+
+// Bundle is a support bundle archive. Every file added is recorded in the
+// manifest which is written last on Close.
+type Bundle struct {
+	gz       *gzip.Writer
+	tw       *tar.Writer
+	now      time.Time
+	Manifest BundleManifest
+}
+
+// Add adds the file with the content at path.
+func (b *Bundle) Add(path string, description string, content []byte) error {
+	err := b.tw.WriteHeader(b.header(path, int64(len(content))))
+	if err != nil {
+		return err
+	}
+	_, err = b.tw.Write(content)
+	if err != nil {
+		return err
+	}
+	b.Manifest.Entries = append(b.Manifest.Entries, BundleEntry{Path: path, Description: description, Size: int64(len(content))})
+	return nil
+}
+
+// AddFile adds the content of the file filename at path.
+func (b *Bundle) AddFile(path string, description string, filename string) error {
+	f, err := os.Open(filename)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	stat, err := f.Stat()
+	if err != nil {
+		return err
+	}
+
+	err = b.tw.WriteHeader(b.header(path, stat.Size()))
+	if err != nil {
+		return err
+	}
+	_, err = io.Copy(b.tw, f)
+	if err != nil {
+		return err
+	}
+	b.Manifest.Entries = append(b.Manifest.Entries, BundleEntry{Path: path, Description: description, Size: stat.Size()})
+	return nil
+}
+
+// AddJSON adds the value encoded as indented JSON at path.
+func (b *Bundle) AddJSON(path string, description string, v interface{}) error {
+	content, err := json.MarshalIndent(v, "", "  ")
+	if err != nil {
+		return err
+	}
+	return b.Add(path, description, append(content, '\n'))
+}
+
+// Failed records that the file at path could not be collected.
+func (b *Bundle) Failed(path string, description string, err error) {
+	b.Manifest.Entries = append(b.Manifest.Entries, BundleEntry{Path: path, Description: description, Err: err.Error()})
+}
+
+// Close writes the manifest and flushes the archive.
+func (b *Bundle) Close() error {
+	content, err := json.MarshalIndent(b.Manifest, "", "  ")
+	if err != nil {
+		return err
+	}
+	err = b.tw.WriteHeader(b.header(ManifestFile, int64(len(content)+1)))
+	if err != nil {
+		return err
+	}
+	_, err = b.tw.Write(append(content, '\n'))
+	if err != nil {
+		return err
+	}
+	err = b.tw.Close()
+	if err != nil {
+		return err
+	}
+	return b.gz.Close()
+}
+
+func (b *Bundle) header(path string, size int64) *tar.Header {
+	return &tar.Header{
+		Name:    path,
+		Mode:    0644,
+		Size:    size,
+		ModTime: b.now,
+	}
+}
@@ -0,0 +1,81 @@
+package main
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"encoding/json"
+	"fmt"
+	"io"
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func Test_Bundle_should_write_manifest_last(t *testing.T) {
+	t.Parallel()
+	var buf bytes.Buffer
+	b := NewBundle(&buf, time.Unix(1589217975, 0).UTC())
+	err := b.Add("agent/info.json", "agent status", []byte("{}\n"))
+	if err != nil {
+		t.Fatalf("Add() err=%v, want nil", err)
+	}
+	b.Failed("agent/leader.json", "agent leader lease", fmt.Errorf("endpoint not found"))
+	err = b.Close()
+	if err != nil {
+		t.Fatalf("Close() err=%v, want nil", err)
+	}
+
+	files := untar(t, &buf)
+	expected := []string{"agent/info.json", ManifestFile}
+	var names []string
+	for _, f := range files {
+		names = append(names, f.name)
+	}
+	if !cmp.Equal(expected, names) {
+		t.Fatalf("files mismatch (-want +got)\n%s", cmp.Diff(expected, names))
+	}
+
+	var manifest BundleManifest
+	err = json.Unmarshal(files[1].content, &manifest)
+	if err != nil {
+		t.Fatalf("manifest err=%v, want nil", err)
+	}
+	entries := []BundleEntry{
+		{Path: "agent/info.json", Description: "agent status", Size: 3},
+		{Path: "agent/leader.json", Description: "agent leader lease", Err: "endpoint not found"},
+	}
+	if !cmp.Equal(entries, manifest.Entries) {
+		t.Errorf("manifest.Entries mismatch (-want +got)\n%s", cmp.Diff(entries, manifest.Entries))
+	}
+}
+
+type tarFile struct {
+	name    string
+	content []byte
+}
+
+func untar(t *testing.T, r io.Reader) []tarFile {
+	t.Helper()
+	gz, err := gzip.NewReader(r)
+	if err != nil {
+		t.Fatalf("gzip err=%v, want nil", err)
+	}
+	tr := tar.NewReader(gz)
+	var files []tarFile
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			return files
+		}
+		if err != nil {
+			t.Fatalf("tar err=%v, want nil", err)
+		}
+		content, err := io.ReadAll(tr)
+		if err != nil {
+			t.Fatalf("read err=%v, want nil", err)
+		}
+		files = append(files, tarFile{hdr.Name, content})
+	}
+}
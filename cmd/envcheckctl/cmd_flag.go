@@ -4,6 +4,8 @@ import (
 	"flag"
 	"fmt"
 	"io"
+	"path/filepath"
+	"strings"
 )
 
 var (
@@ -49,9 +51,24 @@ func (cf *CmdFlag) Usage(cmd string) {
 	cf.w.Write([]byte("\n"))
 }
 
+// pluginPrefix is the executable name prefix kubectl uses to find plugins.
+const pluginPrefix = "kubectl-"
+
+// CommandName provides the name the user invoked the executable with. When
+// installed as the kubectl plugin kubectl-envcheck it is "kubectl envcheck".
+func CommandName(arg0 string) string {
+	name := strings.TrimSuffix(filepath.Base(arg0), ".exe")
+	if !strings.HasPrefix(name, pluginPrefix) {
+		return name
+	}
+	// kubectl maps dashes to subcommands and underscores to dashes in plugin names.
+	plugin := strings.ReplaceAll(strings.TrimPrefix(name, pluginPrefix), "-", " ")
+	return "kubectl " + strings.ReplaceAll(plugin, "_", "-")
+}
+
 // Parse extracts the relevant flag values for the appropriate sub-command.
 func (cf *CmdFlag) Parse(args []string) (*EnvcheckConfig, error) {
-	cmd := args[0]
+	cmd := CommandName(args[0])
 	if len(args) < 2 {
 		cf.Usage(cmd)
 		return nil, ErrNoSubcommand
@@ -67,3 +84,16 @@ func (cf *CmdFlag) Parse(args []string) (*EnvcheckConfig, error) {
 	err := p.Parse(args[2:])
 	return cf.configs[subCmd], err
 }
+
+// IsSet indicates whether the named flag of the sub-command was set on the command line.
+func (cf *CmdFlag) IsSet(subCmd string, name string) bool {
+	var set bool
+	p, ok := cf.flagSets[subCmd]
+	if !ok {
+		return false
+	}
+	p.Visit(func(f *flag.Flag) {
+		set = set || f.Name == name
+	})
+	return set
+}
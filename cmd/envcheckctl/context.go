@@ -0,0 +1,39 @@
+package main
+
+import (
+	"context"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+)
+
+// NewContext provides the context for a subcommand. It is cancelled on the
+// first interrupt or terminate signal and after timeout when it is positive.
+// The signal handling is reset once cancelled so a second Ctrl-C exits
+// immediately rather than waiting for any cleanup.
+func NewContext(timeout time.Duration) (context.Context, context.CancelFunc) {
+	sigCtx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	go func() {
+		<-sigCtx.Done()
+		stop()
+	}()
+	if timeout <= 0 {
+		return sigCtx, stop
+	}
+
+	ctx, cancel := context.WithTimeout(sigCtx, timeout)
+	return ctx, func() {
+		cancel()
+		stop()
+	}
+}
+
+// cleanupTimeout bounds the removal of objects once a subcommand is done.
+var cleanupTimeout = 30 * time.Second
+
+// CleanupContext provides a context for removing objects that outlives the
+// cancellation of ctx, as the subcommand timing out is when cleanup runs.
+func CleanupContext(ctx context.Context) (context.Context, context.CancelFunc) {
+	return context.WithTimeout(context.WithoutCancel(ctx), cleanupTimeout)
+}
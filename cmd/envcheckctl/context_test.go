@@ -0,0 +1,44 @@
+package main
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func Test_NewContext(t *testing.T) {
+	t.Parallel()
+	ctx, cancel := NewContext(0)
+	_, ok := ctx.Deadline()
+	cancel()
+	if ok {
+		t.Error("NewContext(0) has deadline, want none")
+	}
+	<-ctx.Done()
+
+	ctx, cancel = NewContext(10 * time.Millisecond)
+	defer cancel()
+	select {
+	case <-ctx.Done():
+		if ctx.Err() != context.DeadlineExceeded {
+			t.Errorf("ctx.Err()=%v, want DeadlineExceeded", ctx.Err())
+		}
+	case <-time.After(time.Second):
+		t.Error("NewContext(10ms) not done after 1s")
+	}
+}
+
+func Test_CleanupContext_outlives_the_subcommand(t *testing.T) {
+	t.Parallel()
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	cleanup, done := CleanupContext(ctx)
+	defer done()
+	if cleanup.Err() != nil {
+		t.Errorf("Err()=%v, want nil after the subcommand is cancelled", cleanup.Err())
+	}
+	if _, ok := cleanup.Deadline(); !ok {
+		t.Error("CleanupContext() has no deadline, want cleanupTimeout")
+	}
+}
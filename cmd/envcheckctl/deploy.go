@@ -0,0 +1,210 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/instana/envcheck/cluster"
+	corev1 "k8s.io/api/core/v1"
+	"sigs.k8s.io/yaml"
+)
+
+// DeployFile is the optional YAML or JSON config file for the daemon and ping
+// subcommands. Flags specified on the command line take precedence.
+type DeployFile struct {
+	ImageRepository string
+	ImageTag        string
+	Port            int
+	cluster.Workload
+}
+
+// Image provides the image reference for name from the configured repository and tag.
+func (c *EnvcheckConfig) Image(name string) string {
+	return fmt.Sprintf("%s/%s:%s", strings.TrimSuffix(c.ImageRepository, "/"), name, c.ImageTag)
+}
+
+// LoadConfigFile applies the values present in filename over the config.
+func LoadConfigFile(filename string, config *EnvcheckConfig) error {
+	b, err := os.ReadFile(filename)
+	if err != nil {
+		return err
+	}
+
+	df := DeployFile{
+		ImageRepository: config.ImageRepository,
+		ImageTag:        config.ImageTag,
+		Port:            config.Port,
+		Workload:        config.Workload,
+	}
+	err = yaml.UnmarshalStrict(b, &df)
+	if err != nil {
+		return fmt.Errorf("invalid config file %s: %v", filename, err)
+	}
+
+	config.ImageRepository = df.ImageRepository
+	config.ImageTag = df.ImageTag
+	config.Port = df.Port
+	config.Workload = df.Workload
+	return nil
+}
+
+// IsDryRun indicates the manifests should be rendered rather than applied.
+func (c *EnvcheckConfig) IsDryRun() bool {
+	return c.DryRun == DryRunClient || c.OutputDir != ""
+}
+
+const (
+	// DryRunNone applies the manifests to the cluster.
+	DryRunNone = "none"
+	// DryRunClient renders the manifests without contacting the cluster.
+	DryRunClient = "client"
+)
+
+func deployFlags(flags *flag.FlagSet, config *EnvcheckConfig) {
+	config.DryRun = DryRunNone
+	flags.Func("dry-run", "none applies the manifests, client prints them instead (default none)", func(s string) error {
+		if s != DryRunNone && s != DryRunClient {
+			return fmt.Errorf("invalid dry-run %q, expected none or client", s)
+		}
+		config.DryRun = s
+		return nil
+	})
+	flags.StringVar(&config.Output, "o", cluster.FormatYAML, "dry-run output format, yaml or json")
+	flags.StringVar(&config.OutputDir, "output-dir", "", "write the manifests and a kustomization.yaml to the directory instead of applying them")
+	workloadFlags(flags, config)
+	flags.DurationVar(&config.Timeout, "timeout", 5*time.Minute, "time to wait for the rollout to be ready, 0 to not wait")
+}
+
+func workloadFlags(flags *flag.FlagSet, config *EnvcheckConfig) {
+	flags.StringVar(&config.ConfigFile, "config", "", "YAML or JSON file with the image, scheduling and resource configuration")
+	flags.StringVar(&config.ImageRepository, "image-repository", "instana", "image repository, e.g. a mirror registry.corp/instana")
+	flags.StringVar(&config.ImageTag, "image-tag", "latest", "image tag")
+	flags.StringVar((*string)(&config.Workload.PullPolicy), "pull-policy", string(corev1.PullAlways), "image pull policy, one of Always, IfNotPresent or Never")
+	flags.Var((*listFlag)(&config.Workload.PullSecrets), "pull-secrets", "comma separated list of image pull secret names")
+	flags.IntVar(&config.Port, "port", 42700, "daemon port")
+	flags.Var((*tolerationsFlag)(&config.Workload.Tolerations), "tolerations", "comma separated tolerations as key[=value][:effect], * tolerates all taints")
+	flags.Var((*mapFlag)(&config.Workload.NodeSelector), "node-selector", "comma separated node selector as key=value")
+	flags.StringVar(&config.Workload.PriorityClass, "priority-class", "", "pod priority class name")
+	flags.StringVar(&config.Workload.Resources.RequestCPU, "cpu-request", cluster.DefaultResources.RequestCPU, "container cpu request")
+	flags.StringVar(&config.Workload.Resources.RequestMemory, "memory-request", cluster.DefaultResources.RequestMemory, "container memory request")
+	flags.StringVar(&config.Workload.Resources.LimitCPU, "cpu-limit", cluster.DefaultResources.LimitCPU, "container cpu limit")
+	flags.StringVar(&config.Workload.Resources.LimitMemory, "memory-limit", cluster.DefaultResources.LimitMemory, "container memory limit")
+}
+
+// listFlag is a comma separated list that replaces its value on each Set.
+type listFlag []string
+
+func (l *listFlag) String() string {
+	return strings.Join(*l, ",")
+}
+
+func (l *listFlag) Set(s string) error {
+	*l = nil
+	for _, v := range strings.Split(s, ",") {
+		v = strings.TrimSpace(v)
+		if v != "" {
+			*l = append(*l, v)
+		}
+	}
+	return nil
+}
+
+// mapFlag is a comma separated list of key=value pairs.
+type mapFlag map[string]string
+
+func (m *mapFlag) String() string {
+	var pairs []string
+	for k, v := range *m {
+		pairs = append(pairs, k+"="+v)
+	}
+	sort.Strings(pairs)
+	return strings.Join(pairs, ",")
+}
+
+func (m *mapFlag) Set(s string) error {
+	*m = make(map[string]string)
+	for _, pair := range strings.Split(s, ",") {
+		if strings.TrimSpace(pair) == "" {
+			continue
+		}
+		k, v, ok := strings.Cut(pair, "=")
+		if !ok || k == "" {
+			return fmt.Errorf("invalid pair %q, expected key=value", pair)
+		}
+		(*m)[strings.TrimSpace(k)] = strings.TrimSpace(v)
+	}
+	return nil
+}
+
+// tolerationsFlag is a comma separated list of tolerations.
+type tolerationsFlag []corev1.Toleration
+
+func (t *tolerationsFlag) String() string {
+	var s []string
+	for _, tol := range *t {
+		v := tol.Key
+		if tol.Key == "" && tol.Operator == corev1.TolerationOpExists {
+			v = "*"
+		}
+		if tol.Value != "" {
+			v += "=" + tol.Value
+		}
+		if tol.Effect != "" {
+			v += ":" + string(tol.Effect)
+		}
+		s = append(s, v)
+	}
+	return strings.Join(s, ",")
+}
+
+func (t *tolerationsFlag) Set(s string) error {
+	tolerations, err := ParseTolerations(s)
+	if err != nil {
+		return err
+	}
+	*t = tolerations
+	return nil
+}
+
+// ParseTolerations parses a comma separated list of tolerations in the
+// kubectl taint format key[=value][:effect]. A toleration without a value
+// uses the Exists operator and * tolerates every taint.
+func ParseTolerations(s string) ([]corev1.Toleration, error) {
+	var tolerations []corev1.Toleration
+	for _, v := range strings.Split(s, ",") {
+		v = strings.TrimSpace(v)
+		if v == "" {
+			continue
+		}
+
+		var tol corev1.Toleration
+		v, effect, _ := strings.Cut(v, ":")
+		switch corev1.TaintEffect(effect) {
+		case "", corev1.TaintEffectNoSchedule, corev1.TaintEffectPreferNoSchedule, corev1.TaintEffectNoExecute:
+			tol.Effect = corev1.TaintEffect(effect)
+		default:
+			return nil, fmt.Errorf("invalid toleration effect %q", effect)
+		}
+
+		key, value, hasValue := strings.Cut(v, "=")
+		switch {
+		case key == "*" && !hasValue:
+			tol.Operator = corev1.TolerationOpExists
+		case key == "":
+			return nil, fmt.Errorf("invalid toleration %q, expected key[=value][:effect]", v)
+		case hasValue:
+			tol.Key = key
+			tol.Operator = corev1.TolerationOpEqual
+			tol.Value = value
+		default:
+			tol.Key = key
+			tol.Operator = corev1.TolerationOpExists
+		}
+		tolerations = append(tolerations, tol)
+	}
+	return tolerations, nil
+}
@@ -0,0 +1,155 @@
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/instana/envcheck/cluster"
+	corev1 "k8s.io/api/core/v1"
+)
+
+func withDeployDefaults(config EnvcheckConfig) *EnvcheckConfig {
+	config.DryRun = DryRunNone
+	config.Output = "yaml"
+	config.ImageRepository = "instana"
+	config.ImageTag = "latest"
+	config.Port = 42700
+	config.Timeout = 5 * time.Minute
+	config.Workload = cluster.Workload{
+		PullPolicy: corev1.PullAlways,
+		Resources:  cluster.DefaultResources,
+	}
+	return &config
+}
+
+// withConnectivityDefaults sets the workload flag defaults without the render flags.
+func withConnectivityDefaults(config EnvcheckConfig) *EnvcheckConfig {
+	c := withDeployDefaults(config)
+	c.DryRun = ""
+	c.Output = ""
+	return c
+}
+
+func Test_parse_deploy_flags(t *testing.T) {
+	t.Parallel()
+	args := []string{"envcheckctl", "daemon",
+		"-image-repository=registry.corp/instana", "-image-tag=1.2.3", "-pull-policy=IfNotPresent",
+		"-pull-secrets=mirror,backup", "-port=42800", "-tolerations=*", "-node-selector=kubernetes.io/os=linux",
+		"-priority-class=system-node-critical", "-memory-limit=64Mi"}
+	actual, err := Parse(args, ioutil.Discard)
+	if err != nil {
+		t.Fatalf("err=%v, want nil", err)
+	}
+
+	expected := withDeployDefaults(EnvcheckConfig{Subcommand: ApplyDaemon, AgentNamespace: "instana-agent"})
+	expected.ImageRepository = "registry.corp/instana"
+	expected.ImageTag = "1.2.3"
+	expected.Port = 42800
+	expected.Workload.PullPolicy = corev1.PullIfNotPresent
+	expected.Workload.PullSecrets = []string{"mirror", "backup"}
+	expected.Workload.Tolerations = []corev1.Toleration{{Operator: corev1.TolerationOpExists}}
+	expected.Workload.NodeSelector = map[string]string{"kubernetes.io/os": "linux"}
+	expected.Workload.PriorityClass = "system-node-critical"
+	expected.Workload.Resources.LimitMemory = "64Mi"
+	if !cmp.Equal(expected, actual) {
+		t.Errorf("Parse() mismatch (-want +got)\n%s", cmp.Diff(expected, actual))
+	}
+	if actual.Image("envcheck-daemon") != "registry.corp/instana/envcheck-daemon:1.2.3" {
+		t.Errorf("Image()=%v, want registry.corp/instana/envcheck-daemon:1.2.3", actual.Image("envcheck-daemon"))
+	}
+}
+
+func Test_parse_config_file_flags_take_precedence(t *testing.T) {
+	t.Parallel()
+	filename := filepath.Join(t.TempDir(), "envcheck.yaml")
+	err := os.WriteFile(filename, []byte(`imageRepository: registry.corp/instana
+imageTag: 1.2.3
+pullPolicy: IfNotPresent
+tolerations:
+- key: node-role.kubernetes.io/control-plane
+  operator: Exists
+  effect: NoSchedule
+resources:
+  limitMemory: 64Mi
+`), 0600)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	actual, err := Parse([]string{"envcheckctl", "ping", "-config=" + filename, "-image-tag=4.5.6", "-as=jane", "-as-group=ops"}, ioutil.Discard)
+	if err != nil {
+		t.Fatalf("err=%v, want nil", err)
+	}
+
+	expected := withDeployDefaults(EnvcheckConfig{Subcommand: ApplyPinger, PingerNamespace: "default", ConfigFile: filename, As: "jane", AsGroups: []string{"ops"}, Parallel: 4})
+	expected.ImageRepository = "registry.corp/instana"
+	expected.ImageTag = "4.5.6"
+	expected.Workload.PullPolicy = corev1.PullIfNotPresent
+	expected.Workload.Tolerations = []corev1.Toleration{{Key: "node-role.kubernetes.io/control-plane", Operator: corev1.TolerationOpExists, Effect: corev1.TaintEffectNoSchedule}}
+	expected.Workload.Resources.LimitMemory = "64Mi"
+	if !cmp.Equal(expected, actual) {
+		t.Errorf("Parse() mismatch (-want +got)\n%s", cmp.Diff(expected, actual))
+	}
+}
+
+func Test_parse_config_file_unknown_field(t *testing.T) {
+	t.Parallel()
+	filename := filepath.Join(t.TempDir(), "envcheck.yaml")
+	err := os.WriteFile(filename, []byte("imageRepo: registry.corp/instana\n"), 0600)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, err = Parse([]string{"envcheckctl", "daemon", "-config=" + filename}, ioutil.Discard)
+	if err == nil {
+		t.Errorf("err=nil, want unknown field error")
+	}
+}
+
+func Test_parse_dry_run(t *testing.T) {
+	t.Parallel()
+	actual, err := Parse([]string{"envcheckctl", "ping", "-dry-run=client", "-o=json"}, ioutil.Discard)
+	if err != nil {
+		t.Fatalf("err=%v, want nil", err)
+	}
+	if !actual.IsDryRun() || actual.Output != "json" {
+		t.Errorf("IsDryRun()=%v Output=%v, want true json", actual.IsDryRun(), actual.Output)
+	}
+
+	_, err = Parse([]string{"envcheckctl", "ping", "-dry-run=server"}, ioutil.Discard)
+	if err == nil {
+		t.Errorf("err=nil, want invalid dry-run error")
+	}
+}
+
+func Test_ParseTolerations(t *testing.T) {
+	t.Parallel()
+	cases := map[string]struct {
+		s        string
+		expected []corev1.Toleration
+		valid    bool
+	}{
+		"all":         {"*", []corev1.Toleration{{Operator: corev1.TolerationOpExists}}, true},
+		"key exists":  {"dedicated:NoSchedule", []corev1.Toleration{{Key: "dedicated", Operator: corev1.TolerationOpExists, Effect: corev1.TaintEffectNoSchedule}}, true},
+		"key value":   {"dedicated=infra", []corev1.Toleration{{Key: "dedicated", Operator: corev1.TolerationOpEqual, Value: "infra"}}, true},
+		"invalid":     {"dedicated:Sometimes", nil, false},
+		"missing key": {"=infra", nil, false},
+	}
+	for name, tc := range cases {
+		tc := tc
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+			actual, err := ParseTolerations(tc.s)
+			if (err == nil) != tc.valid {
+				t.Fatalf("err=%v, want valid=%v", err, tc.valid)
+			}
+			if !cmp.Equal(tc.expected, actual) {
+				t.Errorf("ParseTolerations() mismatch (-want +got)\n%s", cmp.Diff(tc.expected, actual))
+			}
+		})
+	}
+}
@@ -5,9 +5,11 @@ import (
 	"io"
 	"log"
 	"os"
-	"os/user"
-	"path/filepath"
 	"runtime"
+	"time"
+
+	"github.com/instana/envcheck/cluster"
+	"github.com/instana/envcheck/repocheck"
 )
 
 var (
@@ -22,17 +24,42 @@ func ExecVersion(w io.Writer) {
 
 // Exec is the primary execution for the envcheckctl application.
 func Exec(config EnvcheckConfig) {
+	err := config.DefaultNamespace()
+	if err != nil {
+		log.Fatalf("namespace=failed err='%v'\n", err)
+	}
+
+	timeout := config.Timeout
+	if config.Subcommand == InspectCluster && config.IsFleet() && config.IsLive() {
+		// the fleet applies the timeout to each cluster instead.
+		timeout = 0
+	}
+	ctx, cancel := NewContext(timeout)
+	defer cancel()
+
 	switch config.Subcommand {
 	case Agent:
-		ExecAgent(config)
+		ExecAgent(ctx, config)
 	case ApplyDaemon:
-		ExecDaemon(config)
+		ExecDaemon(ctx, config)
+	case Backend:
+		ExecBackend(ctx, config)
 	case ApplyPinger:
-		ExecPinger(config)
+		ExecPinger(ctx, config)
+	case ConnectivityTest:
+		ExecConnectivity(ctx, config)
 	case InspectCluster:
-		ExecInspect(config)
+		ExecInspect(ctx, config)
 	case Leader:
-		ExecLeader(config)
+		ExecLeader(ctx, config)
+	case RepocheckHistory:
+		ExecRepocheck(ctx, config)
+	case RedactPodfile:
+		ExecRedact(config)
+	case SupportBundle:
+		ExecBundle(ctx, config)
+	case LogSignatures:
+		ExecLogs(ctx, config)
 	case PrintVersion:
 		ExecVersion(os.Stdout)
 	}
@@ -42,15 +69,48 @@ func Exec(config EnvcheckConfig) {
 type EnvcheckConfig struct {
 	AgentNamespace    string
 	AgentName         string
+	AllContexts       bool
+	AllNamespaces     bool
+	As                string
+	AsGroups          []string
 	Annotation        string
+	Compress          bool
+	ConfigFile        string
+	Context           string
+	Contexts          string
+	DryRun            string
+	Endpoint          string
+	HostNetwork       bool
+	ImageRepository   string
+	ImageTag          string
 	IncludeNamespaces string
+	Keep              bool
+	KeepAnnotations   string
+	KubeNamespace     string
 	Kubeconfig        string
+	Namespaces        string
+	NamespaceSet      bool
+	Output            string
+	Parallel          int
+	OutputDir         string
+	OutputFile        string
 	PingerHost        string
 	PingerNamespace   string
 	Podfile           string
+	Port              int
 	Profile           bool
+	Proxy             string
+	Redact            bool
+	ReplaceExisting   bool
+	Selector          string
+	SignatureFile     string
+	Since             time.Duration
 	Subcommand        int
+	Tail              int
+	Timeout           time.Duration
 	UseGateway        bool
+	Workers           int
+	Workload          cluster.Workload
 }
 
 // IsLive indicates whether the inspect details should be loaded from an API or file.
@@ -69,67 +129,153 @@ const (
 	ApplyDaemon
 	// ApplyPinger is the subcommand flag to indicate the pinger to be executed.
 	ApplyPinger
+	// Backend is the subcommand flag to indicate the backend check to be executed.
+	Backend
+	// ConnectivityTest is the subcommand flag to indicate the end-to-end connectivity test to be executed.
+	ConnectivityTest
 	// InspectCluster is the subcommand flag to indicate the inspect to be executed.
 	InspectCluster
 	// Leader is the subcommand enum to indicate leader commands should be executed.
 	Leader
+	// RepocheckHistory is the subcommand enum to indicate the repocheck history should be fetched.
+	RepocheckHistory
+	// RedactPodfile is the subcommand enum to indicate a podfile should be redacted.
+	RedactPodfile
+	// SupportBundle is the subcommand enum to indicate a support bundle should be collected.
+	SupportBundle
+	// LogSignatures is the subcommand enum to indicate the agent logs should be scanned for known problems.
+	LogSignatures
 	// PrintVersion is the subcommand flag to indicate the version print to be executed.
 	PrintVersion
 )
 
 // Parse parses the individual subcommands and returns the related configuration.
-func Parse(args []string, kubepath string, w io.Writer) (*EnvcheckConfig, error) {
+func Parse(args []string, w io.Writer) (*EnvcheckConfig, error) {
 	cmdFlags := New(w)
 
 	flags, config := cmdFlags.FlagSet("agent", Agent)
 	flags.StringVar(&config.AgentNamespace, "ns", "instana-agent", "agent namespace")
 	flags.StringVar(&config.AgentName, "name", "instana-agent", "agent daemonset name")
-	flags.StringVar(&config.Kubeconfig, "kubeconfig", kubepath, "absolute path to the kubeconfig file")
+	kubeconfigFlags(flags, config)
+	flags.DurationVar(&config.Timeout, "timeout", time.Minute, "time limit for the command, 0 for no limit")
 
 	flags, config = cmdFlags.FlagSet("daemon", ApplyDaemon)
 	flags.StringVar(&config.AgentNamespace, "ns", "instana-agent", "daemon namespace")
-	flags.StringVar(&config.Kubeconfig, "kubeconfig", kubepath, "absolute path to the kubeconfig file")
+	kubeconfigFlags(flags, config)
+	deployFlags(flags, config)
 
 	flags, config = cmdFlags.FlagSet("ping", ApplyPinger)
 	flags.StringVar(&config.PingerHost, "host", "", "override IP or DNS name to ping. defaults to nodeIP if blank")
-	flags.StringVar(&config.PingerNamespace, "ns", "default", "ping client namespace")
-	flags.StringVar(&config.Kubeconfig, "kubeconfig", kubepath, "absolute path to the kubeconfig file")
+	flags.StringVar(&config.PingerNamespace, "ns", "default", "comma separated list of ping client namespaces")
+	flags.BoolVar(&config.AllNamespaces, "all-namespaces", false, "ping from every namespace matching -selector")
+	flags.StringVar(&config.Selector, "selector", "", "namespace label selector used with -all-namespaces")
+	kubeconfigFlags(flags, config)
 	flags.BoolVar(&config.UseGateway, "use-gateway", false, "use the pods gateway as the host to ping")
+	flags.IntVar(&config.Parallel, "parallel", 4, "number of namespaces tested concurrently")
+	deployFlags(flags, config)
+
+	flags, config = cmdFlags.FlagSet("backend", Backend)
+	flags.StringVar(&config.Endpoint, "endpoint", "ingress-red-saas.instana.io:443", "agent backend endpoint as host:port")
+	flags.StringVar(&config.AgentNamespace, "ns", "instana-agent", "backend check namespace")
+	flags.BoolVar(&config.HostNetwork, "host-network", true, "run the check on the host network like the agent, pod network if false")
+	flags.StringVar(&config.Proxy, "proxy", "", "proxy URL to reach the backend through")
+	flags.DurationVar(&config.Timeout, "timeout", 2*time.Minute, "time to wait for results from all nodes")
+	flags.StringVar(&config.ImageRepository, "image-repository", "instana", "image repository, e.g. a mirror registry.corp/instana")
+	flags.StringVar(&config.ImageTag, "image-tag", "latest", "image tag")
+	kubeconfigFlags(flags, config)
+
+	flags, config = cmdFlags.FlagSet("connectivity", ConnectivityTest)
+	flags.StringVar(&config.AgentNamespace, "ns", "instana-agent", "daemon namespace")
+	flags.StringVar(&config.PingerNamespace, "pinger-ns", "default", "pinger namespace")
+	flags.BoolVar(&config.Keep, "keep", false, "keep the daemon and pinger after the test")
+	flags.BoolVar(&config.ReplaceExisting, "replace-existing", false, "update an existing daemon or pinger for the test and leave it in place afterwards")
+	flags.DurationVar(&config.Timeout, "timeout", 5*time.Minute, "time to wait for the rollout and every pinger to report")
+	kubeconfigFlags(flags, config)
+	workloadFlags(flags, config)
 
 	flags, config = cmdFlags.FlagSet("inspect", InspectCluster)
-	flags.StringVar(&config.Podfile, "podfile", "", "read from podfile instead of live cluster query")
-	flags.StringVar(&config.Kubeconfig, "kubeconfig", kubepath, "absolute path to the kubeconfig file")
+	flags.StringVar(&config.Podfile, "podfile", "", "read from podfile, or a directory of podfiles for a fleet summary, instead of live cluster query")
+	kubeconfigFlags(flags, config)
+	flags.BoolVar(&config.AllContexts, "all-contexts", false, "inspect the cluster of every kubeconfig context and print a fleet summary")
+	flags.StringVar(&config.Contexts, "contexts", "", "comma separated list of kubeconfig contexts to inspect and print a fleet summary for")
+	flags.IntVar(&config.Parallel, "parallel", 4, "number of clusters inspected concurrently with -all-contexts or -contexts")
 	flags.StringVar(&config.Annotation, "annotation", "", "group by annotation value")
 	flags.StringVar(&config.IncludeNamespaces, "include", "", "comma separated list of namespaces to include, empty list will include everything")
+	flags.StringVar(&config.Namespaces, "namespaces", "", "comma separated list of namespaces to collect from instead of cluster-wide")
+	flags.DurationVar(&config.Timeout, "timeout", 10*time.Minute, "time limit for the command, 0 for no limit")
+	flags.IntVar(&config.Workers, "workers", cluster.DefaultWorkers, "number of collection steps to run concurrently")
+	flags.BoolVar(&config.Compress, "compress", true, "gzip compress the podfile written")
+	flags.StringVar(&config.OutputDir, "output-dir", "", "directory to write the podfiles to, defaults to the current directory")
+	flags.BoolVar(&config.Redact, "redact", false, "pseudonymise names and drop annotations in the podfile written")
+	flags.StringVar(&config.KeepAnnotations, "keep-annotations", "", "comma separated list of annotation and label keys kept with -redact")
 
 	flags, config = cmdFlags.FlagSet("leader", Leader)
-	flags.StringVar(&config.Kubeconfig, "kubeconfig", kubepath, "absolute path to the kubeconfig file")
+	kubeconfigFlags(flags, config)
 	flags.BoolVar(&config.Profile, "profile", false, "attach a profiler to the agent")
+	flags.DurationVar(&config.Timeout, "timeout", time.Minute, "time limit for the command, 0 for no limit")
+
+	flags, config = cmdFlags.FlagSet("repocheck", RepocheckHistory)
+	flags.StringVar(&config.AgentNamespace, "ns", "instana-agent", "repocheck namespace")
+	flags.StringVar(&config.Selector, "selector", "app=repocheck", "repocheck pod label selector")
+	flags.IntVar(&config.Port, "port", repocheck.DefaultPort, "repocheck results port")
+	flags.DurationVar(&config.Since, "since", 7*24*time.Hour, "how far back to fetch the history")
+	kubeconfigFlags(flags, config)
+	flags.DurationVar(&config.Timeout, "timeout", time.Minute, "time limit for the command, 0 for no limit")
+
+	flags, config = cmdFlags.FlagSet("redact", RedactPodfile)
+	flags.StringVar(&config.Podfile, "podfile", "", "podfile to redact")
+	flags.StringVar(&config.OutputFile, "out", "", "redacted podfile to write, defaults to the podfile name with -redacted")
+	flags.StringVar(&config.KeepAnnotations, "keep-annotations", "", "comma separated list of annotation and label keys to keep")
+	flags.BoolVar(&config.Compress, "compress", true, "gzip compress the redacted podfile")
+
+	flags, config = cmdFlags.FlagSet("bundle", SupportBundle)
+	flags.StringVar(&config.AgentNamespace, "ns", "instana-agent", "agent namespace")
+	flags.StringVar(&config.AgentName, "name", "instana-agent", "agent daemonset name")
+	flags.StringVar(&config.Selector, "selector", "", "agent pod label selector, defaults to the daemonset selector")
+	flags.IntVar(&config.Tail, "tail", 1000, "number of lines of each agent container log to collect, 0 for all")
+	flags.StringVar(&config.Namespaces, "namespaces", "", "comma separated list of namespaces to collect pods from instead of cluster-wide")
+	flags.IntVar(&config.Workers, "workers", cluster.DefaultWorkers, "number of collection steps to run concurrently")
+	flags.BoolVar(&config.Redact, "redact", false, "pseudonymise names and drop annotations in the bundle")
+	flags.StringVar(&config.KeepAnnotations, "keep-annotations", "", "comma separated list of annotation and label keys kept with -redact")
+	flags.StringVar(&config.OutputFile, "out", "", "bundle to write, defaults to envcheck-bundle-<timestamp>.tar.gz")
+	kubeconfigFlags(flags, config)
+	flags.DurationVar(&config.Timeout, "timeout", 10*time.Minute, "time limit for the command, 0 for no limit")
+
+	flags, config = cmdFlags.FlagSet("logs", LogSignatures)
+	flags.StringVar(&config.AgentNamespace, "ns", "instana-agent", "agent namespace")
+	flags.StringVar(&config.AgentName, "name", "instana-agent", "agent daemonset name")
+	flags.StringVar(&config.Selector, "selector", "", "agent pod label selector, defaults to the daemonset selector")
+	flags.IntVar(&config.Tail, "tail", 10000, "number of lines of each agent container log to scan, 0 for all")
+	flags.StringVar(&config.SignatureFile, "signatures", "", "YAML or JSON file of signatures extending the built-in catalogue")
+	kubeconfigFlags(flags, config)
+	flags.DurationVar(&config.Timeout, "timeout", 5*time.Minute, "time limit for the command, 0 for no limit")
 
 	cmdFlags.FlagSet("version", PrintVersion)
 
-	return cmdFlags.Parse(args)
+	config, err := cmdFlags.Parse(args)
+	if err == nil && config.ConfigFile != "" {
+		err = LoadConfigFile(config.ConfigFile, config)
+		if err != nil {
+			w.Write([]byte(err.Error() + "\n"))
+			return nil, err
+		}
+		// parse the flags again as those specified take precedence over the
+		// config file, the repeatable flags are reset so they are not doubled.
+		config.AsGroups = nil
+		config, err = cmdFlags.Parse(args)
+	}
+	if err != nil {
+		return config, err
+	}
+	config.NamespaceSet = cmdFlags.IsSet(args[1], "ns")
+	return config, nil
 }
 
 func main() {
-	kubepath := configPath()
-	config, err := Parse(os.Args, kubepath, os.Stderr)
+	config, err := Parse(os.Args, os.Stderr)
 	if err != nil {
 		os.Exit(1)
 	}
 
 	Exec(*config)
 }
-
-func configPath() string {
-	env := os.Getenv("KUBECONFIG")
-	if env != "" {
-		return env
-	}
-	usr, err := user.Current()
-	if err != nil {
-		log.Println(err)
-		return ""
-	}
-	return filepath.Join(usr.HomeDir, ".kube", "config")
-}
@@ -4,8 +4,10 @@ import (
 	"io/ioutil"
 	"log"
 	"testing"
+	"time"
 
 	"github.com/google/go-cmp/cmp"
+	"github.com/instana/envcheck/cluster"
 )
 
 func init() {
@@ -14,7 +16,7 @@ func init() {
 
 func Test_parse_no_subcommand(t *testing.T) {
 	t.Parallel()
-	_, err := Parse([]string{"envcheckctl"}, "", ioutil.Discard)
+	_, err := Parse([]string{"envcheckctl"}, ioutil.Discard)
 	if err != ErrNoSubcommand {
 		t.Errorf("err=%v, want ErrNoSubcommand", err)
 	}
@@ -22,7 +24,7 @@ func Test_parse_no_subcommand(t *testing.T) {
 
 func Test_parse_unknown_subcommand(t *testing.T) {
 	t.Parallel()
-	_, err := Parse([]string{"envcheckctl", "foobar"}, "", ioutil.Discard)
+	_, err := Parse([]string{"envcheckctl", "foobar"}, ioutil.Discard)
 	if err != ErrUnknownSubcommand {
 		t.Errorf("err=%v, want ErrUnknownSubcommand", err)
 	}
@@ -30,31 +32,65 @@ func Test_parse_unknown_subcommand(t *testing.T) {
 
 func Test_parse_unknown_flag(t *testing.T) {
 	t.Parallel()
-	_, err := Parse([]string{"envcheckctl", "version", "-foobar"}, "", ioutil.Discard)
+	_, err := Parse([]string{"envcheckctl", "version", "-foobar"}, ioutil.Discard)
 	if err.Error() != "flag provided but not defined: -foobar" {
 		t.Errorf("err=%#v, want <flag provided but not defined: -foobar>", err)
 	}
 }
 
+func Test_CommandName(t *testing.T) {
+	t.Parallel()
+	testCases := map[string]string{
+		"envcheckctl":                     "envcheckctl",
+		"/usr/local/bin/envcheckctl":      "envcheckctl",
+		"envcheckctl.exe":                 "envcheckctl",
+		"/usr/local/bin/kubectl-envcheck": "kubectl envcheck",
+		"kubectl-envcheck.exe":            "kubectl envcheck",
+		"kubectl-env_check":               "kubectl env-check",
+	}
+
+	for arg0, expected := range testCases {
+		actual := CommandName(arg0)
+		if actual != expected {
+			t.Errorf("CommandName(%q)=%q, want %q", arg0, actual, expected)
+		}
+	}
+}
+
 func Test_parse_flags(t *testing.T) {
 	t.Parallel()
 	cases := map[string]struct {
 		args   []string
 		config *EnvcheckConfig
 	}{
-		"daemon":             {[]string{"envcheckctl", "daemon"}, &EnvcheckConfig{Subcommand: ApplyDaemon, AgentNamespace: "instana-agent"}},
-		"inspect":            {[]string{"envcheckctl", "inspect"}, &EnvcheckConfig{Subcommand: InspectCluster}},
-		"inspect offline":    {[]string{"envcheckctl", "inspect", "-podfile=foobar.json"}, &EnvcheckConfig{Subcommand: InspectCluster, Podfile: "foobar.json"}},
-		"ping":               {[]string{"envcheckctl", "ping"}, &EnvcheckConfig{Subcommand: ApplyPinger, PingerNamespace: "default"}},
-		"ping using gateway": {[]string{"envcheckctl", "ping", "-use-gateway"}, &EnvcheckConfig{Subcommand: ApplyPinger, PingerNamespace: "default", UseGateway: true}},
-		"leader":             {[]string{"envcheckctl", "leader"}, &EnvcheckConfig{Subcommand: Leader}},
-		"leader profile":     {[]string{"envcheckctl", "leader", "-profile"}, &EnvcheckConfig{Subcommand: Leader, Profile: true}},
-		"version":            {[]string{"envcheckctl", "version"}, &EnvcheckConfig{Subcommand: PrintVersion}},
+		"backend":              {[]string{"envcheckctl", "backend", "-host-network=false"}, &EnvcheckConfig{Subcommand: Backend, AgentNamespace: "instana-agent", Endpoint: "ingress-red-saas.instana.io:443", Timeout: 2 * time.Minute, ImageRepository: "instana", ImageTag: "latest"}},
+		"connectivity":         {[]string{"envcheckctl", "connectivity", "-keep"}, withConnectivityDefaults(EnvcheckConfig{Subcommand: ConnectivityTest, AgentNamespace: "instana-agent", PingerNamespace: "default", Keep: true})},
+		"daemon":               {[]string{"envcheckctl", "daemon"}, withDeployDefaults(EnvcheckConfig{Subcommand: ApplyDaemon, AgentNamespace: "instana-agent"})},
+		"inspect":              {[]string{"envcheckctl", "inspect"}, &EnvcheckConfig{Subcommand: InspectCluster, Timeout: 10 * time.Minute, Workers: cluster.DefaultWorkers, Parallel: 4, Compress: true}},
+		"inspect timeout":      {[]string{"envcheckctl", "inspect", "-timeout=30s"}, &EnvcheckConfig{Subcommand: InspectCluster, Timeout: 30 * time.Second, Workers: cluster.DefaultWorkers, Parallel: 4, Compress: true}},
+		"inspect offline":      {[]string{"envcheckctl", "inspect", "-podfile=foobar.json"}, &EnvcheckConfig{Subcommand: InspectCluster, Podfile: "foobar.json", Timeout: 10 * time.Minute, Workers: cluster.DefaultWorkers, Parallel: 4, Compress: true}},
+		"inspect namespaces":   {[]string{"envcheckctl", "inspect", "-namespaces=a,b"}, &EnvcheckConfig{Subcommand: InspectCluster, Namespaces: "a,b", Timeout: 10 * time.Minute, Workers: cluster.DefaultWorkers, Parallel: 4, Compress: true}},
+		"inspect uncompressed": {[]string{"envcheckctl", "inspect", "-compress=false"}, &EnvcheckConfig{Subcommand: InspectCluster, Timeout: 10 * time.Minute, Workers: cluster.DefaultWorkers, Parallel: 4}},
+		"inspect redact":       {[]string{"envcheckctl", "inspect", "-redact", "-keep-annotations=a,b"}, &EnvcheckConfig{Subcommand: InspectCluster, Redact: true, KeepAnnotations: "a,b", Timeout: 10 * time.Minute, Workers: cluster.DefaultWorkers, Parallel: 4, Compress: true}},
+		"inspect contexts":     {[]string{"envcheckctl", "inspect", "-contexts=dev,prod", "-parallel=2"}, &EnvcheckConfig{Subcommand: InspectCluster, Contexts: "dev,prod", Parallel: 2, Timeout: 10 * time.Minute, Workers: cluster.DefaultWorkers, Compress: true}},
+		"inspect all contexts": {[]string{"envcheckctl", "inspect", "-all-contexts"}, &EnvcheckConfig{Subcommand: InspectCluster, AllContexts: true, Parallel: 4, Timeout: 10 * time.Minute, Workers: cluster.DefaultWorkers, Compress: true}},
+		"redact":               {[]string{"envcheckctl", "redact", "-podfile=cluster-info-1.json.gz", "-out=shared.json.gz"}, &EnvcheckConfig{Subcommand: RedactPodfile, Podfile: "cluster-info-1.json.gz", OutputFile: "shared.json.gz", Compress: true}},
+		"bundle":               {[]string{"envcheckctl", "bundle", "-redact", "-tail=50"}, &EnvcheckConfig{Subcommand: SupportBundle, AgentNamespace: "instana-agent", AgentName: "instana-agent", Tail: 50, Workers: cluster.DefaultWorkers, Redact: true, Timeout: 10 * time.Minute}},
+		"logs":                 {[]string{"envcheckctl", "logs", "-signatures=signatures.yaml"}, &EnvcheckConfig{Subcommand: LogSignatures, AgentNamespace: "instana-agent", AgentName: "instana-agent", Tail: 10000, SignatureFile: "signatures.yaml", Timeout: 5 * time.Minute}},
+		"ping":                 {[]string{"envcheckctl", "ping"}, withDeployDefaults(EnvcheckConfig{Subcommand: ApplyPinger, PingerNamespace: "default", Parallel: 4})},
+		"ping using gateway":   {[]string{"envcheckctl", "ping", "-use-gateway"}, withDeployDefaults(EnvcheckConfig{Subcommand: ApplyPinger, PingerNamespace: "default", UseGateway: true, Parallel: 4})},
+		"ping namespaces":      {[]string{"envcheckctl", "ping", "-all-namespaces", "-selector=team=x"}, withDeployDefaults(EnvcheckConfig{Subcommand: ApplyPinger, PingerNamespace: "default", AllNamespaces: true, Selector: "team=x", Parallel: 4})},
+		"leader":               {[]string{"envcheckctl", "leader"}, &EnvcheckConfig{Subcommand: Leader, Timeout: time.Minute}},
+		"leader kubeconfig":    {[]string{"envcheckctl", "leader", "-context=prod", "-namespace=team-a", "-as=jane", "-as-group=ops", "-as-group=sre"}, &EnvcheckConfig{Subcommand: Leader, Context: "prod", KubeNamespace: "team-a", As: "jane", AsGroups: []string{"ops", "sre"}, Timeout: time.Minute}},
+		"logs namespace":       {[]string{"envcheckctl", "logs", "-ns=team-a"}, &EnvcheckConfig{Subcommand: LogSignatures, AgentNamespace: "team-a", NamespaceSet: true, AgentName: "instana-agent", Tail: 10000, Timeout: 5 * time.Minute}},
+		"leader profile":       {[]string{"envcheckctl", "leader", "-profile"}, &EnvcheckConfig{Subcommand: Leader, Profile: true, Timeout: time.Minute}},
+		"repocheck":            {[]string{"envcheckctl", "repocheck", "-since=24h"}, &EnvcheckConfig{Subcommand: RepocheckHistory, AgentNamespace: "instana-agent", Selector: "app=repocheck", Port: 42701, Since: 24 * time.Hour, Timeout: time.Minute}},
+		"version":              {[]string{"envcheckctl", "version"}, &EnvcheckConfig{Subcommand: PrintVersion}},
 	}
 	for name, tc := range cases {
 		tc := tc
 		t.Run(name, func(t *testing.T) {
-			actual, err := Parse(tc.args, "", ioutil.Discard)
+			actual, err := Parse(tc.args, ioutil.Discard)
 			if err != nil {
 				t.Errorf("err=%v, want nil", err)
 			}
@@ -1,19 +1,20 @@
 package main
 
 import (
+	"context"
 	"fmt"
 	"github.com/instana/envcheck/cluster"
 	"log"
 )
 
 // ExecAgent executes the agent debug sub-command.
-func ExecAgent(config EnvcheckConfig) {
-	query, err := cluster.New(config.Kubeconfig)
+func ExecAgent(ctx context.Context, config EnvcheckConfig) {
+	query, err := cluster.New(config.ClusterConfig())
 	if err != nil {
 		log.Fatalf("error initialising cluster query: %v\n", err)
 	}
 
-	info, err := query.AgentInfo(config.AgentNamespace, config.AgentName)
+	info, err := query.AgentInfo(ctx, config.AgentNamespace, config.AgentName)
 	if err != nil {
 		return
 	}
@@ -0,0 +1,182 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"os"
+	"sort"
+	"time"
+
+	"github.com/instana/envcheck/backend"
+	"github.com/instana/envcheck/cluster"
+)
+
+// ExecBackend deploys the backend check DaemonSet, collects the result from
+// each node and removes the DaemonSet.
+func ExecBackend(ctx context.Context, config EnvcheckConfig) {
+	log.SetFlags(0)
+	command, err := cluster.NewCommand(config.ClusterConfig())
+	if err != nil {
+		log.Fatalf("createClient=failed err='%v'\n", err)
+	}
+
+	query, err := cluster.New(config.ClusterConfig())
+	if err != nil {
+		log.Fatalf("error initialising cluster query: %v\n", err)
+	}
+
+	bc := cluster.BackendConfig{
+		Image:       config.Image("envcheck-backendcheck"),
+		Namespace:   config.AgentNamespace,
+		Version:     Revision,
+		Endpoint:    config.Endpoint,
+		HostNetwork: config.HostNetwork,
+		Proxy:       config.Proxy,
+	}
+	applied, err := command.CreateBackend(ctx, bc)
+	if err != nil {
+		log.Fatalf("createBackend=failed err='%v'\n", err)
+	}
+	log.Printf("applied=%v action=%s\n", applied, applied.Action)
+	log.Printf("endpoint=%s namespace=%s hostNetwork=%v proxy=%v timeout=%v\n", bc.Endpoint, bc.Namespace, bc.HostNetwork, bc.Proxy != "", config.Timeout)
+
+	results, pending := CollectBackend(ctx, query, config.AgentNamespace)
+
+	cleanupCtx, cancel := CleanupContext(ctx)
+	defer cancel()
+	err = command.DeleteBackend(cleanupCtx, config.AgentNamespace)
+	if err != nil {
+		log.Printf("deleteBackend=failed err='%v'\n", err)
+	}
+
+	failed := PrintBackend(results, pending)
+	if failed > 0 || len(pending) > 0 {
+		os.Exit(1)
+	}
+}
+
+// CollectBackend polls the backend check pod logs until every scheduled pod
+// has reported a result or ctx is done.
+func CollectBackend(ctx context.Context, query *cluster.KubernetesQuery, namespace string) ([]backend.Result, map[string]error) {
+	for {
+		var desired int
+		info, err := query.AgentInfo(ctx, namespace, cluster.BackendName)
+		if err == nil {
+			desired = int(info.Desired)
+		}
+
+		var results []backend.Result
+		var pending map[string]error
+		responses, err := query.PodLogs(ctx, namespace, cluster.LabelName+"="+cluster.BackendName, 0)
+		if err == nil {
+			results, pending = DecodeBackend(responses)
+		}
+
+		if desired > 0 && len(results) >= desired {
+			return results, pending
+		}
+		log.Printf("results=%d desired=%d\n", len(results), desired)
+		select {
+		case <-ctx.Done():
+			return results, pending
+		case <-time.After(3 * time.Second):
+		}
+	}
+}
+
+// DecodeBackend extracts the result from each pod log, pods without a result
+// are returned with the reason.
+func DecodeBackend(responses []cluster.PodResponse) ([]backend.Result, map[string]error) {
+	var results []backend.Result
+	pending := make(map[string]error)
+	for _, resp := range responses {
+		if resp.Err != nil {
+			pending[resp.Pod] = resp.Err
+			continue
+		}
+		result, err := backend.Decode(resp.Body)
+		if err != nil {
+			pending[resp.Pod] = err
+			continue
+		}
+		if result.Node == "" {
+			result.Node = resp.Node
+		}
+		results = append(results, *result)
+	}
+	sort.Slice(results, func(i, j int) bool {
+		return results[i].Node < results[j].Node
+	})
+	return results, pending
+}
+
+// BackendRows builds the table rows for the results with the first row as the header.
+func BackendRows(results []backend.Result) [][]string {
+	rows := [][]string{{"node", "dns", "tcp", "tls", "http2", "proxy", "error"}}
+	for _, r := range results {
+		rows = append(rows, []string{
+			r.Node,
+			stepCell(r.DNS),
+			stepCell(r.TCP),
+			stepCell(r.TLS),
+			stepCell(r.HTTP2),
+			r.Proxy,
+			firstErr(r.DNS, r.TCP, r.TLS, r.HTTP2),
+		})
+	}
+	return rows
+}
+
+// PrintBackend prints the results table and returns the number of failed nodes.
+func PrintBackend(results []backend.Result, pending map[string]error) int {
+	rows := BackendRows(results)
+	PrintRows(rows, ColumnWidths(rows))
+
+	var failed int
+	for _, r := range results {
+		if !r.OK() {
+			failed++
+		}
+	}
+	for pod, err := range pending {
+		log.Printf("pod=%s result=pending err='%v'\n", pod, err)
+	}
+	log.Printf("\nnodes=%d passed=%d failed=%d pending=%d\n", len(results)+len(pending), len(results)-failed, failed, len(pending))
+	return failed
+}
+
+// ColumnWidths calculates the max width of each column.
+func ColumnWidths(rows [][]string) []int {
+	var maxWidth []int
+	for _, row := range rows {
+		for i, col := range row {
+			if i >= len(maxWidth) {
+				maxWidth = append(maxWidth, 0)
+			}
+			if len(col) > maxWidth[i] {
+				maxWidth[i] = len(col)
+			}
+		}
+	}
+	return maxWidth
+}
+
+func stepCell(s backend.Step) string {
+	if s.OK {
+		return fmt.Sprintf("ok %v", s.Duration.Round(time.Millisecond))
+	}
+	if s.Err == "" {
+		return "-"
+	}
+	return "fail"
+}
+
+func firstErr(steps ...backend.Step) string {
+	for _, s := range steps {
+		if s.Err != "" {
+			return s.Err
+		}
+	}
+	return ""
+}
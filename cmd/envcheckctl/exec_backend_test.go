@@ -0,0 +1,48 @@
+package main
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/instana/envcheck/backend"
+	"github.com/instana/envcheck/cluster"
+)
+
+func Test_DecodeBackend(t *testing.T) {
+	t.Parallel()
+	line, _ := backend.Encode(backend.Result{Node: "node-2", DNS: backend.Step{OK: true}})
+	responses := []cluster.PodResponse{
+		{Pod: "backendcheck-abc12", Node: "node-2", Body: []byte(line + "\n")},
+		{Pod: "backendcheck-def34", Node: "node-1", Body: []byte("starting\n")},
+		{Pod: "backendcheck-ghi56", Node: "node-3", Err: errors.New("ContainerCreating")},
+	}
+
+	results, pending := DecodeBackend(responses)
+	if len(results) != 1 || results[0].Node != "node-2" {
+		t.Errorf("results=%+v, want node-2", results)
+	}
+	if len(pending) != 2 {
+		t.Errorf("len(pending)=%v, want 2", len(pending))
+	}
+}
+
+func Test_BackendRows(t *testing.T) {
+	t.Parallel()
+	results := []backend.Result{{
+		Node:  "node-1",
+		Proxy: "direct",
+		DNS:   backend.Step{OK: true, Duration: 2 * time.Millisecond},
+		TCP:   backend.Step{Err: "i/o timeout"},
+	}}
+
+	expected := [][]string{
+		{"node", "dns", "tcp", "tls", "http2", "proxy", "error"},
+		{"node-1", "ok 2ms", "fail", "-", "-", "direct", "i/o timeout"},
+	}
+	actual := BackendRows(results)
+	if !cmp.Equal(expected, actual) {
+		t.Errorf("BackendRows() mismatch (-want +got)\n%s", cmp.Diff(expected, actual))
+	}
+}
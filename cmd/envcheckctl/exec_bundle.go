@@ -0,0 +1,221 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"log"
+	"os"
+	"path"
+	"time"
+
+	"github.com/instana/envcheck/cluster"
+)
+
+// BundleQuery is the cluster query used to collect a support bundle.
+type BundleQuery interface {
+	cluster.Query
+	AgentInfo(ctx context.Context, namespace string, name string) (*cluster.AgentInfo, error)
+	AgentManifests(ctx context.Context, namespace string, name string) (*cluster.AgentManifests, error)
+	ContainerLogs(ctx context.Context, namespace string, selector string, opts cluster.LogOptions) ([]cluster.ContainerLog, error)
+	LeaderLease(ctx context.Context) (*cluster.LeaderLease, error)
+}
+
+// ExecBundle executes the bundle subcommand.
+func ExecBundle(ctx context.Context, config EnvcheckConfig) {
+	log.SetFlags(0)
+	query, err := cluster.New(config.ClusterConfig())
+	if err != nil {
+		log.Fatalf("error initialising cluster query: %v\n", err)
+	}
+
+	var redactor *cluster.Redactor
+	if config.Redact {
+		redactor, err = cluster.NewRedactor(SplitList(config.KeepAnnotations))
+		if err != nil {
+			log.Fatalf("redact=failed err='%v'\n", err)
+		}
+	}
+
+	now := time.Now().UTC()
+	filename := config.OutputFile
+	if filename == "" {
+		filename = fmt.Sprintf("envcheck-bundle-%d.tar.gz", now.Unix())
+	}
+	w, err := os.Create(filename)
+	if err != nil {
+		log.Fatalf("create=failed file=%s err='%v'\n", filename, err)
+	}
+
+	bundle := NewBundle(w, now)
+	err = CollectBundle(ctx, query, config, redactor, bundle)
+	if err == nil {
+		err = bundle.Close()
+	}
+	w.Close()
+	if err != nil {
+		os.Remove(filename)
+		log.Fatalf("bundle=failed file=%s err='%v'\n", filename, err)
+	}
+
+	var failed int
+	for _, entry := range bundle.Manifest.Entries {
+		if entry.Err != "" {
+			log.Printf("collect=failed path=%s err='%s'\n", entry.Path, entry.Err)
+			failed++
+		}
+	}
+	log.Printf("bundle=%s entries=%d failed=%d redacted=%v\n", filename, len(bundle.Manifest.Entries), failed, config.Redact)
+}
+
+// CollectBundle collects the podfile, agent status, leader lease, agent
+// manifests and agent logs into the bundle. Anything that cannot be
+// collected is recorded in the manifest so a partial bundle is still useful.
+// The podfile is collected first so the names redacted from it are known
+// when redacting the free text of events and logs. An error is only returned
+// when writing the bundle fails.
+func CollectBundle(ctx context.Context, query BundleQuery, config EnvcheckConfig, redactor *cluster.Redactor, bundle *Bundle) error {
+	bundle.Manifest.Redacted = redactor != nil
+	info, err := bundlePodfile(ctx, query, config, redactor, bundle)
+	if err != nil {
+		return err
+	}
+	switch {
+	case info != nil:
+		bundle.Manifest.Cluster = info.Name
+	case redactor != nil:
+		bundle.Manifest.Cluster = redactor.Name("cluster", query.Host())
+	default:
+		bundle.Manifest.Cluster = query.Host()
+	}
+
+	agent, err := query.AgentInfo(ctx, config.AgentNamespace, config.AgentName)
+	if err != nil {
+		bundle.Failed("agent/info.json", "agent DaemonSet status and events", err)
+	} else {
+		if redactor != nil {
+			for i := range agent.EventList {
+				agent.EventList[i].Message = redactor.Text(agent.EventList[i].Message)
+			}
+		}
+		err = bundle.AddJSON("agent/info.json", "agent DaemonSet status and events", agent)
+		if err != nil {
+			return err
+		}
+	}
+
+	lease, err := query.LeaderLease(ctx)
+	if err != nil {
+		bundle.Failed("agent/leader.json", "agent leader lease", err)
+	} else {
+		if redactor != nil {
+			lease.HolderIdentity = redactor.Name("pod", lease.HolderIdentity)
+		}
+		err = bundle.AddJSON("agent/leader.json", "agent leader lease", lease)
+		if err != nil {
+			return err
+		}
+	}
+
+	selector := config.Selector
+	manifests, err := query.AgentManifests(ctx, config.AgentNamespace, config.AgentName)
+	if err != nil {
+		bundle.Failed("agent/manifests.yaml", "agent DaemonSet and ConfigMaps", err)
+	} else {
+		if selector == "" {
+			selector = manifests.Selector
+		}
+		if redactor != nil {
+			redactor.Manifests(manifests)
+		}
+		var buf bytes.Buffer
+		err = cluster.Render(&buf, cluster.FormatYAML, manifests.Objects()...)
+		if err != nil {
+			return err
+		}
+		err = bundle.Add("agent/manifests.yaml", "agent DaemonSet and ConfigMaps", buf.Bytes())
+		if err != nil {
+			return err
+		}
+		for _, name := range manifests.Missing {
+			bundle.Failed("agent/manifests.yaml", "ConfigMap "+name+" mounted by the agent", fmt.Errorf("not found"))
+		}
+	}
+
+	return bundleLogs(ctx, query, config, selector, redactor, bundle)
+}
+
+func bundlePodfile(ctx context.Context, query BundleQuery, config EnvcheckConfig, redactor *cluster.Redactor, bundle *Bundle) (*cluster.Info, error) {
+	const path, description = "podfile.json", "cluster info for envcheckctl inspect -podfile"
+	f, err := os.CreateTemp("", "envcheck-podfile-*.json")
+	if err != nil {
+		return nil, err
+	}
+	defer os.Remove(f.Name())
+
+	// the archive is compressed so the podfile within it is not.
+	podfile := cluster.NewPodfileWriter(f, false)
+	var applyable cluster.Applyable = podfile
+	if redactor != nil {
+		applyable = redactor.Applyable(podfile)
+	}
+	info, err := QueryLive(ctx, query, config.Workers, SplitList(config.Namespaces), applyable)
+	if err != nil {
+		f.Close()
+		bundle.Failed(path, description, err)
+		return nil, nil
+	}
+	if redactor != nil {
+		info = redactor.Info(info)
+	}
+	err = podfile.Close(info)
+	f.Close()
+	if err != nil {
+		return nil, err
+	}
+	return info, bundle.AddFile(path, description, f.Name())
+}
+
+func bundleLogs(ctx context.Context, query BundleQuery, config EnvcheckConfig, selector string, redactor *cluster.Redactor, bundle *Bundle) error {
+	if selector == "" {
+		bundle.Failed("logs/", "agent pod logs", fmt.Errorf("agent pod selector unknown, set -selector"))
+		return nil
+	}
+	logs, err := query.ContainerLogs(ctx, config.AgentNamespace, selector, cluster.LogOptions{TailLines: int64(config.Tail)})
+	if err != nil {
+		bundle.Failed("logs/", "agent pod logs", err)
+		return nil
+	}
+
+	for _, l := range logs {
+		pod := l.Pod
+		body := l.Body
+		if redactor != nil {
+			pod = redactor.Name("pod", pod)
+			body = []byte(redactor.Text(string(body)))
+		}
+		name := l.Container + ".log"
+		description := logDescription(config.Tail, l.Container)
+		if l.Previous {
+			name = l.Container + ".previous.log"
+			description += " before its last restart"
+		}
+		p := path.Join("logs", pod, name)
+		if l.Err != nil {
+			bundle.Failed(p, description, l.Err)
+			continue
+		}
+		err = bundle.Add(p, description, body)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func logDescription(tail int, container string) string {
+	if tail <= 0 {
+		return fmt.Sprintf("%s container log", container)
+	}
+	return fmt.Sprintf("last %d lines of the %s container log", tail, container)
+}
@@ -0,0 +1,114 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/instana/envcheck/cluster"
+	appsv1 "k8s.io/api/apps/v1"
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func Test_CollectBundle(t *testing.T) {
+	t.Parallel()
+	config := EnvcheckConfig{AgentNamespace: "instana-agent", AgentName: "instana-agent", Tail: 100, Workers: cluster.DefaultWorkers}
+	var buf bytes.Buffer
+	bundle := NewBundle(&buf, time.Unix(1589217975, 0).UTC())
+
+	err := CollectBundle(context.Background(), &stubBundleQuery{}, config, nil, bundle)
+	if err != nil {
+		t.Fatalf("CollectBundle() err=%v, want nil", err)
+	}
+	err = bundle.Close()
+	if err != nil {
+		t.Fatalf("Close() err=%v, want nil", err)
+	}
+
+	var names []string
+	for _, f := range untar(t, &buf) {
+		names = append(names, f.name)
+	}
+	expected := []string{
+		"podfile.json",
+		"agent/info.json",
+		"agent/leader.json",
+		"agent/manifests.yaml",
+		"logs/instana-agent-xyz123/instana-agent.log",
+		"logs/instana-agent-xyz123/instana-agent.previous.log",
+		ManifestFile,
+	}
+	if !cmp.Equal(expected, names) {
+		t.Errorf("files mismatch (-want +got)\n%s", cmp.Diff(expected, names))
+	}
+	if bundle.Manifest.Cluster != "https://localhost:8443" {
+		t.Errorf("manifest.Cluster=%v, want https://localhost:8443", bundle.Manifest.Cluster)
+	}
+}
+
+func Test_CollectBundle_should_redact_names(t *testing.T) {
+	t.Parallel()
+	config := EnvcheckConfig{AgentNamespace: "instana-agent", AgentName: "instana-agent", Tail: 100, Workers: cluster.DefaultWorkers}
+	var buf bytes.Buffer
+	bundle := NewBundle(&buf, time.Unix(1589217975, 0).UTC())
+
+	err := CollectBundle(context.Background(), &stubBundleQuery{}, config, cluster.NewRedactorWithKey([]byte("key"), nil), bundle)
+	if err != nil {
+		t.Fatalf("CollectBundle() err=%v, want nil", err)
+	}
+	err = bundle.Close()
+	if err != nil {
+		t.Fatalf("Close() err=%v, want nil", err)
+	}
+
+	for _, f := range untar(t, &buf) {
+		for _, sensitive := range []string{"instana-agent-xyz123", "192.168.253.101", "localhost:8443", "s3cret"} {
+			if strings.Contains(f.name, sensitive) || strings.Contains(string(f.content), sensitive) {
+				t.Errorf("%s contains %q", f.name, sensitive)
+			}
+		}
+	}
+	if !bundle.Manifest.Redacted {
+		t.Error("manifest.Redacted=false, want true")
+	}
+}
+
+type stubBundleQuery struct {
+	stubQuery
+}
+
+func (q *stubBundleQuery) AgentInfo(_ context.Context, _ string, _ string) (*cluster.AgentInfo, error) {
+	return &cluster.AgentInfo{
+		Desired:   2,
+		Ready:     1,
+		EventList: []cluster.AgentEvent{{Reason: "BackOff", Message: "Back-off restarting instana-agent-xyz123"}},
+	}, nil
+}
+
+func (q *stubBundleQuery) LeaderLease(_ context.Context) (*cluster.LeaderLease, error) {
+	return &cluster.LeaderLease{HolderIdentity: "instana-agent-xyz123"}, nil
+}
+
+func (q *stubBundleQuery) AgentManifests(_ context.Context, namespace string, name string) (*cluster.AgentManifests, error) {
+	return &cluster.AgentManifests{
+		DaemonSet: &appsv1.DaemonSet{
+			TypeMeta:   metav1.TypeMeta{APIVersion: "apps/v1", Kind: "DaemonSet"},
+			ObjectMeta: metav1.ObjectMeta{Namespace: namespace, Name: name},
+			Spec: appsv1.DaemonSetSpec{Template: v1.PodTemplateSpec{Spec: v1.PodSpec{
+				Containers: []v1.Container{{Name: "instana-agent", Env: []v1.EnvVar{{Name: "INSTANA_AGENT_PROXY_PASSWORD", Value: "s3cret"}}}},
+			}}},
+		},
+		Selector: "app.kubernetes.io/name=instana-agent",
+	}, nil
+}
+
+func (q *stubBundleQuery) ContainerLogs(_ context.Context, _ string, _ string, _ cluster.LogOptions) ([]cluster.ContainerLog, error) {
+	return []cluster.ContainerLog{
+		{Pod: "instana-agent-xyz123", Container: "instana-agent", Restarts: 1, Body: []byte("started on 192.168.253.101\n")},
+		{Pod: "instana-agent-xyz123", Container: "instana-agent", Restarts: 1, Previous: true, Body: []byte("OutOfMemoryError\n")},
+	}, nil
+}
@@ -0,0 +1,307 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"os"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/instana/envcheck/cluster"
+	"github.com/instana/envcheck/ping"
+	"k8s.io/apimachinery/pkg/api/meta"
+)
+
+// PodLogReader reads the recent logs of the running pods matching a selector.
+type PodLogReader interface {
+	PodLogs(ctx context.Context, namespace string, selector string, since time.Duration) ([]cluster.PodResponse, error)
+}
+
+// statusInterval is the time between reads of the pinger status.
+var statusInterval = 5 * time.Second
+
+// statusSince is how much of the pinger logs is read, enough to include at
+// least one report of a pinger that has been running for a while.
+var statusSince = 2 * ping.ReportInterval
+
+// ExecConnectivity installs the daemon and pinger, reports whether each
+// pinger can reach the daemon on its node and removes them.
+func ExecConnectivity(ctx context.Context, config EnvcheckConfig) {
+	log.SetFlags(0)
+	err := config.Workload.Validate()
+	if err != nil {
+		log.Fatalf("config=invalid err='%v'\n", err)
+	}
+
+	command, err := cluster.NewCommand(config.ClusterConfig())
+	if err != nil {
+		log.Fatalf("createClient=failed err='%v'\n", err)
+	}
+	query, err := cluster.New(config.ClusterConfig())
+	if err != nil {
+		log.Fatalf("error initialising cluster query: %v\n", err)
+	}
+
+	c := NewConnectivity(command, query, config)
+	results, err := c.Run(ctx)
+	if err != nil {
+		log.Printf("connectivity=failed err='%v'\n", err)
+	}
+
+	rows := ConnectivityRows(results)
+	PrintRows(rows, ColumnWidths(rows))
+	failed := Failed(results)
+	log.Printf("\nnodes=%d passed=%d failed=%d\n", len(results), len(results)-failed, failed)
+	if err != nil || failed > 0 || len(results) == 0 {
+		os.Exit(1)
+	}
+}
+
+// NewConnectivity creates the connectivity test from the config.
+func NewConnectivity(command cluster.Command, logs PodLogReader, config EnvcheckConfig) *Connectivity {
+	return &Connectivity{
+		Command: command,
+		Logs:    logs,
+		Daemon: cluster.DaemonConfig{
+			Image:     config.Image("envcheck-daemon"),
+			Namespace: config.AgentNamespace,
+			Host:      "0.0.0.0",
+			Port:      int32(config.Port),
+			Version:   Revision,
+			Workload:  config.Workload,
+		},
+		Pinger: cluster.PingerConfig{
+			Image:     config.Image("envcheck-pinger"),
+			Namespace: config.PingerNamespace,
+			Version:   Revision,
+			Port:      int32(config.Port),
+			Workload:  config.Workload,
+		},
+		Keep:            config.Keep,
+		ReplaceExisting: config.ReplaceExisting,
+	}
+}
+
+// Connectivity is the end-to-end test of pod network to host network connectivity.
+type Connectivity struct {
+	Command cluster.Command
+	Logs    PodLogReader
+	Daemon  cluster.DaemonConfig
+	Pinger  cluster.PingerConfig
+	Keep    bool
+	// ReplaceExisting allows the test to update a daemon or pinger that
+	// already exists, otherwise the test refuses to run.
+	ReplaceExisting bool
+}
+
+// ConnectivityResult is the outcome for a single pinger pod.
+type ConnectivityResult struct {
+	Node      string
+	Pod       string
+	Address   string
+	OK        bool
+	Successes int
+	Failures  int
+	Err       string
+}
+
+// Run applies the daemon and pinger, waits for their rollout and collects the
+// status of each pinger until all have reported or ctx is done. The objects
+// created by the run are removed afterwards unless Keep is set.
+func (c *Connectivity) Run(ctx context.Context) ([]ConnectivityResult, error) {
+	applied, err := c.install(ctx)
+	if !c.Keep {
+		defer c.cleanup(ctx, applied)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	for _, ds := range []struct{ namespace, name string }{
+		{c.Daemon.Namespace, cluster.DaemonSetName},
+		{c.Pinger.Namespace, cluster.PingerName},
+	} {
+		printer := NewRolloutPrinter()
+		_, err = c.Command.WaitRollout(ctx, ds.namespace, ds.name, printer.Print)
+		if err != nil {
+			return nil, fmt.Errorf("rollout of %s/%s: %v", ds.namespace, ds.name, err)
+		}
+	}
+
+	return CollectStatus(ctx, c.Logs, c.Pinger.Namespace, c.Pinger.Version)
+}
+
+// CollectStatus polls the status each pinger of version in namespace reports
+// in its logs until all have reported or ctx is done. The logs are read rather
+// than the status end-point as a policy that denies egress often denies
+// ingress too. Pingers of a previous version never report so are excluded.
+func CollectStatus(ctx context.Context, logs PodLogReader, namespace string, version string) ([]ConnectivityResult, error) {
+	selector := cluster.LabelName + "=" + cluster.PingerName + "," + cluster.LabelVersion + "=" + version
+	for {
+		responses, err := logs.PodLogs(ctx, namespace, selector, statusSince)
+		if err != nil {
+			return nil, err
+		}
+		results, pending := DecodeConnectivity(responses)
+		if pending == 0 && len(results) > 0 {
+			return results, nil
+		}
+
+		select {
+		case <-ctx.Done():
+			return results, fmt.Errorf("%d pingers did not report: %v", pending, ctx.Err())
+		case <-time.After(statusInterval):
+		}
+	}
+}
+
+// install applies the daemon and pinger objects returning those applied
+// before any error. Nothing is applied when any of the objects already exist
+// unless ReplaceExisting is set, as the test would change them and leave them
+// in place.
+func (c *Connectivity) install(ctx context.Context) ([]cluster.ApplyResult, error) {
+	if !c.ReplaceExisting {
+		existing, err := c.existing(ctx)
+		if err != nil {
+			return nil, err
+		}
+		if len(existing) > 0 {
+			return nil, fmt.Errorf("%v already exist, remove them or set -replace-existing to update them for the test", existing)
+		}
+	}
+
+	applied, err := c.Command.CreateDaemonAccess(ctx, c.Daemon)
+	if err != nil {
+		return applied, err
+	}
+
+	for _, create := range []func() (cluster.ApplyResult, error){
+		func() (cluster.ApplyResult, error) { return c.Command.CreateDaemon(ctx, c.Daemon) },
+		func() (cluster.ApplyResult, error) { return c.Command.CreateService(ctx, c.Daemon) },
+		func() (cluster.ApplyResult, error) { return c.Command.CreatePinger(ctx, c.Pinger) },
+	} {
+		result, err := create()
+		if err != nil {
+			return applied, err
+		}
+		applied = append(applied, result)
+	}
+
+	for _, a := range applied {
+		log.Printf("applied=%v action=%s\n", a, a.Action)
+	}
+	return applied, nil
+}
+
+// existing lists the daemon and pinger objects already in the cluster.
+func (c *Connectivity) existing(ctx context.Context) ([]cluster.ApplyResult, error) {
+	objects := append(cluster.DaemonManifests(c.Daemon), cluster.PingerManifests(c.Pinger)...)
+	var found []cluster.ApplyResult
+	for _, obj := range objects {
+		accessor, err := meta.Accessor(obj)
+		if err != nil {
+			return nil, err
+		}
+		object := cluster.ApplyResult{
+			Kind:      obj.GetObjectKind().GroupVersionKind().Kind,
+			Namespace: accessor.GetNamespace(),
+			Name:      accessor.GetName(),
+		}
+		exists, err := c.Command.Exists(ctx, object)
+		if err != nil {
+			return nil, err
+		}
+		if exists {
+			found = append(found, object)
+		}
+	}
+	return found, nil
+}
+
+// cleanup removes the objects in the reverse order they were applied,
+// objects that existed before the run are left in place.
+func (c *Connectivity) cleanup(ctx context.Context, applied []cluster.ApplyResult) {
+	ctx, cancel := CleanupContext(ctx)
+	defer cancel()
+	for i := len(applied) - 1; i >= 0; i-- {
+		a := applied[i]
+		if a.Action != cluster.Created {
+			log.Printf("kept=%v action=%s\n", a, a.Action)
+			continue
+		}
+		err := c.Command.Delete(ctx, a)
+		if err != nil {
+			log.Printf("cleanup=failed object=%v err='%v'\n", a, err)
+		}
+	}
+}
+
+// DecodeConnectivity decodes the pinger status reports in the pod logs and
+// counts the pingers yet to report.
+func DecodeConnectivity(responses []cluster.PodResponse) ([]ConnectivityResult, int) {
+	var results []ConnectivityResult
+	var pending int
+	for _, resp := range responses {
+		result := ConnectivityResult{Node: resp.Node, Pod: resp.Pod}
+		if resp.Err != nil {
+			result.Err = resp.Err.Error()
+			results = append(results, result)
+			pending++
+			continue
+		}
+
+		status, err := ping.DecodeReport(resp.Body)
+		if err == ping.ErrNoReport {
+			results = append(results, result)
+			pending++
+			continue
+		}
+		if err != nil {
+			result.Err = err.Error()
+			results = append(results, result)
+			pending++
+			continue
+		}
+		if !status.Reported() {
+			pending++
+		}
+		result.Address = status.Address
+		result.OK = status.OK
+		result.Successes = status.Successes
+		result.Failures = status.Failures
+		if !status.OK {
+			result.Err = status.LastError
+		}
+		results = append(results, result)
+	}
+	sort.Slice(results, func(i, j int) bool {
+		return results[i].Node < results[j].Node
+	})
+	return results, pending
+}
+
+// ConnectivityRows builds the table rows for the results with the first row as the header.
+func ConnectivityRows(results []ConnectivityResult) [][]string {
+	rows := [][]string{{"node", "pod", "address", "result", "successes", "failures", "error"}}
+	for _, r := range results {
+		result := "fail"
+		if r.OK {
+			result = "pass"
+		}
+		rows = append(rows, []string{r.Node, r.Pod, r.Address, result, strconv.Itoa(r.Successes), strconv.Itoa(r.Failures), r.Err})
+	}
+	return rows
+}
+
+// Failed counts the results that did not pass.
+func Failed(results []ConnectivityResult) int {
+	var failed int
+	for _, r := range results {
+		if !r.OK {
+			failed++
+		}
+	}
+	return failed
+}
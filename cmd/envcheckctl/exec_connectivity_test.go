@@ -0,0 +1,182 @@
+package main
+
+import (
+	"context"
+	"io"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/instana/envcheck/cluster"
+	"github.com/instana/envcheck/ping"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+func Test_Connectivity_Run(t *testing.T) {
+	t.Parallel()
+	cases := map[string]struct {
+		keep       bool
+		existing   bool
+		replace    bool
+		daemonSets int
+	}{
+		"cleanup":                 {false, false, false, 0},
+		"keep":                    {true, false, false, 2},
+		"replace existing daemon": {false, true, true, 1},
+	}
+	for name, tc := range cases {
+		tc := tc
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+			client := connectivityClient()
+			command := &cluster.KubernetesCommand{AppsV1Interface: client.AppsV1(), CoreV1Interface: client.CoreV1(), RbacV1Interface: client.RbacV1()}
+			logs := &stubLogs{client: client, statuses: map[string]ping.Status{
+				"pinger-abc12": {Address: "10.0.0.1:42700", OK: true, Successes: 3, Checked: time.Now()},
+				"pinger-def34": {Address: "10.0.0.2:42700", Failures: 3, LastError: "i/o timeout", Checked: time.Now()},
+			}}
+			config := *withDeployDefaults(EnvcheckConfig{AgentNamespace: "instana-agent", PingerNamespace: "default", Keep: tc.keep, ReplaceExisting: tc.replace})
+			if tc.existing {
+				_, err := command.CreateDaemon(context.Background(), cluster.DaemonConfig{Namespace: "instana-agent", Version: "before"})
+				if err != nil {
+					t.Fatalf("CreateDaemon() err=%v, want nil", err)
+				}
+			}
+
+			ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+			defer cancel()
+			results, err := NewConnectivity(command, logs, config).Run(ctx)
+			if err != nil {
+				t.Fatalf("Run() err=%v, want nil", err)
+			}
+
+			expected := []ConnectivityResult{
+				{Node: "node-1", Pod: "pinger-abc12", Address: "10.0.0.1:42700", OK: true, Successes: 3},
+				{Node: "node-2", Pod: "pinger-def34", Address: "10.0.0.2:42700", Failures: 3, Err: "i/o timeout"},
+			}
+			if !cmp.Equal(expected, results) {
+				t.Errorf("Run() mismatch (-want +got)\n%s", cmp.Diff(expected, results))
+			}
+
+			var daemonSets int
+			for _, ns := range []string{"instana-agent", "default"} {
+				list, _ := client.AppsV1().DaemonSets(ns).List(context.Background(), metav1.ListOptions{})
+				daemonSets += len(list.Items)
+			}
+			if daemonSets != tc.daemonSets {
+				t.Errorf("daemonsets=%d, want %d", daemonSets, tc.daemonSets)
+			}
+		})
+	}
+}
+
+func Test_Connectivity_Run_should_refuse_existing_objects(t *testing.T) {
+	t.Parallel()
+	client := connectivityClient()
+	command := &cluster.KubernetesCommand{AppsV1Interface: client.AppsV1(), CoreV1Interface: client.CoreV1(), RbacV1Interface: client.RbacV1()}
+	_, err := command.CreateDaemon(context.Background(), cluster.DaemonConfig{Namespace: "instana-agent", Version: "before"})
+	if err != nil {
+		t.Fatalf("CreateDaemon() err=%v, want nil", err)
+	}
+	config := *withDeployDefaults(EnvcheckConfig{AgentNamespace: "instana-agent", PingerNamespace: "default"})
+
+	_, err = NewConnectivity(command, &stubLogs{client: client}, config).Run(context.Background())
+	if err == nil || !strings.Contains(err.Error(), "daemonset/instana-agent/envchecker") {
+		t.Errorf("Run() err=%v, want the existing daemonset", err)
+	}
+
+	ds, err := client.AppsV1().DaemonSets("instana-agent").Get(context.Background(), cluster.DaemonSetName, metav1.GetOptions{})
+	if err != nil {
+		t.Fatalf("Get() err=%v, want the existing daemonset kept", err)
+	}
+	if ds.Spec.Template.Labels[cluster.LabelVersion] != "before" {
+		t.Errorf("version=%q, want the existing daemonset unchanged", ds.Spec.Template.Labels[cluster.LabelVersion])
+	}
+	list, _ := client.AppsV1().DaemonSets("default").List(context.Background(), metav1.ListOptions{})
+	if len(list.Items) != 0 {
+		t.Errorf("pingers=%d, want none applied", len(list.Items))
+	}
+}
+
+func Test_CollectStatus_should_skip_pingers_of_previous_versions(t *testing.T) {
+	t.Parallel()
+	previous := pingerPod("default", "pinger-old12", "node-1")
+	previous.Labels[cluster.LabelVersion] = "before"
+	client := fake.NewSimpleClientset(pingerPod("default", "pinger-abc12", "node-1"), previous)
+	logs := &stubLogs{client: client, statuses: map[string]ping.Status{
+		"pinger-abc12": {Address: "10.0.0.1:42700", OK: true, Successes: 3, Checked: time.Now()},
+	}}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	results, err := CollectStatus(ctx, logs, "default", Revision)
+	if err != nil {
+		t.Fatalf("CollectStatus() err=%v, want nil", err)
+	}
+	expected := []ConnectivityResult{{Node: "node-1", Pod: "pinger-abc12", Address: "10.0.0.1:42700", OK: true, Successes: 3}}
+	if !cmp.Equal(expected, results) {
+		t.Errorf("CollectStatus() mismatch (-want +got)\n%s", cmp.Diff(expected, results))
+	}
+}
+
+func Test_DecodeConnectivity_counts_pending(t *testing.T) {
+	t.Parallel()
+	reported, _ := ping.Report(ping.Status{OK: true, Checked: time.Now()})
+	responses := []cluster.PodResponse{
+		{Pod: "pinger-abc12", Node: "node-1", Body: []byte("ping=10.0.0.1:42700 status=success\n" + reported + "\n")},
+		{Pod: "pinger-def34", Node: "node-2", Body: []byte("ping=10.0.0.2:42700 podIP=10.1.0.2\n")},
+		{Pod: "pinger-ghi56", Node: "node-3", Err: io.ErrUnexpectedEOF},
+	}
+
+	results, pending := DecodeConnectivity(responses)
+	if len(results) != 3 || pending != 2 {
+		t.Errorf("len(results)=%d pending=%d, want 3 2", len(results), pending)
+	}
+	if Failed(results) != 2 {
+		t.Errorf("Failed()=%d, want 2", Failed(results))
+	}
+	if results[1].Err != "" {
+		t.Errorf("Err=%q, want blank for a pinger yet to report", results[1].Err)
+	}
+}
+
+func connectivityClient() *fake.Clientset {
+	var objects []runtime.Object
+	for i, name := range []string{"pinger-abc12", "pinger-def34"} {
+		pod := &corev1.Pod{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:      name,
+				Namespace: "default",
+				Labels:    map[string]string{cluster.LabelName: cluster.PingerName, cluster.LabelVersion: Revision},
+			},
+			Spec:   corev1.PodSpec{NodeName: "node-" + strconv.Itoa(i+1)},
+			Status: corev1.PodStatus{Phase: corev1.PodRunning},
+		}
+		objects = append(objects, pod)
+	}
+	return fake.NewSimpleClientset(objects...)
+}
+
+// stubLogs serves the status report of each pod as its logs as the fake
+// clientset logs are always "fake logs".
+type stubLogs struct {
+	client   *fake.Clientset
+	statuses map[string]ping.Status
+}
+
+func (l *stubLogs) PodLogs(ctx context.Context, namespace string, selector string, _ time.Duration) ([]cluster.PodResponse, error) {
+	pods, err := l.client.CoreV1().Pods(namespace).List(ctx, metav1.ListOptions{LabelSelector: selector})
+	if err != nil {
+		return nil, err
+	}
+	var responses []cluster.PodResponse
+	for _, pod := range pods.Items {
+		line, err := ping.Report(l.statuses[pod.Name])
+		responses = append(responses, cluster.PodResponse{Pod: pod.Name, Node: pod.Spec.NodeName, Body: []byte(line + "\n"), Err: err})
+	}
+	return responses, nil
+}
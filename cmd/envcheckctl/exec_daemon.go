@@ -1,32 +1,59 @@
 package main
 
 import (
-	"github.com/instana/envcheck/cluster"
+	"context"
 	"log"
+	"os"
+
+	"github.com/instana/envcheck/cluster"
 )
 
 // ExecDaemon executes the daemon pinger subcommand.
-func ExecDaemon(config EnvcheckConfig) {
-	command, err := cluster.NewCommand(config.Kubeconfig)
+func ExecDaemon(ctx context.Context, config EnvcheckConfig) {
+	err := config.Workload.Validate()
 	if err != nil {
-		log.Fatalf("createClient=failed err='%v'\n", err)
+		log.Fatalf("config=invalid err='%v'\n", err)
 	}
 
 	dc := cluster.DaemonConfig{
-		Image:     "instana/envcheck-daemon:latest",
+		Image:     config.Image("envcheck-daemon"),
 		Namespace: config.AgentNamespace,
 		Host:      "0.0.0.0",
-		Port:      42700,
+		Port:      int32(config.Port),
 		Version:   Revision,
+		Workload:  config.Workload,
+	}
+	if config.IsDryRun() {
+		ExecRender(config, cluster.DaemonManifests(dc)...)
+		return
 	}
-	err = command.CreateDaemon(dc)
 
+	command, err := cluster.NewCommand(config.ClusterConfig())
+	if err != nil {
+		log.Fatalf("createClient=failed err='%v'\n", err)
+	}
+
+	access, err := command.CreateDaemonAccess(ctx, dc)
+	if err != nil {
+		log.Fatalf("createDaemonAccess=failed err='%v'\n", err)
+	}
+	for _, applied := range access {
+		log.Printf("applied=%v action=%s\n", applied, applied.Action)
+	}
+
+	applied, err := command.CreateDaemon(ctx, dc)
 	if err != nil {
 		log.Fatalf("createDaemon=failed err='%v'\n", err)
 	}
+	log.Printf("applied=%v action=%s\n", applied, applied.Action)
 
-	err = command.CreateService(dc)
+	applied, err = command.CreateService(ctx, dc)
 	if err != nil {
 		log.Fatalf("createService=failed err='%v'\n", err)
 	}
+	log.Printf("applied=%v action=%s\n", applied, applied.Action)
+
+	if config.Timeout > 0 && !WaitForRollout(ctx, command, config.AgentNamespace, cluster.DaemonSetName) {
+		os.Exit(1)
+	}
 }
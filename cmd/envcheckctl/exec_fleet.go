@@ -0,0 +1,270 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/instana/envcheck/cluster"
+)
+
+// FleetRow summarises a single cluster of a fleet.
+type FleetRow struct {
+	Cluster       string
+	Distribution  string
+	ServerVersion string
+	Nodes         int
+	Agents        int
+	ChartVersions []string
+	Findings      []string
+	Err           string
+}
+
+// IsFleet indicates whether several clusters should be inspected.
+func (c *EnvcheckConfig) IsFleet() bool {
+	if c.AllContexts || c.Contexts != "" {
+		return true
+	}
+	if c.Podfile == "" {
+		return false
+	}
+	stat, err := os.Stat(c.Podfile)
+	return err == nil && stat.IsDir()
+}
+
+// ExecFleet inspects each cluster of a fleet, or loads the podfiles in a
+// directory, and prints a row per cluster.
+func ExecFleet(ctx context.Context, config EnvcheckConfig) {
+	log.SetFlags(0)
+	var rows []FleetRow
+	if config.IsLive() {
+		contexts := SplitList(config.Contexts)
+		if config.AllContexts {
+			var err error
+			contexts, err = config.ClusterConfig().Contexts()
+			if err != nil {
+				log.Fatalf("contexts=failed err='%v'\n", err)
+			}
+		}
+		if len(contexts) == 0 {
+			log.Fatalln("contexts=failed err='no kubeconfig contexts found'")
+		}
+		newQuery := func(kubeContext string) (cluster.Query, error) {
+			kubeconfig := config.ClusterConfig()
+			kubeconfig.Context = kubeContext
+			return cluster.New(kubeconfig)
+		}
+		rows = InspectFleet(ctx, config, contexts, newQuery, time.Now().UTC())
+	} else {
+		var err error
+		rows, err = LoadFleet(config.Podfile)
+		if err != nil {
+			log.Fatalf("read=failed dir=%s err='%v'\n", config.Podfile, err)
+		}
+	}
+
+	PrintFleet(rows)
+}
+
+// InspectFleet queries the clusters of each kubeconfig context concurrently,
+// writing a podfile for each. The timeout applies to each cluster so a slow
+// cluster does not starve those queued behind it. A cluster that cannot be
+// inspected, or is never reached, is reported in its row rather than stopping
+// the others.
+func InspectFleet(ctx context.Context, config EnvcheckConfig, contexts []string, newQuery func(string) (cluster.Query, error), now time.Time) []FleetRow {
+	rows := make([]FleetRow, len(contexts))
+	var steps []cluster.Step
+	for i, kubeContext := range contexts {
+		i, kubeContext := i, kubeContext
+		rows[i] = FleetRow{Cluster: kubeContext, Err: "not inspected"}
+		steps = append(steps, cluster.Step{Name: kubeContext, Optional: true, Run: func(ctx context.Context) error {
+			// a cluster queued when the fleet is interrupted is left not inspected.
+			err := ctx.Err()
+			if err != nil {
+				return err
+			}
+			if config.Timeout > 0 {
+				var cancel context.CancelFunc
+				ctx, cancel = context.WithTimeout(ctx, config.Timeout)
+				defer cancel()
+			}
+			query, err := newQuery(kubeContext)
+			if err != nil {
+				rows[i] = FleetRow{Cluster: kubeContext, Err: err.Error()}
+				return err
+			}
+			c := config
+			c.Context = kubeContext
+			index := cluster.NewIndex()
+			filename := filepath.Join(c.OutputDir, PodfileName(now, kubeContext, c.Compress))
+			info, err := WritePodfile(ctx, query, c, filename, index)
+			if err != nil {
+				rows[i] = FleetRow{Cluster: kubeContext, Err: err.Error()}
+				return err
+			}
+			log.Printf("context=%s podfile=%s\n", kubeContext, filename)
+			info.Apply(index)
+			rows[i] = NewFleetRow(info, index)
+			return nil
+		}})
+	}
+
+	collector := cluster.NewCollector(config.Parallel, time.Now)
+	// every step is optional so the error of each cluster is kept in its row.
+	_ = collector.Run(ctx, steps...)
+	return rows
+}
+
+// LoadFleet loads the podfiles in dir providing a row for each ordered by
+// cluster. A podfile that cannot be read is reported in its row.
+func LoadFleet(dir string) ([]FleetRow, error) {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+	var rows []FleetRow
+	for _, entry := range entries {
+		name := entry.Name()
+		if entry.IsDir() || !(strings.HasSuffix(name, ".json") || strings.HasSuffix(name, ".json.gz")) {
+			continue
+		}
+		rows = append(rows, loadFleetRow(filepath.Join(dir, name)))
+	}
+	if len(rows) == 0 {
+		return nil, fmt.Errorf("no podfiles found")
+	}
+	sort.SliceStable(rows, func(i, j int) bool {
+		return rows[i].Cluster < rows[j].Cluster
+	})
+	return rows, nil
+}
+
+func loadFleetRow(filename string) FleetRow {
+	r, err := os.Open(filename)
+	if err != nil {
+		return FleetRow{Cluster: filename, Err: err.Error()}
+	}
+	defer r.Close()
+	index := cluster.NewIndex()
+	info, err := cluster.DecodePodfile(r, index)
+	if err != nil {
+		return FleetRow{Cluster: filename, Err: err.Error()}
+	}
+	info.Apply(index)
+	return NewFleetRow(info, index)
+}
+
+// NewFleetRow summarises the cluster info and its index. The index must have
+// had the pods and the info applied.
+func NewFleetRow(info *cluster.Info, index *cluster.Index) FleetRow {
+	name := info.Context
+	if name == "" {
+		name = info.Name
+	}
+	var charts []string
+	for version := range index.ChartVersions {
+		if version == "" {
+			version = "unknown"
+		}
+		charts = append(charts, version)
+	}
+	sort.Strings(charts)
+	return FleetRow{
+		Cluster:       name,
+		Distribution:  ExtractDistribution(info.ServerVersion),
+		ServerVersion: info.ServerVersion,
+		Nodes:         index.Nodes.Len(),
+		Agents:        index.AgentRestarts.Len(),
+		ChartVersions: charts,
+		Findings:      Findings(info, index),
+	}
+}
+
+// Findings lists the problems in the cluster that the inspect report
+// highlights: nodes without an agent, unhealthy or restarting agents,
+// namespaces that cannot reach the agent and what could not be collected.
+func Findings(info *cluster.Info, index *cluster.Index) []string {
+	var findings []string
+	if nodes, agents := index.Nodes.Len(), index.AgentRestarts.Len(); agents < nodes {
+		findings = append(findings, fmt.Sprintf("agent running on %d of %d nodes", agents, nodes))
+	}
+	for status, count := range index.AgentStatus {
+		// the status is unknown in podfiles written before it was collected.
+		if status != "Running" && status != "" {
+			findings = append(findings, fmt.Sprintf("%d agent pods %s", count, status))
+		}
+	}
+	var restarting int
+	for _, restarts := range index.AgentRestarts {
+		if restarts > 0 {
+			restarting++
+		}
+	}
+	if restarting > 0 {
+		findings = append(findings, fmt.Sprintf("%d agent pods restarted", restarting))
+	}
+	for ns, v := range index.Egress {
+		if v.Verdict != cluster.EgressAllowed {
+			findings = append(findings, fmt.Sprintf("egress to agent %s in %s", v.Verdict, ns))
+		}
+	}
+	for _, scope := range cluster.Denied(info.Scopes) {
+		findings = append(findings, fmt.Sprintf("denied %v", scope))
+	}
+	for _, step := range info.Steps {
+		if step.Err != "" {
+			findings = append(findings, fmt.Sprintf("step %s failed", step.Name))
+		}
+	}
+	sort.Strings(findings)
+	return findings
+}
+
+// PrintFleet prints the fleet table followed by the findings of each cluster.
+func PrintFleet(rows []FleetRow) {
+	log.Println("")
+	table := FleetRows(rows)
+	PrintRows(table, ColumnWidths(table))
+	for _, row := range rows {
+		if len(row.Findings) == 0 {
+			continue
+		}
+		log.Println("")
+		log.Println(row.Cluster)
+		for _, finding := range row.Findings {
+			log.Printf("- \"%s\"", finding)
+		}
+	}
+}
+
+// FleetRows builds the table rows for the fleet with the first row as the header.
+func FleetRows(rows []FleetRow) [][]string {
+	table := [][]string{{"cluster", "distribution", "version", "nodes", "coverage", "charts", "findings", "error"}}
+	for _, row := range rows {
+		if row.Err != "" {
+			table = append(table, []string{row.Cluster, "-", "-", "-", "-", "-", "-", row.Err})
+			continue
+		}
+		coverage := "-"
+		if row.Nodes > 0 {
+			coverage = fmt.Sprintf("%d/%d (%0.0f%%)", row.Agents, row.Nodes, float64(row.Agents)/float64(row.Nodes)*100.0)
+		}
+		table = append(table, []string{
+			row.Cluster,
+			row.Distribution,
+			row.ServerVersion,
+			strconv.Itoa(row.Nodes),
+			coverage,
+			strings.Join(row.ChartVersions, ", "),
+			strconv.Itoa(len(row.Findings)),
+			"",
+		})
+	}
+	return table
+}
@@ -0,0 +1,176 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/instana/envcheck/cluster"
+)
+
+func Test_InspectFleet_should_write_podfiles_loaded_as_the_same_fleet(t *testing.T) {
+	t.Parallel()
+	dir := t.TempDir()
+	config := EnvcheckConfig{OutputDir: dir, Compress: true, Parallel: 2, Workers: cluster.DefaultWorkers}
+	newQuery := func(kubeContext string) (cluster.Query, error) {
+		if kubeContext == "broken" {
+			return nil, fmt.Errorf("context broken not found")
+		}
+		return &stubQuery{ts: time.Unix(1589217975, 0).UTC()}, nil
+	}
+
+	live := InspectFleet(context.Background(), config, []string{"dev", "arn:aws:eks:eu-west-1:1234:cluster/prod", "broken"}, newQuery, time.Unix(1589217975, 0).UTC())
+	findings := []string{"egress to agent blocked in instana-agent"}
+	expected := []FleetRow{
+		{Cluster: "dev", Distribution: "eks", ServerVersion: "v1.23.14-eks-ffeb93d", Nodes: 2, Agents: 2, ChartVersions: []string{"unknown"}, Findings: findings},
+		{Cluster: "arn:aws:eks:eu-west-1:1234:cluster/prod", Distribution: "eks", ServerVersion: "v1.23.14-eks-ffeb93d", Nodes: 2, Agents: 2, ChartVersions: []string{"unknown"}, Findings: findings},
+		{Cluster: "broken", Err: "context broken not found"},
+	}
+	if !cmp.Equal(expected, live) {
+		t.Fatalf("InspectFleet() mismatch (-want +got)\n%s", cmp.Diff(expected, live))
+	}
+
+	for _, name := range []string{"cluster-info-dev-1589217975.json.gz", "cluster-info-arn_aws_eks_eu-west-1_1234_cluster_prod-1589217975.json.gz"} {
+		_, err := os.Stat(filepath.Join(dir, name))
+		if err != nil {
+			t.Errorf("podfile %s err=%v, want nil", name, err)
+		}
+	}
+
+	loaded, err := LoadFleet(dir)
+	if err != nil {
+		t.Fatalf("LoadFleet() err=%v, want nil", err)
+	}
+	offline := []FleetRow{expected[1], expected[0]}
+	if !cmp.Equal(offline, loaded) {
+		t.Errorf("LoadFleet() mismatch (-want +got)\n%s", cmp.Diff(offline, loaded))
+	}
+}
+
+func Test_InspectFleet_should_report_clusters_not_inspected(t *testing.T) {
+	t.Parallel()
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	config := EnvcheckConfig{OutputDir: t.TempDir(), Parallel: 1, Workers: cluster.DefaultWorkers}
+	newQuery := func(kubeContext string) (cluster.Query, error) {
+		return &stubQuery{ts: time.Unix(1589217975, 0).UTC()}, nil
+	}
+
+	actual := InspectFleet(ctx, config, []string{"dev", "prod"}, newQuery, time.Unix(1589217975, 0).UTC())
+	expected := []FleetRow{
+		{Cluster: "dev", Err: "not inspected"},
+		{Cluster: "prod", Err: "not inspected"},
+	}
+	if !cmp.Equal(expected, actual) {
+		t.Errorf("InspectFleet() mismatch (-want +got)\n%s", cmp.Diff(expected, actual))
+	}
+}
+
+func Test_InspectFleet_should_apply_the_timeout_to_each_cluster(t *testing.T) {
+	t.Parallel()
+	config := EnvcheckConfig{OutputDir: t.TempDir(), Parallel: 1, Workers: cluster.DefaultWorkers, Timeout: 100 * time.Millisecond}
+	newQuery := func(kubeContext string) (cluster.Query, error) {
+		query := &stubQuery{ts: time.Unix(1589217975, 0).UTC()}
+		if kubeContext == "slow" {
+			return &slowQuery{query}, nil
+		}
+		return query, nil
+	}
+
+	rows := InspectFleet(context.Background(), config, []string{"slow", "dev"}, newQuery, time.Unix(1589217975, 0).UTC())
+	if !strings.Contains(rows[0].Err, context.DeadlineExceeded.Error()) {
+		t.Errorf("rows[0].Err=%q, want %q", rows[0].Err, context.DeadlineExceeded)
+	}
+	if rows[1].Err != "" || rows[1].Nodes != 2 {
+		t.Errorf("rows[1]=%+v, want dev inspected after slow timed out", rows[1])
+	}
+}
+
+// slowQuery blocks on the server version until the context is done.
+type slowQuery struct {
+	*stubQuery
+}
+
+func (q *slowQuery) ServerVersion(ctx context.Context) (string, error) {
+	<-ctx.Done()
+	return "", ctx.Err()
+}
+
+func Test_LoadFleet_should_report_invalid_podfiles(t *testing.T) {
+	t.Parallel()
+	dir := t.TempDir()
+	filename := filepath.Join(dir, "cluster-info-1.json")
+	err := os.WriteFile(filename, []byte("{"), 0600)
+	if err != nil {
+		t.Fatalf("WriteFile() err=%v, want nil", err)
+	}
+	err = os.WriteFile(filepath.Join(dir, "notes.txt"), []byte("ignored"), 0600)
+	if err != nil {
+		t.Fatalf("WriteFile() err=%v, want nil", err)
+	}
+
+	rows, err := LoadFleet(dir)
+	if err != nil {
+		t.Fatalf("LoadFleet() err=%v, want nil", err)
+	}
+	if len(rows) != 1 || rows[0].Cluster != filename || rows[0].Err == "" {
+		t.Errorf("rows=%+v, want a row with the error for %s", rows, filename)
+	}
+}
+
+func Test_LoadFleet_errors_without_podfiles(t *testing.T) {
+	t.Parallel()
+	_, err := LoadFleet(t.TempDir())
+	if err == nil {
+		t.Error("err=nil, want no podfiles found")
+	}
+}
+
+func Test_Findings(t *testing.T) {
+	t.Parallel()
+	index := cluster.NewIndex()
+	index.Nodes.Add("node-1")
+	index.Nodes.Add("node-2")
+	index.AgentRestarts.Set("instana-agent-a", 3)
+	index.AgentStatus.Add("CrashLoopBackOff")
+	info := &cluster.Info{
+		Steps:  []cluster.StepInfo{{Name: "events", Err: "events is forbidden"}},
+		Scopes: []cluster.ScopeInfo{{Resource: "nodes", Denied: true}},
+	}
+
+	expected := []string{
+		"1 agent pods CrashLoopBackOff",
+		"1 agent pods restarted",
+		"agent running on 1 of 2 nodes",
+		"denied " + cluster.ScopeInfo{Resource: "nodes", Denied: true}.String(),
+		"step events failed",
+	}
+	actual := Findings(info, index)
+	if !cmp.Equal(expected, actual) {
+		t.Errorf("Findings() mismatch (-want +got)\n%s", cmp.Diff(expected, actual))
+	}
+}
+
+func Test_FleetRows(t *testing.T) {
+	t.Parallel()
+	rows := []FleetRow{
+		{Cluster: "dev", Distribution: "eks", ServerVersion: "v1.23.14-eks-ffeb93d", Nodes: 4, Agents: 3, ChartVersions: []string{"1.2.3", "1.2.4"}, Findings: []string{"agent running on 3 of 4 nodes"}},
+		{Cluster: "empty", Distribution: "kubernetes", ServerVersion: "v1.27.0"},
+		{Cluster: "broken", Err: "context broken not found"},
+	}
+	expected := [][]string{
+		{"cluster", "distribution", "version", "nodes", "coverage", "charts", "findings", "error"},
+		{"dev", "eks", "v1.23.14-eks-ffeb93d", "4", "3/4 (75%)", "1.2.3, 1.2.4", "1", ""},
+		{"empty", "kubernetes", "v1.27.0", "0", "-", "", "0", ""},
+		{"broken", "-", "-", "-", "-", "-", "-", "context broken not found"},
+	}
+	actual := FleetRows(rows)
+	if !cmp.Equal(expected, actual) {
+		t.Errorf("FleetRows() mismatch (-want +got)\n%s", cmp.Diff(expected, actual))
+	}
+}
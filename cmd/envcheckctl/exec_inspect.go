@@ -1,52 +1,56 @@
 package main
 
 import (
-	"encoding/json"
+	"context"
 	"fmt"
 	"io"
 	"log"
 	"os"
+	"path/filepath"
+	"regexp"
 	"sort"
+	"strconv"
 	"strings"
 	"time"
 
 	"github.com/instana/envcheck/cluster"
+	"k8s.io/apimachinery/pkg/api/errors"
 )
 
 // ExecInspect executes the subcommand inspect.
-func ExecInspect(config EnvcheckConfig) {
+func ExecInspect(ctx context.Context, config EnvcheckConfig) {
+	if config.IsFleet() {
+		ExecFleet(ctx, config)
+		return
+	}
 	log.SetFlags(0)
 	var info *cluster.Info
+	index := cluster.NewIndex()
+	applyables := []cluster.Applyable{index}
+	var grouping *AnnotationTable
+	if config.CheckAnnotation() {
+		grouping = NewGrouping(config.IncludeNamespaces)
+		applyables = append(applyables, grouping)
+	}
+
 	if config.IsLive() {
-		query, err := cluster.New(config.Kubeconfig)
+		query, err := cluster.New(config.ClusterConfig())
 		if err != nil {
 			log.Fatalf("error initialising cluster query: %v\n", err)
 		}
 
-		info, err = QueryLive(query)
+		filename := filepath.Join(config.OutputDir, PodfileName(time.Now().UTC(), "", config.Compress))
+		info, err = WritePodfile(ctx, query, config, filename, applyables...)
 		if err != nil {
 			log.Fatalf("error retrieving cluster info: %v\n", err)
 		}
-
-		filename := fmt.Sprintf("cluster-info-%d.json", time.Now().UTC().Unix())
-		w, err := os.Create(filename)
-		if err != nil {
-			log.Fatalln(err)
-		}
-
-		enc := json.NewEncoder(w)
-		err = enc.Encode(info)
-		w.Close()
-		if err != nil {
-			log.Fatalln(err)
-		}
 		log.Printf("podfile=%s", filename)
 	} else {
 		r, err := os.Open(config.Podfile)
 		if err != nil {
 			log.Fatalf("open=failed file=%s err='%v'\n", config.Podfile, err)
 		}
-		info, err = LoadInfo(r)
+		info, err = cluster.DecodePodfile(r, applyables...)
 		r.Close()
 		if err != nil {
 			log.Fatalf("read=failed file=%s err='%v'\n", config.Podfile, err)
@@ -54,8 +58,8 @@ func ExecInspect(config EnvcheckConfig) {
 		log.Printf("envcheckctl=%s, cluster=%v, podfile=%v\n", Revision, info.Name, config.Podfile)
 	}
 
-	index := cluster.NewIndex()
-	info.Apply(index)
+	// pods have been streamed to the applyables leaving the nodes and egress.
+	info.Apply(applyables...)
 	summary := index.Summary()
 
 	log.Printf("pods=%d, running=%d, nodes=%d, containers=%d, namespaces=%d, deployments=%d, replicaSets=%d, daemonsets=%d, statefulsets=%d, duration=%v\n\n",
@@ -86,21 +90,88 @@ func ExecInspect(config EnvcheckConfig) {
 	PrintCounter("zones", index.Zones)
 	PrintCounter("linkedConfigMaps", index.LinkedConfigMaps)
 	PrintCounter("owners", index.Owners)
+	PrintCounter("agentEgress", index.EgressVerdicts)
+	PrintEgress(index.Egress)
+	PrintCounter("warningEvents", WarningReasons(info.Events))
+	PrintSteps(info.Steps)
+	PrintBlindSpots(info.Scopes)
 
-	if config.CheckAnnotation() {
-		grouping := NewGrouping(config.IncludeNamespaces)
-		info.Apply(grouping)
+	if grouping != nil {
 		PrintTable(config.Annotation, grouping)
 	}
 }
 
+// PodfileName provides the podfile name for a query started at now. The
+// context is included when set so each cluster of a fleet has its own podfile.
+func PodfileName(now time.Time, context string, compress bool) string {
+	filename := fmt.Sprintf("cluster-info-%d.json", now.Unix())
+	if context != "" {
+		filename = fmt.Sprintf("cluster-info-%s-%d.json", unsafeFilename.ReplaceAllString(context, "_"), now.Unix())
+	}
+	if compress {
+		filename += ".gz"
+	}
+	return filename
+}
+
+// unsafeFilename matches the characters of context names such as EKS ARNs
+// that are not safe in a filename.
+var unsafeFilename = regexp.MustCompile(`[^A-Za-z0-9._-]+`)
+
+// WritePodfile queries the cluster streaming the pods to the applyables and
+// to the podfile filename. The podfile is redacted when configured, the
+// applyables and the info returned are not.
+func WritePodfile(ctx context.Context, query cluster.Query, config EnvcheckConfig, filename string, applyables ...cluster.Applyable) (*cluster.Info, error) {
+	var redactor *cluster.Redactor
+	if config.Redact {
+		var err error
+		redactor, err = cluster.NewRedactor(SplitList(config.KeepAnnotations))
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	w, err := os.Create(filename)
+	if err != nil {
+		return nil, err
+	}
+	podfile := cluster.NewPodfileWriter(w, config.Compress)
+	var podfileApplyable cluster.Applyable = podfile
+	if redactor != nil {
+		podfileApplyable = redactor.Applyable(podfile)
+	}
+
+	info, err := QueryLive(ctx, query, config.Workers, SplitList(config.Namespaces), append(applyables, podfileApplyable)...)
+	if err != nil {
+		w.Close()
+		os.Remove(filename)
+		return nil, err
+	}
+	info.Context = config.Context
+
+	written := info
+	if redactor != nil {
+		written = redactor.Info(info)
+	}
+	err = podfile.Close(written)
+	w.Close()
+	if err != nil {
+		return nil, err
+	}
+	return info, nil
+}
+
 func PrintTable(header string, ag *AnnotationTable) {
 	log.Println("")
 	log.Println(header)
 	log.Println("")
 	annotations := strings.Split(header, ",")
 	rows, maxWidth := ag.Rows(annotations...)
+	PrintRows(rows, maxWidth)
+}
 
+// PrintRows prints the rows as a markdown style table with the first row as the header.
+func PrintRows(rows [][]string, maxWidth []int) {
 	sep := "| "
 	for r, row := range rows {
 		s := "| "
@@ -198,6 +269,100 @@ func (a *AnnotationTable) EachPod(pod cluster.PodInfo) {
 
 func (a *AnnotationTable) EachNode(_ cluster.NodeInfo) {}
 
+func (a *AnnotationTable) EachEgress(_ cluster.EgressVerdict) {}
+
+// PrintEgress prints the namespaces where policies block some or all pods
+// from reaching the agent.
+func PrintEgress(verdicts map[string]cluster.EgressVerdict) {
+	rows := EgressRows(verdicts)
+	if len(rows) == 1 {
+		return
+	}
+	log.Println("")
+	PrintRows(rows, ColumnWidths(rows))
+}
+
+// EgressRows builds the table rows for the namespaces that are not allowed to
+// reach every agent port with the first row as the header.
+func EgressRows(verdicts map[string]cluster.EgressVerdict) [][]string {
+	header := []string{"namespace", "verdict", "pods"}
+	for _, port := range cluster.AgentPorts {
+		header = append(header, fmt.Sprintf("blocked %d", port))
+	}
+	header = append(header, "policies", "unevaluated")
+	rows := [][]string{header}
+
+	var namespaces []string
+	for ns, v := range verdicts {
+		if v.Verdict != cluster.EgressAllowed || len(v.Unevaluated) > 0 {
+			namespaces = append(namespaces, ns)
+		}
+	}
+	sort.Strings(namespaces)
+
+	for _, ns := range namespaces {
+		v := verdicts[ns]
+		row := []string{ns, v.Verdict, strconv.Itoa(v.Pods)}
+		for _, port := range cluster.AgentPorts {
+			blocked := "-"
+			for _, p := range v.Ports {
+				if p.Port == port {
+					blocked = strconv.Itoa(p.Blocked)
+				}
+			}
+			row = append(row, blocked)
+		}
+		row = append(row, strings.Join(v.Policies, ", "), strings.Join(v.Unevaluated, ", "))
+		rows = append(rows, row)
+	}
+	return rows
+}
+
+// PrintBlindSpots prints the resources that could not be collected so the
+// report states what it does not cover.
+func PrintBlindSpots(scopes []cluster.ScopeInfo) {
+	if len(scopes) == 0 {
+		return
+	}
+	log.Println("")
+	log.Println("blindSpots")
+	denied := cluster.Denied(scopes)
+	for _, scope := range denied {
+		log.Printf("- \"%v\"", scope)
+	}
+	if len(denied) == 0 {
+		log.Println(" - \"none\"")
+	}
+}
+
+// WarningReasons counts the warning events by reason.
+func WarningReasons(events []cluster.EventInfo) cluster.Counter {
+	reasons := make(cluster.Counter)
+	for _, ev := range events {
+		reasons[ev.Reason] += ev.Count
+	}
+	return reasons
+}
+
+// PrintSteps prints the duration of each collection step and any error.
+func PrintSteps(steps []cluster.StepInfo) {
+	if len(steps) == 0 {
+		return
+	}
+	log.Println("")
+	rows := StepRows(steps)
+	PrintRows(rows, ColumnWidths(rows))
+}
+
+// StepRows builds the table rows for the collection steps with the first row as the header.
+func StepRows(steps []cluster.StepInfo) [][]string {
+	rows := [][]string{{"step", "duration", "error"}}
+	for _, step := range steps {
+		rows = append(rows, []string{step.Name, step.Duration.Round(time.Millisecond).String(), step.Err})
+	}
+	return rows
+}
+
 func PrintKind(version string) {
 	dist := ExtractDistribution(version)
 	log.Println("serverDistribution")
@@ -258,8 +423,14 @@ func PrintCounter(header string, c cluster.Counter) {
 	}
 }
 
-// QueryLive queries a cluster and builds the cluster info from the current data.
-func QueryLive(query cluster.Query) (*cluster.Info, error) {
+// QueryLive queries a cluster and builds the cluster info from the current
+// data. Independent collection steps run concurrently on at most workers
+// goroutines. Pods are streamed to the applyables as they are listed rather
+// than kept in the info. A failed optional step such as events is recorded in
+// the info steps rather than failing the query. Namespaced resources are
+// collected from the namespaces, or cluster-wide when empty with a fallback to
+// each namespace when cluster-wide access is denied.
+func QueryLive(ctx context.Context, query cluster.Query, workers int, namespaces []string, applyable ...cluster.Applyable) (*cluster.Info, error) {
 	info := &cluster.Info{
 		Name:    query.Host(),
 		Started: query.Time(),
@@ -267,34 +438,118 @@ func QueryLive(query cluster.Query) (*cluster.Info, error) {
 
 	log.Printf("envcheckctl=%s, cluster=%v, start=%v\n", Revision, info.Name, info.Started.Format(time.RFC3339))
 	log.Println("Collecting cluster details. Duration varies depending on the cluster.")
-	versionInfo, err := query.ServerVersion()
+
+	scopes := cluster.NewScopes(query, namespaces)
+	collector := cluster.NewCollector(workers, query.Time)
+	err := collector.Run(ctx,
+		cluster.Step{Name: "pods", Run: func(ctx context.Context) error {
+			// policies are needed up front to evaluate egress as the pods stream past.
+			// a failure is recorded in the steps and egress is not evaluated.
+			var egress *cluster.EgressEvaluator
+			_ = collector.Time(ctx, cluster.Step{Name: "policies", Optional: true, Run: func(ctx context.Context) error {
+				policies, err := query.AllPolicies(ctx)
+				if err != nil {
+					return err
+				}
+				info.Policies = policies
+				egress = cluster.NewEgressEvaluator(policies, cluster.AgentPorts)
+				return nil
+			}})
+			consumers := append([]cluster.Applyable{}, applyable...)
+			if egress != nil {
+				consumers = append(consumers, egress)
+			}
+
+			err := scopes.Each(ctx, "pods", func(ctx context.Context, namespace string) error {
+				return query.StreamPods(ctx, namespace, func(pod cluster.PodInfo) {
+					info.PodCount++
+					for _, a := range consumers {
+						a.EachPod(pod)
+					}
+				})
+			})
+			if err != nil {
+				return err
+			}
+			if egress != nil {
+				info.Egress = egress.Verdicts()
+			}
+			return nil
+		}},
+		cluster.Step{Name: "nodes", Run: func(ctx context.Context) error {
+			nodes, err := query.AllNodes(ctx)
+			if errors.IsForbidden(err) {
+				// nodes are cluster scoped, the pod hosts still give a node count.
+				scopes.Record(cluster.ScopeInfo{Resource: "nodes", Denied: true, Err: err.Error()})
+				return nil
+			}
+			if err != nil {
+				return err
+			}
+			scopes.Record(cluster.ScopeInfo{Resource: "nodes"})
+			info.Nodes = nodes
+			info.NodeCount = len(nodes)
+			return nil
+		}},
+		cluster.Step{Name: "serverVersion", Run: func(ctx context.Context) error {
+			version, err := query.ServerVersion(ctx)
+			if err != nil {
+				return err
+			}
+			info.ServerVersion = version
+			return nil
+		}},
+		cluster.Step{Name: "events", Optional: true, Run: func(ctx context.Context) error {
+			return scopes.Each(ctx, "events", func(ctx context.Context, namespace string) error {
+				events, err := query.AllEvents(ctx, namespace)
+				if err != nil {
+					return err
+				}
+				info.Events = append(info.Events, events...)
+				return nil
+			})
+		}},
+	)
+	info.Finished = query.Time()
+	info.Steps = collector.Steps()
+	info.Scopes = scopes.Scopes()
 	if err != nil {
 		return nil, err
 	}
-	info.ServerVersion = versionInfo
 
-	pods, err := query.AllPods()
-	if err != nil {
-		return nil, err
+	for _, step := range info.Steps {
+		if step.Err != "" {
+			log.Printf("step=failed name=%s err='%s'\n", step.Name, step.Err)
+		}
 	}
-	info.Finished = query.Time()
-	info.Pods = pods
-	info.PodCount = len(pods)
+	for _, scope := range cluster.Denied(info.Scopes) {
+		log.Printf("scope=denied resource=%s namespace=%s\n", scope.Resource, scope.Namespace)
+	}
+
+	return info, nil
+}
 
-	nodes, err := query.AllNodes()
+// LoadInfo loads cluster details including the pods from the specified
+// reader. Compressed and older podfiles are handled as with DecodePodfile.
+func LoadInfo(r io.Reader) (*cluster.Info, error) {
+	pods := &podList{items: []cluster.PodInfo{}}
+	info, err := cluster.DecodePodfile(r, pods)
 	if err != nil {
 		return nil, err
 	}
-	info.Nodes = nodes
-	info.NodeCount = len(nodes)
-
+	info.Pods = pods.items
 	return info, nil
 }
 
-// LoadInfo loads cluster details from the specified reader.
-func LoadInfo(r io.Reader) (*cluster.Info, error) {
-	var info cluster.Info
-	dec := json.NewDecoder(r)
-	err := dec.Decode(&info)
-	return &info, err
+// podList collects the pods applied to it.
+type podList struct {
+	items []cluster.PodInfo
+}
+
+func (l *podList) EachPod(pod cluster.PodInfo) {
+	l.items = append(l.items, pod)
 }
+
+func (l *podList) EachNode(_ cluster.NodeInfo) {}
+
+func (l *podList) EachEgress(_ cluster.EgressVerdict) {}
@@ -1,12 +1,17 @@
 package main
 
 import (
+	"context"
+	"fmt"
+	"sort"
 	"strings"
 	"testing"
 	"time"
 
 	"github.com/google/go-cmp/cmp"
 	"github.com/instana/envcheck/cluster"
+	"k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/runtime/schema"
 )
 
 func Test_LoadInfo_reads_empty_ClusterInfo(t *testing.T) {
@@ -17,7 +22,7 @@ func Test_LoadInfo_reads_empty_ClusterInfo(t *testing.T) {
 		t.Errorf("err=%v, want nil", err)
 	}
 
-	expected := &cluster.Info{Name: "https://gke.gcloud.com:8443", Pods: []cluster.PodInfo{}}
+	expected := &cluster.Info{SchemaVersion: cluster.PodfileSchemaVersion, Name: "https://gke.gcloud.com:8443", Pods: []cluster.PodInfo{}}
 	if !cmp.Equal(expected, info) {
 		t.Errorf("LoadInfo() mismatch (-want +got)\n%s", cmp.Diff(expected, info))
 	}
@@ -35,32 +40,210 @@ func Test_LoadInfo_errors_with_invalid_json(t *testing.T) {
 func Test_QueryLive_should_count_pods_correctly(t *testing.T) {
 	t.Parallel()
 	query := &stubQuery{}
-	info, _ := QueryLive(query)
+	info, _ := QueryLive(context.Background(), query, cluster.DefaultWorkers, nil)
 
 	if info.PodCount != 2 {
 		t.Errorf("info.PodCount=%v, want 2", info.PodCount)
 	}
 }
 
-func Test_QueryLive_should_associate_pods_correctly(t *testing.T) {
+func Test_QueryLive_should_stream_pods_to_applyables(t *testing.T) {
 	t.Parallel()
 	query := &stubQuery{}
-	info, _ := QueryLive(query)
+	index := cluster.NewIndex()
+	info, _ := QueryLive(context.Background(), query, cluster.DefaultWorkers, nil, index)
 
-	if len(info.Pods) != 2 {
-		t.Errorf("len(info.Pods)=%v, want 2", info.PodCount)
+	if len(info.Pods) != 0 {
+		t.Errorf("len(info.Pods)=%v, want 0", len(info.Pods))
+	}
+	if index.Pods.Len() != 2 {
+		t.Errorf("index.Pods.Len()=%v, want 2", index.Pods.Len())
+	}
+}
+
+func Test_QueryLive_should_evaluate_agent_egress(t *testing.T) {
+	t.Parallel()
+	query := &stubQuery{}
+	info, _ := QueryLive(context.Background(), query, cluster.DefaultWorkers, nil)
+
+	expected := []cluster.EgressVerdict{
+		{
+			Namespace: "instana-agent",
+			Pods:      2,
+			Ports: []cluster.PortVerdict{
+				{Port: 42699, Blocked: 2},
+				{Port: 4317, Blocked: 2},
+				{Port: 4318, Blocked: 2},
+			},
+			Policies: []string{"NetworkPolicy/default-deny"},
+			Verdict:  cluster.EgressBlocked,
+		},
+	}
+	if !cmp.Equal(expected, info.Egress) {
+		t.Errorf("info.Egress mismatch (-want +got)\n%s", cmp.Diff(expected, info.Egress))
+	}
+}
+
+func Test_QueryLive_should_record_each_step(t *testing.T) {
+	t.Parallel()
+	query := &stubQuery{}
+	info, err := QueryLive(context.Background(), query, cluster.DefaultWorkers, nil)
+	if err != nil {
+		t.Fatalf("err=%v, want nil", err)
+	}
+
+	var names []string
+	for _, step := range info.Steps {
+		names = append(names, step.Name)
+	}
+	sort.Strings(names)
+	expected := []string{"events", "nodes", "pods", "policies", "serverVersion"}
+	if !cmp.Equal(expected, names) {
+		t.Errorf("info.Steps mismatch (-want +got)\n%s", cmp.Diff(expected, names))
+	}
+	if len(info.Events) != 1 {
+		t.Errorf("len(info.Events)=%v, want 1", len(info.Events))
+	}
+}
+
+func Test_QueryLive_should_keep_partial_results_when_optional_step_fails(t *testing.T) {
+	t.Parallel()
+	query := &stubQuery{eventsErr: fmt.Errorf("events is forbidden")}
+	info, err := QueryLive(context.Background(), query, 1, nil)
+	if err != nil {
+		t.Fatalf("err=%v, want nil", err)
+	}
+	if info.PodCount != 2 {
+		t.Errorf("info.PodCount=%v, want 2", info.PodCount)
+	}
+
+	var stepErr string
+	for _, step := range info.Steps {
+		if step.Name == "events" {
+			stepErr = step.Err
+		}
+	}
+	if stepErr != "events is forbidden" {
+		t.Errorf("events step err=%q, want events is forbidden", stepErr)
+	}
+}
+
+func Test_QueryLive_should_fail_when_required_step_fails(t *testing.T) {
+	t.Parallel()
+	query := &stubQuery{nodesErr: fmt.Errorf("nodes is forbidden")}
+	_, err := QueryLive(context.Background(), query, cluster.DefaultWorkers, nil)
+	if err == nil || err.Error() != "nodes: nodes is forbidden" {
+		t.Errorf("err=%v, want nodes: nodes is forbidden", err)
+	}
+}
+
+func Test_QueryLive_should_collect_explicit_namespaces(t *testing.T) {
+	t.Parallel()
+	query := &stubQuery{namespaced: true, nodesErr: forbidden("nodes")}
+	info, err := QueryLive(context.Background(), query, cluster.DefaultWorkers, []string{"instana-agent", "payments"})
+	if err != nil {
+		t.Fatalf("err=%v, want nil", err)
+	}
+	if info.PodCount != 2 {
+		t.Errorf("info.PodCount=%v, want 2", info.PodCount)
+	}
+
+	expected := []string{"nodes cluster-wide", "pods in payments"}
+	actual := deniedScopes(info.Scopes)
+	if !cmp.Equal(expected, actual) {
+		t.Errorf("denied scopes mismatch (-want +got)\n%s", cmp.Diff(expected, actual))
+	}
+}
+
+func Test_QueryLive_should_fall_back_to_namespace_when_cluster_scope_denied(t *testing.T) {
+	t.Parallel()
+	query := &stubQuery{namespaced: true}
+	_, err := QueryLive(context.Background(), query, cluster.DefaultWorkers, nil)
+	// the kubeconfig namespace default is denied too leaving no pods.
+	if err == nil || err.Error() != "pods: pods denied in every namespace" {
+		t.Errorf("err=%v, want pods: pods denied in every namespace", err)
+	}
+}
+
+func Test_QueryLive_should_fall_back_to_each_listable_namespace(t *testing.T) {
+	t.Parallel()
+	query := &stubQuery{namespaced: true}
+	query.listable = true
+	info, err := QueryLive(context.Background(), query, cluster.DefaultWorkers, nil)
+	if err != nil {
+		t.Fatalf("err=%v, want nil", err)
+	}
+	if info.PodCount != 2 {
+		t.Errorf("info.PodCount=%v, want 2", info.PodCount)
+	}
+
+	expected := []string{"pods cluster-wide", "pods in default"}
+	actual := deniedScopes(info.Scopes)
+	if !cmp.Equal(expected, actual) {
+		t.Errorf("denied scopes mismatch (-want +got)\n%s", cmp.Diff(expected, actual))
+	}
+}
+
+func deniedScopes(scopes []cluster.ScopeInfo) []string {
+	var denied []string
+	for _, s := range cluster.Denied(scopes) {
+		denied = append(denied, s.String())
+	}
+	return denied
+}
+
+func Test_WarningReasons(t *testing.T) {
+	t.Parallel()
+	events := []cluster.EventInfo{
+		{Reason: "BackOff", Count: 3},
+		{Reason: "FailedScheduling", Count: 1},
+		{Reason: "BackOff", Count: 2},
+	}
+	expected := cluster.Counter{"BackOff": 5, "FailedScheduling": 1}
+	actual := WarningReasons(events)
+	if !cmp.Equal(expected, actual) {
+		t.Errorf("WarningReasons() mismatch (-want +got)\n%s", cmp.Diff(expected, actual))
+	}
+}
+
+func Test_EgressRows_should_only_list_restricted_namespaces(t *testing.T) {
+	t.Parallel()
+	verdicts := map[string]cluster.EgressVerdict{
+		"default": {Namespace: "default", Pods: 3, Verdict: cluster.EgressAllowed},
+		"payments": {
+			Namespace: "payments",
+			Pods:      4,
+			Ports:     []cluster.PortVerdict{{Port: 42699, Allowed: 4}, {Port: 4317, Blocked: 4}, {Port: 4318, Blocked: 4}},
+			Policies:  []string{"NetworkPolicy/agent-only"},
+			Verdict:   cluster.EgressPartial,
+		},
+	}
+
+	expected := [][]string{
+		{"namespace", "verdict", "pods", "blocked 42699", "blocked 4317", "blocked 4318", "policies", "unevaluated"},
+		{"payments", "partial", "4", "0", "4", "4", "NetworkPolicy/agent-only", ""},
+	}
+	actual := EgressRows(verdicts)
+	if !cmp.Equal(expected, actual) {
+		t.Errorf("EgressRows() mismatch (-want +got)\n%s", cmp.Diff(expected, actual))
 	}
 }
 
 type stubQuery struct {
-	ts time.Time
+	ts        time.Time
+	eventsErr error
+	nodesErr  error
+	// namespaced denies listing pods cluster-wide and in any namespace but instana-agent.
+	namespaced bool
+	// listable allows listing namespaces when namespaced.
+	listable bool
 }
 
-func (q *stubQuery) ServerVersion() (string, error) {
+func (q *stubQuery) ServerVersion(_ context.Context) (string, error) {
 	return "v1.23.14-eks-ffeb93d", nil
 }
 
-func (q *stubQuery) InstanaLeader() (string, error) {
+func (q *stubQuery) InstanaLeader(_ context.Context) (string, error) {
 	return "instana-agent-hcdhs", nil
 }
 
@@ -72,11 +255,34 @@ func (q *stubQuery) Host() string {
 	return "https://localhost:8443"
 }
 
-func (q *stubQuery) AllNodes() ([]cluster.NodeInfo, error) {
-	return []cluster.NodeInfo{}, nil
+func (q *stubQuery) AllNodes(_ context.Context) ([]cluster.NodeInfo, error) {
+	return []cluster.NodeInfo{}, q.nodesErr
+}
+
+func (q *stubQuery) Namespace() string {
+	return "default"
+}
+
+func (q *stubQuery) Namespaces(_ context.Context) ([]string, error) {
+	if q.namespaced && !q.listable {
+		return nil, forbidden("namespaces")
+	}
+	return []string{"default", "instana-agent"}, nil
+}
+
+func (q *stubQuery) AllEvents(_ context.Context, _ string) ([]cluster.EventInfo, error) {
+	if q.eventsErr != nil {
+		return nil, q.eventsErr
+	}
+	return []cluster.EventInfo{
+		{Namespace: "instana-agent", Kind: "Pod", Name: "instana-agent-xyz123", Reason: "BackOff", Count: 3},
+	}, nil
 }
 
-func (q *stubQuery) AllPods() ([]cluster.PodInfo, error) {
+func (q *stubQuery) StreamPods(_ context.Context, namespace string, fn func(cluster.PodInfo)) error {
+	if q.namespaced && namespace != "instana-agent" {
+		return forbidden("pods")
+	}
 	pods := []cluster.PodInfo{
 		{
 			Host: "192.168.253.101",
@@ -109,5 +315,18 @@ func (q *stubQuery) AllPods() ([]cluster.PodInfo, error) {
 			},
 		},
 	}
-	return pods, nil
+	for _, pod := range pods {
+		fn(pod)
+	}
+	return nil
+}
+
+func (q *stubQuery) AllPolicies(_ context.Context) ([]cluster.PolicyInfo, error) {
+	return []cluster.PolicyInfo{
+		{Kind: cluster.KindNetworkPolicy, Namespace: "instana-agent", Name: "default-deny", Egress: true},
+	}, nil
+}
+
+func forbidden(resource string) error {
+	return errors.NewForbidden(schema.GroupResource{Resource: resource}, "", fmt.Errorf("rbac"))
 }
@@ -1,6 +1,7 @@
 package main
 
 import (
+	"context"
 	"fmt"
 	"io"
 	"log"
@@ -11,13 +12,13 @@ import (
 )
 
 // ExecLeader executes the leader subcommand.
-func ExecLeader(config EnvcheckConfig) {
-	query, err := cluster.New(config.Kubeconfig)
+func ExecLeader(ctx context.Context, config EnvcheckConfig) {
+	query, err := cluster.New(config.ClusterConfig())
 	if err != nil {
 		log.Fatalf("error initialising cluster query: %v\n", err)
 	}
 
-	leader, err := query.InstanaLeader()
+	leader, err := query.InstanaLeader(ctx)
 	if err != nil {
 		log.Fatalf("error retrieving leader: %v\n", err)
 	}
@@ -0,0 +1,133 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"log"
+	"sort"
+	"time"
+
+	"github.com/instana/envcheck/cluster"
+	"github.com/instana/envcheck/signature"
+)
+
+// LogQuery is the cluster query used to retrieve the agent logs.
+type LogQuery interface {
+	AgentManifests(ctx context.Context, namespace string, name string) (*cluster.AgentManifests, error)
+	ContainerLogs(ctx context.Context, namespace string, selector string, opts cluster.LogOptions) ([]cluster.ContainerLog, error)
+}
+
+// LogMatches are the signatures matched in a container log.
+type LogMatches struct {
+	Pod       string
+	Node      string
+	Container string
+	Previous  bool
+	Matches   []signature.Match
+	Err       error
+}
+
+// ExecLogs retrieves the current and previous agent container logs and scans
+// them for known problem signatures.
+func ExecLogs(ctx context.Context, config EnvcheckConfig) {
+	log.SetFlags(0)
+	catalogue, err := LoadCatalogue(config.SignatureFile)
+	if err != nil {
+		log.Fatalf("signatures=failed err='%v'\n", err)
+	}
+
+	query, err := cluster.New(config.ClusterConfig())
+	if err != nil {
+		log.Fatalf("error initialising cluster query: %v\n", err)
+	}
+
+	logs, err := AgentLogs(ctx, query, config)
+	if err != nil {
+		log.Fatalf("logs=failed err='%v'\n", err)
+	}
+	PrintLogMatches(ScanLogs(logs, catalogue))
+}
+
+// LoadCatalogue provides the built-in signatures extended with those in
+// filename when it is set.
+func LoadCatalogue(filename string) (*signature.Catalogue, error) {
+	signatures := signature.Builtin()
+	if filename != "" {
+		extra, err := signature.LoadFile(filename)
+		if err != nil {
+			return nil, err
+		}
+		signatures = signature.Merge(signatures, extra)
+	}
+	return signature.NewCatalogue(signatures)
+}
+
+// AgentLogs retrieves the timestamped agent container logs. The agent pods
+// are selected with the DaemonSet selector unless a selector is configured.
+func AgentLogs(ctx context.Context, query LogQuery, config EnvcheckConfig) ([]cluster.ContainerLog, error) {
+	selector := config.Selector
+	if selector == "" {
+		manifests, err := query.AgentManifests(ctx, config.AgentNamespace, config.AgentName)
+		if err != nil {
+			return nil, err
+		}
+		selector = manifests.Selector
+	}
+	return query.ContainerLogs(ctx, config.AgentNamespace, selector, cluster.LogOptions{TailLines: int64(config.Tail), Timestamps: true})
+}
+
+// ScanLogs scans each container log for the signatures in the catalogue.
+func ScanLogs(logs []cluster.ContainerLog, catalogue *signature.Catalogue) []LogMatches {
+	var scanned []LogMatches
+	for _, l := range logs {
+		lm := LogMatches{Pod: l.Pod, Node: l.Node, Container: l.Container, Previous: l.Previous, Err: l.Err}
+		if l.Err == nil {
+			lm.Matches, lm.Err = catalogue.Scan(bytes.NewReader(l.Body))
+		}
+		scanned = append(scanned, lm)
+	}
+	return scanned
+}
+
+// PrintLogMatches prints a row for each signature matched in each log followed
+// by the description of every signature matched.
+func PrintLogMatches(scanned []LogMatches) {
+	descriptions := make(map[string]string)
+	pods := make(map[string]cluster.Set)
+	for _, lm := range scanned {
+		if lm.Err != nil {
+			log.Printf("pod=%s container=%s previous=%v scan=failed err='%v'\n", lm.Pod, lm.Container, lm.Previous, lm.Err)
+			continue
+		}
+		for _, m := range lm.Matches {
+			log.Printf("pod=%s node=%s container=%s previous=%v signature=%s count=%d first=%s\n",
+				lm.Pod, lm.Node, lm.Container, lm.Previous, m.Signature, m.Count, firstSeen(m.FirstSeen))
+			descriptions[m.Signature] = m.Description
+			if pods[m.Signature] == nil {
+				pods[m.Signature] = make(cluster.Set)
+			}
+			pods[m.Signature].Add(lm.Pod)
+		}
+	}
+
+	if len(descriptions) == 0 {
+		log.Printf("\nlogs=%d signatures=0\n", len(scanned))
+		return
+	}
+	var names []string
+	for name := range descriptions {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	log.Println()
+	for _, name := range names {
+		log.Printf("signature=%s pods=%d hint='%s'\n", name, len(pods[name]), descriptions[name])
+	}
+}
+
+func firstSeen(ts time.Time) string {
+	if ts.IsZero() {
+		return "unknown"
+	}
+	return ts.Format(time.RFC3339)
+}
@@ -0,0 +1,94 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/instana/envcheck/cluster"
+)
+
+func Test_AgentLogs_should_default_to_daemonset_selector(t *testing.T) {
+	t.Parallel()
+	query := &stubLogQuery{}
+	config := EnvcheckConfig{AgentNamespace: "instana-agent", AgentName: "instana-agent", Tail: 100}
+
+	_, err := AgentLogs(context.Background(), query, config)
+	if err != nil {
+		t.Fatalf("AgentLogs() err=%v, want nil", err)
+	}
+	if query.selector != "app=instana-agent" {
+		t.Errorf("selector=%v, want app=instana-agent", query.selector)
+	}
+	expected := cluster.LogOptions{TailLines: 100, Timestamps: true}
+	if query.opts != expected {
+		t.Errorf("opts=%+v, want %+v", query.opts, expected)
+	}
+}
+
+func Test_ScanLogs(t *testing.T) {
+	t.Parallel()
+	catalogue, err := LoadCatalogue("")
+	if err != nil {
+		t.Fatalf("LoadCatalogue() err=%v, want nil", err)
+	}
+	logs := []cluster.ContainerLog{
+		{Pod: "instana-agent-a", Container: "instana-agent", Body: []byte("2022-03-01T10:00:00Z INFO | started\n")},
+		{Pod: "instana-agent-b", Container: "instana-agent", Previous: true, Body: []byte(
+			"2022-03-01T10:00:00Z WARN | Failed to connect to ingress-red-saas.instana.io:443: Connection refused\n2022-03-01T10:01:00Z ERROR | java.lang.OutOfMemoryError: Java heap space\n")},
+		{Pod: "instana-agent-c", Container: "instana-agent", Err: fmt.Errorf("forbidden")},
+	}
+
+	type row struct {
+		Pod       string
+		Signature string
+		Count     int
+		FirstSeen time.Time
+	}
+	var rows []row
+	var failed []string
+	for _, lm := range ScanLogs(logs, catalogue) {
+		if lm.Err != nil {
+			failed = append(failed, lm.Pod)
+		}
+		for _, m := range lm.Matches {
+			rows = append(rows, row{lm.Pod, m.Signature, m.Count, m.FirstSeen})
+		}
+	}
+
+	expected := []row{
+		{"instana-agent-b", "backend-connection-refused", 1, time.Date(2022, 3, 1, 10, 0, 0, 0, time.UTC)},
+		{"instana-agent-b", "out-of-memory", 1, time.Date(2022, 3, 1, 10, 1, 0, 0, time.UTC)},
+	}
+	if !cmp.Equal(expected, rows) {
+		t.Errorf("ScanLogs() mismatch (-want +got)\n%s", cmp.Diff(expected, rows))
+	}
+	if !cmp.Equal([]string{"instana-agent-c"}, failed) {
+		t.Errorf("failed=%v, want [instana-agent-c]", failed)
+	}
+}
+
+func Test_LoadCatalogue_errors_when_file_missing(t *testing.T) {
+	t.Parallel()
+	_, err := LoadCatalogue("does-not-exist.yaml")
+	if err == nil {
+		t.Error("err=nil, want not found err")
+	}
+}
+
+type stubLogQuery struct {
+	selector string
+	opts     cluster.LogOptions
+}
+
+func (q *stubLogQuery) AgentManifests(_ context.Context, _ string, _ string) (*cluster.AgentManifests, error) {
+	return &cluster.AgentManifests{Selector: "app=instana-agent"}, nil
+}
+
+func (q *stubLogQuery) ContainerLogs(_ context.Context, _ string, selector string, opts cluster.LogOptions) ([]cluster.ContainerLog, error) {
+	q.selector = selector
+	q.opts = opts
+	return nil, nil
+}
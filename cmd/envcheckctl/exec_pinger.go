@@ -1,27 +1,248 @@
 package main
 
 import (
-	"github.com/instana/envcheck/cluster"
+	"context"
+	"fmt"
 	"log"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/instana/envcheck/cluster"
+	"k8s.io/apimachinery/pkg/runtime"
 )
 
 // ExecPinger executes the pinger subcommand.
-func ExecPinger(config EnvcheckConfig) {
-	command, err := cluster.NewCommand(config.Kubeconfig)
+func ExecPinger(ctx context.Context, config EnvcheckConfig) {
+	err := config.Workload.Validate()
 	if err != nil {
-		log.Fatalf("createClient=failed err='%v'\n", err)
+		log.Fatalf("config=invalid err='%v'\n", err)
 	}
 
 	pc := cluster.PingerConfig{
-		Image:      "instana/envcheck-pinger:latest",
+		Image:      config.Image("envcheck-pinger"),
 		Namespace:  config.PingerNamespace,
 		Version:    Revision,
 		Host:       config.PingerHost,
-		Port:       42700,
+		Port:       int32(config.Port),
 		UseGateway: config.UseGateway,
+		Workload:   config.Workload,
+	}
+	if config.IsDryRun() {
+		if config.AllNamespaces {
+			log.Fatalf("render=failed err='-all-namespaces requires the cluster, use -ns instead'\n")
+		}
+		var objects []runtime.Object
+		for _, ns := range SplitList(config.PingerNamespace) {
+			pc.Namespace = ns
+			objects = append(objects, cluster.PingerManifests(pc)...)
+		}
+		ExecRender(config, objects...)
+		return
+	}
+
+	command, err := cluster.NewCommand(config.ClusterConfig())
+	if err != nil {
+		log.Fatalf("createClient=failed err='%v'\n", err)
+	}
+
+	namespaces, err := PingerNamespaces(ctx, command, config)
+	if err != nil {
+		log.Fatalf("namespaces=failed err='%v'\n", err)
+	}
+	if len(namespaces) == 0 {
+		log.Fatalf("namespaces=failed err='no namespaces match selector %q'\n", config.Selector)
+	}
+
+	for _, ns := range namespaces {
+		pc.Namespace = ns
+		applied, err := command.CreatePinger(ctx, pc)
+		if err != nil {
+			log.Fatalf("createPinger=failed err='%v'\n", err)
+		}
+		log.Printf("applied=%v action=%s\n", applied, applied.Action)
+	}
+
+	if config.Timeout == 0 {
+		return
+	}
+
+	query, err := cluster.New(config.ClusterConfig())
+	if err != nil {
+		log.Fatalf("error initialising cluster query: %v\n", err)
+	}
+
+	fanout := &PingerFanout{
+		Command:   command,
+		Logs:      query,
+		PodLabels: cluster.Pinger(pc).Spec.Template.Labels,
+		Port:      int32(config.Port),
+		Version:   pc.Version,
+		Parallel:  config.Parallel,
+	}
+	reports := fanout.Run(ctx, namespaces)
+
+	rows := NamespaceRows(reports)
+	PrintRows(rows, ColumnWidths(rows))
+	unreachable := Unreachable(reports)
+	log.Printf("\nnamespaces=%d reachable=%d unreachable=%d\n", len(reports), len(reports)-unreachable, unreachable)
+	notInspected := NotInspected(reports)
+	if len(notInspected) > 0 {
+		log.Printf("notInspected=%s\n", strings.Join(notInspected, ","))
+	}
+	if unreachable > 0 {
+		os.Exit(1)
+	}
+}
+
+// SplitList splits the comma separated list such as namespaces, dropping blanks.
+func SplitList(s string) []string {
+	var namespaces []string
+	for _, ns := range strings.Split(s, ",") {
+		ns = strings.TrimSpace(ns)
+		if ns != "" {
+			namespaces = append(namespaces, ns)
+		}
+	}
+	return namespaces
+}
+
+// PingerNamespaces provides the namespaces to deploy the pinger to, either
+// the -ns list or every namespace matching the selector with -all-namespaces.
+func PingerNamespaces(ctx context.Context, command cluster.Command, config EnvcheckConfig) ([]string, error) {
+	if config.AllNamespaces {
+		return command.Namespaces(ctx, config.Selector)
 	}
-	err = command.CreatePinger(pc)
+	return SplitList(config.PingerNamespace), nil
+}
+
+// PingerFanout collects the pinger results and the NetworkPolicies selecting
+// the pinger pods in each namespace, Parallel namespaces at a time.
+type PingerFanout struct {
+	Command   cluster.Command
+	Logs      PodLogReader
+	PodLabels map[string]string
+	Port      int32
+	Version   string
+	Parallel  int
+}
+
+// errNotInspected is the report error of a namespace still queued when the
+// fanout is done.
+const errNotInspected = "not inspected"
+
+// NamespaceReport is the connectivity of the pingers in a namespace and the
+// NetworkPolicies that select them.
+type NamespaceReport struct {
+	Namespace string
+	Results   []ConnectivityResult
+	Policies  []cluster.PolicyReport
+	Err       string
+}
+
+// Reachable indicates whether every pinger in the namespace reached the daemon.
+func (r *NamespaceReport) Reachable() bool {
+	return r.Err == "" && len(r.Results) > 0 && Failed(r.Results) == 0
+}
+
+// Blocking lists the policies that do not allow egress to the daemon.
+func (r *NamespaceReport) Blocking() []string {
+	var names []string
+	for _, p := range r.Policies {
+		if p.BlocksEgress {
+			names = append(names, fmt.Sprintf("%s (%s)", p.Name, p.Reason))
+		}
+	}
+	return names
+}
+
+// Run waits for the pinger rollout in each namespace and collects its report
+// until ctx is done. The namespaces are tested concurrently so a namespace
+// whose rollout never completes does not hold up the others, a namespace
+// still queued when ctx is done is reported as not inspected.
+func (f *PingerFanout) Run(ctx context.Context, namespaces []string) []NamespaceReport {
+	reports := make([]NamespaceReport, len(namespaces))
+	var steps []cluster.Step
+	for i, ns := range namespaces {
+		i, ns := i, ns
+		reports[i] = NamespaceReport{Namespace: ns, Err: errNotInspected}
+		steps = append(steps, cluster.Step{Name: ns, Optional: true, Run: func(ctx context.Context) error {
+			err := ctx.Err()
+			if err != nil {
+				return err
+			}
+			reports[i] = f.report(ctx, ns)
+			return nil
+		}})
+	}
+
+	collector := cluster.NewCollector(f.Parallel, time.Now)
+	// every step is optional so the outcome of each namespace is kept in its report.
+	_ = collector.Run(ctx, steps...)
+	return reports
+}
+
+// NotInspected lists the namespaces that were never tested.
+func NotInspected(reports []NamespaceReport) []string {
+	var namespaces []string
+	for _, r := range reports {
+		if r.Err == errNotInspected {
+			namespaces = append(namespaces, r.Namespace)
+		}
+	}
+	return namespaces
+}
+
+func (f *PingerFanout) report(ctx context.Context, namespace string) NamespaceReport {
+	report := NamespaceReport{Namespace: namespace}
+
+	policies, err := f.Command.NetworkPolicies(ctx, namespace)
 	if err != nil {
-		log.Fatalf("createPinger=failed err='%v'\n", err)
+		log.Printf("networkPolicies=failed namespace=%s err='%v'\n", namespace, err)
+	}
+	report.Policies = cluster.PolicyReports(policies, f.PodLabels, f.Port)
+
+	if !WaitForRollout(ctx, f.Command, namespace, cluster.PingerName) {
+		report.Err = "rollout failed"
+		return report
+	}
+
+	report.Results, err = CollectStatus(ctx, f.Logs, namespace, f.Version)
+	if err != nil {
+		report.Err = err.Error()
+	}
+	return report
+}
+
+// NamespaceRows builds the table rows for the reports with the first row as the header.
+func NamespaceRows(reports []NamespaceReport) [][]string {
+	rows := [][]string{{"namespace", "result", "pingers", "failed", "policies", "likely blocking", "error"}}
+	for _, r := range reports {
+		result := "unreachable"
+		if r.Reachable() {
+			result = "reachable"
+		}
+		rows = append(rows, []string{
+			r.Namespace,
+			result,
+			strconv.Itoa(len(r.Results)),
+			strconv.Itoa(Failed(r.Results)),
+			strconv.Itoa(len(r.Policies)),
+			strings.Join(r.Blocking(), ", "),
+			r.Err,
+		})
+	}
+	return rows
+}
+
+// Unreachable counts the namespaces where a pinger could not reach the daemon.
+func Unreachable(reports []NamespaceReport) int {
+	var unreachable int
+	for i := range reports {
+		if !reports[i].Reachable() {
+			unreachable++
+		}
 	}
+	return unreachable
 }
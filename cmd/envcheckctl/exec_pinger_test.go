@@ -0,0 +1,164 @@
+package main
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/instana/envcheck/cluster"
+	"github.com/instana/envcheck/ping"
+	corev1 "k8s.io/api/core/v1"
+	networkingv1 "k8s.io/api/networking/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+func Test_PingerFanout_Run(t *testing.T) {
+	t.Parallel()
+	podLabels := map[string]string{cluster.LabelName: cluster.PingerName}
+	objects := []runtime.Object{
+		pingerPod("team-a", "pinger-abc12", "node-1"),
+		pingerPod("team-b", "pinger-def34", "node-1"),
+		&networkingv1.NetworkPolicy{
+			ObjectMeta: metav1.ObjectMeta{Namespace: "team-b", Name: "default-deny"},
+			Spec: networkingv1.NetworkPolicySpec{
+				PolicyTypes: []networkingv1.PolicyType{networkingv1.PolicyTypeEgress},
+			},
+		},
+	}
+	statuses := map[string]ping.Status{
+		"pinger-abc12": {Address: "10.0.0.1:42700", OK: true, Successes: 3, Checked: time.Now()},
+		"pinger-def34": {Address: "10.0.0.1:42700", Failures: 3, LastError: "i/o timeout", Checked: time.Now()},
+	}
+	client := fake.NewSimpleClientset(objects...)
+	command := &cluster.KubernetesCommand{AppsV1Interface: client.AppsV1(), CoreV1Interface: client.CoreV1(), NetworkingV1Interface: client.NetworkingV1()}
+	logs := &stubLogs{client: client, statuses: statuses}
+
+	namespaces := []string{"team-a", "team-b"}
+	for _, ns := range namespaces {
+		_, err := command.CreatePinger(context.Background(), cluster.PingerConfig{Namespace: ns, Version: Revision})
+		if err != nil {
+			t.Fatalf("CreatePinger() err=%v, want nil", err)
+		}
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	fanout := &PingerFanout{Command: command, Logs: logs, PodLabels: podLabels, Port: 42700, Version: Revision}
+	reports := fanout.Run(ctx, namespaces)
+
+	expected := [][]string{
+		{"namespace", "result", "pingers", "failed", "policies", "likely blocking", "error"},
+		{"team-a", "reachable", "1", "0", "0", "", ""},
+		{"team-b", "unreachable", "1", "1", "1", "default-deny (denies all egress)", ""},
+	}
+	actual := NamespaceRows(reports)
+	if !cmp.Equal(expected, actual) {
+		t.Errorf("NamespaceRows() mismatch (-want +got)\n%s", cmp.Diff(expected, actual))
+	}
+	if Unreachable(reports) != 1 {
+		t.Errorf("Unreachable()=%d, want 1", Unreachable(reports))
+	}
+}
+
+func Test_PingerFanout_Run_should_not_wait_on_a_stuck_namespace(t *testing.T) {
+	t.Parallel()
+	client := fake.NewSimpleClientset(pingerPod("team-a", "pinger-abc12", "node-1"))
+	kc := &cluster.KubernetesCommand{AppsV1Interface: client.AppsV1(), CoreV1Interface: client.CoreV1(), NetworkingV1Interface: client.NetworkingV1()}
+	for _, ns := range []string{"stuck", "team-a"} {
+		_, err := kc.CreatePinger(context.Background(), cluster.PingerConfig{Namespace: ns, Version: Revision})
+		if err != nil {
+			t.Fatalf("CreatePinger() err=%v, want nil", err)
+		}
+	}
+	logs := &stubLogs{client: client, statuses: map[string]ping.Status{
+		"pinger-abc12": {Address: "10.0.0.1:42700", OK: true, Successes: 3, Checked: time.Now()},
+	}}
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	fanout := &PingerFanout{Command: &stuckCommand{kc, "stuck"}, Logs: logs, Port: 42700, Version: Revision, Parallel: 2}
+	reports := fanout.Run(ctx, []string{"stuck", "team-a"})
+
+	if reports[0].Err != "rollout failed" {
+		t.Errorf("stuck Err=%q, want rollout failed", reports[0].Err)
+	}
+	if !reports[1].Reachable() {
+		t.Errorf("team-a=%+v, want reachable", reports[1])
+	}
+}
+
+func Test_PingerFanout_Run_should_report_namespaces_not_inspected(t *testing.T) {
+	t.Parallel()
+	client := fake.NewSimpleClientset()
+	command := &cluster.KubernetesCommand{AppsV1Interface: client.AppsV1(), CoreV1Interface: client.CoreV1(), NetworkingV1Interface: client.NetworkingV1()}
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	fanout := &PingerFanout{Command: command, Logs: &stubLogs{client: client}, Port: 42700, Version: Revision, Parallel: 1}
+	reports := fanout.Run(ctx, []string{"team-a", "team-b"})
+
+	expected := []string{"team-a", "team-b"}
+	actual := NotInspected(reports)
+	if !cmp.Equal(expected, actual) {
+		t.Errorf("NotInspected() mismatch (-want +got)\n%s", cmp.Diff(expected, actual))
+	}
+}
+
+// stuckCommand never completes the rollout in namespace.
+type stuckCommand struct {
+	cluster.Command
+	namespace string
+}
+
+func (c *stuckCommand) WaitRollout(ctx context.Context, namespace string, name string, progress func(*cluster.Rollout)) (*cluster.Rollout, error) {
+	if namespace != c.namespace {
+		return c.Command.WaitRollout(ctx, namespace, name, progress)
+	}
+	<-ctx.Done()
+	return nil, ctx.Err()
+}
+
+func Test_PingerNamespaces(t *testing.T) {
+	t.Parallel()
+	client := fake.NewSimpleClientset(
+		&corev1.Namespace{ObjectMeta: metav1.ObjectMeta{Name: "team-a", Labels: map[string]string{"team": "x"}}},
+		&corev1.Namespace{ObjectMeta: metav1.ObjectMeta{Name: "team-c"}},
+	)
+	command := &cluster.KubernetesCommand{CoreV1Interface: client.CoreV1(), NetworkingV1Interface: client.NetworkingV1()}
+	cases := map[string]struct {
+		config   EnvcheckConfig
+		expected []string
+	}{
+		"single":         {EnvcheckConfig{PingerNamespace: "default"}, []string{"default"}},
+		"list":           {EnvcheckConfig{PingerNamespace: "team-a, team-b,"}, []string{"team-a", "team-b"}},
+		"all namespaces": {EnvcheckConfig{PingerNamespace: "default", AllNamespaces: true, Selector: "team=x"}, []string{"team-a"}},
+	}
+	for name, tc := range cases {
+		tc := tc
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+			actual, err := PingerNamespaces(context.Background(), command, tc.config)
+			if err != nil {
+				t.Fatalf("PingerNamespaces() err=%v, want nil", err)
+			}
+			if !cmp.Equal(tc.expected, actual) {
+				t.Errorf("PingerNamespaces() mismatch (-want +got)\n%s", cmp.Diff(tc.expected, actual))
+			}
+		})
+	}
+}
+
+func pingerPod(namespace string, name string, node string) *corev1.Pod {
+	return &corev1.Pod{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      name,
+			Namespace: namespace,
+			Labels:    map[string]string{cluster.LabelName: cluster.PingerName, cluster.LabelVersion: Revision},
+		},
+		Spec:   corev1.PodSpec{NodeName: node},
+		Status: corev1.PodStatus{Phase: corev1.PodRunning},
+	}
+}
@@ -0,0 +1,56 @@
+package main
+
+import (
+	"log"
+	"os"
+	"strings"
+
+	"github.com/instana/envcheck/cluster"
+)
+
+// ExecRedact executes the redact subcommand.
+func ExecRedact(config EnvcheckConfig) {
+	log.SetFlags(0)
+	if config.Podfile == "" {
+		log.Fatalf("redact=failed err='-podfile is required'\n")
+	}
+
+	redactor, err := cluster.NewRedactor(SplitList(config.KeepAnnotations))
+	if err != nil {
+		log.Fatalf("redact=failed err='%v'\n", err)
+	}
+
+	r, err := os.Open(config.Podfile)
+	if err != nil {
+		log.Fatalf("open=failed file=%s err='%v'\n", config.Podfile, err)
+	}
+	defer r.Close()
+
+	filename := config.OutputFile
+	if filename == "" {
+		filename = RedactedFilename(config.Podfile, config.Compress)
+	}
+	w, err := os.Create(filename)
+	if err != nil {
+		log.Fatalf("create=failed file=%s err='%v'\n", filename, err)
+	}
+
+	info, err := cluster.RedactPodfile(r, w, redactor, config.Compress)
+	w.Close()
+	if err != nil {
+		os.Remove(filename)
+		log.Fatalf("redact=failed file=%s err='%v'\n", config.Podfile, err)
+	}
+	log.Printf("podfile=%s redacted=%s cluster=%s pods=%d\n", config.Podfile, filename, info.Name, info.PodCount)
+}
+
+// RedactedFilename provides the name of the redacted podfile beside the
+// podfile, e.g. cluster-info-1589217975-redacted.json.gz.
+func RedactedFilename(podfile string, compress bool) string {
+	base := strings.TrimSuffix(strings.TrimSuffix(podfile, ".gz"), ".json")
+	filename := base + "-redacted.json"
+	if compress {
+		filename += ".gz"
+	}
+	return filename
+}
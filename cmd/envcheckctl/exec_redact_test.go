@@ -0,0 +1,27 @@
+package main
+
+import "testing"
+
+func Test_RedactedFilename(t *testing.T) {
+	testCases := map[string]struct {
+		podfile  string
+		compress bool
+		expected string
+	}{
+		"compressed":          {"cluster-info-1.json.gz", true, "cluster-info-1-redacted.json.gz"},
+		"plain to compressed": {"cluster-info-1.json", true, "cluster-info-1-redacted.json.gz"},
+		"compressed to plain": {"cluster-info-1.json.gz", false, "cluster-info-1-redacted.json"},
+		"no extension":        {"dump", false, "dump-redacted.json"},
+	}
+
+	for name, tc := range testCases {
+		tc := tc
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+			actual := RedactedFilename(tc.podfile, tc.compress)
+			if actual != tc.expected {
+				t.Errorf("RedactedFilename()=%v, want %v", actual, tc.expected)
+			}
+		})
+	}
+}
@@ -0,0 +1,27 @@
+package main
+
+import (
+	"log"
+	"os"
+
+	"github.com/instana/envcheck/cluster"
+	"k8s.io/apimachinery/pkg/runtime"
+)
+
+// ExecRender prints the manifests or writes them to a kustomize directory
+// instead of applying them to the cluster.
+func ExecRender(config EnvcheckConfig, objects ...runtime.Object) {
+	if config.OutputDir != "" {
+		files, err := cluster.WriteKustomize(config.OutputDir, objects...)
+		if err != nil {
+			log.Fatalf("render=failed dir=%s err='%v'\n", config.OutputDir, err)
+		}
+		log.Printf("render=success dir=%s files=%v\n", config.OutputDir, files)
+		return
+	}
+
+	err := cluster.Render(os.Stdout, config.Output, objects...)
+	if err != nil {
+		log.Fatalf("render=failed err='%v'\n", err)
+	}
+}
@@ -0,0 +1,87 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"os"
+	"sort"
+	"time"
+
+	"github.com/instana/envcheck/cluster"
+	"github.com/instana/envcheck/repocheck"
+)
+
+// ExecRepocheck fetches the connectivity history from each repocheck pod.
+func ExecRepocheck(ctx context.Context, config EnvcheckConfig) {
+	log.SetFlags(0)
+	query, err := cluster.New(config.ClusterConfig())
+	if err != nil {
+		log.Fatalf("error initialising cluster query: %v\n", err)
+	}
+
+	params := map[string]string{"since": config.Since.String()}
+	responses, err := query.ProxyPods(ctx, config.AgentNamespace, config.Selector, config.Port, repocheck.ResultsPath, params)
+	if err != nil {
+		log.Fatalf("error listing repocheck pods: %v\n", err)
+	}
+
+	history, failed := DecodeHistory(responses)
+	for pod, err := range failed {
+		log.Printf("pod=%s fetch=failed err='%v'\n", pod, err)
+	}
+	PrintHistory(history)
+
+	filename := fmt.Sprintf("repocheck-history-%d.json", time.Now().UTC().Unix())
+	w, err := os.Create(filename)
+	if err != nil {
+		log.Fatalln(err)
+	}
+	err = json.NewEncoder(w).Encode(history)
+	w.Close()
+	if err != nil {
+		log.Fatalln(err)
+	}
+	log.Printf("\nhistory=%s pods=%d failed=%d\n", filename, len(history), len(failed))
+}
+
+// DecodeHistory decodes the windows from each pod response keyed by pod name.
+func DecodeHistory(responses []cluster.PodResponse) (map[string][]repocheck.Window, map[string]error) {
+	history := make(map[string][]repocheck.Window)
+	failed := make(map[string]error)
+	for _, resp := range responses {
+		if resp.Err != nil {
+			failed[resp.Pod] = resp.Err
+			continue
+		}
+		var windows []repocheck.Window
+		err := json.Unmarshal(resp.Body, &windows)
+		if err != nil {
+			failed[resp.Pod] = err
+			continue
+		}
+		history[resp.Pod] = windows
+	}
+	return history, failed
+}
+
+// PrintHistory prints a summary row for each pod and period.
+func PrintHistory(history map[string][]repocheck.Window) {
+	var pods []string
+	for pod := range history {
+		pods = append(pods, pod)
+	}
+	sort.Strings(pods)
+
+	for _, pod := range pods {
+		summary := repocheck.Summarise(pod, history[pod])
+		for _, p := range summary.Periods {
+			log.Printf("pod=%s period=%v windows=%d requests=%d first=%s last=%s verdicts=%v failures=%v\n",
+				pod, p.Period, p.Windows, p.Count, p.First.Format(time.RFC3339), p.Last.Format(time.RFC3339), p.Verdicts, p.Failures)
+		}
+		if len(summary.Periods) == 0 {
+			log.Printf("pod=%s windows=0\n", pod)
+		}
+	}
+}
@@ -0,0 +1,25 @@
+package main
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/instana/envcheck/cluster"
+)
+
+func Test_DecodeHistory(t *testing.T) {
+	t.Parallel()
+	responses := []cluster.PodResponse{
+		{Pod: "repocheck-abc12", Body: []byte(`[{"Pod":"repocheck-abc12","Period":3600000000000,"Count":60,"Verdict":"healthy"}]`)},
+		{Pod: "repocheck-def34", Err: errors.New("service unavailable")},
+		{Pod: "repocheck-ghi56", Body: []byte(`bloop`)},
+	}
+
+	history, failed := DecodeHistory(responses)
+	if len(history["repocheck-abc12"]) != 1 {
+		t.Errorf("len(history)=%v, want 1", len(history["repocheck-abc12"]))
+	}
+	if len(failed) != 2 {
+		t.Errorf("len(failed)=%v, want 2", len(failed))
+	}
+}
@@ -0,0 +1,78 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+
+	"github.com/instana/envcheck/cluster"
+)
+
+// WaitForRollout waits until ctx is done for the DaemonSet to be ready on every
+// scheduled node logging the progress, it returns whether the rollout succeeded.
+func WaitForRollout(ctx context.Context, command cluster.Command, namespace string, name string) bool {
+	printer := NewRolloutPrinter()
+	rollout, err := command.WaitRollout(ctx, namespace, name, printer.Print)
+	if err != nil {
+		if rollout == nil {
+			log.Printf("rollout=failed daemonset=%s/%s err='%v'\n", namespace, name, err)
+			return false
+		}
+		log.Printf("rollout=failed daemonset=%s/%s desired=%d updated=%d ready=%d err='%v'\n",
+			namespace, name, rollout.Desired, rollout.Updated, rollout.Ready, err)
+		return false
+	}
+
+	log.Printf("rollout=success daemonset=%s/%s desired=%d ready=%d\n", namespace, name, rollout.Desired, rollout.Ready)
+	return true
+}
+
+// NewRolloutPrinter creates a RolloutPrinter.
+func NewRolloutPrinter() *RolloutPrinter {
+	return &RolloutPrinter{
+		pods:     make(map[string]string),
+		warnings: make(map[string]int32),
+	}
+}
+
+// RolloutPrinter logs the rollout progress with each pod state and warning
+// event logged only when it changes.
+type RolloutPrinter struct {
+	status   string
+	pods     map[string]string
+	warnings map[string]int32
+}
+
+// Print logs the changes since the previous rollout.
+func (p *RolloutPrinter) Print(r *cluster.Rollout) {
+	for _, line := range p.Changes(r) {
+		log.Println(line)
+	}
+}
+
+// Changes provides the log lines that changed since the previous rollout.
+func (p *RolloutPrinter) Changes(r *cluster.Rollout) []string {
+	var lines []string
+	status := fmt.Sprintf("rollout=waiting daemonset=%s/%s desired=%d updated=%d ready=%d", r.Namespace, r.Name, r.Desired, r.Updated, r.Ready)
+	if status != p.status {
+		lines = append(lines, status)
+		p.status = status
+	}
+
+	for _, pod := range r.Pods {
+		line := pod.String()
+		if p.pods[pod.Name] != line {
+			lines = append(lines, line)
+			p.pods[pod.Name] = line
+		}
+	}
+
+	for _, w := range r.Warnings {
+		key := w.UID + w.Object + w.Reason
+		if p.warnings[key] != w.Count {
+			lines = append(lines, "warning "+w.String())
+			p.warnings[key] = w.Count
+		}
+	}
+	return lines
+}
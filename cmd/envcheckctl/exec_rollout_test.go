@@ -0,0 +1,47 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/instana/envcheck/cluster"
+)
+
+func Test_RolloutPrinter_Changes(t *testing.T) {
+	t.Parallel()
+	printer := NewRolloutPrinter()
+	rollout := &cluster.Rollout{
+		Namespace: "default",
+		Name:      "pinger",
+		Desired:   2,
+		Updated:   2,
+		Ready:     1,
+		Pods: []cluster.PodProgress{
+			{Name: "pinger-abc12", Node: "node-1", Phase: "Pending", Reason: "CrashLoopBackOff"},
+		},
+		Warnings: []cluster.Warning{
+			{UID: "1", Object: "Pod/pinger-abc12", Reason: "BackOff", Message: "Back-off restarting failed container", Count: 1},
+		},
+	}
+
+	expected := []string{
+		"rollout=waiting daemonset=default/pinger desired=2 updated=2 ready=1",
+		"pod=pinger-abc12 node=node-1 phase=Pending ready=false reason=CrashLoopBackOff message=''",
+		"warning object=Pod/pinger-abc12 reason=BackOff count=1 message='Back-off restarting failed container'",
+	}
+	actual := printer.Changes(rollout)
+	if !cmp.Equal(expected, actual) {
+		t.Errorf("Changes() mismatch (-want +got)\n%s", cmp.Diff(expected, actual))
+	}
+
+	actual = printer.Changes(rollout)
+	if len(actual) != 0 {
+		t.Errorf("Changes()=%v, want no changes", actual)
+	}
+
+	rollout.Warnings[0].Count = 2
+	actual = printer.Changes(rollout)
+	if len(actual) != 1 {
+		t.Errorf("Changes()=%v, want the repeated warning", actual)
+	}
+}
@@ -0,0 +1,54 @@
+package main
+
+import (
+	"flag"
+
+	"github.com/instana/envcheck/cluster"
+)
+
+// ClusterConfig provides the kubeconfig selection for the cluster commands.
+func (c *EnvcheckConfig) ClusterConfig() cluster.Kubeconfig {
+	return cluster.Kubeconfig{
+		Path:      c.Kubeconfig,
+		Context:   c.Context,
+		Namespace: c.KubeNamespace,
+		As:        c.As,
+		AsGroups:  c.AsGroups,
+	}
+}
+
+// kubeconfigFlags adds the kubectl flags selecting the cluster, user and namespace.
+func kubeconfigFlags(flags *flag.FlagSet, config *EnvcheckConfig) {
+	flags.StringVar(&config.Kubeconfig, "kubeconfig", "", "path to the kubeconfig file, defaults to the KUBECONFIG paths merged or ~/.kube/config")
+	flags.StringVar(&config.Context, "context", "", "kubeconfig context to use instead of the current context")
+	flags.StringVar(&config.KubeNamespace, "namespace", "", "namespace to use instead of the kubeconfig context namespace")
+	flags.StringVar(&config.As, "as", "", "user to impersonate")
+	flags.Func("as-group", "group to impersonate, can be repeated", func(s string) error {
+		config.AsGroups = append(config.AsGroups, s)
+		return nil
+	})
+}
+
+// DefaultNamespace replaces the -ns default with the -namespace value or the
+// namespace of the kubeconfig context, as kubectl would, when -ns is not set.
+func (c *EnvcheckConfig) DefaultNamespace() error {
+	var namespace *string
+	switch c.Subcommand {
+	case ApplyPinger:
+		namespace = &c.PingerNamespace
+	case Agent, ApplyDaemon, Backend, ConnectivityTest, RepocheckHistory, SupportBundle, LogSignatures:
+		namespace = &c.AgentNamespace
+	}
+	if namespace == nil || c.NamespaceSet {
+		return nil
+	}
+
+	ns, err := c.ClusterConfig().ContextNamespace()
+	if err != nil {
+		return err
+	}
+	if ns != "" {
+		*namespace = ns
+	}
+	return nil
+}
@@ -0,0 +1,64 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+const teamKubeconfig = `apiVersion: v1
+kind: Config
+current-context: dev
+clusters:
+- name: dev
+  cluster:
+    server: https://dev.example:6443
+contexts:
+- name: dev
+  context:
+    cluster: dev
+    user: dev
+    namespace: team-a
+users:
+- name: dev
+  user:
+    token: dev-token
+`
+
+func Test_DefaultNamespace(t *testing.T) {
+	t.Parallel()
+	kubeconfig := filepath.Join(t.TempDir(), "config")
+	err := os.WriteFile(kubeconfig, []byte(teamKubeconfig), 0600)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	cases := map[string]struct {
+		args   []string
+		agent  string
+		pinger string
+	}{
+		"kubeconfig context": {[]string{"envcheckctl", "logs"}, "team-a", ""},
+		"namespace flag":     {[]string{"envcheckctl", "bundle", "-namespace=team-b"}, "team-b", ""},
+		"ns flag":            {[]string{"envcheckctl", "agent", "-namespace=team-b", "-ns=instana-agent"}, "instana-agent", ""},
+		"pinger":             {[]string{"envcheckctl", "ping"}, "", "team-a"},
+		"connectivity":       {[]string{"envcheckctl", "connectivity", "-namespace=team-b"}, "team-b", "default"},
+	}
+	for name, tc := range cases {
+		tc := tc
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+			config, err := Parse(append(tc.args, "-kubeconfig="+kubeconfig), os.Stderr)
+			if err != nil {
+				t.Fatalf("Parse() err=%v, want nil", err)
+			}
+			err = config.DefaultNamespace()
+			if err != nil {
+				t.Fatalf("DefaultNamespace() err=%v, want nil", err)
+			}
+			if config.AgentNamespace != tc.agent || config.PingerNamespace != tc.pinger {
+				t.Errorf("namespaces=%q %q, want %q %q", config.AgentNamespace, config.PingerNamespace, tc.agent, tc.pinger)
+			}
+		})
+	}
+}
@@ -0,0 +1,203 @@
+package main
+
+import (
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/instana/envcheck/procfs"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// userHZ is the clock ticks per second used by delayacct_blkio_ticks.
+const userHZ = 100
+
+// Other is the bucket name for processes and pods outside of the top N.
+const Other = "other"
+
+var (
+	processDesc = prometheus.NewDesc("iowait_process_ratio",
+		"Fraction of the sample interval the processes with the command name spent waiting on block IO.",
+		[]string{"comm"}, nil)
+	podDesc = prometheus.NewDesc("iowait_pod_ratio",
+		"Fraction of the sample interval the processes of a pod spent waiting on block IO.",
+		[]string{"pod_uid"}, nil)
+	pressureDesc = prometheus.NewDesc("iowait_pressure_percent",
+		"Node pressure stall average as reported by /proc/pressure.",
+		[]string{"resource", "kind", "window"}, nil)
+	stallDesc = prometheus.NewDesc("iowait_pressure_stall_seconds_total",
+		"Node pressure total stall time as reported by /proc/pressure.",
+		[]string{"resource", "kind"}, nil)
+	processesDesc = prometheus.NewDesc("iowait_processes",
+		"Number of processes on the node.",
+		nil, nil)
+	waitingDesc = prometheus.NewDesc("iowait_processes_waiting",
+		"Number of processes that waited on block IO during the sample interval.",
+		nil, nil)
+)
+
+// NewSampler creates a sampler for the proc filesystem under root that reports
+// the top N processes and pods with the remainder in an "other" bucket.
+func NewSampler(root string, top int) *Sampler {
+	return &Sampler{
+		root: root,
+		top:  top,
+		prev: make(map[int]float64),
+	}
+}
+
+// Sampler tracks the block IO delay between samples to provide rates and
+// exposes the latest snapshot as a prometheus collector.
+type Sampler struct {
+	root     string
+	top      int
+	mu       sync.Mutex
+	prev     map[int]float64
+	prevTime time.Time
+	snapshot Snapshot
+}
+
+// Snapshot is the result of a single sample.
+type Snapshot struct {
+	Processes    []Rate
+	Pods         []Rate
+	Pressure     []*procfs.Pressure
+	ProcessCount int
+	Waiting      int
+}
+
+// Rate is the iowait ratio for a command or pod. The processes are summed by
+// command name as a pid label would add a series for every short-lived process.
+type Rate struct {
+	Name  string
+	Value float64
+}
+
+// Sample reads the current process stats and pressure and updates the snapshot.
+func (s *Sampler) Sample(now time.Time) error {
+	stats, err := procfs.ReadStats(s.root)
+	if err != nil {
+		return err
+	}
+
+	var pressure []*procfs.Pressure
+	for _, resource := range procfs.PressureResources {
+		p, err := procfs.ReadPressure(s.root, resource)
+		if err != nil {
+			// PSI is unavailable on older kernels or when disabled with psi=0.
+			continue
+		}
+		pressure = append(pressure, p)
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.snapshot = s.rates(stats, now)
+	s.snapshot.Pressure = pressure
+	return nil
+}
+
+func (s *Sampler) rates(stats []*procfs.ProcessInfo, now time.Time) Snapshot {
+	elapsed := now.Sub(s.prevTime).Seconds()
+	first := s.prevTime.IsZero()
+	current := make(map[int]float64, len(stats))
+	comms := make(map[string]float64)
+	pods := make(map[string]float64)
+
+	var waiting int
+	for _, st := range stats {
+		current[st.PID] = st.IOWait
+		prev, ok := s.prev[st.PID]
+		// new PIDs and PID reuse have no usable baseline.
+		if first || !ok || st.IOWait < prev || elapsed <= 0 {
+			continue
+		}
+
+		ratio := (st.IOWait - prev) / userHZ / elapsed
+		if ratio <= 0 {
+			continue
+		}
+		waiting++
+		comms[st.Name] += ratio
+		if st.PodUID != "" {
+			pods[st.PodUID] += ratio
+		}
+	}
+	s.prev = current
+	s.prevTime = now
+
+	var processes []Rate
+	for comm, v := range comms {
+		processes = append(processes, Rate{Name: comm, Value: v})
+	}
+
+	var podRates []Rate
+	for uid, v := range pods {
+		podRates = append(podRates, Rate{Name: uid, Value: v})
+	}
+
+	return Snapshot{
+		Processes:    TopN(s.top, processes),
+		Pods:         TopN(s.top, podRates),
+		ProcessCount: len(stats),
+		Waiting:      waiting,
+	}
+}
+
+// TopN returns the n highest rates followed by an "other" bucket summing the
+// remainder. This bounds the cardinality of the exported series. A sorted copy
+// is used so the order of rates is left as it was.
+func TopN(n int, rates []Rate) []Rate {
+	rates = append([]Rate(nil), rates...)
+	sort.Slice(rates, func(i, j int) bool {
+		return rates[i].Value > rates[j].Value
+	})
+	if len(rates) <= n {
+		return rates
+	}
+
+	other := Rate{Name: Other}
+	for _, r := range rates[n:] {
+		other.Value += r.Value
+	}
+	return append(rates[:n:n], other)
+}
+
+// Describe implements prometheus.Collector.
+func (s *Sampler) Describe(ch chan<- *prometheus.Desc) {
+	ch <- processDesc
+	ch <- podDesc
+	ch <- pressureDesc
+	ch <- stallDesc
+	ch <- processesDesc
+	ch <- waitingDesc
+}
+
+// Collect implements prometheus.Collector using the latest snapshot.
+func (s *Sampler) Collect(ch chan<- prometheus.Metric) {
+	s.mu.Lock()
+	snapshot := s.snapshot
+	s.mu.Unlock()
+
+	for _, r := range snapshot.Processes {
+		ch <- prometheus.MustNewConstMetric(processDesc, prometheus.GaugeValue, r.Value, r.Name)
+	}
+	for _, r := range snapshot.Pods {
+		ch <- prometheus.MustNewConstMetric(podDesc, prometheus.GaugeValue, r.Value, r.Name)
+	}
+	for _, p := range snapshot.Pressure {
+		collectPressure(ch, p.Resource, "some", p.Some)
+		if p.Full != nil {
+			collectPressure(ch, p.Resource, "full", *p.Full)
+		}
+	}
+	ch <- prometheus.MustNewConstMetric(processesDesc, prometheus.GaugeValue, float64(snapshot.ProcessCount))
+	ch <- prometheus.MustNewConstMetric(waitingDesc, prometheus.GaugeValue, float64(snapshot.Waiting))
+}
+
+func collectPressure(ch chan<- prometheus.Metric, resource string, kind string, line procfs.PressureLine) {
+	ch <- prometheus.MustNewConstMetric(pressureDesc, prometheus.GaugeValue, line.Avg10, resource, kind, "avg10")
+	ch <- prometheus.MustNewConstMetric(pressureDesc, prometheus.GaugeValue, line.Avg60, resource, kind, "avg60")
+	ch <- prometheus.MustNewConstMetric(pressureDesc, prometheus.GaugeValue, line.Avg300, resource, kind, "avg300")
+	ch <- prometheus.MustNewConstMetric(stallDesc, prometheus.CounterValue, float64(line.Total)/1e6, resource, kind)
+}
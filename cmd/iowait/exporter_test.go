@@ -0,0 +1,87 @@
+package main
+
+import (
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/instana/envcheck/procfs"
+)
+
+func Test_TopN_groups_remainder_as_other(t *testing.T) {
+	rates := []Rate{{Name: "a", Value: 0.1}, {Name: "b", Value: 0.3}, {Name: "c", Value: 0.2}, {Name: "d", Value: 0.05}}
+	actual := TopN(2, rates)
+	expected := []Rate{{Name: "b", Value: 0.3}, {Name: "c", Value: 0.2}, {Name: Other, Value: 0.15000000000000002}}
+	if !cmp.Equal(expected, actual) {
+		t.Errorf("TopN() mismatch (-want +got)\n%s", cmp.Diff(expected, actual))
+	}
+	unchanged := []Rate{{Name: "a", Value: 0.1}, {Name: "b", Value: 0.3}, {Name: "c", Value: 0.2}, {Name: "d", Value: 0.05}}
+	if !cmp.Equal(unchanged, rates) {
+		t.Errorf("TopN() changed rates (-want +got)\n%s", cmp.Diff(unchanged, rates))
+	}
+}
+
+func Test_TopN_without_other_when_under_limit(t *testing.T) {
+	rates := []Rate{{Name: "a", Value: 0.1}}
+	actual := TopN(2, rates)
+	if len(actual) != 1 {
+		t.Errorf("len=%v, want 1", len(actual))
+	}
+}
+
+func Test_rates_uses_delta_between_samples(t *testing.T) {
+	s := NewSampler("/", 10)
+	start := time.Unix(1000, 0)
+	first := []*procfs.ProcessInfo{
+		{PID: 1, Name: "(db)", IOWait: 100, PodUID: "pod-a"},
+		{PID: 2, Name: "(app)", IOWait: 0, PodUID: "pod-a"},
+	}
+	snapshot := s.rates(first, start)
+	if len(snapshot.Processes) != 0 {
+		t.Errorf("len(Processes)=%v, want 0 on first sample", len(snapshot.Processes))
+	}
+
+	second := []*procfs.ProcessInfo{
+		{PID: 1, Name: "(db)", IOWait: 600, PodUID: "pod-a"},
+		{PID: 2, Name: "(app)", IOWait: 100, PodUID: "pod-a"},
+		{PID: 3, Name: "(new)", IOWait: 5000},
+	}
+	snapshot = s.rates(second, start.Add(10*time.Second))
+
+	expected := Snapshot{
+		Processes:    []Rate{{Name: "(db)", Value: 0.5}, {Name: "(app)", Value: 0.1}},
+		Pods:         []Rate{{Name: "pod-a", Value: 0.6}},
+		ProcessCount: 3,
+		Waiting:      2,
+	}
+	if !cmp.Equal(expected, snapshot) {
+		t.Errorf("rates() mismatch (-want +got)\n%s", cmp.Diff(expected, snapshot))
+	}
+}
+
+func Test_rates_sums_processes_by_command(t *testing.T) {
+	s := NewSampler("/", 10)
+	start := time.Unix(1000, 0)
+	first := []*procfs.ProcessInfo{
+		{PID: 1, Name: "(worker)", IOWait: 0},
+		{PID: 2, Name: "(worker)", IOWait: 0},
+		{PID: 3, Name: "(db)", IOWait: 0},
+	}
+	s.rates(first, start)
+
+	second := []*procfs.ProcessInfo{
+		{PID: 1, Name: "(worker)", IOWait: 200},
+		{PID: 2, Name: "(worker)", IOWait: 300},
+		{PID: 3, Name: "(db)", IOWait: 100},
+	}
+	snapshot := s.rates(second, start.Add(10*time.Second))
+
+	expected := Snapshot{
+		Processes:    []Rate{{Name: "(worker)", Value: 0.5}, {Name: "(db)", Value: 0.1}},
+		ProcessCount: 3,
+		Waiting:      3,
+	}
+	if !cmp.Equal(expected, snapshot) {
+		t.Errorf("rates() mismatch (-want +got)\n%s", cmp.Diff(expected, snapshot))
+	}
+}
@@ -1,21 +1,61 @@
 package main
 
 import (
-	"github.com/instana/envcheck/procfs"
+	"flag"
 	"log"
+	"net/http"
 	"strconv"
 	"time"
+
+	"github.com/instana/envcheck/procfs"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
 )
 
 var Version = "dev"
 
 func main() {
+	listen := flag.String("listen", "", "address to expose prometheus metrics on (e.g. :9464), logs only if blank")
+	root := flag.String("root", "/", "root path containing the proc filesystem")
+	top := flag.Int("top", 10, "number of processes and pods to export before grouping as other")
+	interval := flag.Duration("interval", 5*time.Second, "sample interval")
+	flag.Parse()
+
 	log.SetFlags(log.LstdFlags | log.Lshortfile | log.LUTC)
-	log.Printf("app=iowait@%v ", Version)
-	ticker := time.Tick(5 * time.Second)
+	log.Printf("app=iowait@%v listen=%v top=%v interval=%v", Version, *listen, *top, *interval)
+
+	if *listen == "" {
+		logLoop(*root, *interval)
+		return
+	}
+
+	sampler := NewSampler(*root, *top)
+	go sampleLoop(sampler, *interval)
+
+	registry := prometheus.NewRegistry()
+	registry.MustRegister(sampler)
+	http.Handle("/metrics", promhttp.HandlerFor(registry, promhttp.HandlerOpts{}))
+	log.Fatalln(http.ListenAndServe(*listen, nil))
+}
+
+func sampleLoop(sampler *Sampler, interval time.Duration) {
+	err := sampler.Sample(time.Now())
+	if err != nil {
+		log.Printf("err=`%v`", err)
+	}
+	for t := range time.Tick(interval) {
+		err := sampler.Sample(t)
+		if err != nil {
+			log.Printf("err=`%v`", err)
+		}
+	}
+}
+
+func logLoop(root string, interval time.Duration) {
+	ticker := time.Tick(interval)
 	for t := range ticker {
 		log.Printf("==== %v ================================================================\n", t)
-		stats, err := procfs.ReadStats("/")
+		stats, err := procfs.ReadStats(root)
 		if err != nil {
 			log.Printf("err=`%v`", err)
 			continue
@@ -1,6 +1,7 @@
 package main
 
 import (
+	"context"
 	"expvar"
 	"flag"
 	"fmt"
@@ -9,8 +10,11 @@ import (
 	"net/http"
 	"os"
 	"strconv"
+	"strings"
+	"sync"
 	"time"
 
+	"github.com/instana/envcheck/dns"
 	"github.com/instana/envcheck/network"
 	"github.com/instana/envcheck/ping"
 	"github.com/jackpal/gateway"
@@ -21,8 +25,19 @@ var (
 	Revision = "dev"
 )
 
+// defaultDNSNames is the kube API Service, agent Service, backend and an external name.
+const defaultDNSNames = "kubernetes.default.svc,instana-agent.instana-agent.svc,ingress-red-saas.instana.io,www.ibm.com"
+
+// DNSProbe configures the periodic DNS resolution diagnostics.
+type DNSProbe struct {
+	Names      []string
+	ResolvConf string
+	Interval   time.Duration
+	Timeout    time.Duration
+}
+
 // Exec is the primary execution for the pinger application.
-func Exec(host string, port int, info ping.DownwardInfo, c *http.Client) error {
+func Exec(host string, port int, listen string, info ping.DownwardInfo, c *http.Client, probe DNSProbe) error {
 	log.SetFlags(log.LUTC | log.Lmsgprefix | log.LstdFlags)
 	log.SetPrefix(fmt.Sprintf("pod=%s/%s ", info.Namespace, info.Name))
 
@@ -37,13 +52,15 @@ func Exec(host string, port int, info ping.DownwardInfo, c *http.Client) error {
 	}
 
 	address := fmt.Sprintf("%s:%d", host, port)
+	proxy := proxyFor(c, address)
 
-	log.Printf("ping=%s podIP=%s nodeIP=%s gw=%v revision=%v", address, info.PodIP, info.NodeIP, gw, Revision)
+	log.Printf("ping=%s podIP=%s nodeIP=%s gw=%v proxy=%s revision=%v", address, info.PodIP, info.NodeIP, gw, proxy, Revision)
 	publish("address", address)
 	publish("name", info.Name)
 	publish("namespace", info.Namespace)
 	publish("nodeIP", info.NodeIP)
 	publish("podIP", info.PodIP)
+	publish("proxy", proxy)
 
 	ifs, err := network.MapInterfaces()
 	if err != nil {
@@ -54,17 +71,48 @@ func Exec(host string, port int, info ping.DownwardInfo, c *http.Client) error {
 		log.Printf("if=%s ips=%v\n", k, v)
 	}
 
+	if probe.Interval > 0 && len(probe.Names) > 0 {
+		go dnsLoop(probe)
+	}
+
+	recorder := ping.NewRecorder(ping.Status{
+		Pod:       info.Name,
+		Namespace: info.Namespace,
+		NodeIP:    info.NodeIP,
+		Address:   address,
+		Proxy:     proxy,
+	})
+	if listen != "" {
+		http.HandleFunc(ping.StatusPath, recorder.Handler)
+		go func() {
+			log.Printf("listen=%s status=failed err='%v'", listen, http.ListenAndServe(listen, nil))
+		}()
+	}
+
 	client := ping.New(c)
 
-	pingLoop(client, address, info)
+	pingLoop(client, address, info, recorder)
 
 	return nil
 }
 
-func pingLoop(client *ping.Client, address string, info ping.DownwardInfo) {
+// reportInterval is the longest time between status reports in the logs.
+var reportInterval = ping.ReportInterval
+
+// pingLoop pings the address every 5s. The status is logged on every failure,
+// the first success and at least every reportInterval for envcheckctl to read
+// from the pod logs as ingress to the pinger may be denied.
+func pingLoop(client *ping.Client, address string, info ping.DownwardInfo, recorder *ping.Recorder) {
 	success := false
+	var reported time.Time
 	for true {
 		err := client.Ping(address, info)
+		now := time.Now()
+		recorder.Record(err, now)
+		if err != nil || !success || now.Sub(reported) >= reportInterval {
+			report(recorder.Status())
+			reported = now
+		}
 		time.Sleep(5 * time.Second)
 		if err != nil {
 			log.Printf("ping=%s status=failed err='%v'", address, err)
@@ -79,10 +127,73 @@ func pingLoop(client *ping.Client, address string, info ping.DownwardInfo) {
 	}
 }
 
+func report(status ping.Status) {
+	line, err := ping.Report(status)
+	if err != nil {
+		log.Printf("encodeReport=failed err='%v'", err)
+		return
+	}
+	log.Println(line)
+}
+
+func dnsLoop(probe DNSProbe) {
+	var mu sync.Mutex
+	var latest []dns.Report
+	expvar.Publish("dns", expvar.Func(func() interface{} {
+		mu.Lock()
+		defer mu.Unlock()
+		return latest
+	}))
+
+	for {
+		reports, err := diagnoseDNS(probe)
+		if err != nil {
+			log.Printf("dns=failed resolvconf=%s err='%v'", probe.ResolvConf, err)
+		}
+		mu.Lock()
+		latest = reports
+		mu.Unlock()
+		time.Sleep(probe.Interval)
+	}
+}
+
+func diagnoseDNS(probe DNSProbe) ([]dns.Report, error) {
+	r, err := os.Open(probe.ResolvConf)
+	if err != nil {
+		return nil, err
+	}
+	conf, err := dns.ParseResolvConf(r)
+	r.Close()
+	if err != nil {
+		return nil, err
+	}
+
+	d := &dns.Diagnoser{Conf: conf, Timeout: probe.Timeout}
+	reports := d.Diagnose(context.Background(), probe.Names)
+	log.Printf("dns=resolvconf nameservers=%v search=%v ndots=%d", conf.Nameservers, conf.Search, conf.Ndots)
+	for _, r := range reports {
+		log.Printf("dns=%s resolver=pod rcode=%s latency=%v addrs=%v err='%s'", r.Name, r.Pod.RCode, r.Pod.Duration, r.Pod.Addrs, r.Pod.Err)
+		for _, sr := range r.Servers {
+			var rcodes []string
+			var latency time.Duration
+			for _, a := range sr.Answers {
+				rcodes = append(rcodes, a.RCode)
+				latency += a.Duration
+			}
+			log.Printf("dns=%s server=%s resolved=%s queries=%d latency=%v rcodes=%v", r.Name, sr.Server, sr.Resolved, sr.Queries, latency, rcodes)
+		}
+	}
+	return reports, nil
+}
+
 func main() {
 	var host string
+	var listen string
 	var port int
+	var tc network.TransportConfig
 	var downward ping.DownwardInfo
+	var probe DNSProbe
+	var dnsNames string
 	var envPort = os.Getenv("PINGPORT")
 	var defaultPort = 42700
 	if envPort != "" {
@@ -96,32 +207,78 @@ func main() {
 
 	flag.StringVar(&host, "address", os.Getenv("PINGHOST"), "the host to ping.")
 	flag.IntVar(&port, "port", defaultPort, "the port to ping.")
+	flag.StringVar(&listen, "listen", envOr("PINGLISTEN", fmt.Sprintf(":%d", ping.DefaultStatusPort)), "address to serve the ping status on, blank to disable.")
 	flag.StringVar(&downward.Name, "name", os.Getenv("NAME"), "name of this pod.")
 	flag.StringVar(&downward.Namespace, "namespace", os.Getenv("NAMESPACE"), "namespace this service is running in.")
 	flag.StringVar(&downward.NodeIP, "nodeip", os.Getenv("NODEIP"), "node IP this service is running on.")
 	flag.StringVar(&downward.PodIP, "podip", os.Getenv("PODIP"), "pod IP this service is running on.")
+	flag.StringVar(&tc.Proxy, "proxy", os.Getenv("PINGPROXY"), "proxy URL to ping through, direct if blank.")
+	flag.StringVar(&tc.ProxyAuth, "proxy-auth", os.Getenv("PINGPROXYAUTH"), "proxy credentials in the form user:password.")
+	flag.StringVar(&tc.CAFile, "ca-file", "", "PEM bundle of additional CA certificates to trust.")
+	flag.BoolVar(&tc.InsecureSkipVerify, "insecure-skip-verify", false, "skip server certificate verification.")
+	flag.StringVar(&dnsNames, "dns-names", envOr("PINGDNSNAMES", defaultDNSNames), "comma separated names to resolve, blank to disable.")
+	flag.StringVar(&probe.ResolvConf, "resolv-conf", "/etc/resolv.conf", "resolver configuration to read nameservers and search domains from.")
+	flag.DurationVar(&probe.Interval, "dns-interval", 5*time.Minute, "interval between DNS diagnostics, 0 to disable.")
+	flag.DurationVar(&probe.Timeout, "dns-timeout", 2*time.Second, "timeout for each DNS query.")
 
 	flag.Parse()
+	probe.Names = splitNames(dnsNames)
 
-	client := newClient()
-	err := Exec(host, port, downward, client)
+	client, err := newClient(tc)
+	if err != nil {
+		log.Printf("status=shutdown error='%v'\n", err)
+		os.Exit(1)
+	}
+	err = Exec(host, port, listen, downward, client, probe)
 	if err != nil {
 		log.Printf("status=shutdown error='%v'\n", err)
 		os.Exit(1)
 	}
 }
 
-func newClient() *http.Client {
+func newClient(tc network.TransportConfig) (*http.Client, error) {
+	transport, err := network.NewTransport(tc)
+	if err != nil {
+		return nil, err
+	}
+	transport.DialContext = (&net.Dialer{
+		Timeout:   1 * time.Second,
+		KeepAlive: 3 * time.Second,
+	}).DialContext
+	transport.ResponseHeaderTimeout = 2 * time.Second
+
 	return &http.Client{
-		Transport: &http.Transport{
-			Dial: (&net.Dialer{
-				Timeout:   1 * time.Second,
-				KeepAlive: 3 * time.Second,
-			}).Dial,
-			ResponseHeaderTimeout: 2 * time.Second,
-		},
-		Timeout: 6 * time.Second,
+		Transport: transport,
+		Timeout:   6 * time.Second,
+	}, nil
+}
+
+func proxyFor(c *http.Client, address string) string {
+	transport, _ := c.Transport.(*http.Transport)
+	req, err := http.NewRequest(http.MethodGet, fmt.Sprintf("http://%s/ping", address), nil)
+	if err != nil {
+		return network.Direct
+	}
+	return network.ProxyFor(transport, req)
+}
+
+func splitNames(s string) []string {
+	var names []string
+	for _, name := range strings.Split(s, ",") {
+		name = strings.TrimSpace(name)
+		if name != "" {
+			names = append(names, name)
+		}
+	}
+	return names
+}
+
+func envOr(key string, fallback string) string {
+	v, ok := os.LookupEnv(key)
+	if !ok {
+		return fallback
 	}
+	return v
 }
 
 func publish(key string, value string) {
@@ -0,0 +1,209 @@
+package main
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"sort"
+	"strings"
+)
+
+// FailureType is the classification of a failed request.
+type FailureType string
+
+const (
+	// FailureDNS occurs when the target host could not be resolved.
+	FailureDNS FailureType = "dns"
+	// FailureConnectTimeout occurs when the TCP connection could not be established in time.
+	FailureConnectTimeout FailureType = "tcp_connect_timeout"
+	// FailureConnect occurs when the TCP connection was refused or reset.
+	FailureConnect FailureType = "tcp_connect"
+	// FailureTLS occurs when the TLS handshake or certificate verification fails.
+	FailureTLS FailureType = "tls"
+	// FailureProxy occurs when the request could not be sent through the proxy.
+	FailureProxy FailureType = "proxy"
+	// FailureTimeout occurs when the request exceeds the client timeout after connecting.
+	FailureTimeout FailureType = "timeout"
+	// FailureAuth occurs when the target responds with 401 or 403, typically a bad agent key.
+	FailureAuth FailureType = "http_auth"
+	// FailureServer occurs when the target responds with a 5xx.
+	FailureServer FailureType = "http_5xx"
+	// FailureStatus occurs when the target responds with any other unexpected status.
+	FailureStatus FailureType = "http_status"
+	// FailureUnknown is any error that does not match the other classifications.
+	FailureUnknown FailureType = "unknown"
+)
+
+// Failure is the classification of a failed request with a human readable detail.
+type Failure struct {
+	Type   FailureType
+	Detail string
+}
+
+// Classify categorises the outcome of a request to host. A nil Failure is
+// returned when the request succeeded with the expected status.
+func Classify(host string, code int, expected int, err error) *Failure {
+	if err == nil {
+		if code == expected {
+			return nil
+		}
+		switch {
+		case code == http.StatusUnauthorized || code == http.StatusForbidden:
+			return &Failure{FailureAuth, fmt.Sprintf("status=%d credentials rejected", code)}
+		case code >= 500:
+			return &Failure{FailureServer, fmt.Sprintf("status=%d", code)}
+		default:
+			return &Failure{FailureStatus, fmt.Sprintf("status=%d expected=%d", code, expected)}
+		}
+	}
+
+	var opErr *net.OpError
+	isOp := errors.As(err, &opErr)
+	if isOp && opErr.Op == "proxyconnect" {
+		return &Failure{FailureProxy, opErr.Error()}
+	}
+
+	var dnsErr *net.DNSError
+	if errors.As(err, &dnsErr) {
+		detail := fmt.Sprintf("name=%s server=%s", dnsErr.Name, dnsErr.Server)
+		if dnsErr.IsNotFound {
+			detail += " notfound=true"
+		}
+		if dnsErr.IsTimeout {
+			detail += " timeout=true"
+		}
+		return &Failure{FailureDNS, detail}
+	}
+
+	if tlsDetail, ok := classifyTLS(host, err); ok {
+		return &Failure{FailureTLS, tlsDetail}
+	}
+
+	if isOp && opErr.Op == "dial" {
+		if opErr.Timeout() {
+			return &Failure{FailureConnectTimeout, fmt.Sprintf("addr=%v", opErr.Addr)}
+		}
+		return &Failure{FailureConnect, opErr.Err.Error()}
+	}
+
+	if strings.Contains(err.Error(), "proxyconnect") || strings.Contains(err.Error(), "Proxy Authentication Required") {
+		return &Failure{FailureProxy, err.Error()}
+	}
+
+	var netErr net.Error
+	if errors.As(err, &netErr) && netErr.Timeout() {
+		return &Failure{FailureTimeout, err.Error()}
+	}
+
+	return &Failure{FailureUnknown, err.Error()}
+}
+
+func classifyTLS(host string, err error) (string, bool) {
+	sni := "sni=" + host
+
+	var verifyErr *tls.CertificateVerificationError
+	if errors.As(err, &verifyErr) {
+		return fmt.Sprintf("%s chain=%s err=%v", sni, chain(verifyErr.UnverifiedCertificates), verifyErr.Err), true
+	}
+
+	var authorityErr x509.UnknownAuthorityError
+	if errors.As(err, &authorityErr) {
+		return fmt.Sprintf("%s unknown authority chain=%s", sni, chain([]*x509.Certificate{authorityErr.Cert})), true
+	}
+
+	var hostnameErr x509.HostnameError
+	if errors.As(err, &hostnameErr) {
+		var names []string
+		if hostnameErr.Certificate != nil {
+			names = hostnameErr.Certificate.DNSNames
+		}
+		return fmt.Sprintf("%s hostname mismatch host=%s names=%v", sni, hostnameErr.Host, names), true
+	}
+
+	var invalidErr x509.CertificateInvalidError
+	if errors.As(err, &invalidErr) {
+		return fmt.Sprintf("%s invalid certificate chain=%s detail=%v", sni, chain([]*x509.Certificate{invalidErr.Cert}), invalidErr.Error()), true
+	}
+
+	var recordErr tls.RecordHeaderError
+	if errors.As(err, &recordErr) {
+		return fmt.Sprintf("%s not a TLS server msg=%s", sni, recordErr.Msg), true
+	}
+
+	var alertErr tls.AlertError
+	if errors.As(err, &alertErr) || strings.Contains(err.Error(), "tls: ") {
+		return fmt.Sprintf("%s handshake err=%v", sni, err), true
+	}
+
+	return "", false
+}
+
+func chain(certs []*x509.Certificate) string {
+	var li []string
+	for _, c := range certs {
+		if c == nil {
+			continue
+		}
+		li = append(li, fmt.Sprintf("%q issuer=%q", c.Subject.String(), c.Issuer.String()))
+	}
+	return "[" + strings.Join(li, " <- ") + "]"
+}
+
+// Verdict is the root-cause conclusion for an accumulator window.
+type Verdict string
+
+const (
+	// VerdictHealthy indicates no target failed in the window.
+	VerdictHealthy Verdict = "healthy"
+	// VerdictUpstream indicates only primary targets failed, an issue outside the customers estate.
+	VerdictUpstream Verdict = "upstream_issue"
+	// VerdictCustomerNetwork indicates secondary targets failed, an issue inside the customers estate.
+	VerdictCustomerNetwork Verdict = "customer_network_issue"
+	// VerdictCredentials indicates primary targets only rejected the credentials, typically a bad agent key.
+	VerdictCredentials Verdict = "credentials_issue"
+)
+
+// Verdict evaluates the window failures by target class. Rejected credentials
+// are a customer configuration problem so are kept out of upstream_issue.
+func (a *Accumulator) Verdict() Verdict {
+	var primary, auth, secondary int
+	for _, t := range a.Targets {
+		switch t.Class {
+		case Primary:
+			auth += a.Types[t.Name][FailureAuth]
+			primary += a.Failures[t.Name] - a.Types[t.Name][FailureAuth]
+		case Secondary:
+			secondary += a.Failures[t.Name]
+		}
+	}
+
+	switch {
+	case secondary > 0:
+		return VerdictCustomerNetwork
+	case primary > 0:
+		return VerdictUpstream
+	case auth > 0:
+		return VerdictCredentials
+	default:
+		return VerdictHealthy
+	}
+}
+
+// TypeSummary renders the failure type counts for a target in a stable order.
+func (a *Accumulator) TypeSummary(name string) string {
+	types := a.Types[name]
+	var keys []string
+	for k := range types {
+		keys = append(keys, string(k))
+	}
+	sort.Strings(keys)
+
+	var li []string
+	for _, k := range keys {
+		li = append(li, fmt.Sprintf("%s:%d", k, types[FailureType(k)]))
+	}
+	return strings.Join(li, ",")
+}
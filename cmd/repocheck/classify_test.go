@@ -0,0 +1,137 @@
+package main
+
+import (
+	"errors"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+)
+
+func Test_Classify_status(t *testing.T) {
+	testCases := map[string]struct {
+		code     int
+		expected int
+		want     FailureType
+	}{
+		"unauthorized": {401, 200, FailureAuth},
+		"forbidden":    {403, 200, FailureAuth},
+		"bad gateway":  {502, 200, FailureServer},
+		"not found":    {404, 200, FailureStatus},
+	}
+	for name, tc := range testCases {
+		tc := tc
+		t.Run(name, func(t *testing.T) {
+			actual := Classify("example.com", tc.code, tc.expected, nil)
+			if actual == nil || actual.Type != tc.want {
+				t.Errorf("Classify()=%+v, want %v", actual, tc.want)
+			}
+		})
+	}
+}
+
+func Test_Classify_success_is_nil(t *testing.T) {
+	actual := Classify("example.com", 204, 204, nil)
+	if actual != nil {
+		t.Errorf("Classify()=%+v, want nil", actual)
+	}
+}
+
+func Test_Classify_errors(t *testing.T) {
+	dnsErr := &url.Error{Op: "Get", URL: "https://bloop.invalid", Err: &net.OpError{Op: "dial", Net: "tcp", Err: &net.DNSError{Name: "bloop.invalid", IsNotFound: true}}}
+	timeoutErr := &url.Error{Op: "Get", URL: "https://10.0.0.1", Err: &net.OpError{Op: "dial", Net: "tcp", Err: timeout{}}}
+	refusedErr := &url.Error{Op: "Get", URL: "https://10.0.0.1", Err: &net.OpError{Op: "dial", Net: "tcp", Err: errors.New("connect: connection refused")}}
+	proxyErr := &url.Error{Op: "Get", URL: "https://10.0.0.1", Err: &net.OpError{Op: "proxyconnect", Net: "tcp", Err: errors.New("connect: connection refused")}}
+
+	testCases := map[string]struct {
+		err  error
+		want FailureType
+	}{
+		"dns":             {dnsErr, FailureDNS},
+		"connect timeout": {timeoutErr, FailureConnectTimeout},
+		"connect refused": {refusedErr, FailureConnect},
+		"proxy":           {proxyErr, FailureProxy},
+		"unknown":         {errors.New("bloop"), FailureUnknown},
+	}
+	for name, tc := range testCases {
+		tc := tc
+		t.Run(name, func(t *testing.T) {
+			actual := Classify("example.com", -1, 200, tc.err)
+			if actual == nil || actual.Type != tc.want {
+				t.Errorf("Classify()=%+v, want %v", actual, tc.want)
+			}
+		})
+	}
+}
+
+func Test_Classify_tls_unknown_authority(t *testing.T) {
+	ts := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer ts.Close()
+
+	client := &http.Client{Timeout: time.Second}
+	_, err := client.Get(ts.URL)
+	actual := Classify("127.0.0.1", -1, 200, err)
+	if actual == nil || actual.Type != FailureTLS {
+		t.Fatalf("Classify()=%+v, want tls", actual)
+	}
+
+	if !strings.Contains(actual.Detail, "sni=127.0.0.1") || !strings.Contains(actual.Detail, "Acme Co") {
+		t.Errorf("Detail=%v, want sni and chain", actual.Detail)
+	}
+}
+
+func Test_Verdict(t *testing.T) {
+	targets := []Target{{Name: "p", Class: Primary}, {Name: "s", Class: Secondary}}
+	failure := &Failure{Type: FailureConnectTimeout}
+	auth := &Failure{Type: FailureAuth}
+	testCases := map[string]struct {
+		failures []*Failure
+		want     Verdict
+	}{
+		"healthy":        {[]*Failure{nil, nil}, VerdictHealthy},
+		"primary auth":   {[]*Failure{auth, nil}, VerdictCredentials},
+		"auth secondary": {[]*Failure{auth, failure}, VerdictCustomerNetwork},
+		"primary only":   {[]*Failure{failure, nil}, VerdictUpstream},
+		"both":           {[]*Failure{failure, failure}, VerdictCustomerNetwork},
+		"secondary only": {[]*Failure{nil, failure}, VerdictCustomerNetwork},
+	}
+	for name, tc := range testCases {
+		tc := tc
+		t.Run(name, func(t *testing.T) {
+			accum := NewAccumulator(0, targets)
+			accum.Add(tc.failures)
+			if accum.Verdict() != tc.want {
+				t.Errorf("Verdict()=%v, want %v", accum.Verdict(), tc.want)
+			}
+		})
+	}
+}
+
+func Test_Verdict_auth_with_outage_is_upstream(t *testing.T) {
+	targets := []Target{{Name: "p", Class: Primary}, {Name: "s", Class: Secondary}}
+	accum := NewAccumulator(0, targets)
+	accum.Add([]*Failure{{Type: FailureAuth}, nil})
+	accum.Add([]*Failure{{Type: FailureServer}, nil})
+	if accum.Verdict() != VerdictUpstream {
+		t.Errorf("Verdict()=%v, want %v", accum.Verdict(), VerdictUpstream)
+	}
+}
+
+func Test_TypeSummary(t *testing.T) {
+	accum := NewAccumulator(0, []Target{{Name: "p"}})
+	accum.Add([]*Failure{{Type: FailureTLS}})
+	accum.Add([]*Failure{{Type: FailureDNS}})
+	accum.Add([]*Failure{{Type: FailureTLS}})
+	if accum.TypeSummary("p") != "dns:1,tls:2" {
+		t.Errorf("TypeSummary()=%v, want dns:1,tls:2", accum.TypeSummary("p"))
+	}
+}
+
+type timeout struct{}
+
+func (timeout) Error() string   { return "i/o timeout" }
+func (timeout) Timeout() bool   { return true }
+func (timeout) Temporary() bool { return true }
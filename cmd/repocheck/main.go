@@ -3,129 +3,281 @@ package main
 import (
 	"flag"
 	"fmt"
+	"io"
 	"log"
 	"net/http"
 	"os"
+	"strings"
 	"sync"
 	"time"
+
+	"github.com/instana/envcheck/network"
+	"github.com/instana/envcheck/repocheck"
 )
 
 // Revision is the sha version for this application.
 var Revision = "dev"
 
+// NewAccumulator creates an accumulator with a zeroed failure count for each target.
+func NewAccumulator(period time.Duration, targets []Target) *Accumulator {
+	a := &Accumulator{
+		Failures: make(map[string]int),
+		Period:   period,
+		Targets:  targets,
+		Types:    make(map[string]map[FailureType]int),
+	}
+	for _, t := range targets {
+		a.Failures[t.Name] = 0
+		a.Types[t.Name] = make(map[FailureType]int)
+	}
+	return a
+}
+
 // Accumulator is used to capture a given time periods failure and total request count.
 type Accumulator struct {
 	Failures map[string]int
 	Count    int
 	Period   time.Duration
+	Targets  []Target
+	Types    map[string]map[FailureType]int
+}
+
+// Add records a single tick where failures is indexed in the same order as
+// Targets and a nil entry is a successful request.
+func (a *Accumulator) Add(failures []*Failure) {
+	for i, t := range a.Targets {
+		if failures[i] != nil {
+			a.Failures[t.Name]++
+			a.Types[t.Name][failures[i].Type]++
+		}
+	}
+	a.Count++
+}
+
+// Window captures the current accumulator state as a completed window.
+func (a *Accumulator) Window(pod string, end time.Time) repocheck.Window {
+	w := repocheck.Window{
+		Pod:     pod,
+		Period:  a.Period,
+		End:     end,
+		Count:   a.Count,
+		Verdict: string(a.Verdict()),
+	}
+	for _, t := range a.Targets {
+		types := make(map[string]int)
+		for k, v := range a.Types[t.Name] {
+			types[string(k)] = v
+		}
+		w.Targets = append(w.Targets, repocheck.TargetResult{
+			Name:     t.Name,
+			Class:    t.Class,
+			Failures: a.Failures[t.Name],
+			Types:    types,
+		})
+	}
+	return w
+}
+
+// Reset zeroes the failures and request count.
+func (a *Accumulator) Reset() {
+	for k := range a.Failures {
+		a.Failures[k] = 0
+		a.Types[k] = make(map[FailureType]int)
+	}
+	a.Count = 0
 }
 
 func main() {
 	var lock sync.Mutex
-	var shortAccum = Accumulator{Failures: make(map[string]int)}
-	var longAccum = Accumulator{Failures: make(map[string]int)}
+	var targets targetFlags
 
-	secondaryURL := flag.String("secondary", "https://www.google.com", "secondary check url")
+	configFile := flag.String("config", os.Getenv("REPOCHECK_CONFIG"), "JSON file with the list of targets to check")
+	flag.Var(&targets, "target", "repeatable target in the form url=URL,auth=agentkey|bearer|none,status=200,class=primary|secondary[,name=NAME]")
+	secondaryURL := flag.String("secondary", "https://www.google.com", "secondary check url used when no targets are specified")
 	agentKey := flag.String("key", os.Getenv("INSTANA_AGENT_KEY"), "instana agent key")
+	token := flag.String("token", os.Getenv("REPOCHECK_TOKEN"), "bearer token for targets with auth=bearer")
 	podName := flag.String("name", os.Getenv("POD_NAME"), "pod name from downward API")
 	tickRate := flag.Duration("tick", 1*time.Minute, "tick duration")
+	timeout := flag.Duration("timeout", 30*time.Second, "request timeout")
+	proxy := flag.String("proxy", os.Getenv("REPOCHECK_PROXY"), "proxy URL (e.g. http://proxy:3128), uses HTTPS_PROXY/NO_PROXY if blank")
+	proxyAuth := flag.String("proxy-auth", os.Getenv("REPOCHECK_PROXY_AUTH"), "proxy credentials in the form user:password")
+	caFile := flag.String("ca-file", "", "PEM bundle of additional CA certificates to trust")
+	insecure := flag.Bool("insecure-skip-verify", false, "skip server certificate verification")
+	listen := flag.String("listen", fmt.Sprintf(":%d", repocheck.DefaultPort), "address to serve the results on, disabled if blank")
+	resultsFile := flag.String("results", os.Getenv("REPOCHECK_RESULTS"), "JSON lines file to persist completed windows to, memory only if blank")
+	retain := flag.Int("retain", 1000, "maximum number of completed windows to retain")
 	shortReset := flag.Duration("short", 1*time.Hour, "short reset period")
 	longReset := flag.Duration("long", 24*time.Hour, "long reset period")
 
 	flag.Parse()
 	log.SetFlags(log.LUTC | log.Lshortfile | log.LstdFlags)
-	log.Printf("name=%s app=repocheck@%s key=%s tick=%v short=%v long=%v\n", *podName, Revision, *agentKey, *tickRate, *shortReset, *longReset)
+	log.Printf("name=%s app=repocheck@%s key=%s tick=%v short=%v long=%v\n", *podName, Revision, redactedState(*agentKey), *tickRate, *shortReset, *longReset)
+
+	transport, err := network.NewTransport(network.TransportConfig{
+		Proxy:              *proxy,
+		ProxyAuth:          *proxyAuth,
+		CAFile:             *caFile,
+		InsecureSkipVerify: *insecure,
+		FromEnvironment:    true,
+	})
+	if err != nil {
+		log.Fatalf("err=`%v`\n", Redact(err.Error(), *proxyAuth))
+	}
+	secrets := []string{*agentKey, *token, *proxyAuth}
+
+	if *configFile != "" {
+		r, err := os.Open(*configFile)
+		if err != nil {
+			log.Fatalf("err=`%v`\n", err)
+		}
+		config, err := LoadConfig(r)
+		r.Close()
+		if err != nil {
+			log.Fatalf("config=%s err=`%v`\n", *configFile, Redact(err.Error(), secrets...))
+		}
+		targets = append(config.Targets, targets...)
+	}
+
+	if len(targets) == 0 {
+		if *secondaryURL == "" {
+			log.Fatalln("err=`secondary URL is required, none specified`")
+		}
+		targets = DefaultTargets(*secondaryURL)
+	}
+
+	// per-target tokens are only known once the targets are loaded.
+	for _, t := range targets {
+		secrets = append(secrets, t.Token)
+	}
+
+	names := make(map[string]bool)
+	for i := range targets {
+		t := &targets[i]
+		err := t.Normalise()
+		if err != nil {
+			log.Fatalf("err=`%v`\n", Redact(err.Error(), secrets...))
+		}
+		if names[t.Name] {
+			log.Fatalf("err=`duplicate target name %s, specify a unique name`\n", t.Name)
+		}
+		names[t.Name] = true
+		req, err := t.Request("", "")
+		if err != nil {
+			log.Fatalf("err=`%v`\n", Redact(err.Error(), secrets...))
+		}
+		log.Printf("name=%s target=%s class=%s auth=%s status=%d proxy=%s ca=%s insecure=%v url=%s\n", *podName, t.Name, t.Class, t.Auth, t.Status, network.ProxyFor(transport, req), *caFile, *insecure, Redact(t.URL, secrets...))
+	}
 
-	if *agentKey == "" {
+	if RequiresKey(targets) && *agentKey == "" {
 		log.Fatalln("err=`agent key is required, none specified`")
 	}
 
-	if *secondaryURL == "" {
-		log.Fatalln("err=`secondary URL is required, none specified`")
+	missing := MissingToken(targets, *token)
+	if len(missing) > 0 {
+		log.Fatalf("err=`bearer token is required for %s, none specified`\n", strings.Join(missing, ","))
+	}
+
+	store, err := repocheck.NewStore(*resultsFile, *retain)
+	if err != nil {
+		log.Fatalf("results=%s err=`%v`\n", *resultsFile, err)
 	}
 
-	shortAccum.Period = *shortReset
+	if *listen != "" {
+		mux := http.NewServeMux()
+		mux.Handle(repocheck.ResultsPath, store.ResultsHandler())
+		mux.Handle(repocheck.SummaryPath, store.SummaryHandler(*podName))
+		go func() {
+			log.Fatalln(http.ListenAndServe(*listen, mux))
+		}()
+	}
+
+	shortAccum := NewAccumulator(*shortReset, targets)
 	shortTicker := time.NewTicker(*shortReset)
-	longAccum.Period = *longReset
+	longAccum := NewAccumulator(*longReset, targets)
 	longTicker := time.NewTicker(*longReset)
 
-	url := "artifact-public.instana.io"
-	shortAccum.Failures[*secondaryURL] = 0
-	shortAccum.Failures[url] = 0
-	longAccum.Failures[*secondaryURL] = 0
-	longAccum.Failures[url] = 0
-
-	go resetAccumulator(shortTicker.C, *podName, &shortAccum, &lock)
-	go resetAccumulator(longTicker.C, *podName, &longAccum, &lock)
+	go resetAccumulator(shortTicker.C, *podName, shortAccum, store, &lock)
+	go resetAccumulator(longTicker.C, *podName, longAccum, store, &lock)
 
-	artifactURL := fmt.Sprintf("https://_:%s@artifact-public.instana.io/artifactory/features-public/com/instana/agent-feature/1.0.0-SNAPSHOT/agent-feature-1.0.0-20180125.135714-873-features.xml", *agentKey)
+	client := &http.Client{Timeout: *timeout, Transport: transport}
 	ticker := time.NewTicker(*tickRate)
 
 	for t := range ticker.C {
-		var secondaryFail int
-		var primaryFail int
+		failures := make([]*Failure, len(targets))
 
 		var wg sync.WaitGroup
-		wg.Add(2)
-		go func() {
-			resp, err := http.Get(*secondaryURL)
-			if err != nil || resp.StatusCode != 200 {
-				var code = -1
-				if err == nil {
-					code = resp.StatusCode
-				}
-				log.Printf("name=%s get=failed status=%d host=%s requested=%v err=`%v`\n", *podName, code, *secondaryURL, t, err)
-				secondaryFail = 1
-			}
-			wg.Done()
-		}()
-
-		go func() {
-			resp, err := http.Get(artifactURL)
-			if err != nil || resp.StatusCode != 200 {
-				var code = -1
-				if err == nil {
-					code = resp.StatusCode
+		for i := range targets {
+			wg.Add(1)
+			go func(i int) {
+				defer wg.Done()
+				target := &targets[i]
+				code, via, err := check(client, target, *agentKey, *token)
+				failure := Classify(target.Host(), code, target.Status, err)
+				if failure != nil {
+					var msg string
+					if err != nil {
+						msg = Redact(err.Error(), secrets...)
+					}
+					log.Printf("name=%s get=failed status=%d host=%s class=%s proxy=%s type=%s detail=`%s` requested=%v err=`%v`\n", *podName, code, target.Name, target.Class, via, failure.Type, Redact(failure.Detail, secrets...), t, msg)
+					failures[i] = failure
 				}
-				log.Printf("name=%s get=failed status=%d host=artifact-public.instana.io requested=%v err=`%v`\n", *podName, code, t, err)
-				primaryFail = 1
-			}
-			wg.Done()
-		}()
-
+			}(i)
+		}
 		wg.Wait()
 
 		lock.Lock()
-		url := *secondaryURL
-		v := shortAccum.Failures[url]
-		shortAccum.Failures[url] = v + secondaryFail
-		lv := longAccum.Failures[url]
-		longAccum.Failures[url] = lv + secondaryFail
-
-		url = "artifact-public.instana.io"
-		v = shortAccum.Failures[url]
-		shortAccum.Failures[url] = v + primaryFail
-		lv = longAccum.Failures[url]
-		longAccum.Failures[url] = lv + primaryFail
-
-		shortAccum.Count++
-		longAccum.Count++
+		shortAccum.Add(failures)
+		longAccum.Add(failures)
 		lock.Unlock()
 	}
 }
 
-func resetAccumulator(ch <-chan time.Time, name string, data *Accumulator, lock *sync.Mutex) {
+// check requests the target and returns the status code or -1 on error, and
+// the proxy the request was routed through.
+func check(client *http.Client, target *Target, agentKey string, token string) (int, string, error) {
+	req, err := target.Request(agentKey, token)
+	if err != nil {
+		return -1, network.Direct, err
+	}
+	transport, _ := client.Transport.(*http.Transport)
+	via := network.ProxyFor(transport, req)
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return -1, via, err
+	}
+	defer resp.Body.Close()
+	_, err = io.Copy(io.Discard, resp.Body)
+	if err != nil {
+		return resp.StatusCode, via, err
+	}
+	return resp.StatusCode, via, nil
+}
+
+func redactedState(secret string) string {
+	if secret == "" {
+		return "<none>"
+	}
+	return "<redacted>"
+}
+
+func resetAccumulator(ch <-chan time.Time, name string, data *Accumulator, store *repocheck.Store, lock *sync.Mutex) {
 	for t := range ch {
 		lock.Lock()
-		for k, v := range data.Failures {
+		for _, target := range data.Targets {
+			v := data.Failures[target.Name]
 			var percentage float64 = 0.0
 			if data.Count > 0 {
 				percentage = float64(v) / float64(data.Count) * 100.0
 			}
-			log.Printf("name=%s period=%v failures=%v/%v(%v%%) host=%s end=%v \n", name, data.Period, v, data.Count, percentage, k, t)
-			data.Failures[k] = 0
+			log.Printf("name=%s period=%v failures=%v/%v(%v%%) host=%s class=%s types=%s end=%v \n", name, data.Period, v, data.Count, percentage, target.Name, target.Class, data.TypeSummary(target.Name), t)
+		}
+		log.Printf("name=%s period=%v verdict=%s end=%v\n", name, data.Period, data.Verdict(), t)
+		err := store.Append(data.Window(name, t))
+		if err != nil {
+			log.Printf("name=%s period=%v store=failed err=`%v`\n", name, data.Period, err)
 		}
-		data.Count = 0
+		data.Reset()
 		lock.Unlock()
 	}
 }
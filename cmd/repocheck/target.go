@@ -0,0 +1,236 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+)
+
+const (
+	// AuthAgentKey authenticates with basic auth using the agent key as the password.
+	AuthAgentKey = "agentkey"
+	// AuthBearer authenticates with a bearer token.
+	AuthBearer = "bearer"
+	// AuthNone sends unauthenticated requests.
+	AuthNone = "none"
+
+	// Primary targets are the Instana endpoints under test.
+	Primary = "primary"
+	// Secondary targets are highly available hosts used as a control.
+	Secondary = "secondary"
+)
+
+const defaultPrimaryURL = "https://artifact-public.instana.io/artifactory/features-public/com/instana/agent-feature/1.0.0-SNAPSHOT/agent-feature-1.0.0-20180125.135714-873-features.xml"
+
+var (
+	// ErrNoTargets occurs when a config file does not specify any targets.
+	ErrNoTargets = fmt.Errorf("no targets specified")
+	// ErrNoURL occurs when a target is specified without a URL.
+	ErrNoURL = fmt.Errorf("target url is required")
+)
+
+// Target is a single URL that is checked on each tick.
+type Target struct {
+	Name   string `json:"name"`
+	URL    string `json:"url"`
+	Auth   string `json:"auth"`
+	Token  string `json:"token,omitempty"`
+	Status int    `json:"status"`
+	Class  string `json:"class"`
+}
+
+// Config is the repocheck configuration file format.
+type Config struct {
+	Targets []Target `json:"targets"`
+}
+
+// DefaultTargets are the targets used when none are specified.
+func DefaultTargets(secondaryURL string) []Target {
+	return []Target{
+		{URL: defaultPrimaryURL, Auth: AuthAgentKey, Class: Primary},
+		{URL: secondaryURL, Auth: AuthNone, Class: Secondary},
+	}
+}
+
+// LoadConfig reads a JSON config file from r.
+func LoadConfig(r io.Reader) (*Config, error) {
+	var config Config
+	dec := json.NewDecoder(r)
+	dec.DisallowUnknownFields()
+	err := dec.Decode(&config)
+	if err != nil {
+		return nil, err
+	}
+	if len(config.Targets) == 0 {
+		return nil, ErrNoTargets
+	}
+	return &config, nil
+}
+
+// targetOptions are the keys of the target flag options.
+var targetOptions = map[string]bool{"name": true, "url": true, "auth": true, "token": true, "class": true, "status": true}
+
+// ParseTarget parses a target flag in the form of comma separated key=value
+// pairs, e.g. "url=https://example.com,auth=none,status=200,class=secondary".
+// A comma in the url is kept when the text after it is not another option so
+// query strings such as "?ids=1,2" are supported.
+func ParseTarget(s string) (Target, error) {
+	var t Target
+	var last string
+	for _, kv := range strings.Split(s, ",") {
+		k, v, ok := strings.Cut(kv, "=")
+		if last == "url" && (!ok || !targetOptions[k]) {
+			t.URL += "," + kv
+			continue
+		}
+		if !ok {
+			return t, fmt.Errorf("invalid target option %q", kv)
+		}
+		last = k
+		switch k {
+		case "name":
+			t.Name = v
+		case "url":
+			t.URL = v
+		case "auth":
+			t.Auth = v
+		case "token":
+			t.Token = v
+		case "class":
+			t.Class = v
+		case "status":
+			code, err := strconv.Atoi(v)
+			if err != nil {
+				return t, fmt.Errorf("invalid target status %q", v)
+			}
+			t.Status = code
+		default:
+			return t, fmt.Errorf("unknown target option %q", k)
+		}
+	}
+	return t, nil
+}
+
+// Normalise validates the target and populates default values.
+func (t *Target) Normalise() error {
+	if t.URL == "" {
+		return ErrNoURL
+	}
+	u, err := url.Parse(t.URL)
+	if err != nil {
+		return err
+	}
+	if t.Name == "" {
+		t.Name = u.Host
+	}
+	if t.Auth == "" {
+		t.Auth = AuthNone
+	}
+	if t.Status == 0 {
+		t.Status = http.StatusOK
+	}
+	if t.Class == "" {
+		t.Class = Primary
+	}
+
+	switch t.Auth {
+	case AuthAgentKey, AuthBearer, AuthNone:
+	default:
+		return fmt.Errorf("target %s has unknown auth %q", t.Name, t.Auth)
+	}
+
+	switch t.Class {
+	case Primary, Secondary:
+	default:
+		return fmt.Errorf("target %s has unknown class %q", t.Name, t.Class)
+	}
+	return nil
+}
+
+// Request builds the HTTP request for the target with the relevant credentials.
+func (t *Target) Request(agentKey string, token string) (*http.Request, error) {
+	req, err := http.NewRequest(http.MethodGet, t.URL, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	switch t.Auth {
+	case AuthAgentKey:
+		req.SetBasicAuth("_", agentKey)
+	case AuthBearer:
+		if t.Token != "" {
+			token = t.Token
+		}
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+	return req, nil
+}
+
+// Host returns the target URL host name used for SNI.
+func (t *Target) Host() string {
+	u, err := url.Parse(t.URL)
+	if err != nil {
+		return ""
+	}
+	return u.Hostname()
+}
+
+// RequiresKey indicates whether any of the targets use the agent key.
+func RequiresKey(targets []Target) bool {
+	for _, t := range targets {
+		if t.Auth == AuthAgentKey {
+			return true
+		}
+	}
+	return false
+}
+
+// MissingToken lists the names of the bearer targets without a token of their
+// own when token, the default for every bearer target, is blank.
+func MissingToken(targets []Target, token string) []string {
+	if token != "" {
+		return nil
+	}
+	var names []string
+	for _, t := range targets {
+		if t.Auth == AuthBearer && t.Token == "" {
+			names = append(names, t.Name)
+		}
+	}
+	return names
+}
+
+// Redact replaces every occurrence of the secrets in s.
+func Redact(s string, secrets ...string) string {
+	for _, secret := range secrets {
+		if secret == "" {
+			continue
+		}
+		s = strings.ReplaceAll(s, secret, "<redacted>")
+	}
+	return s
+}
+
+// targetFlags captures repeated -target flags.
+type targetFlags []Target
+
+func (tf *targetFlags) String() string {
+	var names []string
+	for _, t := range *tf {
+		names = append(names, t.URL)
+	}
+	return strings.Join(names, " ")
+}
+
+func (tf *targetFlags) Set(s string) error {
+	t, err := ParseTarget(s)
+	if err != nil {
+		return err
+	}
+	*tf = append(*tf, t)
+	return nil
+}
@@ -0,0 +1,104 @@
+package dns
+
+import (
+	"context"
+	"errors"
+	"net"
+	"sort"
+	"time"
+)
+
+// Report is the resolution outcome of a single name.
+type Report struct {
+	Name string
+	// Pod is the lookup through the pods resolver as an application would see it.
+	Pod Answer
+	// Servers is the search expansion queried directly against each nameserver.
+	Servers []ServerReport
+}
+
+// ServerReport is the search expansion of a name against a single nameserver.
+type ServerReport struct {
+	Server string
+	// Resolved is the first candidate that returned an address.
+	Resolved string `json:",omitempty"`
+	// Queries is the number of queries issued until the name resolved.
+	Queries int
+	Answers []Answer
+}
+
+// Diagnoser resolves names through the pod resolver and each nameserver.
+type Diagnoser struct {
+	Conf     *ResolvConf
+	Resolver *net.Resolver
+	Timeout  time.Duration
+}
+
+// Diagnose resolves each of the names.
+func (d *Diagnoser) Diagnose(ctx context.Context, names []string) []Report {
+	var reports []Report
+	for _, name := range names {
+		reports = append(reports, d.diagnose(ctx, name))
+	}
+	return reports
+}
+
+func (d *Diagnoser) diagnose(ctx context.Context, name string) Report {
+	report := Report{Name: name, Pod: d.lookup(ctx, name)}
+	candidates := d.Conf.Candidates(name)
+	for _, server := range d.Conf.Servers() {
+		sr := ServerReport{Server: server}
+		for _, candidate := range candidates {
+			qctx, cancel := context.WithTimeout(ctx, d.Timeout)
+			answer := Query(qctx, server, candidate)
+			cancel()
+			sr.Answers = append(sr.Answers, answer)
+			if answer.Resolved() {
+				sr.Resolved = candidate
+				break
+			}
+		}
+		sr.Queries = len(sr.Answers)
+		report.Servers = append(report.Servers, sr)
+	}
+	return report
+}
+
+func (d *Diagnoser) lookup(ctx context.Context, name string) Answer {
+	resolver := d.Resolver
+	if resolver == nil {
+		resolver = net.DefaultResolver
+	}
+	ctx, cancel := context.WithTimeout(ctx, d.Timeout)
+	defer cancel()
+
+	answer := Answer{Server: "pod", Name: name, RCode: NoError}
+	start := time.Now()
+	addrs, err := resolver.LookupHost(ctx, name)
+	answer.Duration = time.Since(start)
+	if err != nil {
+		answer.RCode = LookupRCode(err)
+		answer.Err = err.Error()
+		return answer
+	}
+	sort.Strings(addrs)
+	answer.Addrs = addrs
+	return answer
+}
+
+// LookupRCode approximates the response code from a resolver error.
+func LookupRCode(err error) string {
+	var de *net.DNSError
+	if !errors.As(err, &de) {
+		return Failed
+	}
+	switch {
+	case de.IsNotFound:
+		return NXDomain
+	case de.IsTimeout:
+		return Timeout
+	case de.Err == "server misbehaving":
+		return ServFail
+	}
+	return Failed
+}
@@ -0,0 +1,226 @@
+package dns_test
+
+import (
+	"context"
+	"net"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/instana/envcheck/dns"
+	"golang.org/x/net/dns/dnsmessage"
+)
+
+const resolvConf = `# generated by kubelet
+nameserver 10.96.0.10
+search instana-agent.svc.cluster.local svc.cluster.local cluster.local
+options ndots:5 timeout:2
+`
+
+func Test_ParseResolvConf(t *testing.T) {
+	t.Parallel()
+	conf, err := dns.ParseResolvConf(strings.NewReader(resolvConf))
+	if err != nil {
+		t.Fatalf("ParseResolvConf() err=%v, want nil", err)
+	}
+
+	expected := &dns.ResolvConf{
+		Nameservers: []string{"10.96.0.10"},
+		Search:      []string{"instana-agent.svc.cluster.local", "svc.cluster.local", "cluster.local"},
+		Ndots:       5,
+	}
+	if !cmp.Equal(expected, conf) {
+		t.Errorf("ParseResolvConf() mismatch (-want +got)\n%s", cmp.Diff(expected, conf))
+	}
+}
+
+func Test_Candidates(t *testing.T) {
+	t.Parallel()
+	conf := &dns.ResolvConf{Search: []string{"ns.svc.cluster.local", "cluster.local"}, Ndots: 2}
+	td := map[string]struct {
+		name     string
+		expected []string
+	}{
+		"short name searched first": {"kubernetes", []string{"kubernetes.ns.svc.cluster.local.", "kubernetes.cluster.local.", "kubernetes."}},
+		"name at ndots tried first": {"www.example.com", []string{"www.example.com.", "www.example.com.ns.svc.cluster.local.", "www.example.com.cluster.local."}},
+		"fully qualified":           {"example.com.", []string{"example.com."}},
+	}
+
+	for name, tc := range td {
+		tc := tc
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+			actual := conf.Candidates(tc.name)
+			if !cmp.Equal(tc.expected, actual) {
+				t.Errorf("Candidates() mismatch (-want +got)\n%s", cmp.Diff(tc.expected, actual))
+			}
+		})
+	}
+}
+
+func Test_Query(t *testing.T) {
+	t.Parallel()
+	server := fakeServer(t)
+	td := map[string]struct {
+		name  string
+		rcode string
+		addrs []string
+	}{
+		"resolves": {"kubernetes.default.svc.cluster.local.", dns.NoError, []string{"10.96.0.1"}},
+		"nxdomain": {"missing.cluster.local.", dns.NXDomain, nil},
+		"servfail": {"upstream.example.", dns.ServFail, nil},
+	}
+
+	for name, tc := range td {
+		tc := tc
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+			ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+			defer cancel()
+			answer := dns.Query(ctx, server, tc.name)
+			if answer.RCode != tc.rcode {
+				t.Errorf("RCode=%v, want %v (err=%v)", answer.RCode, tc.rcode, answer.Err)
+			}
+			if !cmp.Equal(tc.addrs, answer.Addrs) {
+				t.Errorf("Addrs mismatch (-want +got)\n%s", cmp.Diff(tc.addrs, answer.Addrs))
+			}
+			if answer.Duration <= 0 {
+				t.Errorf("Duration=%v, want > 0", answer.Duration)
+			}
+		})
+	}
+}
+
+func Test_Query_timeout(t *testing.T) {
+	t.Parallel()
+	conn, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+	answer := dns.Query(ctx, conn.LocalAddr().String(), "example.com.")
+	if answer.RCode != dns.Timeout {
+		t.Errorf("RCode=%v, want %v", answer.RCode, dns.Timeout)
+	}
+	if answer.Duration < 100*time.Millisecond {
+		t.Errorf("Duration=%v, want at least the 100ms timeout", answer.Duration)
+	}
+}
+
+func Test_Diagnose(t *testing.T) {
+	t.Parallel()
+	server := fakeServer(t)
+	d := &dns.Diagnoser{
+		Conf: &dns.ResolvConf{
+			Nameservers: []string{server},
+			Search:      []string{"instana-agent.svc.cluster.local", "svc.cluster.local", "cluster.local"},
+			Ndots:       5,
+		},
+		Resolver: &net.Resolver{
+			PreferGo: true,
+			Dial: func(ctx context.Context, network, address string) (net.Conn, error) {
+				var d net.Dialer
+				return d.DialContext(ctx, "udp", server)
+			},
+		},
+		Timeout: 2 * time.Second,
+	}
+
+	reports := d.Diagnose(context.Background(), []string{"kubernetes.default.svc.cluster.local.", "kubernetes.default"})
+	if len(reports) != 2 {
+		t.Fatalf("len(reports)=%d, want 2", len(reports))
+	}
+	if !reports[0].Pod.Resolved() {
+		t.Errorf("Pod=%+v, want resolved", reports[0].Pod)
+	}
+
+	sr := reports[1].Servers[0]
+	if sr.Resolved != "kubernetes.default.svc.cluster.local." {
+		t.Errorf("Resolved=%v, want kubernetes.default.svc.cluster.local.", sr.Resolved)
+	}
+	if sr.Queries != 2 {
+		t.Errorf("Queries=%v, want 2", sr.Queries)
+	}
+	if sr.Answers[0].RCode != dns.NXDomain {
+		t.Errorf("Answers[0].RCode=%v, want %v", sr.Answers[0].RCode, dns.NXDomain)
+	}
+}
+
+func Test_LookupRCode(t *testing.T) {
+	t.Parallel()
+	td := map[string]struct {
+		err      error
+		expected string
+	}{
+		"not found": {&net.DNSError{Err: "no such host", IsNotFound: true}, dns.NXDomain},
+		"timeout":   {&net.DNSError{Err: "i/o timeout", IsTimeout: true}, dns.Timeout},
+		"servfail":  {&net.DNSError{Err: "server misbehaving"}, dns.ServFail},
+		"other":     {context.Canceled, dns.Failed},
+	}
+
+	for name, tc := range td {
+		tc := tc
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+			actual := dns.LookupRCode(tc.err)
+			if actual != tc.expected {
+				t.Errorf("LookupRCode()=%v, want %v", actual, tc.expected)
+			}
+		})
+	}
+}
+
+// fakeServer answers A queries for kubernetes.default.svc.cluster.local.,
+// SERVFAIL for names under example. and NXDOMAIN for everything else.
+func fakeServer(t *testing.T) string {
+	t.Helper()
+	conn, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { conn.Close() })
+
+	go func() {
+		buf := make([]byte, 512)
+		for {
+			n, addr, err := conn.ReadFrom(buf)
+			if err != nil {
+				return
+			}
+			var req dnsmessage.Message
+			if req.Unpack(buf[:n]) != nil || len(req.Questions) == 0 {
+				continue
+			}
+
+			q := req.Questions[0]
+			resp := dnsmessage.Message{
+				Header:    dnsmessage.Header{ID: req.Header.ID, Response: true, RCode: dnsmessage.RCodeNameError},
+				Questions: req.Questions,
+			}
+			switch {
+			case q.Name.String() == "kubernetes.default.svc.cluster.local.":
+				resp.Header.RCode = dnsmessage.RCodeSuccess
+				if q.Type == dnsmessage.TypeA {
+					resp.Answers = []dnsmessage.Resource{{
+						Header: dnsmessage.ResourceHeader{Name: q.Name, Type: dnsmessage.TypeA, Class: dnsmessage.ClassINET, TTL: 30},
+						Body:   &dnsmessage.AResource{A: [4]byte{10, 96, 0, 1}},
+					}}
+				}
+			case strings.HasSuffix(q.Name.String(), "example."):
+				resp.Header.RCode = dnsmessage.RCodeServerFailure
+			}
+
+			b, err := resp.Pack()
+			if err != nil {
+				continue
+			}
+			conn.WriteTo(b, addr)
+		}
+	}()
+
+	return conn.LocalAddr().String()
+}
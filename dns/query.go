@@ -0,0 +1,130 @@
+package dns
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"time"
+
+	"golang.org/x/net/dns/dnsmessage"
+)
+
+const (
+	// NoError indicates the query succeeded, it may still have no addresses.
+	NoError = "NOERROR"
+	// NXDomain indicates the name does not exist.
+	NXDomain = "NXDOMAIN"
+	// ServFail indicates the server failed to answer, commonly an upstream failure.
+	ServFail = "SERVFAIL"
+	// Refused indicates the server refused to answer the query.
+	Refused = "REFUSED"
+	// Timeout indicates the server did not respond in time.
+	Timeout = "TIMEOUT"
+	// Failed indicates the query could not be sent or the response decoded.
+	Failed = "FAILED"
+)
+
+// Answer is the outcome of a single A query against a single server.
+type Answer struct {
+	Server   string
+	Name     string
+	RCode    string
+	Addrs    []string `json:",omitempty"`
+	Duration time.Duration
+	Err      string `json:",omitempty"`
+}
+
+// Resolved indicates the query returned at least one address.
+func (a *Answer) Resolved() bool {
+	return a.RCode == NoError && len(a.Addrs) > 0
+}
+
+// Query sends an A query for the fully qualified name directly to server
+// (host:port) over UDP. The named result lets the deferred timing apply to
+// every return.
+func Query(ctx context.Context, server string, name string) (answer Answer) {
+	answer = Answer{Server: server, Name: name}
+	start := time.Now()
+	defer func() { answer.Duration = time.Since(start) }()
+
+	n, err := dnsmessage.NewName(name)
+	if err != nil {
+		return answer.failed(err)
+	}
+
+	id := uint16(start.UnixNano())
+	msg := dnsmessage.Message{
+		Header: dnsmessage.Header{ID: id, RecursionDesired: true},
+		Questions: []dnsmessage.Question{
+			{Name: n, Type: dnsmessage.TypeA, Class: dnsmessage.ClassINET},
+		},
+	}
+	b, err := msg.Pack()
+	if err != nil {
+		return answer.failed(err)
+	}
+
+	var d net.Dialer
+	conn, err := d.DialContext(ctx, "udp", server)
+	if err != nil {
+		return answer.failed(err)
+	}
+	defer conn.Close()
+	if deadline, ok := ctx.Deadline(); ok {
+		conn.SetDeadline(deadline)
+	}
+
+	_, err = conn.Write(b)
+	if err != nil {
+		return answer.failed(err)
+	}
+
+	buf := make([]byte, 1232)
+	for {
+		l, err := conn.Read(buf)
+		if err != nil {
+			return answer.failed(err)
+		}
+
+		var resp dnsmessage.Message
+		err = resp.Unpack(buf[:l])
+		if err != nil || resp.Header.ID != id || !resp.Header.Response {
+			// ignore stray or malformed packets and wait for our response.
+			continue
+		}
+
+		answer.RCode = RCodeName(resp.Header.RCode)
+		for _, rr := range resp.Answers {
+			if a, ok := rr.Body.(*dnsmessage.AResource); ok {
+				answer.Addrs = append(answer.Addrs, net.IP(a.A[:]).String())
+			}
+		}
+		return answer
+	}
+}
+
+func (a Answer) failed(err error) Answer {
+	a.RCode = Failed
+	var ne net.Error
+	if errors.As(err, &ne) && ne.Timeout() {
+		a.RCode = Timeout
+	}
+	a.Err = err.Error()
+	return a
+}
+
+// RCodeName provides the conventional name for the response code.
+func RCodeName(rc dnsmessage.RCode) string {
+	switch rc {
+	case dnsmessage.RCodeSuccess:
+		return NoError
+	case dnsmessage.RCodeNameError:
+		return NXDomain
+	case dnsmessage.RCodeServerFailure:
+		return ServFail
+	case dnsmessage.RCodeRefused:
+		return Refused
+	}
+	return fmt.Sprintf("RCODE%d", rc)
+}
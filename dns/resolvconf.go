@@ -0,0 +1,90 @@
+package dns
+
+import (
+	"bufio"
+	"io"
+	"net"
+	"strconv"
+	"strings"
+)
+
+// DefaultNdots is the resolver default when resolv.conf does not specify ndots.
+const DefaultNdots = 1
+
+// ResolvConf is the subset of resolv.conf that determines how a name is resolved.
+type ResolvConf struct {
+	Nameservers []string
+	Search      []string
+	Ndots       int
+}
+
+// ParseResolvConf parses the nameserver, search/domain and ndots option from r.
+func ParseResolvConf(r io.Reader) (*ResolvConf, error) {
+	conf := &ResolvConf{Ndots: DefaultNdots}
+	s := bufio.NewScanner(r)
+	for s.Scan() {
+		line := s.Text()
+		if i := strings.IndexAny(line, "#;"); i >= 0 {
+			line = line[:i]
+		}
+		fields := strings.Fields(line)
+		if len(fields) < 2 {
+			continue
+		}
+
+		switch fields[0] {
+		case "nameserver":
+			conf.Nameservers = append(conf.Nameservers, fields[1])
+		case "domain":
+			conf.Search = []string{fields[1]}
+		case "search":
+			conf.Search = fields[1:]
+		case "options":
+			for _, opt := range fields[1:] {
+				v, ok := strings.CutPrefix(opt, "ndots:")
+				if !ok {
+					continue
+				}
+				n, err := strconv.Atoi(v)
+				if err == nil && n >= 0 {
+					conf.Ndots = n
+				}
+			}
+		}
+	}
+	return conf, s.Err()
+}
+
+// Servers returns the nameservers as host:port addresses, port 53 is used
+// unless the nameserver already includes a port.
+func (c *ResolvConf) Servers() []string {
+	var servers []string
+	for _, ns := range c.Nameservers {
+		if _, _, err := net.SplitHostPort(ns); err == nil {
+			servers = append(servers, ns)
+			continue
+		}
+		servers = append(servers, net.JoinHostPort(ns, "53"))
+	}
+	return servers
+}
+
+// Candidates lists the fully qualified names the resolver tries for name in
+// order. Names with fewer dots than ndots are expanded with the search domains
+// first, which is why short names such as an external host can generate a
+// query per search domain before the name itself is tried.
+func (c *ResolvConf) Candidates(name string) []string {
+	if strings.HasSuffix(name, ".") {
+		return []string{name}
+	}
+
+	var searched []string
+	for _, domain := range c.Search {
+		searched = append(searched, name+"."+strings.TrimSuffix(domain, ".")+".")
+	}
+
+	if strings.Count(name, ".") >= c.Ndots {
+		return append([]string{name + "."}, searched...)
+	}
+	return append(searched, name+".")
+}
@@ -0,0 +1,136 @@
+package network
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"time"
+)
+
+// Direct is the proxy description for requests that bypass a proxy.
+const Direct = "direct"
+
+// TransportConfig configures the proxy and TLS trust for outbound requests.
+// It mirrors the agents own repository proxy and certificate configuration.
+type TransportConfig struct {
+	// Proxy is the proxy URL, e.g. http://proxy.corp:3128.
+	Proxy string
+	// ProxyAuth is the proxy credentials in the form user:password.
+	ProxyAuth string
+	// CAFile is a PEM bundle appended to the system trust store.
+	CAFile string
+	// InsecureSkipVerify disables server certificate verification.
+	InsecureSkipVerify bool
+	// FromEnvironment uses HTTP_PROXY/HTTPS_PROXY/NO_PROXY when Proxy is blank.
+	FromEnvironment bool
+	// DialTimeout is the TCP connect timeout, defaults to 30s.
+	DialTimeout time.Duration
+}
+
+// NewTransport creates a HTTP transport from the provided config.
+func NewTransport(config TransportConfig) (*http.Transport, error) {
+	proxy, err := ProxyFunc(config)
+	if err != nil {
+		return nil, err
+	}
+
+	tlsConfig := &tls.Config{
+		InsecureSkipVerify: config.InsecureSkipVerify,
+	}
+	if config.CAFile != "" {
+		pool, err := LoadCertPool(config.CAFile)
+		if err != nil {
+			return nil, err
+		}
+		tlsConfig.RootCAs = pool
+	}
+
+	dialTimeout := config.DialTimeout
+	if dialTimeout == 0 {
+		dialTimeout = 30 * time.Second
+	}
+
+	return &http.Transport{
+		Proxy: proxy,
+		DialContext: (&net.Dialer{
+			Timeout:   dialTimeout,
+			KeepAlive: 30 * time.Second,
+		}).DialContext,
+		TLSClientConfig:     tlsConfig,
+		TLSHandshakeTimeout: 10 * time.Second,
+		ForceAttemptHTTP2:   true,
+	}, nil
+}
+
+// ProxyFunc builds the transport proxy function from the config.
+func ProxyFunc(config TransportConfig) (func(*http.Request) (*url.URL, error), error) {
+	if config.Proxy == "" {
+		if config.FromEnvironment {
+			return http.ProxyFromEnvironment, nil
+		}
+		return nil, nil
+	}
+
+	u, err := ParseProxy(config)
+	if err != nil {
+		return nil, err
+	}
+	return http.ProxyURL(u), nil
+}
+
+// ParseProxy parses the proxy URL with the credentials from ProxyAuth.
+func ParseProxy(config TransportConfig) (*url.URL, error) {
+	u, err := url.Parse(config.Proxy)
+	if err != nil {
+		return nil, err
+	}
+	if u.Host == "" {
+		return nil, fmt.Errorf("invalid proxy url %q, expected scheme://host:port", config.Proxy)
+	}
+
+	if config.ProxyAuth != "" {
+		user, password, ok := strings.Cut(config.ProxyAuth, ":")
+		if !ok {
+			return nil, fmt.Errorf("invalid proxy auth, expected user:password")
+		}
+		u.User = url.UserPassword(user, password)
+	}
+	return u, nil
+}
+
+// LoadCertPool loads the PEM encoded certificates in filename into a copy of
+// the system cert pool.
+func LoadCertPool(filename string) (*x509.CertPool, error) {
+	b, err := os.ReadFile(filename)
+	if err != nil {
+		return nil, err
+	}
+
+	pool, err := x509.SystemCertPool()
+	if err != nil || pool == nil {
+		pool = x509.NewCertPool()
+	}
+
+	if !pool.AppendCertsFromPEM(b) {
+		return nil, fmt.Errorf("no PEM certificates found in %s", filename)
+	}
+	return pool, nil
+}
+
+// ProxyFor describes the proxy the transport uses for req with credentials
+// removed, or Direct if the request bypasses a proxy.
+func ProxyFor(t *http.Transport, req *http.Request) string {
+	if t == nil || t.Proxy == nil {
+		return Direct
+	}
+	u, err := t.Proxy(req)
+	if err != nil || u == nil {
+		return Direct
+	}
+	return u.Redacted()
+}
@@ -0,0 +1,120 @@
+package ping
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	// DefaultStatusPort is the port the pinger serves its status on.
+	DefaultStatusPort = 42702
+	// StatusPath is the end-point that serves the pinger status.
+	StatusPath = "/status"
+	// ReportPrefix prefixes the JSON encoded Status in the pinger logs.
+	ReportPrefix = "report="
+	// ReportInterval is the longest time between status reports in the pinger logs.
+	ReportInterval = time.Minute
+)
+
+// ErrNoReport occurs when the log output does not yet contain a status.
+var ErrNoReport = fmt.Errorf("no report found")
+
+// Status is the outcome of the pings to the daemon so far.
+type Status struct {
+	Pod       string
+	Namespace string
+	NodeIP    string
+	Address   string
+	Proxy     string
+	OK        bool
+	Successes int
+	Failures  int
+	LastError string `json:",omitempty"`
+	Checked   time.Time
+}
+
+// Reported indicates the pinger has pinged the daemon at least once.
+func (s *Status) Reported() bool {
+	return !s.Checked.IsZero()
+}
+
+// NewRecorder creates a Recorder with the initial status.
+func NewRecorder(status Status) *Recorder {
+	return &Recorder{status: status}
+}
+
+// Recorder records the outcome of each ping.
+type Recorder struct {
+	mu     sync.Mutex
+	status Status
+}
+
+// Record updates the status with the outcome of a ping.
+func (r *Recorder) Record(err error, now time.Time) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.status.Checked = now
+	r.status.OK = err == nil
+	if err != nil {
+		r.status.Failures++
+		r.status.LastError = err.Error()
+		return
+	}
+	r.status.Successes++
+}
+
+// Status provides a copy of the current status.
+func (r *Recorder) Status() Status {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.status
+}
+
+// Handler serves the current status as JSON.
+func (r *Recorder) Handler(w http.ResponseWriter, req *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	err := json.NewEncoder(w).Encode(r.Status())
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+	}
+}
+
+// Report renders the status as a single log line.
+func Report(status Status) (string, error) {
+	b, err := json.Marshal(status)
+	if err != nil {
+		return "", err
+	}
+	return ReportPrefix + string(b), nil
+}
+
+// DecodeReport finds and decodes the last status in the log output.
+func DecodeReport(logs []byte) (*Status, error) {
+	var found *Status
+	s := bufio.NewScanner(strings.NewReader(string(logs)))
+	s.Buffer(make([]byte, 64*1024), 1024*1024)
+	for s.Scan() {
+		i := strings.Index(s.Text(), ReportPrefix)
+		if i < 0 {
+			continue
+		}
+		var status Status
+		err := json.Unmarshal([]byte(s.Text()[i+len(ReportPrefix):]), &status)
+		if err != nil {
+			return nil, err
+		}
+		found = &status
+	}
+	if err := s.Err(); err != nil {
+		return nil, err
+	}
+	if found == nil {
+		return nil, ErrNoReport
+	}
+	return found, nil
+}
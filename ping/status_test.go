@@ -0,0 +1,59 @@
+package ping_test
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/instana/envcheck/ping"
+)
+
+func Test_Recorder(t *testing.T) {
+	recorder := ping.NewRecorder(ping.Status{Pod: "pinger-abc12", Address: "10.0.0.1:42700"})
+	if s := recorder.Status(); s.Reported() {
+		t.Errorf("Reported()=true, want false before the first ping")
+	}
+
+	now := time.Date(2023, 3, 17, 10, 5, 0, 0, time.UTC)
+	recorder.Record(errors.New("i/o timeout"), now)
+	recorder.Record(nil, now.Add(5*time.Second))
+
+	w := httptest.NewRecorder()
+	recorder.Handler(w, httptest.NewRequest("GET", ping.StatusPath, nil))
+
+	var status ping.Status
+	err := json.Unmarshal(w.Body.Bytes(), &status)
+	if err != nil {
+		t.Fatalf("Unmarshal() err=%v, want nil", err)
+	}
+	if !status.OK || status.Successes != 1 || status.Failures != 1 || status.LastError != "i/o timeout" {
+		t.Errorf("status=%+v, want OK with 1 success and 1 failure", status)
+	}
+	if !status.Checked.Equal(now.Add(5 * time.Second)) {
+		t.Errorf("Checked=%v, want %v", status.Checked, now.Add(5*time.Second))
+	}
+}
+
+func Test_DecodeReport_should_return_the_last_report(t *testing.T) {
+	first, _ := ping.Report(ping.Status{Pod: "pinger-abc12", Failures: 1, LastError: "i/o timeout", Checked: time.Now()})
+	last, _ := ping.Report(ping.Status{Pod: "pinger-abc12", OK: true, Failures: 1, Successes: 1, Checked: time.Now()})
+	logs := "pod=default/pinger-abc12 ping=10.0.0.1:42700 podIP=10.1.0.1\n" +
+		"2023/03/17 10:05:00 pod=default/pinger-abc12 " + first + "\n" +
+		"2023/03/17 10:05:00 pod=default/pinger-abc12 ping=10.0.0.1:42700 status=failed err='i/o timeout'\n" +
+		"2023/03/17 10:05:05 pod=default/pinger-abc12 " + last + "\n"
+
+	status, err := ping.DecodeReport([]byte(logs))
+	if err != nil {
+		t.Fatalf("DecodeReport() err=%v, want nil", err)
+	}
+	if !status.OK || status.Successes != 1 || status.Failures != 1 {
+		t.Errorf("status=%+v, want the last OK report", status)
+	}
+
+	_, err = ping.DecodeReport([]byte("pod=default/pinger-abc12 ping=10.0.0.1:42700 status=success\n"))
+	if err != ping.ErrNoReport {
+		t.Errorf("DecodeReport() err=%v, want ErrNoReport", err)
+	}
+}
@@ -0,0 +1,72 @@
+package procfs
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"strings"
+)
+
+// PressureResources are the resources reported by the kernel under /proc/pressure.
+var PressureResources = []string{"cpu", "io", "memory"}
+
+// ReadPressure reads the pressure stall information for resource under the root p.
+func ReadPressure(p string, resource string) (*Pressure, error) {
+	r, err := os.Open(path.Join(p, "proc", "pressure", resource))
+	if err != nil {
+		return nil, err
+	}
+	defer r.Close()
+
+	pressure, err := PressureStat(r)
+	if err != nil {
+		return nil, err
+	}
+	pressure.Resource = resource
+	return pressure, nil
+}
+
+// PressureStat parses a PSI file, see the kernel psi.rst documentation.
+func PressureStat(r io.Reader) (*Pressure, error) {
+	var pressure Pressure
+	s := bufio.NewScanner(r)
+	for s.Scan() {
+		var line PressureLine
+		var kind string
+		_, err := fmt.Sscanf(s.Text(), "%s avg10=%f avg60=%f avg300=%f total=%d",
+			&kind, &line.Avg10, &line.Avg60, &line.Avg300, &line.Total)
+		if err != nil {
+			return nil, err
+		}
+
+		switch strings.TrimSpace(kind) {
+		case "some":
+			pressure.Some = line
+		case "full":
+			full := line
+			pressure.Full = &full
+		default:
+			return nil, fmt.Errorf("unknown pressure kind %q", kind)
+		}
+	}
+	return &pressure, s.Err()
+}
+
+// Pressure is the stall information for a single resource.
+type Pressure struct {
+	Resource string
+	Some     PressureLine
+	// Full is nil when the kernel does not report it (e.g. cpu prior to 5.13).
+	Full *PressureLine
+}
+
+// PressureLine is a single some/full line from a PSI file. Averages are
+// percentages and Total is the accumulated stall time in microseconds.
+type PressureLine struct {
+	Avg10  float64
+	Avg60  float64
+	Avg300 float64
+	Total  uint64
+}
@@ -0,0 +1,69 @@
+package procfs_test
+
+import (
+	"os"
+	"path"
+	"strings"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	. "github.com/instana/envcheck/procfs"
+)
+
+func Test_should_parse_pressure_with_full(t *testing.T) {
+	r := strings.NewReader("some avg10=1.50 avg60=0.25 avg300=0.00 total=12345\nfull avg10=0.50 avg60=0.10 avg300=0.00 total=678\n")
+	actual, err := PressureStat(r)
+	if err != nil {
+		t.Fatalf("got %v, want `nil`", err)
+	}
+
+	expected := &Pressure{
+		Some: PressureLine{Avg10: 1.5, Avg60: 0.25, Total: 12345},
+		Full: &PressureLine{Avg10: 0.5, Avg60: 0.1, Total: 678},
+	}
+	if !cmp.Equal(expected, actual) {
+		t.Errorf("PressureStat() mismatch (-want +got)\n%s", cmp.Diff(expected, actual))
+	}
+}
+
+func Test_should_parse_pressure_without_full(t *testing.T) {
+	r := strings.NewReader("some avg10=0.00 avg60=0.00 avg300=0.00 total=0\n")
+	actual, err := PressureStat(r)
+	if err != nil {
+		t.Fatalf("got %v, want `nil`", err)
+	}
+
+	if actual.Full != nil {
+		t.Errorf("got %v, want `nil`", actual.Full)
+	}
+}
+
+func Test_should_fail_on_invalid_pressure(t *testing.T) {
+	r := strings.NewReader("bloop avg10=0.00 avg60=0.00 avg300=0.00 total=0\n")
+	_, err := PressureStat(r)
+	if err == nil {
+		t.Error("got nil, want unknown kind error")
+	}
+}
+
+func Test_should_read_pressure_from_root(t *testing.T) {
+	d := t.TempDir()
+	p := path.Join(d, "proc", "pressure")
+	err := os.MkdirAll(p, 0700)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = os.WriteFile(path.Join(p, "io"), []byte("some avg10=2.00 avg60=0.00 avg300=0.00 total=10\n"), 0600)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	actual, err := ReadPressure(d, "io")
+	if err != nil {
+		t.Fatalf("got %v, want `nil`", err)
+	}
+
+	if actual.Resource != "io" || actual.Some.Avg10 != 2.0 {
+		t.Errorf("got %+v, want io with avg10=2", actual)
+	}
+}
@@ -1,6 +1,7 @@
 package procfs
 
 import (
+	"bufio"
 	"fmt"
 	"io"
 	"io/ioutil"
@@ -8,6 +9,7 @@ import (
 	"path"
 	"regexp"
 	"sort"
+	"strings"
 )
 
 var re = regexp.MustCompile(`^[0-9]*$`)
@@ -39,6 +41,13 @@ func ReadStats(p string) ([]*ProcessInfo, error) {
 			}
 			r.Close()
 
+			// cgroup is best effort as kernel threads and short lived processes won't have one.
+			cg, err := os.Open(path.Join(proc, f.Name(), "cgroup"))
+			if err == nil {
+				pInfo.PodUID = PodUID(cg)
+				cg.Close()
+			}
+
 			arr = append(arr, pInfo)
 		}
 	}
@@ -87,8 +96,25 @@ func ProcessStat(r io.Reader) (*ProcessInfo, error) {
 	return &pinfo, nil
 }
 
+// PodUID extracts the kubernetes pod UID from a /proc/<pid>/cgroup file.
+// An empty string is returned when the process is not part of a pod.
+func PodUID(r io.Reader) string {
+	s := bufio.NewScanner(r)
+	for s.Scan() {
+		m := podRe.FindStringSubmatch(s.Text())
+		if m != nil {
+			// the systemd cgroup driver replaces the dashes in the UID with underscores.
+			return strings.ReplaceAll(m[1], "_", "-")
+		}
+	}
+	return ""
+}
+
+var podRe = regexp.MustCompile(`kubepods.*pod([0-9a-f]{8}[-_][0-9a-f]{4}[-_][0-9a-f]{4}[-_][0-9a-f]{4}[-_][0-9a-f]{12})`)
+
 type ProcessInfo struct {
 	PID    int
 	Name   string
 	IOWait float64
+	PodUID string
 }
@@ -78,3 +78,25 @@ func generateProcFS(t *testing.T) string {
 
 	return d
 }
+
+func Test_PodUID(t *testing.T) {
+	testCases := map[string]struct {
+		cgroup string
+		uid    string
+	}{
+		"cgroupfs": {"0::/kubepods/burstable/pod0b1c2d3e-4f50-6172-8394-a5b6c7d8e9f0/0123abcd", "0b1c2d3e-4f50-6172-8394-a5b6c7d8e9f0"},
+		"systemd":  {"0::/kubepods.slice/kubepods-besteffort.slice/kubepods-besteffort-pod0b1c2d3e_4f50_6172_8394_a5b6c7d8e9f0.slice/cri-containerd-0123abcd.scope", "0b1c2d3e-4f50-6172-8394-a5b6c7d8e9f0"},
+		"v1 multi": {"12:cpuset:/\n11:memory:/kubepods/pod0b1c2d3e-4f50-6172-8394-a5b6c7d8e9f0/0123abcd", "0b1c2d3e-4f50-6172-8394-a5b6c7d8e9f0"},
+		"host":     {"0::/system.slice/sshd.service", ""},
+	}
+
+	for name, tc := range testCases {
+		tc := tc
+		t.Run(name, func(t *testing.T) {
+			actual := PodUID(strings.NewReader(tc.cgroup))
+			if actual != tc.uid {
+				t.Errorf("got `%v`, want `%v`", actual, tc.uid)
+			}
+		})
+	}
+}
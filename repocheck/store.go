@@ -0,0 +1,171 @@
+package repocheck
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+// NewStore creates a ring buffer of at most retain windows persisted as JSON
+// lines to filename. Existing windows are loaded from the file if present. An
+// empty filename keeps the windows in memory only.
+func NewStore(filename string, retain int) (*Store, error) {
+	s := &Store{
+		filename: filename,
+		retain:   retain,
+	}
+	if filename == "" {
+		return s, nil
+	}
+
+	r, err := os.Open(filename)
+	if errors.Is(err, os.ErrNotExist) {
+		return s, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer r.Close()
+
+	windows, err := ReadWindows(r)
+	if err != nil {
+		return nil, err
+	}
+	s.windows = s.trim(windows)
+	return s, nil
+}
+
+// Store is a bounded list of completed windows.
+type Store struct {
+	filename string
+	retain   int
+	mu       sync.Mutex
+	windows  []Window
+}
+
+// ReadWindows decodes JSON lines windows from r.
+func ReadWindows(r io.Reader) ([]Window, error) {
+	var windows []Window
+	s := bufio.NewScanner(r)
+	s.Buffer(make([]byte, 64*1024), 1024*1024)
+	for s.Scan() {
+		if len(s.Bytes()) == 0 {
+			continue
+		}
+		var w Window
+		err := json.Unmarshal(s.Bytes(), &w)
+		if err != nil {
+			return nil, err
+		}
+		windows = append(windows, w)
+	}
+	return windows, s.Err()
+}
+
+// Append adds the window evicting the oldest windows beyond the retention and
+// rewrites the backing file.
+func (s *Store) Append(w Window) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.windows = s.trim(append(s.windows, w))
+	if s.filename == "" {
+		return nil
+	}
+	return s.write()
+}
+
+// Windows returns the windows that ended after since.
+func (s *Store) Windows(since time.Time) []Window {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	windows := []Window{}
+	for _, w := range s.windows {
+		if w.End.After(since) {
+			windows = append(windows, w)
+		}
+	}
+	return windows
+}
+
+func (s *Store) trim(windows []Window) []Window {
+	if s.retain > 0 && len(windows) > s.retain {
+		windows = windows[len(windows)-s.retain:]
+	}
+	return windows
+}
+
+// write replaces the file atomically so a restart never reads a partial file.
+func (s *Store) write() error {
+	w, err := os.CreateTemp(filepath.Dir(s.filename), filepath.Base(s.filename)+".*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(w.Name())
+
+	enc := json.NewEncoder(w)
+	for _, window := range s.windows {
+		err = enc.Encode(window)
+		if err != nil {
+			w.Close()
+			return err
+		}
+	}
+
+	err = w.Close()
+	if err != nil {
+		return err
+	}
+	return os.Rename(w.Name(), s.filename)
+}
+
+// ResultsHandler serves the windows as a JSON array. The optional since query
+// parameter is a duration (e.g. 168h) limiting how far back to return.
+func (s *Store) ResultsHandler() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		since, err := Since(r, time.Now())
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		writeJSON(w, s.Windows(since))
+	}
+}
+
+// SummaryHandler serves the summary of the windows for pod.
+func (s *Store) SummaryHandler(pod string) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		since, err := Since(r, time.Now())
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		writeJSON(w, Summarise(pod, s.Windows(since)))
+	}
+}
+
+// Since parses the since query parameter relative to now.
+func Since(r *http.Request, now time.Time) (time.Time, error) {
+	v := r.URL.Query().Get("since")
+	if v == "" {
+		return time.Time{}, nil
+	}
+	d, err := time.ParseDuration(v)
+	if err != nil {
+		return time.Time{}, err
+	}
+	return now.Add(-d), nil
+}
+
+func writeJSON(w http.ResponseWriter, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	err := json.NewEncoder(w).Encode(v)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+	}
+}
@@ -0,0 +1,122 @@
+package repocheck_test
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"path"
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/instana/envcheck/repocheck"
+)
+
+func window(end time.Time, period time.Duration, verdict string, failures int) repocheck.Window {
+	return repocheck.Window{
+		Pod:     "repocheck-abc12",
+		Period:  period,
+		End:     end,
+		Count:   60,
+		Verdict: verdict,
+		Targets: []repocheck.TargetResult{{Name: "artifact-public.instana.io", Class: "primary", Failures: failures}},
+	}
+}
+
+func Test_Store_retains_the_newest_windows(t *testing.T) {
+	t.Parallel()
+	store, _ := repocheck.NewStore("", 2)
+	start := time.Date(2021, 9, 1, 0, 0, 0, 0, time.UTC)
+	for i := 0; i < 3; i++ {
+		err := store.Append(window(start.Add(time.Duration(i)*time.Hour), time.Hour, "healthy", 0))
+		if err != nil {
+			t.Fatalf("err=%v, want nil", err)
+		}
+	}
+
+	windows := store.Windows(time.Time{})
+	if len(windows) != 2 {
+		t.Fatalf("len(windows)=%v, want 2", len(windows))
+	}
+	if !windows[0].End.Equal(start.Add(time.Hour)) {
+		t.Errorf("windows[0].End=%v, want %v", windows[0].End, start.Add(time.Hour))
+	}
+}
+
+func Test_Store_persists_across_restarts(t *testing.T) {
+	t.Parallel()
+	filename := path.Join(t.TempDir(), "results.jsonl")
+	store, err := repocheck.NewStore(filename, 10)
+	if err != nil {
+		t.Fatalf("err=%v, want nil", err)
+	}
+	expected := window(time.Date(2021, 9, 1, 0, 0, 0, 0, time.UTC), time.Hour, "upstream_issue", 3)
+	err = store.Append(expected)
+	if err != nil {
+		t.Fatalf("err=%v, want nil", err)
+	}
+
+	reloaded, err := repocheck.NewStore(filename, 10)
+	if err != nil {
+		t.Fatalf("err=%v, want nil", err)
+	}
+	actual := reloaded.Windows(time.Time{})
+	if !cmp.Equal([]repocheck.Window{expected}, actual) {
+		t.Errorf("Windows() mismatch (-want +got)\n%s", cmp.Diff([]repocheck.Window{expected}, actual))
+	}
+}
+
+func Test_Summarise_groups_by_period(t *testing.T) {
+	t.Parallel()
+	start := time.Date(2021, 9, 1, 0, 0, 0, 0, time.UTC)
+	windows := []repocheck.Window{
+		window(start, time.Hour, "healthy", 0),
+		window(start.Add(time.Hour), time.Hour, "upstream_issue", 2),
+		window(start.Add(time.Hour), 24*time.Hour, "upstream_issue", 2),
+	}
+
+	actual := repocheck.Summarise("repocheck-abc12", windows)
+	expected := repocheck.Summary{
+		Pod: "repocheck-abc12",
+		Periods: []repocheck.PeriodSummary{
+			{Period: time.Hour, Windows: 2, First: start, Last: start.Add(time.Hour), Count: 120,
+				Verdicts: map[string]int{"healthy": 1, "upstream_issue": 1},
+				Failures: map[string]int{"artifact-public.instana.io": 2}},
+			{Period: 24 * time.Hour, Windows: 1, First: start.Add(time.Hour), Last: start.Add(time.Hour), Count: 60,
+				Verdicts: map[string]int{"upstream_issue": 1},
+				Failures: map[string]int{"artifact-public.instana.io": 2}},
+		},
+	}
+	if !cmp.Equal(expected, actual) {
+		t.Errorf("Summarise() mismatch (-want +got)\n%s", cmp.Diff(expected, actual))
+	}
+}
+
+func Test_ResultsHandler_filters_with_since(t *testing.T) {
+	t.Parallel()
+	store, _ := repocheck.NewStore("", 10)
+	store.Append(window(time.Now().Add(-48*time.Hour), time.Hour, "healthy", 0))
+	store.Append(window(time.Now().Add(-1*time.Hour), time.Hour, "healthy", 0))
+
+	w := httptest.NewRecorder()
+	store.ResultsHandler()(w, httptest.NewRequest(http.MethodGet, "/results?since=24h", nil))
+
+	var windows []repocheck.Window
+	err := json.NewDecoder(w.Body).Decode(&windows)
+	if err != nil {
+		t.Fatalf("err=%v, want nil", err)
+	}
+	if len(windows) != 1 {
+		t.Errorf("len(windows)=%v, want 1", len(windows))
+	}
+}
+
+func Test_ResultsHandler_rejects_invalid_since(t *testing.T) {
+	t.Parallel()
+	store, _ := repocheck.NewStore("", 10)
+	w := httptest.NewRecorder()
+	store.ResultsHandler()(w, httptest.NewRequest(http.MethodGet, "/results?since=bloop", nil))
+	if w.Code != http.StatusBadRequest {
+		t.Errorf("Code=%v, want 400", w.Code)
+	}
+}
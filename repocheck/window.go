@@ -0,0 +1,88 @@
+package repocheck
+
+import (
+	"sort"
+	"time"
+)
+
+// Window is the result of a completed repocheck accumulator period.
+type Window struct {
+	Pod     string
+	Period  time.Duration
+	End     time.Time
+	Count   int
+	Verdict string
+	Targets []TargetResult
+}
+
+// TargetResult is the failure count for a single target within a Window.
+type TargetResult struct {
+	Name     string
+	Class    string
+	Failures int
+	Types    map[string]int `json:",omitempty"`
+}
+
+// Summary aggregates the windows held by a single repocheck pod.
+type Summary struct {
+	Pod     string
+	Periods []PeriodSummary
+}
+
+// PeriodSummary aggregates all windows of the same period length.
+type PeriodSummary struct {
+	Period   time.Duration
+	Windows  int
+	First    time.Time
+	Last     time.Time
+	Count    int
+	Verdicts map[string]int
+	Failures map[string]int
+}
+
+// Summarise aggregates the windows by period ordered from shortest to longest.
+func Summarise(pod string, windows []Window) Summary {
+	periods := make(map[time.Duration]*PeriodSummary)
+	for _, w := range windows {
+		ps, ok := periods[w.Period]
+		if !ok {
+			ps = &PeriodSummary{
+				Period:   w.Period,
+				First:    w.End,
+				Verdicts: make(map[string]int),
+				Failures: make(map[string]int),
+			}
+			periods[w.Period] = ps
+		}
+		ps.Windows++
+		ps.Count += w.Count
+		ps.Verdicts[w.Verdict]++
+		if w.End.Before(ps.First) {
+			ps.First = w.End
+		}
+		if w.End.After(ps.Last) {
+			ps.Last = w.End
+		}
+		for _, t := range w.Targets {
+			ps.Failures[t.Name] += t.Failures
+		}
+	}
+
+	summary := Summary{Pod: pod}
+	for _, ps := range periods {
+		summary.Periods = append(summary.Periods, *ps)
+	}
+	sort.Slice(summary.Periods, func(i, j int) bool {
+		return summary.Periods[i].Period < summary.Periods[j].Period
+	})
+	return summary
+}
+
+const (
+	// DefaultPort is the default port repocheck serves its results on.
+	DefaultPort = 42701
+	// ResultsPath is the end-point that serves the stored windows.
+	ResultsPath = "/results"
+	// SummaryPath is the end-point that serves the summary of the stored windows.
+	SummaryPath = "/summary"
+)
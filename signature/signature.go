@@ -0,0 +1,214 @@
+package signature
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+	"regexp"
+	"strings"
+	"time"
+
+	"sigs.k8s.io/yaml"
+)
+
+// Signature is a known problem recognised by a pattern in the agent logs.
+type Signature struct {
+	Name        string `json:"name"`
+	Description string `json:"description"`
+	Pattern     string `json:"pattern"`
+}
+
+// File is the YAML or JSON file of signatures extending the catalogue.
+type File struct {
+	Signatures []Signature `json:"signatures"`
+}
+
+// builtin are the problems most often found in agent support cases.
+var builtin = []Signature{
+	{
+		Name:        "backend-connection-refused",
+		Description: "the agent cannot connect to the backend, check the endpoint host and port, proxy settings and egress network policies",
+		Pattern:     `(?i)(backend|instana\.io).*connection refused|connection refused.*(backend|instana\.io)`,
+	},
+	{
+		Name:        "invalid-agent-key",
+		Description: "the backend rejected the agent key, check the key in the agent secret matches the tenant unit",
+		Pattern:     `(?i)(invalid|unknown|rejected|unauthori[sz]ed)\W.{0,40}agent.?key|agent.?key\W.{0,40}(invalid|unknown|rejected|unauthori[sz]ed)`,
+	},
+	{
+		Name:        "out-of-memory",
+		Description: "the agent ran out of heap or container memory, raise the agent memory limit and heap size",
+		Pattern:     `OutOfMemoryError|(?i)java heap space|gc overhead limit exceeded|out of memory`,
+	},
+	{
+		Name:        "tls",
+		Description: "a TLS handshake failed, check the backend certificate is trusted and any proxy intercepting TLS",
+		Pattern:     `SSLHandshakeException|PKIX path building failed|x509: |(?i)certificate (has expired|verify failed|signed by unknown authority)|tls: handshake failure`,
+	},
+	{
+		Name:        "apiserver-forbidden",
+		Description: "the API server denied the agent, check the agent ClusterRole and ClusterRoleBinding",
+		Pattern:     `(?i)forbidden: user "[^"]*" cannot|\b403\b.{0,20}forbidden`,
+	},
+}
+
+// Builtin provides a copy of the built-in signatures.
+func Builtin() []Signature {
+	return append([]Signature(nil), builtin...)
+}
+
+// LoadFile reads the signatures from the YAML or JSON file filename.
+func LoadFile(filename string) ([]Signature, error) {
+	b, err := os.ReadFile(filename)
+	if err != nil {
+		return nil, err
+	}
+	var f File
+	err = yaml.UnmarshalStrict(b, &f)
+	if err != nil {
+		return nil, fmt.Errorf("invalid signature file %s: %v", filename, err)
+	}
+	return f.Signatures, nil
+}
+
+// Merge provides the signatures in base extended with those in extra. A
+// signature in extra replaces the one in base with the same name.
+func Merge(base []Signature, extra []Signature) []Signature {
+	merged := append([]Signature(nil), base...)
+	for _, e := range extra {
+		replaced := false
+		for i := range merged {
+			if merged[i].Name == e.Name {
+				merged[i] = e
+				replaced = true
+			}
+		}
+		if !replaced {
+			merged = append(merged, e)
+		}
+	}
+	return merged
+}
+
+// NewCatalogue compiles the signatures into a catalogue.
+func NewCatalogue(signatures []Signature) (*Catalogue, error) {
+	c := &Catalogue{signatures: signatures}
+	for _, s := range signatures {
+		if s.Name == "" {
+			return nil, fmt.Errorf("signature with pattern %q has no name", s.Pattern)
+		}
+		re, err := regexp.Compile(s.Pattern)
+		if err != nil {
+			return nil, fmt.Errorf("signature %s has an invalid pattern: %v", s.Name, err)
+		}
+		c.patterns = append(c.patterns, re)
+	}
+	return c, nil
+}
+
+// Catalogue is a compiled set of signatures.
+type Catalogue struct {
+	signatures []Signature
+	patterns   []*regexp.Regexp
+}
+
+// Signatures provides the signatures in the catalogue.
+func (c *Catalogue) Signatures() []Signature {
+	return c.signatures
+}
+
+// Match is a signature found in a log.
+type Match struct {
+	Signature   string
+	Description string
+	Count       int
+	// FirstSeen is the timestamp of the first matching line, zero when the
+	// lines are not timestamped.
+	FirstSeen time.Time
+	// Line is the first matching line.
+	Line string
+}
+
+// maxLine is the longest log line scanned, longer lines are truncated.
+const maxLine = 64 * 1024
+
+// Scan reads the log line by line and provides the signatures matched in
+// catalogue order. Lines prefixed with an RFC3339 timestamp as retrieved with
+// kubectl logs --timestamps give the first seen time of each match.
+func (c *Catalogue) Scan(r io.Reader) ([]Match, error) {
+	matches := make([]*Match, len(c.patterns))
+	br := bufio.NewReader(r)
+	for {
+		line, err := readLine(br)
+		if line != "" {
+			c.match(line, matches)
+		}
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	var found []Match
+	for _, m := range matches {
+		if m != nil {
+			found = append(found, *m)
+		}
+	}
+	return found, nil
+}
+
+func (c *Catalogue) match(line string, matches []*Match) {
+	ts, text := timestamp(line)
+	for i, re := range c.patterns {
+		if !re.MatchString(text) {
+			continue
+		}
+		m := matches[i]
+		if m == nil {
+			m = &Match{
+				Signature:   c.signatures[i].Name,
+				Description: c.signatures[i].Description,
+				FirstSeen:   ts,
+				Line:        text,
+			}
+			matches[i] = m
+		}
+		m.Count++
+	}
+}
+
+// readLine reads the next line without its line ending truncating it to
+// maxLine so a single huge line does not exhaust memory.
+func readLine(br *bufio.Reader) (string, error) {
+	var sb strings.Builder
+	for {
+		chunk, isPrefix, err := br.ReadLine()
+		if sb.Len() < maxLine {
+			n := maxLine - sb.Len()
+			if len(chunk) < n {
+				n = len(chunk)
+			}
+			sb.Write(chunk[:n])
+		}
+		if err != nil || !isPrefix {
+			return sb.String(), err
+		}
+	}
+}
+
+// timestamp splits the RFC3339 timestamp prefix from the line.
+func timestamp(line string) (time.Time, string) {
+	prefix, text, ok := strings.Cut(line, " ")
+	if !ok {
+		return time.Time{}, line
+	}
+	ts, err := time.Parse(time.RFC3339Nano, prefix)
+	if err != nil {
+		return time.Time{}, line
+	}
+	return ts, text
+}
@@ -0,0 +1,170 @@
+package signature_test
+
+import (
+	"os"
+	"path"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/instana/envcheck/signature"
+)
+
+func Test_Builtin_signatures(t *testing.T) {
+	catalogue, err := signature.NewCatalogue(signature.Builtin())
+	if err != nil {
+		t.Fatalf("NewCatalogue() err=%v, want nil", err)
+	}
+	testCases := map[string]struct {
+		line      string
+		signature string
+	}{
+		"connection refused": {"2022-03-01 10:00:00,001 | WARN | Failed to connect to ingress-red-saas.instana.io:443: Connection refused", "backend-connection-refused"},
+		"backend connector":  {"2022-03-01 10:00:00,001 | WARN | com.instana.agent-backend-connector | Connection refused: backend.corp/10.0.0.9:443", "backend-connection-refused"},
+		"sensor refused":     {"2022-03-01 10:00:00,001 | WARN | com.instana.sensor-redis | Redis | Connection refused (Connection refused) to 10.1.0.5:6379", ""},
+		"invalid agent key":  {"ERROR | Backend rejected connection: invalid agent key", "invalid-agent-key"},
+		"agent key rejected": {"agent key was rejected by the backend (401)", "invalid-agent-key"},
+		"heap":               {"java.lang.OutOfMemoryError: Java heap space", "out-of-memory"},
+		"gc overhead":        {"java.lang.OutOfMemoryError: GC overhead limit exceeded", "out-of-memory"},
+		"pkix":               {"javax.net.ssl.SSLHandshakeException: PKIX path building failed", "tls"},
+		"x509":               {"x509: certificate signed by unknown authority", "tls"},
+		"forbidden":          {`pods is forbidden: User "system:serviceaccount:instana-agent:instana-agent" cannot list resource "pods"`, "apiserver-forbidden"},
+		"403":                {"Request failed with 403 Forbidden", "apiserver-forbidden"},
+		"healthy":            {"INFO | Established connection to backend", ""},
+	}
+
+	for name, tc := range testCases {
+		tc := tc
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+			matches, err := catalogue.Scan(strings.NewReader(tc.line))
+			if err != nil {
+				t.Fatalf("Scan() err=%v, want nil", err)
+			}
+			var names []string
+			for _, m := range matches {
+				names = append(names, m.Signature)
+			}
+			var expected []string
+			if tc.signature != "" {
+				expected = []string{tc.signature}
+			}
+			if !cmp.Equal(expected, names) {
+				t.Errorf("Scan(%q) mismatch (-want +got)\n%s", tc.line, cmp.Diff(expected, names))
+			}
+		})
+	}
+}
+
+func Test_Scan_should_count_and_record_first_seen(t *testing.T) {
+	t.Parallel()
+	catalogue, err := signature.NewCatalogue(signature.Builtin())
+	if err != nil {
+		t.Fatalf("NewCatalogue() err=%v, want nil", err)
+	}
+	log := strings.Join([]string{
+		"2022-03-01T10:00:00.000000001Z INFO | starting",
+		"2022-03-01T10:00:05.000000000Z WARN | Connection refused by backend",
+		"2022-03-01T10:00:10.000000000Z WARN | Connection refused by backend again",
+		"",
+	}, "\n")
+
+	matches, err := catalogue.Scan(strings.NewReader(log))
+	if err != nil {
+		t.Fatalf("Scan() err=%v, want nil", err)
+	}
+	expected := []signature.Match{{
+		Signature:   "backend-connection-refused",
+		Description: signature.Builtin()[0].Description,
+		Count:       2,
+		FirstSeen:   time.Date(2022, 3, 1, 10, 0, 5, 0, time.UTC),
+		Line:        "WARN | Connection refused by backend",
+	}}
+	if !cmp.Equal(expected, matches) {
+		t.Errorf("Scan() mismatch (-want +got)\n%s", cmp.Diff(expected, matches))
+	}
+}
+
+func Test_Scan_should_truncate_long_lines(t *testing.T) {
+	t.Parallel()
+	catalogue, err := signature.NewCatalogue([]signature.Signature{{Name: "end", Pattern: "end$"}})
+	if err != nil {
+		t.Fatalf("NewCatalogue() err=%v, want nil", err)
+	}
+	log := "start" + strings.Repeat("x", 200*1024) + "end\nend\n"
+
+	matches, err := catalogue.Scan(strings.NewReader(log))
+	if err != nil {
+		t.Fatalf("Scan() err=%v, want nil", err)
+	}
+	if len(matches) != 1 || matches[0].Count != 1 {
+		t.Errorf("matches=%v, want end matched once", matches)
+	}
+}
+
+func Test_NewCatalogue_errors(t *testing.T) {
+	testCases := map[string]signature.Signature{
+		"no name":         {Pattern: "x"},
+		"invalid pattern": {Name: "x", Pattern: "("},
+	}
+
+	for name, s := range testCases {
+		s := s
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+			_, err := signature.NewCatalogue([]signature.Signature{s})
+			if err == nil {
+				t.Error("err=nil, want err")
+			}
+		})
+	}
+}
+
+func Test_LoadFile_should_extend_builtin(t *testing.T) {
+	t.Parallel()
+	filename := path.Join(t.TempDir(), "signatures.yaml")
+	content := `signatures:
+- name: proxy-auth
+  description: the proxy requires authentication
+  pattern: 407 Proxy Authentication Required
+- name: tls
+  description: replaced
+  pattern: handshake
+`
+	err := os.WriteFile(filename, []byte(content), 0600)
+	if err != nil {
+		t.Fatalf("WriteFile() err=%v, want nil", err)
+	}
+
+	extra, err := signature.LoadFile(filename)
+	if err != nil {
+		t.Fatalf("LoadFile() err=%v, want nil", err)
+	}
+	merged := signature.Merge(signature.Builtin(), extra)
+	var names []string
+	for _, s := range merged {
+		names = append(names, s.Name)
+	}
+	expected := []string{"backend-connection-refused", "invalid-agent-key", "out-of-memory", "tls", "apiserver-forbidden", "proxy-auth"}
+	if !cmp.Equal(expected, names) {
+		t.Errorf("Merge() mismatch (-want +got)\n%s", cmp.Diff(expected, names))
+	}
+	if merged[3].Pattern != "handshake" {
+		t.Errorf("tls pattern=%q, want handshake", merged[3].Pattern)
+	}
+}
+
+func Test_LoadFile_errors_with_unknown_fields(t *testing.T) {
+	t.Parallel()
+	filename := path.Join(t.TempDir(), "signatures.yaml")
+	err := os.WriteFile(filename, []byte("signatures:\n- name: x\n  regex: y\n"), 0600)
+	if err != nil {
+		t.Fatalf("WriteFile() err=%v, want nil", err)
+	}
+
+	_, err = signature.LoadFile(filename)
+	if err == nil {
+		t.Error("err=nil, want invalid signature file")
+	}
+}